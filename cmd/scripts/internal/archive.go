@@ -2,15 +2,18 @@ package internal
 
 import (
 	"archive/zip"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
 )
 
-// CreateProjectArchive creates a production build archive
+// CreateProjectArchive creates a production build archive of outputDir,
+// leaving out files matching the default ignore patterns and .pbdeployerignore
 func CreateProjectArchive(rootDir, outputDir string) error {
 	PrintStep("📦", "Creating production build archive...")
 
@@ -19,11 +22,16 @@ func CreateProjectArchive(rootDir, outputDir string) error {
 	// Create zip file outside dist directory first to avoid infinite loop
 	tempArchivePath := filepath.Join(rootDir, archiveName)
 
-	distDir := filepath.Join(rootDir, "dist")
+	distDir := outputDir
 	if _, err := os.Stat(distDir); os.IsNotExist(err) {
 		return fmt.Errorf("dist directory not found - please run production build first")
 	}
 
+	ignore, err := loadArchiveIgnore(rootDir)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", archiveIgnoreFile, err)
+	}
+
 	file, err := os.Create(tempArchivePath)
 	if err != nil {
 		return fmt.Errorf("failed to create archive file: %w", err)
@@ -35,6 +43,8 @@ func CreateProjectArchive(rootDir, outputDir string) error {
 
 	var totalSize int64 = 0
 	var fileCount int = 0
+	var skippedSize int64 = 0
+	var skippedCount int = 0
 
 	err = filepath.Walk(distDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -55,6 +65,18 @@ func CreateProjectArchive(rootDir, outputDir string) error {
 		// Use forward slashes in zip files
 		relPath = strings.ReplaceAll(relPath, "\\", "/")
 
+		if isArchiveIgnored(relPath, ignore) {
+			if info.IsDir() {
+				files, size := treeSize(path)
+				skippedCount += files
+				skippedSize += size
+				return filepath.SkipDir
+			}
+			skippedCount++
+			skippedSize += info.Size()
+			return nil
+		}
+
 		if info.IsDir() {
 			// Create directory entry in zip
 			_, err := zipWriter.Create(relPath + "/")
@@ -107,20 +129,25 @@ func CreateProjectArchive(rootDir, outputDir string) error {
 		PrintInfo("Archive size: %s", formatBytes(archiveSize))
 		PrintInfo("Compression: %.1f%%", 100.0-compressionRatio)
 	}
+	if skippedCount > 0 {
+		PrintInfo("Skipped: %d file(s), %s matching ignore patterns", skippedCount, formatBytes(skippedSize))
+	}
 
 	return nil
 }
 
 // GeneratePackageMetadata creates metadata files for the package
-func GeneratePackageMetadata(rootDir, outputDir string) error {
+func GeneratePackageMetadata(rootDir, outputDir string, target BuildTarget, tests TestOutcome) error {
 	PrintStep("📋", "Generating package metadata...")
 
 	goVersion := GetCommandOutput("go", "version")
 	nodeVersion := GetCommandOutput("node", "--version")
 	npmVersion := GetCommandOutput("npm", "--version")
-	gitCommit := GetCommandOutput("git", "rev-parse", "HEAD")
-	gitBranch := GetCommandOutput("git", "rev-parse", "--abbrev-ref", "HEAD")
-	gitTag := GetCommandOutput("git", "describe", "--tags", "--exact-match")
+	git := collectGitMetadata()
+	gitJSON, err := json.MarshalIndent(git, "  ", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode git metadata: %w", err)
+	}
 
 	buildTime := time.Now().UTC().Format(time.RFC3339)
 
@@ -134,8 +161,10 @@ func GeneratePackageMetadata(rootDir, outputDir string) error {
 
 	fmt.Fprintf(buildInfoFile, "pb-deployer Production Build\n")
 	fmt.Fprintf(buildInfoFile, "============================\n\n")
+	fmt.Fprintf(buildInfoFile, "Version: %s\n", BuildVersion())
 	fmt.Fprintf(buildInfoFile, "Build Time: %s\n", buildTime)
-	fmt.Fprintf(buildInfoFile, "Build Type: Production\n\n")
+	fmt.Fprintf(buildInfoFile, "Build Type: Production\n")
+	fmt.Fprintf(buildInfoFile, "Platform: %s\n\n", target)
 
 	fmt.Fprintf(buildInfoFile, "Environment:\n")
 	fmt.Fprintf(buildInfoFile, "  Go Version: %s\n", goVersion)
@@ -143,10 +172,30 @@ func GeneratePackageMetadata(rootDir, outputDir string) error {
 	fmt.Fprintf(buildInfoFile, "  npm: %s\n", npmVersion)
 
 	fmt.Fprintf(buildInfoFile, "\nGit Information:\n")
-	fmt.Fprintf(buildInfoFile, "  Branch: %s\n", gitBranch)
-	fmt.Fprintf(buildInfoFile, "  Commit: %s\n", gitCommit)
-	if gitTag != "unknown" && gitTag != "" {
-		fmt.Fprintf(buildInfoFile, "  Tag: %s\n", gitTag)
+	if !git.Available {
+		fmt.Fprintf(buildInfoFile, "  Not available (not a git checkout; set %s to record it)\n", gitCommitEnv)
+	} else {
+		if git.Branch != "" {
+			fmt.Fprintf(buildInfoFile, "  Branch: %s\n", git.Branch)
+		}
+		fmt.Fprintf(buildInfoFile, "  Commit: %s\n", git.Commit)
+		if git.Tag != "" {
+			fmt.Fprintf(buildInfoFile, "  Tag: %s\n", git.Tag)
+		}
+	}
+
+	fmt.Fprintf(buildInfoFile, "\nTests: %s\n", tests.Status)
+	if tests.Status == TestStatusSkipped {
+		fmt.Fprintf(buildInfoFile, "  WARNING: built with --skip-tests, this build is unvalidated\n")
+	} else {
+		fmt.Fprintf(buildInfoFile, "  Packages: %d\n", tests.Totals.Packages)
+		fmt.Fprintf(buildInfoFile, "  Passed: %d, Failed: %d, Skipped: %d, Total: %d\n",
+			tests.Totals.Passed, tests.Totals.Failed, tests.Totals.Skipped, tests.Totals.Total)
+		if tests.HasCoverage {
+			fmt.Fprintf(buildInfoFile, "  Coverage: %.1f%%\n", tests.Coverage)
+		} else {
+			fmt.Fprintf(buildInfoFile, "  Coverage: unavailable\n")
+		}
 	}
 
 	fmt.Fprintf(buildInfoFile, "\nContents:\n")
@@ -154,6 +203,11 @@ func GeneratePackageMetadata(rootDir, outputDir string) error {
 	fmt.Fprintf(buildInfoFile, "  - Frontend static files (pb_public/)\n")
 	fmt.Fprintf(buildInfoFile, "  - Build metadata and reports\n")
 
+	coverage := "null"
+	if tests.HasCoverage {
+		coverage = fmt.Sprintf("%.1f", tests.Coverage)
+	}
+
 	// Create JSON metadata
 	metadataPath := filepath.Join(outputDir, "package-metadata.json")
 	metadataFile, err := os.Create(metadataPath)
@@ -164,25 +218,34 @@ func GeneratePackageMetadata(rootDir, outputDir string) error {
 
 	jsonMetadata := fmt.Sprintf(`{
   "name": "pb-deployer",
-  "version": "1.0.0",
+  "version": "%s",
   "buildTime": "%s",
   "buildType": "production",
+  "platform": "%s",
   "environment": {
     "go": "%s",
     "node": "%s",
     "npm": "%s"
   },
-  "git": {
-    "branch": "%s",
-    "commit": "%s",
-    "tag": "%s"
+  "git": %s,
+  "testResults": {
+    "status": "%s",
+    "packages": %d,
+    "total": %d,
+    "passed": %d,
+    "failed": %d,
+    "skipped": %d,
+    "coverageAvailable": %t,
+    "coverage": %s
   },
   "contents": [
     "server binary",
     "frontend assets",
     "build metadata"
   ]
-}`, buildTime, goVersion, nodeVersion, npmVersion, gitBranch, gitCommit, gitTag)
+}`, BuildVersion(), buildTime, target, goVersion, nodeVersion, npmVersion, gitJSON,
+		tests.Status, tests.Totals.Packages, tests.Totals.Total, tests.Totals.Passed,
+		tests.Totals.Failed, tests.Totals.Skipped, tests.HasCoverage, coverage)
 
 	if _, err := metadataFile.WriteString(jsonMetadata); err != nil {
 		return fmt.Errorf("failed to write metadata: %w", err)
@@ -216,15 +279,11 @@ func ValidateArchive(archivePath string) error {
 	}
 
 	// Check for required files
-	requiredFiles := []string{"pb-deployer", "pb-deployer.exe"}
 	hasServerBinary := false
-
 	for _, file := range reader.File {
-		for _, required := range requiredFiles {
-			if strings.HasSuffix(file.Name, required) {
-				hasServerBinary = true
-				break
-			}
+		if isServerBinaryName(path.Base(file.Name)) {
+			hasServerBinary = true
+			break
 		}
 	}
 
@@ -257,6 +316,9 @@ func addFileToZip(zipWriter *zip.Writer, filePath, zipPath string) error {
 
 	header.Name = zipPath
 	header.Method = zip.Deflate
+	// FileInfoHeader only records the Unix mode the host reports, which on
+	// Windows never includes the executable bit
+	header.SetMode(zipEntryMode(zipPath, info.Mode()))
 
 	writer, err := zipWriter.CreateHeader(header)
 	if err != nil {
@@ -267,6 +329,17 @@ func addFileToZip(zipWriter *zip.Writer, filePath, zipPath string) error {
 	return err
 }
 
+// zipEntryMode returns the Unix permissions to store for a file in the
+// archive. The server binary at the top level is always executable, and any
+// other file keeps its own permissions.
+func zipEntryMode(zipPath string, mode os.FileMode) os.FileMode {
+	perm := mode.Perm()
+	if !strings.Contains(zipPath, "/") && isServerBinaryName(zipPath) {
+		perm |= 0755
+	}
+	return perm
+}
+
 // formatBytes formats bytes into human-readable format
 func formatBytes(bytes int64) string {
 	const unit = 1024
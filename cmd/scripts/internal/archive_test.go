@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// zipAndExtract archives a single file under name and extracts it again,
+// returning the extracted file's mode
+func zipAndExtract(t *testing.T, name string, mode os.FileMode) os.FileMode {
+	t.Helper()
+	dir := t.TempDir()
+
+	src := filepath.Join(dir, "src")
+	if err := os.WriteFile(src, []byte("#!/bin/sh\necho ok\n"), mode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(src, mode); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	if err := addFileToZip(zw, src, name); err != nil {
+		t.Fatalf("addFileToZip failed: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := zr.File[0]
+
+	rc, err := entry.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	dst := filepath.Join(dir, "extracted")
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY, entry.Mode().Perm())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, rc); err != nil {
+		t.Fatal(err)
+	}
+	// Apply the stored mode exactly, as unzip does, regardless of umask
+	if err := os.Chmod(dst, entry.Mode().Perm()); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Mode().Perm()
+}
+
+func TestAddFileToZipPreservesExecutableMode(t *testing.T) {
+	if got := zipAndExtract(t, "scripts/start.sh", 0755); got != 0755 {
+		t.Errorf("Expected 0755 after extraction, got %o", got)
+	}
+	if got := zipAndExtract(t, "build-info.txt", 0644); got != 0644 {
+		t.Errorf("Expected 0644 after extraction, got %o", got)
+	}
+}
+
+func TestAddFileToZipMakesServerBinaryExecutable(t *testing.T) {
+	// As built on a host that does not report the executable bit
+	if got := zipAndExtract(t, "pb-deployer-linux-amd64", 0644); got != 0755 {
+		t.Errorf("Expected the server binary to be 0755, got %o", got)
+	}
+	if got := zipAndExtract(t, "pb_public/pb-deployer.svg", 0644); got != 0644 {
+		t.Errorf("Expected nested files to keep 0644, got %o", got)
+	}
+}
+
+func TestIsServerBinaryName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"pb-deployer", true},
+		{"pb-deployer.exe", true},
+		{"pb-deployer-linux-amd64", true},
+		{"pb-deployer-windows-arm64.exe", true},
+		{"pb-deployer-linux-mips64le", true},
+		{"pb-deployer-production-20250101-120000.zip", false},
+		{"pb-deployer-metadata.json", false},
+		{"pb-deployer-linux-amd64.tar.gz", false},
+		{"pb-deployer-linux-amd64-debug", false},
+		{"pb-deployer-linux-", false},
+		{"pb-deployer-Linux-AMD64", false},
+		{"pb-deployer.svg", false},
+		{"pocketbase", false},
+	}
+
+	for _, tt := range tests {
+		if got := isServerBinaryName(tt.name); got != tt.want {
+			t.Errorf("isServerBinaryName(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIsArchiveIgnored(t *testing.T) {
+	patterns := append(append([]string{}, defaultArchiveIgnore...), "test-reports/*.out")
+
+	tests := []struct {
+		path    string
+		ignored bool
+	}{
+		{"node_modules", true},
+		{"pb_public/node_modules", true},
+		{".git", true},
+		{"server.log", true},
+		{"pb_public/.DS_Store", true},
+		{"test-reports/coverage.out", true},
+		{"pb-deployer", false},
+		{"pb_public/index.html", false},
+		{"test-reports/junit.xml", false},
+		{"logs", false},
+	}
+
+	for _, tt := range tests {
+		if got := isArchiveIgnored(tt.path, patterns); got != tt.ignored {
+			t.Errorf("isArchiveIgnored(%q) = %v, want %v", tt.path, got, tt.ignored)
+		}
+	}
+}
+
+func TestLoadArchiveIgnore(t *testing.T) {
+	dir := t.TempDir()
+	content := "# local artifacts\n\n*.tmp\n/coverage/\n"
+	if err := os.WriteFile(filepath.Join(dir, archiveIgnoreFile), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	patterns, err := loadArchiveIgnore(dir)
+	if err != nil {
+		t.Fatalf("loadArchiveIgnore failed: %v", err)
+	}
+	want := append(append([]string{}, defaultArchiveIgnore...), "*.tmp", "coverage")
+	if !slices.Equal(patterns, want) {
+		t.Errorf("Expected %q, got %q", want, patterns)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, archiveIgnoreFile), []byte("[a-\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadArchiveIgnore(dir); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+}
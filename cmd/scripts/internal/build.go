@@ -1,18 +1,107 @@
 package internal
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"io"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strings"
 	"time"
 )
 
+// BuildTarget is a GOOS/GOARCH pair for cross-compiling the server binary.
+// The zero value builds for the host platform.
+type BuildTarget struct {
+	GOOS   string
+	GOARCH string
+}
+
+// ParseBuildTarget parses a target like "linux/amd64" and validates it against
+// the platforms supported by the installed Go toolchain
+func ParseBuildTarget(target string) (BuildTarget, error) {
+	if target == "" {
+		return BuildTarget{}, nil
+	}
+
+	goos, goarch, ok := strings.Cut(target, "/")
+	if !ok || goos == "" || goarch == "" {
+		return BuildTarget{}, fmt.Errorf("invalid target %q, expected GOOS/GOARCH (e.g. linux/amd64)", target)
+	}
+
+	output, err := exec.Command("go", "tool", "dist", "list").Output()
+	if err != nil {
+		return BuildTarget{}, fmt.Errorf("failed to list supported targets: %w", err)
+	}
+
+	if !slices.Contains(strings.Fields(string(output)), target) {
+		return BuildTarget{}, fmt.Errorf("unsupported target %q, see: go tool dist list", target)
+	}
+
+	return BuildTarget{GOOS: goos, GOARCH: goarch}, nil
+}
+
+// IsCross reports whether both GOOS and GOARCH are set. It does not compare
+// them with the host platform, so an explicit target matching the host is
+// still reported as cross.
+func (t BuildTarget) IsCross() bool {
+	return t.GOOS != "" && t.GOARCH != ""
+}
+
+// String returns the GOOS/GOARCH pair, falling back to the host platform
+func (t BuildTarget) String() string {
+	if !t.IsCross() {
+		return runtime.GOOS + "/" + runtime.GOARCH
+	}
+	return t.GOOS + "/" + t.GOARCH
+}
+
+// BinaryName returns the server binary file name for the target
+func (t BuildTarget) BinaryName() string {
+	name := "pb-deployer"
+	goos := runtime.GOOS
+	if t.IsCross() {
+		name += "-" + t.GOOS + "-" + t.GOARCH
+		goos = t.GOOS
+	}
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// buildTask carries the context and output destination for a build step, so the
+// same steps can run sequentially on stdout or concurrently into a buffer
+type buildTask struct {
+	ctx context.Context
+	out io.Writer
+}
+
+// stdoutTask returns a task that writes straight to the terminal
+func stdoutTask() *buildTask {
+	return &buildTask{ctx: context.Background(), out: os.Stdout}
+}
+
+// command creates an exec.Cmd bound to the task context and output
+func (t *buildTask) command(dir, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(t.ctx, name, args...)
+	cmd.Dir = dir
+	cmd.Stdout = t.out
+	cmd.Stderr = t.out
+	return cmd
+}
+
 // ValidateFrontendSetup checks if the frontend directory and package.json exist
 func ValidateFrontendSetup(frontendDir string) error {
-	PrintStep("🔍", "Validating frontend setup...")
+	return stdoutTask().validateFrontendSetup(frontendDir)
+}
+
+func (t *buildTask) validateFrontendSetup(frontendDir string) error {
+	fprintStep(t.out, "🔍", "Validating frontend setup...")
 
 	if _, err := os.Stat(frontendDir); os.IsNotExist(err) {
 		return fmt.Errorf("frontend directory not found at %s", frontendDir)
@@ -23,47 +112,78 @@ func ValidateFrontendSetup(frontendDir string) error {
 		return fmt.Errorf("package.json not found at %s", packageJSON)
 	}
 
-	PrintSuccess("Frontend setup validated")
+	fprintSuccess(t.out, "Frontend setup validated")
 	return nil
 }
 
+// FrontendOptions controls how the frontend is built
+type FrontendOptions struct {
+	InstallDeps bool
+	BuildDir    string
+	Force       bool
+}
+
 // BuildFrontend builds the frontend for development
-func BuildFrontend(rootDir string, installDeps bool) error {
-	PrintHeader("🔨 FRONTEND BUILD")
+func BuildFrontend(rootDir string, opts FrontendOptions) error {
+	return stdoutTask().buildFrontend(rootDir, opts)
+}
+
+func (t *buildTask) buildFrontend(rootDir string, opts FrontendOptions) error {
+	fprintHeader(t.out, "🔨 FRONTEND BUILD")
 
 	frontendDir := filepath.Join(rootDir, "frontend")
 
-	if err := ValidateFrontendSetup(frontendDir); err != nil {
+	if err := t.validateFrontendSetup(frontendDir); err != nil {
 		return err
 	}
 
-	if installDeps {
+	// Dependencies are installed before the cache is consulted so a cache hit
+	// never skips them
+	if opts.InstallDeps {
 		if err := InstallDependencies(rootDir, frontendDir); err != nil {
 			return err
 		}
 	}
 
-	if err := BuildFrontendCore(frontendDir); err != nil {
+	hash, err := ComputeFrontendHash(frontendDir, opts.BuildDir)
+	if err != nil {
+		fprintWarning(t.out, "Failed to hash frontend sources, build cache disabled: %v", err)
+	} else if !opts.Force && frontendUpToDate(rootDir, hash) {
+		fprintInfo(t.out, "Frontend unchanged since last build, skipping npm build (use --force-build to rebuild)")
+		return nil
+	}
+
+	if err := t.buildFrontendCore(frontendDir); err != nil {
 		return err
 	}
 
-	return CopyFrontendToPbPublic(rootDir, frontendDir)
+	if err := t.copyFrontendToPbPublic(rootDir, frontendDir, opts.BuildDir); err != nil {
+		return err
+	}
+
+	if hash != "" {
+		if err := writeBuildCache(rootDir, hash); err != nil {
+			fprintWarning(t.out, "Failed to write build cache: %v", err)
+		}
+	}
+	return nil
 }
 
 // BuildFrontendProduction builds the frontend for production
-func BuildFrontendProduction(rootDir string, installDeps bool) error {
+func BuildFrontendProduction(rootDir string, opts FrontendOptions) error {
 	PrintStep("🏗️", "Building frontend for production...")
-	return BuildFrontend(rootDir, installDeps)
+	return BuildFrontend(rootDir, opts)
 }
 
 // BuildFrontendCore runs the actual npm build process
 func BuildFrontendCore(frontendDir string) error {
-	PrintStep("⚙️", "Building frontend...")
+	return stdoutTask().buildFrontendCore(frontendDir)
+}
 
-	cmd := exec.Command("npm", "run", "build")
-	cmd.Dir = frontendDir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+func (t *buildTask) buildFrontendCore(frontendDir string) error {
+	fprintStep(t.out, "⚙️", "Building frontend...")
+
+	cmd := t.command(frontendDir, "npm", "run", "build")
 
 	start := time.Now()
 	if err := cmd.Run(); err != nil {
@@ -71,13 +191,24 @@ func BuildFrontendCore(frontendDir string) error {
 	}
 
 	duration := time.Since(start)
-	PrintSuccess("Frontend built successfully in %v", duration.Round(time.Millisecond))
+	fprintSuccess(t.out, "Frontend built successfully in %v", duration.Round(time.Millisecond))
 	return nil
 }
 
 // CopyFrontendToPbPublic copies the built frontend to the pb_public directory
-func CopyFrontendToPbPublic(rootDir, frontendDir string) error {
-	PrintStep("📂", "Copying frontend build to pb_public...")
+func CopyFrontendToPbPublic(rootDir, frontendDir, buildDir string) error {
+	return stdoutTask().copyFrontendToPbPublic(rootDir, frontendDir, buildDir)
+}
+
+func (t *buildTask) copyFrontendToPbPublic(rootDir, frontendDir, buildDir string) error {
+	fprintStep(t.out, "📂", "Copying frontend build to pb_public...")
+
+	// Resolve the build output before touching pb_public so a missing build
+	// leaves the previous assets in place
+	buildDir, err := FindBuildDirectory(frontendDir, buildDir)
+	if err != nil {
+		return err
+	}
 
 	pbPublicDir := filepath.Join(rootDir, "pb_public")
 
@@ -89,28 +220,30 @@ func CopyFrontendToPbPublic(rootDir, frontendDir string) error {
 		return fmt.Errorf("failed to create pb_public: %w", err)
 	}
 
-	buildDir := FindBuildDirectory(frontendDir)
-	if err := copyDir(buildDir, pbPublicDir); err != nil {
+	if err := copyTree(buildDir, pbPublicDir); err != nil {
 		return fmt.Errorf("failed to copy frontend build: %w", err)
 	}
 
-	PrintSuccess("Frontend copied to pb_public successfully")
+	fprintSuccess(t.out, "Frontend copied to pb_public successfully")
 	return nil
 }
 
 // CopyFrontendToDist copies the built frontend to the dist directory for production
-func CopyFrontendToDist(rootDir, outputDir string) error {
+func CopyFrontendToDist(rootDir, outputDir, buildDir string) error {
 	PrintStep("📁", "Copying frontend to dist...")
 
+	frontendDir := filepath.Join(rootDir, "frontend")
+	buildDir, err := FindBuildDirectory(frontendDir, buildDir)
+	if err != nil {
+		return err
+	}
+
 	pbPublicDir := filepath.Join(outputDir, "pb_public")
 	if err := os.MkdirAll(pbPublicDir, 0755); err != nil {
 		return fmt.Errorf("failed to create dist pb_public: %w", err)
 	}
 
-	frontendDir := filepath.Join(rootDir, "frontend")
-	buildDir := FindBuildDirectory(frontendDir)
-
-	if err := copyDir(buildDir, pbPublicDir); err != nil {
+	if err := copyTree(buildDir, pbPublicDir); err != nil {
 		return fmt.Errorf("failed to copy frontend to dist: %w", err)
 	}
 
@@ -119,73 +252,100 @@ func CopyFrontendToDist(rootDir, outputDir string) error {
 }
 
 // BuildServerBinary builds the server binary for production
-func BuildServerBinary(rootDir, outputDir string) error {
-	PrintStep("🏗️", "Building server binary...")
+func BuildServerBinary(rootDir, outputDir string, target BuildTarget) error {
+	return stdoutTask().buildServerBinary(rootDir, outputDir, target)
+}
 
-	binaryName := "pb-deployer"
-	if runtime.GOOS == "windows" {
-		binaryName += ".exe"
-	}
+func (t *buildTask) buildServerBinary(rootDir, outputDir string, target BuildTarget) error {
+	fprintStep(t.out, "🏗️", "Building server binary for %s...", target)
 
-	outputPath := filepath.Join(outputDir, binaryName)
+	outputPath := filepath.Join(outputDir, target.BinaryName())
 
 	start := time.Now()
-	cmd := exec.Command("go", "build",
-		"-ldflags", "-s -w",
+	cmd := t.command(rootDir, "go", "build",
+		"-ldflags", serverLDFlags(start),
 		"-o", outputPath,
 		filepath.Join(rootDir, "cmd/server/main.go"))
-	cmd.Dir = rootDir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	if target.IsCross() {
+		// PocketBase uses a pure Go SQLite driver, so cgo is not needed
+		cmd.Env = append(os.Environ(),
+			"GOOS="+target.GOOS,
+			"GOARCH="+target.GOARCH,
+			"CGO_ENABLED=0")
+	}
 
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("server binary build failed: %w", err)
 	}
 
 	duration := time.Since(start)
-	PrintSuccess("Server binary built successfully in %v", duration.Round(time.Millisecond))
-	PrintInfo("Binary location: %s", outputPath)
+	fprintSuccess(t.out, "Server binary built successfully in %v", duration.Round(time.Millisecond))
+	fprintInfo(t.out, "Binary location: %s", outputPath)
 	return nil
 }
 
-// FindBuildDirectory finds the frontend build output directory
-func FindBuildDirectory(frontendDir string) string {
+// FindBuildDirectory finds the frontend build output directory. A non-empty
+// override is used as-is, resolved relative to frontendDir when not absolute.
+func FindBuildDirectory(frontendDir, override string) (string, error) {
 	possibleDirs := []string{"build", "dist", "static"}
+	if override != "" {
+		possibleDirs = []string{override}
+	}
 
+	var searched []string
 	for _, dir := range possibleDirs {
-		buildDir := filepath.Join(frontendDir, dir)
-		if _, err := os.Stat(buildDir); err == nil {
-			return buildDir
+		buildDir := dir
+		if !filepath.IsAbs(buildDir) {
+			buildDir = filepath.Join(frontendDir, dir)
+		}
+		searched = append(searched, buildDir)
+
+		if info, err := os.Stat(buildDir); err == nil && info.IsDir() {
+			return buildDir, nil
 		}
 	}
 
-	log.Fatalf("Could not find frontend build directory in: %v", possibleDirs)
-	return ""
+	return "", fmt.Errorf("could not find frontend build directory, searched: %s", strings.Join(searched, ", "))
 }
 
-// copyDir recursively copies a directory from src to dst
-func copyDir(src, dst string) error {
-	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+// copyTree recursively copies the directory tree at src into dst, recreating
+// the directory structure and preserving file modes
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to read %s: %w", path, err)
 		}
 
-		// Calculate the destination path
 		relPath, err := filepath.Rel(src, path)
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to resolve %s: %w", path, err)
 		}
 		dstPath := filepath.Join(dst, relPath)
 
-		if info.IsDir() {
-			return os.MkdirAll(dstPath, info.Mode())
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+
+		if d.IsDir() {
+			if err := os.MkdirAll(dstPath, info.Mode().Perm()); err != nil {
+				return fmt.Errorf("failed to create directory %s: %w", dstPath, err)
+			}
+			return nil
 		}
 
-		return copyFile(path, dstPath)
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("unsupported file type for %s: %s", path, info.Mode().Type())
+		}
+
+		if err := copyFile(path, dstPath); err != nil {
+			return fmt.Errorf("failed to copy %s to %s: %w", path, dstPath, err)
+		}
+		return nil
 	})
 }
 
-// copyFile copies a single file from src to dst
+// copyFile copies a single file from src to dst, preserving its mode
 func copyFile(src, dst string) error {
 	sourceFile, err := os.Open(src)
 	if err != nil {
@@ -193,17 +353,30 @@ func copyFile(src, dst string) error {
 	}
 	defer sourceFile.Close()
 
+	info, err := sourceFile.Stat()
+	if err != nil {
+		return err
+	}
+
 	// Create the destination directory if it doesn't exist
 	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
 		return err
 	}
 
-	destFile, err := os.Create(dst)
+	destFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
 	if err != nil {
 		return err
 	}
-	defer destFile.Close()
 
-	_, err = destFile.ReadFrom(sourceFile)
-	return err
+	if _, err := io.Copy(destFile, sourceFile); err != nil {
+		destFile.Close()
+		return err
+	}
+
+	if err := destFile.Close(); err != nil {
+		return err
+	}
+
+	// OpenFile only applies the mode on creation and is subject to umask
+	return os.Chmod(dst, info.Mode().Perm())
 }
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCopyTree(t *testing.T) {
+	src := t.TempDir()
+	dst := filepath.Join(t.TempDir(), "pb_public")
+
+	fixtures := []struct {
+		path    string
+		content []byte
+		mode    os.FileMode
+	}{
+		{"index.html", []byte("<html></html>"), 0644},
+		{"favicon.ico", []byte{0x00, 0x01, 0xfe, 0xff}, 0644},
+		{"_app/immutable/entry.js", []byte("console.log('entry')"), 0644},
+		{"_app/immutable/chunks/deep.js", bytes.Repeat([]byte("x"), 64*1024), 0600},
+		{"scripts/run.sh", []byte("#!/bin/sh\necho ok\n"), 0755},
+		{"empty.txt", []byte{}, 0644},
+	}
+
+	for _, f := range fixtures {
+		path := filepath.Join(src, f.path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create fixture directory: %v", err)
+		}
+		if err := os.WriteFile(path, f.content, f.mode); err != nil {
+			t.Fatalf("Failed to write fixture %s: %v", f.path, err)
+		}
+		if err := os.Chmod(path, f.mode); err != nil {
+			t.Fatalf("Failed to chmod fixture %s: %v", f.path, err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Join(src, "assets", "empty"), 0755); err != nil {
+		t.Fatalf("Failed to create empty directory: %v", err)
+	}
+
+	if err := copyTree(src, dst); err != nil {
+		t.Fatalf("copyTree failed: %v", err)
+	}
+
+	for _, f := range fixtures {
+		t.Run(f.path, func(t *testing.T) {
+			path := filepath.Join(dst, f.path)
+
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Expected copied file: %v", err)
+			}
+			if !bytes.Equal(got, f.content) {
+				t.Errorf("Content mismatch for %s: got %d bytes, want %d bytes", f.path, len(got), len(f.content))
+			}
+
+			if runtime.GOOS == "windows" {
+				return
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("Failed to stat copied file: %v", err)
+			}
+			if info.Mode().Perm() != f.mode {
+				t.Errorf("Expected mode %04o, got %04o", f.mode, info.Mode().Perm())
+			}
+		})
+	}
+
+	if info, err := os.Stat(filepath.Join(dst, "assets", "empty")); err != nil || !info.IsDir() {
+		t.Errorf("Expected empty directory to be recreated, got err: %v", err)
+	}
+}
+
+func TestCopyTree_MissingSource(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "does-not-exist")
+
+	err := copyTree(src, t.TempDir())
+	if err == nil {
+		t.Fatal("Expected error for missing source")
+	}
+	if !strings.Contains(err.Error(), src) {
+		t.Errorf("Expected error to mention %s, got: %v", src, err)
+	}
+}
@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// buildCacheFile stores the frontend hash of the last successful build
+const buildCacheFile = ".pb-deployer-build-cache"
+
+// frontendHashInputs are the paths, relative to frontend/, that affect the build output
+var frontendHashInputs = []string{
+	"src",
+	"static",
+	"package.json",
+	"package-lock.json",
+	"svelte.config.js",
+	"vite.config.ts",
+	"vite.config.js",
+	"vite.config.mjs",
+}
+
+// frontendHashIgnore lists directory and file names excluded from the hash
+var frontendHashIgnore = []string{
+	"node_modules",
+	".svelte-kit",
+	".git",
+	".DS_Store",
+	"Thumbs.db",
+}
+
+// isHashIgnored reports whether a file name should be left out of the hash
+func isHashIgnored(name string) bool {
+	return slices.Contains(frontendHashIgnore, name) ||
+		strings.HasSuffix(name, ".swp") ||
+		strings.HasSuffix(name, "~")
+}
+
+// ComputeFrontendHash hashes the frontend sources that affect the build output,
+// along with the build output directory override copied into pb_public
+func ComputeFrontendHash(frontendDir, buildDir string) (string, error) {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "build-dir\x00%s\x00", filepath.ToSlash(buildDir))
+
+	for _, input := range frontendHashInputs {
+		root := filepath.Join(frontendDir, input)
+		if _, err := os.Stat(root); os.IsNotExist(err) {
+			continue
+		}
+
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if isHashIgnored(d.Name()) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+
+			relPath, err := filepath.Rel(frontendDir, path)
+			if err != nil {
+				return err
+			}
+
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			// Include the path so renames and moves change the hash
+			fmt.Fprintf(hash, "%s\x00", filepath.ToSlash(relPath))
+			if _, err := io.Copy(hash, file); err != nil {
+				return err
+			}
+			hash.Write([]byte{0})
+			return nil
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to hash %s: %w", input, err)
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// frontendUpToDate reports whether the cached hash matches and pb_public exists
+func frontendUpToDate(rootDir, hash string) bool {
+	if _, err := os.Stat(filepath.Join(rootDir, "pb_public")); err != nil {
+		return false
+	}
+
+	cached, err := os.ReadFile(filepath.Join(rootDir, buildCacheFile))
+	if err != nil {
+		return false
+	}
+
+	return strings.TrimSpace(string(cached)) == hash
+}
+
+// writeBuildCache records the hash of a successful frontend build
+func writeBuildCache(rootDir, hash string) error {
+	return os.WriteFile(filepath.Join(rootDir, buildCacheFile), []byte(hash+"\n"), 0644)
+}
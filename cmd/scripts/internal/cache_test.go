@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestComputeFrontendHash(t *testing.T) {
+	frontendDir := t.TempDir()
+	files := map[string]string{
+		"package.json":            `{"name":"frontend"}`,
+		"src/routes/+page.svelte": "<h1>Hello</h1>",
+		"node_modules/dep/x.js":   "ignored",
+	}
+	for name, content := range files {
+		path := filepath.Join(frontendDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	base, err := ComputeFrontendHash(frontendDir, "")
+	if err != nil {
+		t.Fatalf("ComputeFrontendHash failed: %v", err)
+	}
+
+	if other, _ := ComputeFrontendHash(frontendDir, "dist"); other == base {
+		t.Error("Expected the build directory override to change the hash")
+	}
+
+	if err := os.WriteFile(filepath.Join(frontendDir, "node_modules/dep/x.js"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if same, _ := ComputeFrontendHash(frontendDir, ""); same != base {
+		t.Error("Expected node_modules to be ignored")
+	}
+
+	if err := os.WriteFile(filepath.Join(frontendDir, "src/routes/+page.svelte"), []byte("<h1>Bye</h1>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if changed, _ := ComputeFrontendHash(frontendDir, ""); changed == base {
+		t.Error("Expected a source change to change the hash")
+	}
+}
+
+func TestFrontendUpToDate(t *testing.T) {
+	rootDir := t.TempDir()
+
+	if err := writeBuildCache(rootDir, "abc"); err != nil {
+		t.Fatalf("writeBuildCache failed: %v", err)
+	}
+	if frontendUpToDate(rootDir, "abc") {
+		t.Error("Expected a missing pb_public to invalidate the cache")
+	}
+
+	if err := os.Mkdir(filepath.Join(rootDir, "pb_public"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if !frontendUpToDate(rootDir, "abc") {
+		t.Error("Expected a matching hash to be up to date")
+	}
+	if frontendUpToDate(rootDir, "def") {
+		t.Error("Expected a different hash to be stale")
+	}
+}
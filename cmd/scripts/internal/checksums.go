@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// checksumsFile lists the SHA-256 of each artifact in sha256sum format, so
+// `sha256sum -c SHA256SUMS` verifies a downloaded build
+const checksumsFile = "SHA256SUMS"
+
+// WriteChecksums hashes every top-level file in outputDir (the server
+// binary, the archive and the metadata files) and writes them to
+// SHA256SUMS. Directories are covered by the archive. It returns the hashes
+// by file name.
+func WriteChecksums(outputDir string) (map[string]string, error) {
+	PrintStep("🔐", "Writing SHA256 checksums...")
+
+	entries, err := os.ReadDir(outputDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read output directory: %w", err)
+	}
+
+	sums := make(map[string]string)
+	var names []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || entry.Name() == checksumsFile {
+			continue
+		}
+		sum, err := fileSHA256(filepath.Join(outputDir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash %s: %w", entry.Name(), err)
+		}
+		sums[entry.Name()] = sum
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+
+	var content strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&content, "%s  %s\n", sums[name], name)
+	}
+
+	path := filepath.Join(outputDir, checksumsFile)
+	if err := os.WriteFile(path, []byte(content.String()), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write checksums: %w", err)
+	}
+
+	PrintSuccess("Checksums for %d file(s) saved to: %s", len(names), path)
+	return sums, nil
+}
+
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
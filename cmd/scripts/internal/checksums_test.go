@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteChecksums(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"pb-deployer": "binary",
+		"pb-deployer-production-20250101-120000.zip": "archive",
+		"pb_public/index.html":                       "<html></html>",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sums, err := WriteChecksums(dir)
+	if err != nil {
+		t.Fatalf("WriteChecksums failed: %v", err)
+	}
+
+	// Matches sha256sum output, sorted by name; pb_public is covered by the archive
+	want := "9a3a45d01531a20e89ac6ae10b0b0beb0492acd7216a368aa062d1a5fecaf9cd  pb-deployer\n" +
+		"0eb3e36bfb24dcd9bb1d1bece1531216b59539a8fde17ee80224af0653c92aa3  pb-deployer-production-20250101-120000.zip\n"
+	data, err := os.ReadFile(filepath.Join(dir, checksumsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want {
+		t.Errorf("Unexpected %s:\n%s", checksumsFile, data)
+	}
+	if len(sums) != 2 || sums["pb-deployer"] != "9a3a45d01531a20e89ac6ae10b0b0beb0492acd7216a368aa062d1a5fecaf9cd" {
+		t.Errorf("Unexpected sums %v", sums)
+	}
+
+	// A rerun must not hash the previous SHA256SUMS
+	if sums, err := WriteChecksums(dir); err != nil || len(sums) != 2 {
+		t.Errorf("Expected SHA256SUMS to be left out, got %v, %v", sums, err)
+	}
+}
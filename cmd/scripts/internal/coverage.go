@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// coverageProfileFile is the merged coverage profile written by the test suite
+const coverageProfileFile = "coverage.out"
+
+// CoverageProfilePath returns where RunTestSuiteAndGenerateReport writes the
+// coverage profile for a build output directory
+func CoverageProfilePath(outputDir string) string {
+	return filepath.Join(outputDir, "test-reports", coverageProfileFile)
+}
+
+// TotalCoverage returns the total statement coverage, in percent, of a
+// coverage profile as reported by go tool cover
+func TotalCoverage(profilePath string) (float64, error) {
+	if _, err := os.Stat(profilePath); err != nil {
+		return 0, fmt.Errorf("coverage profile not found: %w", err)
+	}
+
+	output, err := exec.Command("go", "tool", "cover", "-func="+profilePath).CombinedOutput()
+	if err != nil {
+		return 0, fmt.Errorf("go tool cover failed: %s", strings.TrimSpace(string(output)))
+	}
+	return parseCoverageTotal(string(output))
+}
+
+// parseCoverageTotal extracts the percentage from the "total:" line of
+// go tool cover -func output
+func parseCoverageTotal(output string) (float64, error) {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != "total:" {
+			continue
+		}
+		percent := strings.TrimSuffix(fields[len(fields)-1], "%")
+		total, err := strconv.ParseFloat(percent, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid coverage total %q", fields[len(fields)-1])
+		}
+		return total, nil
+	}
+	return 0, fmt.Errorf("no total in coverage output")
+}
+
+// checkCoverageGate fails when total coverage is below minimum. A minimum of
+// zero disables the gate.
+func checkCoverageGate(total, minimum float64) error {
+	if minimum <= 0 || total >= minimum {
+		return nil
+	}
+	return fmt.Errorf("total coverage %.1f%% is below the required %.1f%%", total, minimum)
+}
@@ -0,0 +1,38 @@
+package internal
+
+import "testing"
+
+func TestParseCoverageTotal(t *testing.T) {
+	output := "pb-deployer/internal/api/deploy.go:39:\thandleDeploy\t\t0.0%\n" +
+		"total:\t\t\t\t\t\t(statements)\t\t\t42.7%\n"
+
+	total, err := parseCoverageTotal(output)
+	if err != nil {
+		t.Fatalf("parseCoverageTotal failed: %v", err)
+	}
+	if total != 42.7 {
+		t.Errorf("Expected 42.7, got %v", total)
+	}
+
+	if _, err := parseCoverageTotal("no coverage here\n"); err == nil {
+		t.Error("Expected an error without a total line")
+	}
+}
+
+func TestCheckCoverageGate(t *testing.T) {
+	tests := []struct {
+		total, minimum float64
+		wantErr        bool
+	}{
+		{42.7, 0, false},
+		{42.7, 40, false},
+		{42.7, 42.7, false},
+		{42.7, 50, true},
+	}
+
+	for _, tt := range tests {
+		if err := checkCoverageGate(tt.total, tt.minimum); (err != nil) != tt.wantErr {
+			t.Errorf("checkCoverageGate(%v, %v) = %v, wantErr %v", tt.total, tt.minimum, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Environment variables that override the git metadata, for CI checkouts
+// that are detached, shallow or not git repositories at all
+const (
+	gitCommitEnv = "PB_DEPLOYER_GIT_COMMIT"
+	gitBranchEnv = "PB_DEPLOYER_GIT_BRANCH"
+	gitTagEnv    = "PB_DEPLOYER_GIT_TAG"
+)
+
+// gitMetadata holds the git state recorded in build metadata. Outside a git
+// checkout, and without overrides, only Available is set.
+type gitMetadata struct {
+	Available bool   `json:"available"`
+	Commit    string `json:"commit,omitempty"`
+	Branch    string `json:"branch,omitempty"`
+	Tag       string `json:"tag,omitempty"`
+}
+
+// collectGitMetadata gathers the current commit, branch and exact tag. git
+// is only asked once per run.
+var collectGitMetadata = sync.OnceValue(func() gitMetadata {
+	return resolveGitMetadata(os.Getenv, runGit)
+})
+
+// runGit returns the trimmed output of a git command
+func runGit(args ...string) (string, error) {
+	output, err := exec.Command("git", args...).Output()
+	return strings.TrimSpace(string(output)), err
+}
+
+// resolveGitMetadata reads the metadata from git when the working directory
+// is a checkout, then applies the environment overrides
+func resolveGitMetadata(getenv func(string) string, git func(args ...string) (string, error)) gitMetadata {
+	var meta gitMetadata
+
+	if inside, err := git("rev-parse", "--is-inside-work-tree"); err == nil && inside == "true" {
+		meta.Commit, _ = git("rev-parse", "HEAD")
+		// A detached checkout reports its branch as HEAD
+		if branch, err := git("rev-parse", "--abbrev-ref", "HEAD"); err == nil && branch != "HEAD" {
+			meta.Branch = branch
+		}
+		// Fails unless HEAD is exactly at a tag
+		meta.Tag, _ = git("describe", "--tags", "--exact-match")
+	}
+
+	if commit := getenv(gitCommitEnv); commit != "" {
+		meta.Commit = commit
+	}
+	if branch := getenv(gitBranchEnv); branch != "" {
+		meta.Branch = branch
+	}
+	if tag := getenv(gitTagEnv); tag != "" {
+		meta.Tag = tag
+	}
+
+	meta.Available = meta.Commit != ""
+	return meta
+}
@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fakeGit answers git commands from a map keyed by their arguments
+func fakeGit(outputs map[string]string) func(args ...string) (string, error) {
+	return func(args ...string) (string, error) {
+		if out, ok := outputs[strings.Join(args, " ")]; ok {
+			return out, nil
+		}
+		return "", errors.New("exit status 128")
+	}
+}
+
+func noEnv(string) string { return "" }
+
+func TestResolveGitMetadataOutsideRepository(t *testing.T) {
+	meta := resolveGitMetadata(noEnv, fakeGit(nil))
+	if meta != (gitMetadata{}) {
+		t.Errorf("Expected only available=false, got %+v", meta)
+	}
+}
+
+func TestResolveGitMetadataDetachedCheckout(t *testing.T) {
+	git := fakeGit(map[string]string{
+		"rev-parse --is-inside-work-tree": "true",
+		"rev-parse HEAD":                  "4f2c1e0",
+		"rev-parse --abbrev-ref HEAD":     "HEAD",
+		"describe --tags --exact-match":   "v1.2.0",
+	})
+
+	meta := resolveGitMetadata(noEnv, git)
+	want := gitMetadata{Available: true, Commit: "4f2c1e0", Tag: "v1.2.0"}
+	if meta != want {
+		t.Errorf("Expected %+v, got %+v", want, meta)
+	}
+}
+
+func TestResolveGitMetadataEnvironmentOverrides(t *testing.T) {
+	env := map[string]string{
+		gitCommitEnv: "9b8a7c6",
+		gitBranchEnv: "main",
+	}
+
+	meta := resolveGitMetadata(func(key string) string { return env[key] }, fakeGit(nil))
+	want := gitMetadata{Available: true, Commit: "9b8a7c6", Branch: "main"}
+	if meta != want {
+		t.Errorf("Expected %+v, got %+v", want, meta)
+	}
+}
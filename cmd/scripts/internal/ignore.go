@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// archiveIgnoreFile holds per-project archive ignore patterns, one per line
+const archiveIgnoreFile = ".pbdeployerignore"
+
+// defaultArchiveIgnore keeps development artifacts out of the production
+// archive when the dist directory accidentally contains them
+var defaultArchiveIgnore = []string{
+	"node_modules",
+	".git",
+	"*.log",
+	".DS_Store",
+}
+
+// loadArchiveIgnore returns the default ignore patterns plus those in
+// rootDir/.pbdeployerignore. Blank lines and lines starting with # are
+// skipped.
+func loadArchiveIgnore(rootDir string) ([]string, error) {
+	patterns := append([]string{}, defaultArchiveIgnore...)
+
+	file, err := os.Open(filepath.Join(rootDir, archiveIgnoreFile))
+	if os.IsNotExist(err) {
+		return patterns, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		pattern := strings.TrimSpace(scanner.Text())
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		pattern = strings.Trim(filepath.ToSlash(pattern), "/")
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid pattern %q: %w", archiveIgnoreFile, line, pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return patterns, nil
+}
+
+// isArchiveIgnored reports whether a path relative to the archive root
+// matches a pattern, either by its base name or by its whole path, with
+// filepath.Match semantics
+func isArchiveIgnored(relPath string, patterns []string) bool {
+	relPath = filepath.ToSlash(relPath)
+	base := path.Base(relPath)
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, base); matched {
+			return true
+		}
+		if matched, _ := path.Match(pattern, relPath); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// treeSize counts the files and bytes under root, for reporting what an
+// ignored directory would have added
+func treeSize(root string) (files int, size int64) {
+	filepath.WalkDir(root, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			files++
+			size += info.Size()
+		}
+		return nil
+	})
+	return files, size
+}
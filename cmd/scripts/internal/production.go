@@ -1,20 +1,56 @@
 package internal
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
+
+	"golang.org/x/sync/errgroup"
 )
 
+// ProductionOptions controls how a production build is performed
+type ProductionOptions struct {
+	InstallDeps bool
+	DistDir     string
+	Parallel    bool
+	Target      BuildTarget
+	BuildDir    string
+	ForceBuild  bool
+	ReportJSON  string
+	// MinCoverage fails the build when total test coverage, in percent, is
+	// below it. Zero disables the gate.
+	MinCoverage float64
+	// SkipTests leaves out the test suite and coverage for emergency builds.
+	// The build is marked as unvalidated.
+	SkipTests bool
+}
+
+// frontendOptions returns the frontend build options for a production build.
+// ProductionBuild installs dependencies itself before any build step, so they
+// are installed whether or not the frontend build cache is hit.
+func (o ProductionOptions) frontendOptions() FrontendOptions {
+	return FrontendOptions{
+		BuildDir: o.BuildDir,
+		Force:    o.ForceBuild,
+	}
+}
+
 // ProductionBuild orchestrates the entire production build process
-func ProductionBuild(rootDir string, installDeps bool, distDir string) error {
+func ProductionBuild(rootDir string, opts ProductionOptions) error {
 	PrintHeader("🚀 PRODUCTION BUILD")
 
-	outputDir := filepath.Join(rootDir, distDir)
+	outputDir := filepath.Join(rootDir, opts.DistDir)
+	installDeps := opts.InstallDeps
 	start := time.Now()
 
+	if opts.SkipTests && opts.MinCoverage > 0 {
+		return fmt.Errorf("--min-coverage cannot be checked with --skip-tests")
+	}
+
 	// Clean and create output directory
 	if err := prepareOutputDirectory(outputDir); err != nil {
 		return err
@@ -33,43 +69,203 @@ func ProductionBuild(rootDir string, installDeps bool, distDir string) error {
 		}
 	}
 
-	// Build frontend for production
-	if err := BuildFrontendProduction(rootDir, installDeps); err != nil {
-		return fmt.Errorf("frontend build failed: %w", err)
-	}
+	if opts.Parallel {
+		// Build frontend and server binary concurrently
+		if err := buildInParallel(rootDir, outputDir, opts); err != nil {
+			return err
+		}
 
-	// Copy frontend to dist
-	if err := CopyFrontendToDist(rootDir, outputDir); err != nil {
-		return fmt.Errorf("frontend copy to dist failed: %w", err)
+		// Copy frontend to dist
+		if err := CopyFrontendToDist(rootDir, outputDir, opts.BuildDir); err != nil {
+			return fmt.Errorf("frontend copy to dist failed: %w", err)
+		}
+	} else {
+		// Build frontend for production
+		if err := BuildFrontendProduction(rootDir, opts.frontendOptions()); err != nil {
+			return fmt.Errorf("frontend build failed: %w", err)
+		}
+
+		// Copy frontend to dist
+		if err := CopyFrontendToDist(rootDir, outputDir, opts.BuildDir); err != nil {
+			return fmt.Errorf("frontend copy to dist failed: %w", err)
+		}
+
+		// Build server binary
+		if err := BuildServerBinary(rootDir, outputDir, opts.Target); err != nil {
+			return fmt.Errorf("server binary build failed: %w", err)
+		}
 	}
 
-	// Build server binary
-	if err := BuildServerBinary(rootDir, outputDir); err != nil {
-		return fmt.Errorf("server binary build failed: %w", err)
+	// Run test suite and generate reports
+	tests, err := runProductionTests(rootDir, outputDir, opts)
+	if err != nil {
+		return err
 	}
 
 	// Generate package metadata
-	if err := GeneratePackageMetadata(rootDir, outputDir); err != nil {
+	if err := GeneratePackageMetadata(rootDir, outputDir, opts.Target, tests); err != nil {
 		PrintWarning("Failed to generate package metadata: %v", err)
 	}
 
-	// Run test suite and generate reports
-	if err := RunTestSuiteAndGenerateReport(rootDir, outputDir); err != nil {
-		PrintWarning("Test suite failed: %v", err)
-	}
-
 	// Create production archive
 	if err := CreateProjectArchive(rootDir, outputDir); err != nil {
 		PrintWarning("Failed to create production archive: %v", err)
 	}
 
 	duration := time.Since(start)
+
+	// Write machine-readable build report
+	reportPath := opts.ReportJSON
+	if reportPath == "" {
+		reportPath = filepath.Join(outputDir, buildReportFile)
+	} else if !filepath.IsAbs(reportPath) {
+		reportPath = filepath.Join(rootDir, reportPath)
+	}
+	if err := WriteBuildReport(outputDir, reportPath, opts.Target, duration); err != nil {
+		PrintWarning("Failed to write build report: %v", err)
+	}
+
+	// Checksum the final artifacts, including the build report
+	sums, err := WriteChecksums(outputDir)
+	if err != nil {
+		PrintWarning("Failed to write checksums: %v", err)
+	}
+
 	PrintBuildSummary(duration, true)
-	printProductionSummary(outputDir, duration)
+	printProductionSummary(outputDir, duration, tests, sums)
 
 	return nil
 }
 
+// runProductionTests runs the test suite unless opts.SkipTests is set and
+// enforces the coverage gate before anything is packaged. A failing suite
+// only warns; a missed coverage gate fails the build.
+func runProductionTests(rootDir, outputDir string, opts ProductionOptions) (TestOutcome, error) {
+	if opts.SkipTests {
+		fmt.Println()
+		PrintWarning("%s--skip-tests: test suite and coverage skipped, this build is UNVALIDATED%s", Bold, Reset)
+		fmt.Println()
+		return TestOutcome{Status: TestStatusSkipped}, nil
+	}
+
+	totals, err := RunTestSuiteAndGenerateReport(rootDir, outputDir)
+	tests := TestOutcome{Status: TestStatusPassed, Totals: totals}
+	if err != nil {
+		PrintWarning("Test suite failed: %v", err)
+		tests.Status = TestStatusFailed
+	}
+
+	coverage, err := TotalCoverage(CoverageProfilePath(outputDir))
+	if err != nil {
+		PrintWarning("Coverage unavailable: %v", err)
+		if opts.MinCoverage > 0 {
+			return tests, fmt.Errorf("coverage gate of %.1f%% could not be checked: %w", opts.MinCoverage, err)
+		}
+		return tests, nil
+	}
+
+	tests.Coverage, tests.HasCoverage = coverage, true
+	PrintInfo("Total coverage: %.1f%%", coverage)
+	if err := checkCoverageGate(coverage, opts.MinCoverage); err != nil {
+		return tests, fmt.Errorf("coverage gate failed: %w", err)
+	}
+	return tests, nil
+}
+
+// buildInParallel builds the frontend and server binary concurrently. Each task
+// writes into its own buffer which is flushed in order once the task finishes,
+// and the first failure cancels the other task.
+func buildInParallel(rootDir, outputDir string, opts ProductionOptions) error {
+	PrintStep("⚡", "Building frontend and server binary in parallel...")
+
+	g, ctx := errgroup.WithContext(context.Background())
+
+	type parallelTask struct {
+		name string
+		out  bytes.Buffer
+		done chan struct{}
+		run  func(t *buildTask) error
+	}
+
+	tasks := []*parallelTask{
+		{
+			name: "frontend build",
+			run: func(t *buildTask) error {
+				// Dependencies were already installed before the parallel stage;
+				// running go mod tidy alongside go build would race
+				return t.buildFrontend(rootDir, opts.frontendOptions())
+			},
+		},
+		{
+			name: "server binary build",
+			run: func(t *buildTask) error {
+				return t.buildServerBinary(rootDir, outputDir, opts.Target)
+			},
+		},
+	}
+
+	for _, task := range tasks {
+		task.done = make(chan struct{})
+		g.Go(func() error {
+			defer close(task.done)
+			if err := task.run(&buildTask{ctx: ctx, out: &task.out}); err != nil {
+				return fmt.Errorf("%s failed: %w", task.name, err)
+			}
+			return nil
+		})
+	}
+
+	for _, task := range tasks {
+		<-task.done
+		os.Stdout.Write(task.out.Bytes())
+	}
+
+	return g.Wait()
+}
+
+// isServerBinaryName reports whether a file name is a server binary as named by
+// BuildTarget.BinaryName: pb-deployer[-GOOS-GOARCH][.exe]
+func isServerBinaryName(name string) bool {
+	name = strings.TrimSuffix(name, ".exe")
+	if name == "pb-deployer" {
+		return true
+	}
+
+	platform, ok := strings.CutPrefix(name, "pb-deployer-")
+	if !ok {
+		return false
+	}
+	goos, goarch, ok := strings.Cut(platform, "-")
+	return ok && isPlatformWord(goos) && isPlatformWord(goarch)
+}
+
+// isPlatformWord reports whether s is a plausible GOOS or GOARCH value
+func isPlatformWord(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// findServerBinary returns the name of the server binary in outputDir, if any
+func findServerBinary(outputDir string) string {
+	entries, err := os.ReadDir(outputDir)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && isServerBinaryName(entry.Name()) {
+			return entry.Name()
+		}
+	}
+	return ""
+}
+
 // prepareOutputDirectory cleans and creates the output directory
 func prepareOutputDirectory(outputDir string) error {
 	PrintStep("🧹", "Cleaning output directory...")
@@ -87,7 +283,7 @@ func prepareOutputDirectory(outputDir string) error {
 }
 
 // printProductionSummary displays a detailed summary of the production build
-func printProductionSummary(outputDir string, duration time.Duration) {
+func printProductionSummary(outputDir string, duration time.Duration, tests TestOutcome, sums map[string]string) {
 	fmt.Printf("\n%sProduction Build Summary%s\n", Bold, Reset)
 	fmt.Printf("%s%s%s\n", Gray, strings.Repeat("─", 24), Reset)
 
@@ -95,13 +291,8 @@ func printProductionSummary(outputDir string, duration time.Duration) {
 	fmt.Printf("\n%sGenerated Files:%s\n", Gray, Reset)
 
 	// Check for server binary
-	binaryPaths := []string{"pb-deployer", "pb-deployer.exe"}
-	for _, binary := range binaryPaths {
-		binaryPath := filepath.Join(outputDir, binary)
-		if _, err := os.Stat(binaryPath); err == nil {
-			fmt.Printf("  %s✓%s %s\n", Green, Reset, binary)
-			break
-		}
+	if binary := findServerBinary(outputDir); binary != "" {
+		fmt.Printf("  %s✓%s %s\n", Green, Reset, binary)
 	}
 
 	// Check for frontend assets
@@ -129,18 +320,33 @@ func printProductionSummary(outputDir string, duration time.Duration) {
 	}
 
 	// Check for archive
-	entries, err := os.ReadDir(outputDir)
-	if err == nil {
-		for _, entry := range entries {
-			if strings.HasSuffix(entry.Name(), ".zip") {
-				fmt.Printf("  %s✓%s %s\n", Green, Reset, entry.Name())
-				break
-			}
-		}
+	archive := findLatestArchive(outputDir)
+	if archive != "" {
+		fmt.Printf("  %s✓%s %s\n", Green, Reset, archive)
+	}
+
+	if len(sums) > 0 {
+		fmt.Printf("  %s✓%s %s\n", Green, Reset, checksumsFile)
+	}
+	if sum, ok := sums[archive]; ok {
+		fmt.Printf("\n%sArchive SHA256:%s %s\n", Gray, Reset, sum)
 	}
 
 	fmt.Printf("\n%sDeployment Ready:%s %s%s%s\n",
 		Gray, Reset, Green, outputDir, Reset)
+	switch tests.Status {
+	case TestStatusSkipped:
+		fmt.Printf("%sTests:%s %sskipped (unvalidated build)%s\n", Gray, Reset, Bold+Yellow, Reset)
+	case TestStatusFailed:
+		fmt.Printf("%sTests:%s %sfailed%s\n", Gray, Reset, Red, Reset)
+	default:
+		fmt.Printf("%sTests:%s %spassed%s\n", Gray, Reset, Green, Reset)
+	}
+	if tests.HasCoverage {
+		fmt.Printf("%sCoverage:%s %s%.1f%%%s\n", Gray, Reset, Cyan, tests.Coverage, Reset)
+	} else {
+		fmt.Printf("%sCoverage:%s %sunavailable%s\n", Gray, Reset, Yellow, Reset)
+	}
 	fmt.Printf("%sTotal Time:%s %s%v%s\n",
 		Gray, Reset, Cyan, duration.Round(time.Millisecond), Reset)
 
@@ -157,20 +363,11 @@ func ValidateProductionBuild(outputDir string) error {
 	}
 
 	// Check for server binary
-	binaryFound := false
-	binaryPaths := []string{"pb-deployer", "pb-deployer.exe"}
-	for _, binary := range binaryPaths {
-		binaryPath := filepath.Join(outputDir, binary)
-		if _, err := os.Stat(binaryPath); err == nil {
-			binaryFound = true
-			PrintSuccess("Server binary found: %s", binary)
-			break
-		}
-	}
-
-	if !binaryFound {
+	binary := findServerBinary(outputDir)
+	if binary == "" {
 		return fmt.Errorf("server binary not found in production build")
 	}
+	PrintSuccess("Server binary found: %s", binary)
 
 	// Check for frontend assets
 	pbPublicPath := filepath.Join(outputDir, "pb_public")
@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// buildReportFile is the default name of the machine-readable build report
+const buildReportFile = "build-report.json"
+
+// BuildReport is the machine-readable summary of a production build
+type BuildReport struct {
+	BuildType  string        `json:"buildType"`
+	BuildTime  string        `json:"buildTime"`
+	DurationMs int64         `json:"durationMs"`
+	Target     string        `json:"target"`
+	Binary     *artifactInfo `json:"binary,omitempty"`
+	Archive    *artifactInfo `json:"archive,omitempty"`
+	FileCount  int           `json:"fileCount"`
+	Git        gitMetadata   `json:"git"`
+}
+
+// artifactInfo describes a single build output file
+type artifactInfo struct {
+	Name      string `json:"name"`
+	SizeBytes int64  `json:"sizeBytes"`
+}
+
+// WriteBuildReport collects information about the build outputs in outputDir
+// and writes it as JSON to reportPath
+func WriteBuildReport(outputDir, reportPath string, target BuildTarget, duration time.Duration) error {
+	PrintStep("🧾", "Writing build report...")
+
+	report := BuildReport{
+		BuildType:  "production",
+		BuildTime:  time.Now().UTC().Format(time.RFC3339),
+		DurationMs: duration.Milliseconds(),
+		Target:     target.String(),
+		Git:        collectGitMetadata(),
+	}
+
+	if binary := findServerBinary(outputDir); binary != "" {
+		report.Binary = statArtifact(filepath.Join(outputDir, binary))
+	}
+	if archive := findLatestArchive(outputDir); archive != "" {
+		report.Archive = statArtifact(filepath.Join(outputDir, archive))
+	}
+
+	reportAbs, _ := filepath.Abs(reportPath)
+	err := filepath.WalkDir(outputDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || isArchiveName(d.Name()) {
+			return nil
+		}
+		if abs, _ := filepath.Abs(path); abs == reportAbs {
+			return nil
+		}
+		report.FileCount++
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to count build files: %w", err)
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode build report: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(reportPath), 0755); err != nil {
+		return fmt.Errorf("failed to create report directory: %w", err)
+	}
+	if err := os.WriteFile(reportPath, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write build report: %w", err)
+	}
+
+	PrintSuccess("Build report saved to: %s", reportPath)
+	return nil
+}
+
+// statArtifact returns name and size information for a file, or nil if missing
+func statArtifact(path string) *artifactInfo {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	return &artifactInfo{Name: info.Name(), SizeBytes: info.Size()}
+}
+
+// isArchiveName reports whether a file name is a production archive
+func isArchiveName(name string) bool {
+	return strings.HasPrefix(name, "pb-deployer-production-") && strings.HasSuffix(name, ".zip")
+}
+
+// findLatestArchive returns the name of the most recent production archive in dir
+func findLatestArchive(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+
+	// Archive names embed a sortable timestamp
+	latest := ""
+	for _, entry := range entries {
+		if !entry.IsDir() && isArchiveName(entry.Name()) && entry.Name() > latest {
+			latest = entry.Name()
+		}
+	}
+	return latest
+}
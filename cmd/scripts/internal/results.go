@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Test suite outcomes recorded in the build metadata
+const (
+	TestStatusPassed  = "passed"
+	TestStatusFailed  = "failed"
+	TestStatusSkipped = "skipped"
+)
+
+// junitReportFile is the JUnit report cmd/tests writes into test-reports
+const junitReportFile = "junit.xml"
+
+// TestTotals counts the packages and tests of a test run. Subtests count as
+// tests, as go test reports them.
+type TestTotals struct {
+	Packages int
+	Total    int
+	Passed   int
+	Failed   int
+	Skipped  int
+}
+
+// TestOutcome is what a production build knows about its test run
+type TestOutcome struct {
+	Status      string
+	Totals      TestTotals
+	Coverage    float64
+	HasCoverage bool
+}
+
+// junitSuites is the part of a JUnit report needed for the totals
+type junitSuites struct {
+	Tests    int `xml:"tests,attr"`
+	Failures int `xml:"failures,attr"`
+	Skipped  int `xml:"skipped,attr"`
+	Suites   []struct {
+		Name string `xml:"name,attr"`
+	} `xml:"testsuite"`
+}
+
+// readJUnitTotals reads the totals of the JUnit report written by cmd/tests
+func readJUnitTotals(path string) (TestTotals, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return TestTotals{}, err
+	}
+
+	var report junitSuites
+	if err := xml.Unmarshal(data, &report); err != nil {
+		return TestTotals{}, fmt.Errorf("invalid JUnit report %s: %w", path, err)
+	}
+
+	return TestTotals{
+		Packages: len(report.Suites),
+		Total:    report.Tests,
+		Passed:   report.Tests - report.Failures - report.Skipped,
+		Failed:   report.Failures,
+		Skipped:  report.Skipped,
+	}, nil
+}
+
+// testTotals returns the totals of a run from its JUnit report, falling back
+// to the plain go test output when the suite ran without cmd/tests
+func testTotals(reportsDir, testOutput, testErrors string) TestTotals {
+	if totals, err := readJUnitTotals(filepath.Join(reportsDir, junitReportFile)); err == nil {
+		return totals
+	}
+
+	analysis := AnalyzeTestResults(testOutput, testErrors)
+	totals := TestTotals{
+		Total:   analysis["totalTests"].(int),
+		Passed:  analysis["passedTests"].(int),
+		Failed:  analysis["failedTests"].(int),
+		Skipped: analysis["skippedTests"].(int),
+	}
+	for _, line := range strings.Split(testOutput, "\n") {
+		if strings.HasPrefix(line, "ok  \t") || strings.HasPrefix(line, "FAIL\t") {
+			totals.Packages++
+		}
+	}
+	return totals
+}
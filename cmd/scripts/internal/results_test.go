@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadJUnitTotals(t *testing.T) {
+	report := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites tests="7" failures="1" skipped="2" time="1.234">
+  <testsuite name="./internal/tunnel" tests="5" failures="1" skipped="1" time="1.000"></testsuite>
+  <testsuite name="./cmd/scripts/internal" tests="2" failures="0" skipped="1" time="0.234"></testsuite>
+</testsuites>
+`
+	path := filepath.Join(t.TempDir(), junitReportFile)
+	if err := os.WriteFile(path, []byte(report), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	totals, err := readJUnitTotals(path)
+	if err != nil {
+		t.Fatalf("readJUnitTotals failed: %v", err)
+	}
+	want := TestTotals{Packages: 2, Total: 7, Passed: 4, Failed: 1, Skipped: 2}
+	if totals != want {
+		t.Errorf("Expected %+v, got %+v", want, totals)
+	}
+}
+
+func TestTestTotalsFallsBackToGoTestOutput(t *testing.T) {
+	output := "ok  \tpb-deployer/internal/api\t0.068s\n" +
+		"FAIL\tpb-deployer/internal/tunnel\t0.031s\n" +
+		"?   \tpb-deployer/cmd/server\t[no test files]\n"
+
+	totals := testTotals(t.TempDir(), output, "")
+	if totals.Packages != 2 {
+		t.Errorf("Expected 2 tested packages, got %d", totals.Packages)
+	}
+}
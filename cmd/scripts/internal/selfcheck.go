@@ -0,0 +1,232 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CheckStatus represents the outcome of a single self-check
+type CheckStatus int
+
+const (
+	CheckPass CheckStatus = iota
+	CheckWarn
+	CheckFail
+)
+
+// CheckResult holds the outcome of a single self-check
+type CheckResult struct {
+	Name    string
+	Status  CheckStatus
+	Message string
+}
+
+// SelfCheck validates the local toolchain and environment in depth
+func SelfCheck(rootDir, distDir string) error {
+	PrintHeader("🩺 SELF CHECK")
+
+	var results []CheckResult
+	results = append(results, checkToolchain()...)
+	results = append(results, checkFrontendScripts(filepath.Join(rootDir, "frontend")))
+	results = append(results, checkGoBuild(rootDir))
+	results = append(results, checkSSHAgent())
+	results = append(results, checkSSHPermissions()...)
+	results = append(results, checkDistWritable(filepath.Join(rootDir, distDir)))
+
+	failed := printCheckResults(results)
+	if failed > 0 {
+		return fmt.Errorf("%d self-check(s) failed", failed)
+	}
+
+	PrintSuccess("Environment is ready for build and deploy")
+	return nil
+}
+
+// checkToolchain verifies the required commands are installed
+func checkToolchain() []CheckResult {
+	tools := []struct {
+		name    string
+		command string
+		args    []string
+	}{
+		{"Go", "go", []string{"version"}},
+		{"Node.js", "node", []string{"--version"}},
+		{"npm", "npm", []string{"--version"}},
+		{"Git", "git", []string{"--version"}},
+	}
+
+	var results []CheckResult
+	for _, tool := range tools {
+		if CheckCommand(tool.command, tool.args...) {
+			results = append(results, CheckResult{tool.name, CheckPass, GetCommandOutput(tool.command, tool.args...)})
+		} else {
+			results = append(results, CheckResult{tool.name, CheckFail, "not installed or not in PATH"})
+		}
+	}
+	return results
+}
+
+// checkFrontendScripts verifies package.json defines a build script
+func checkFrontendScripts(frontendDir string) CheckResult {
+	name := "Frontend build script"
+
+	data, err := os.ReadFile(filepath.Join(frontendDir, "package.json"))
+	if err != nil {
+		return CheckResult{name, CheckFail, fmt.Sprintf("cannot read package.json: %v", err)}
+	}
+
+	var pkg struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return CheckResult{name, CheckFail, fmt.Sprintf("invalid package.json: %v", err)}
+	}
+
+	if _, ok := pkg.Scripts["build"]; !ok {
+		return CheckResult{name, CheckFail, "package.json has no \"build\" script"}
+	}
+	return CheckResult{name, CheckPass, fmt.Sprintf("npm run build → %s", pkg.Scripts["build"])}
+}
+
+// checkGoBuild verifies the Go module compiles
+func checkGoBuild(rootDir string) CheckResult {
+	name := "Go build"
+
+	cmd := exec.Command("go", "build", "./...")
+	cmd.Dir = rootDir
+	start := time.Now()
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return CheckResult{name, CheckFail, strings.TrimSpace(string(output))}
+	}
+	return CheckResult{name, CheckPass, fmt.Sprintf("compiled in %v", time.Since(start).Round(time.Millisecond))}
+}
+
+// checkSSHAgent verifies the SSH agent socket is reachable
+func checkSSHAgent() CheckResult {
+	name := "SSH agent"
+
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return CheckResult{name, CheckFail, "SSH_AUTH_SOCK not set. Run: eval $(ssh-agent) && ssh-add"}
+	}
+
+	conn, err := net.DialTimeout("unix", sock, 2*time.Second)
+	if err != nil {
+		return CheckResult{name, CheckFail, fmt.Sprintf("agent not reachable at %s", sock)}
+	}
+	conn.Close()
+
+	if !CheckCommand("ssh-add", "-l") {
+		return CheckResult{name, CheckWarn, "agent reachable but holds no keys. Run: ssh-add"}
+	}
+	return CheckResult{name, CheckPass, "agent reachable with keys loaded"}
+}
+
+// checkSSHPermissions verifies ~/.ssh and private keys are not too permissive
+func checkSSHPermissions() []CheckResult {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return []CheckResult{{"SSH permissions", CheckWarn, fmt.Sprintf("cannot determine home directory: %v", err)}}
+	}
+
+	sshDir := filepath.Join(home, ".ssh")
+	info, err := os.Stat(sshDir)
+	if os.IsNotExist(err) {
+		return []CheckResult{{"SSH permissions", CheckWarn, fmt.Sprintf("%s does not exist", sshDir)}}
+	}
+	if err != nil {
+		return []CheckResult{{"SSH permissions", CheckFail, err.Error()}}
+	}
+
+	var results []CheckResult
+	if info.Mode().Perm()&0077 != 0 {
+		results = append(results, CheckResult{"SSH directory", CheckFail,
+			fmt.Sprintf("%s has mode %04o, expected 0700. Run: chmod 700 %s", sshDir, info.Mode().Perm(), sshDir)})
+	} else {
+		results = append(results, CheckResult{"SSH directory", CheckPass, fmt.Sprintf("%s mode %04o", sshDir, info.Mode().Perm())})
+	}
+
+	entries, err := os.ReadDir(sshDir)
+	if err != nil {
+		return append(results, CheckResult{"SSH keys", CheckWarn, fmt.Sprintf("cannot list %s: %v", sshDir, err)})
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), "id_") || strings.HasSuffix(entry.Name(), ".pub") {
+			continue
+		}
+		keyInfo, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if keyInfo.Mode().Perm()&0077 != 0 {
+			keyPath := filepath.Join(sshDir, entry.Name())
+			results = append(results, CheckResult{"SSH key " + entry.Name(), CheckFail,
+				fmt.Sprintf("mode %04o, expected 0600. Run: chmod 600 %s", keyInfo.Mode().Perm(), keyPath)})
+		}
+	}
+
+	if info, err := os.Stat(filepath.Join(sshDir, "known_hosts")); err == nil && info.Mode().Perm()&0022 != 0 {
+		results = append(results, CheckResult{"known_hosts", CheckWarn,
+			fmt.Sprintf("mode %04o is writable by others", info.Mode().Perm())})
+	}
+
+	return results
+}
+
+// checkDistWritable verifies the dist directory can be written to
+func checkDistWritable(distDir string) CheckResult {
+	name := "Dist directory"
+
+	// Walk up to the nearest existing directory since dist may not exist yet
+	dir := distDir
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return CheckResult{name, CheckFail, fmt.Sprintf("no existing parent for %s", distDir)}
+		}
+		dir = parent
+	}
+
+	probe, err := os.CreateTemp(dir, ".pb-deployer-selfcheck-*")
+	if err != nil {
+		return CheckResult{name, CheckFail, fmt.Sprintf("cannot write to %s: %v", dir, err)}
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	return CheckResult{name, CheckPass, fmt.Sprintf("%s is writable", distDir)}
+}
+
+// printCheckResults prints the checklist and returns the number of failures
+func printCheckResults(results []CheckResult) int {
+	failed := 0
+	warned := 0
+
+	fmt.Println()
+	for _, result := range results {
+		switch result.Status {
+		case CheckPass:
+			fmt.Printf("  %s✓%s %-24s %s%s%s\n", Green, Reset, result.Name, Gray, result.Message, Reset)
+		case CheckWarn:
+			warned++
+			fmt.Printf("  %s⚠%s %-24s %s%s%s\n", Yellow, Reset, result.Name, Yellow, result.Message, Reset)
+		case CheckFail:
+			failed++
+			fmt.Printf("  %s✗%s %-24s %s%s%s\n", Red, Reset, result.Name, Red, result.Message, Reset)
+		}
+	}
+	fmt.Println()
+
+	PrintInfo("Checks: %d passed, %d warnings, %d failed", len(results)-failed-warned, warned, failed)
+	return failed
+}
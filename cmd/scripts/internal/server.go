@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -20,6 +21,27 @@ func RunServer(rootDir string) error {
 	return cmd.Run()
 }
 
+// RunServerContext starts the development server and interrupts it when ctx
+// is cancelled, waiting briefly for it to shut down before killing it
+func RunServerContext(ctx context.Context, rootDir string) error {
+	PrintHeader("🚀 STARTING SERVER")
+
+	cmd := exec.CommandContext(ctx, "go", "run", filepath.Join(rootDir, "cmd/server/main.go"), "serve")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = 5 * time.Second
+
+	PrintStep("🌐", "Server starting...")
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
 // ValidateServerSetup checks if the server directory and files exist
 func ValidateServerSetup(rootDir string) error {
 	PrintStep("🔍", "Validating server setup...")
@@ -11,19 +11,20 @@ import (
 	"time"
 )
 
-// RunTestSuiteAndGenerateReport runs the full test suite and generates reports
-func RunTestSuiteAndGenerateReport(rootDir, outputDir string) error {
+// RunTestSuiteAndGenerateReport runs the full test suite, generates reports
+// and returns the totals of the run
+func RunTestSuiteAndGenerateReport(rootDir, outputDir string) (TestTotals, error) {
 	PrintStep("🧪", "Running test suite...")
 
 	reportsDir := filepath.Join(outputDir, "test-reports")
 	if err := os.MkdirAll(reportsDir, 0755); err != nil {
-		return fmt.Errorf("failed to create test reports directory: %w", err)
+		return TestTotals{}, fmt.Errorf("failed to create test reports directory: %w", err)
 	}
 
 	start := time.Now()
 
 	// Try multiple test execution strategies
-	testOutput, testErrors, testErr, duration := executeTestsWithFallback(rootDir, start)
+	testOutput, testErrors, testErr, duration := executeTestsWithFallback(rootDir, reportsDir, start)
 
 	// Always generate reports regardless of test outcome
 	testStatus := "PASSED"
@@ -48,26 +49,21 @@ func RunTestSuiteAndGenerateReport(rootDir, outputDir string) error {
 	}
 
 	// Print appropriate completion message with analysis
-	analysis := AnalyzeTestResults(testOutput, testErrors)
+	totals := testTotals(reportsDir, testOutput, testErrors)
 
 	if testErr != nil {
 		PrintError("Test suite failed in %v", duration.Round(time.Millisecond))
-		if analysis["totalTests"].(int) > 0 {
-			PrintInfo("Failed: %d, Passed: %d, Total: %d",
-				analysis["failedTests"].(int),
-				analysis["passedTests"].(int),
-				analysis["totalTests"].(int))
+		if totals.Total > 0 {
+			PrintInfo("Failed: %d, Passed: %d, Total: %d", totals.Failed, totals.Passed, totals.Total)
 		}
 		PrintInfo("Reports generated in: %s", reportsDir)
-		return fmt.Errorf("test suite failed: %w", testErr)
+		return totals, fmt.Errorf("test suite failed: %w", testErr)
 	} else {
 		PrintSuccess("Test suite completed successfully in %v", duration.Round(time.Millisecond))
-		if analysis["totalTests"].(int) > 0 {
-			PrintInfo("Passed: %d, Total: %d",
-				analysis["passedTests"].(int),
-				analysis["totalTests"].(int))
+		if totals.Total > 0 {
+			PrintInfo("Passed: %d, Total: %d", totals.Passed, totals.Total)
 		}
-		return nil
+		return totals, nil
 	}
 }
 
@@ -87,7 +83,7 @@ func TestOnlyMode(rootDir, distDir string) error {
 		// Still try to run tests in case they exist elsewhere
 	}
 
-	if err := RunTestSuiteAndGenerateReport(rootDir, outputDir); err != nil {
+	if _, err := RunTestSuiteAndGenerateReport(rootDir, outputDir); err != nil {
 		return fmt.Errorf("test suite failed: %w", err)
 	}
 
@@ -315,18 +311,30 @@ func GenerateEnhancedTestReport(rootDir, reportsDir string, duration time.Durati
 
 // ValidateTestEnvironment checks if the test environment is properly set up
 // executeTestsWithFallback tries multiple strategies to execute tests
-func executeTestsWithFallback(rootDir string, start time.Time) (string, string, error, time.Duration) {
+// The first two strategies write the merged coverage profile to
+// reportsDir/coverage.out, and cmd/tests also writes reportsDir/junit.xml.
+func executeTestsWithFallback(rootDir, reportsDir string, start time.Time) (string, string, error, time.Duration) {
+	if abs, err := filepath.Abs(reportsDir); err == nil {
+		reportsDir = abs
+	}
+	coverProfile := filepath.Join(reportsDir, coverageProfileFile)
+	junitReport := filepath.Join(reportsDir, junitReportFile)
+	os.Remove(coverProfile)
+	os.Remove(junitReport)
+
 	strategies := []struct {
 		name string
 		cmd  func() *exec.Cmd
 	}{
 		{
 			name: "go run ./cmd/tests",
-			cmd:  func() *exec.Cmd { return exec.Command("go", "run", "./cmd/tests") },
+			cmd: func() *exec.Cmd {
+				return exec.Command("go", "run", "./cmd/tests", "-coverprofile", coverProfile, "-junit", junitReport)
+			},
 		},
 		{
 			name: "go test ./...",
-			cmd:  func() *exec.Cmd { return exec.Command("go", "test", "./...") },
+			cmd:  func() *exec.Cmd { return exec.Command("go", "test", "-coverprofile="+coverProfile, "./...") },
 		},
 		{
 			name: "go test .",
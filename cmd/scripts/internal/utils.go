@@ -2,6 +2,8 @@ package internal
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"runtime"
 	"strings"
 	"time"
@@ -20,27 +22,25 @@ const (
 	Bold   = "\033[1m"
 )
 
-// PrintBanner displays the application banner with operation type
-func PrintBanner(operation string) {
-	fmt.Printf("\n%s▲ pb-deployer%s %sv1.0.0%s\n", Bold, Reset, Gray, Reset)
+// PrintBanner displays the application banner with version and operation type
+func PrintBanner(operation, version string) {
+	fmt.Printf("\n%s▲ pb-deployer%s %s%s%s\n", Bold, Reset, Gray, version, Reset)
 	fmt.Printf("%s%s%s\n\n", Gray, strings.ToLower(operation), Reset)
 }
 
 // PrintHeader displays a section header
 func PrintHeader(title string) {
-	fmt.Printf("\n%s%s%s\n", Bold, title, Reset)
+	fprintHeader(os.Stdout, title)
 }
 
 // PrintStep displays a step with emoji and message
 func PrintStep(emoji, format string, args ...any) {
-	message := fmt.Sprintf(format, args...)
-	fmt.Printf("%s %s\n", emoji, message)
+	fprintStep(os.Stdout, emoji, format, args...)
 }
 
 // PrintSuccess displays a success message
 func PrintSuccess(format string, args ...any) {
-	message := fmt.Sprintf(format, args...)
-	fmt.Printf("%s✓%s %s\n", Green, Reset, message)
+	fprintSuccess(os.Stdout, format, args...)
 }
 
 // PrintError displays an error message
@@ -51,14 +51,41 @@ func PrintError(format string, args ...any) {
 
 // PrintWarning displays a warning message
 func PrintWarning(format string, args ...any) {
-	message := fmt.Sprintf(format, args...)
-	fmt.Printf("%s⚠ Warning:%s %s\n", Yellow, Reset, message)
+	fprintWarning(os.Stdout, format, args...)
 }
 
 // PrintInfo displays an info message
 func PrintInfo(format string, args ...any) {
+	fprintInfo(os.Stdout, format, args...)
+}
+
+// fprintHeader writes a section header to w
+func fprintHeader(w io.Writer, title string) {
+	fmt.Fprintf(w, "\n%s%s%s\n", Bold, title, Reset)
+}
+
+// fprintStep writes a step with emoji and message to w
+func fprintStep(w io.Writer, emoji, format string, args ...any) {
 	message := fmt.Sprintf(format, args...)
-	fmt.Printf("%sℹ%s %s\n", Cyan, Reset, message)
+	fmt.Fprintf(w, "%s %s\n", emoji, message)
+}
+
+// fprintSuccess writes a success message to w
+func fprintSuccess(w io.Writer, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	fmt.Fprintf(w, "%s✓%s %s\n", Green, Reset, message)
+}
+
+// fprintWarning writes a warning message to w
+func fprintWarning(w io.Writer, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	fmt.Fprintf(w, "%s⚠ Warning:%s %s\n", Yellow, Reset, message)
+}
+
+// fprintInfo writes an info message to w
+func fprintInfo(w io.Writer, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	fmt.Fprintf(w, "%sℹ%s %s\n", Cyan, Reset, message)
 }
 
 // PrintBuildSummary displays a summary of the build process
@@ -98,8 +125,8 @@ func PrintTestSummary(duration time.Duration) {
 }
 
 // ShowHelp displays the help information
-func ShowHelp() {
-	fmt.Printf("\n%s▲ pb-deployer%s %sv1.0.0%s\n", Bold, Reset, Gray, Reset)
+func ShowHelp(version string) {
+	fmt.Printf("\n%s▲ pb-deployer%s %s%s%s\n", Bold, Reset, Gray, version, Reset)
 	fmt.Printf("%sModern deployment automation tool%s\n\n", Gray, Reset)
 
 	fmt.Printf("%sUSAGE:%s\n", Bold, Reset)
@@ -112,7 +139,16 @@ func ShowHelp() {
 	fmt.Printf("  %s--build-only%s    Build frontend without running server\n", Green, Reset)
 	fmt.Printf("  %s--run-only%s      Run server without building frontend\n", Green, Reset)
 	fmt.Printf("  %s--test-only%s     Run test suite and generate reports\n", Green, Reset)
+	fmt.Printf("  %s--selfcheck%s     Validate local toolchain and environment\n", Green, Reset)
 	fmt.Printf("  %s--dist DIR%s      Specify output directory (default: dist)\n", Green, Reset)
+	fmt.Printf("  %s--build-dir DIR%s Frontend build output dir (default: build, dist, static)\n", Green, Reset)
+	fmt.Printf("  %s--force-build%s   Rebuild frontend even if sources are unchanged\n", Green, Reset)
+	fmt.Printf("  %s--watch%s         Rebuild frontend on changes while the server runs\n", Green, Reset)
+	fmt.Printf("  %s--target OS/ARCH%s Cross-compile server binary (e.g. linux/amd64)\n", Green, Reset)
+	fmt.Printf("  %s--report-json PATH%s Write JSON build report to PATH (production)\n", Green, Reset)
+	fmt.Printf("  %s--min-coverage PCT%s Fail below PCT total coverage (production)\n", Green, Reset)
+	fmt.Printf("  %s--skip-tests%s    Skip tests for an unvalidated hotfix build (production)\n", Green, Reset)
+	fmt.Printf("  %s--parallel-build%s Build frontend and binary concurrently (production)\n", Green, Reset)
 
 	fmt.Printf("\n%sEXAMPLES:%s\n", Bold, Reset)
 	fmt.Printf("  %s# Development mode (default)%s\n", Gray, Reset)
@@ -124,12 +160,27 @@ func ShowHelp() {
 	fmt.Printf("  %s# Production build%s\n", Gray, Reset)
 	fmt.Printf("  go run ./cmd/scripts --production --install\n\n")
 
+	fmt.Printf("  %s# Production build for a linux/amd64 server%s\n", Gray, Reset)
+	fmt.Printf("  go run ./cmd/scripts --production --target linux/amd64\n\n")
+
+	fmt.Printf("  %s# Production build with concurrent frontend/binary builds%s\n", Gray, Reset)
+	fmt.Printf("  go run ./cmd/scripts --production --parallel-build\n\n")
+
+	fmt.Printf("  %s# Development server with frontend rebuilds on save%s\n", Gray, Reset)
+	fmt.Printf("  go run ./cmd/scripts --watch\n\n")
+
 	fmt.Printf("  %s# Build only (no server)%s\n", Gray, Reset)
 	fmt.Printf("  go run ./cmd/scripts --build-only\n\n")
 
 	fmt.Printf("  %s# Run tests only%s\n", Gray, Reset)
 	fmt.Printf("  go run ./cmd/scripts --test-only\n\n")
 
+	fmt.Printf("  %s# Check local environment%s\n", Gray, Reset)
+	fmt.Printf("  go run ./cmd/scripts --selfcheck\n\n")
+
+	fmt.Printf("  %s# SvelteKit adapter output%s\n", Gray, Reset)
+	fmt.Printf("  go run ./cmd/scripts --production --build-dir .svelte-kit/output/client\n\n")
+
 	fmt.Printf("  %s# Custom dist directory%s\n", Gray, Reset)
 	fmt.Printf("  go run ./cmd/scripts --production --dist release\n\n")
 
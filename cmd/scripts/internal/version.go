@@ -0,0 +1,25 @@
+package internal
+
+import "time"
+
+// defaultVersion is reported by builds that are not at a release tag
+const defaultVersion = "dev"
+
+// BuildVersion returns the version stamped into a production build: the git
+// tag HEAD is at (or PB_DEPLOYER_GIT_TAG) for a release, "dev" otherwise
+func BuildVersion() string {
+	if tag := collectGitMetadata().Tag; tag != "" {
+		return tag
+	}
+	return defaultVersion
+}
+
+// serverLDFlags returns the linker flags for cmd/server: stripped symbols
+// plus the version, commit and build time its main package reports
+func serverLDFlags(buildTime time.Time) string {
+	flags := "-s -w -X main.Version=" + BuildVersion()
+	if commit := collectGitMetadata().Commit; commit != "" {
+		flags += " -X main.Commit=" + commit
+	}
+	return flags + " -X main.BuildTime=" + buildTime.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// watchInterval is how often the frontend sources are re-hashed
+	watchInterval = 500 * time.Millisecond
+	// watchDebounce is how long sources must stay unchanged before a rebuild,
+	// so a burst of saves triggers a single build
+	watchDebounce = 300 * time.Millisecond
+)
+
+// WatchFrontend rebuilds the frontend into pb_public whenever its sources
+// change, until ctx is cancelled. Changes are detected by polling the same
+// source hash used for the build cache. A failed rebuild is reported and the
+// watch continues.
+func WatchFrontend(ctx context.Context, rootDir string, opts FrontendOptions) error {
+	frontendDir := filepath.Join(rootDir, "frontend")
+	task := &buildTask{ctx: ctx, out: os.Stdout}
+
+	last, err := ComputeFrontendHash(frontendDir, opts.BuildDir)
+	if err != nil {
+		PrintWarning("Failed to hash frontend sources: %v", err)
+	}
+
+	PrintInfo("Watching %s for changes (Ctrl-C to stop)", frontendDir)
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	var pending string
+	var changedAt time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		hash, err := ComputeFrontendHash(frontendDir, opts.BuildDir)
+		if err != nil {
+			// Editors briefly remove files while saving
+			continue
+		}
+		if hash == last {
+			pending = ""
+			continue
+		}
+		if hash != pending {
+			pending, changedAt = hash, time.Now()
+			continue
+		}
+		if time.Since(changedAt) < watchDebounce {
+			continue
+		}
+
+		last, pending = hash, ""
+		start := time.Now()
+		if err := task.buildFrontendCore(frontendDir); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			PrintError("Rebuild failed: %v", err)
+			continue
+		}
+		if err := task.copyFrontendToPbPublic(rootDir, frontendDir, opts.BuildDir); err != nil {
+			PrintError("Rebuild failed: %v", err)
+			continue
+		}
+		if err := writeBuildCache(rootDir, hash); err != nil {
+			PrintWarning("Failed to write build cache: %v", err)
+		}
+
+		PrintSuccess("Rebuilt in %dms", time.Since(start).Milliseconds())
+	}
+}
@@ -1,14 +1,21 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"pb-deployer/cmd/scripts/internal"
 )
 
+// Version is reported in the banner and help, set with
+// -ldflags "-X main.Version=..."
+var Version = "dev"
+
 func main() {
 	// Parse command line flags
 	installDeps := flag.Bool("install", false, "Install project dependencies")
@@ -16,13 +23,22 @@ func main() {
 	runOnly := flag.Bool("run-only", false, "Run the server without building the frontend")
 	production := flag.Bool("production", false, "Create a production build in dist folder")
 	testOnly := flag.Bool("test-only", false, "Run test suite and generate reports only")
+	selfCheck := flag.Bool("selfcheck", false, "Validate the local toolchain and environment")
+	parallelBuild := flag.Bool("parallel-build", false, "Build frontend and server binary concurrently (production only)")
+	target := flag.String("target", "", "Cross-compile the server binary for GOOS/GOARCH (e.g. linux/amd64)")
+	buildDir := flag.String("build-dir", "", "Frontend build output directory, relative to frontend/ (default: auto-detect)")
+	forceBuild := flag.Bool("force-build", false, "Rebuild the frontend even if sources are unchanged")
+	reportJSON := flag.String("report-json", "", "Path for the JSON build report (default: <dist>/build-report.json)")
+	minCoverage := flag.Float64("min-coverage", 0, "Fail the production build below this total test coverage percent (default: off)")
+	skipTests := flag.Bool("skip-tests", false, "Skip the test suite in a production build (unvalidated hotfix builds)")
 	distDir := flag.String("dist", "dist", "Output directory for production build")
+	watch := flag.Bool("watch", false, "Rebuild the frontend on source changes while the server runs")
 	help := flag.Bool("help", false, "Show help and usage information")
 	flag.Parse()
 
 	// Show help if requested
 	if *help {
-		internal.ShowHelp()
+		internal.ShowHelp(Version)
 		return
 	}
 
@@ -32,8 +48,10 @@ func main() {
 		operation = "PRODUCTION"
 	} else if *testOnly {
 		operation = "TESTING"
+	} else if *selfCheck {
+		operation = "SELF CHECK"
 	}
-	internal.PrintBanner(operation)
+	internal.PrintBanner(operation, Version)
 
 	// Get root directory
 	rootDir, err := os.Getwd()
@@ -42,20 +60,45 @@ func main() {
 		os.Exit(1)
 	}
 
+	frontendOpts := internal.FrontendOptions{
+		InstallDeps: *installDeps,
+		BuildDir:    *buildDir,
+		Force:       *forceBuild,
+	}
+
 	// Execute the appropriate operation
 	start := time.Now()
 
 	switch {
+	case *selfCheck:
+		err = internal.SelfCheck(rootDir, *distDir)
 	case *testOnly:
 		err = handleTestOnlyMode(rootDir, *distDir)
 	case *production:
-		err = handleProductionMode(rootDir, *installDeps, *distDir)
+		var buildTarget internal.BuildTarget
+		buildTarget, err = internal.ParseBuildTarget(*target)
+		if err != nil {
+			break
+		}
+		err = handleProductionMode(rootDir, internal.ProductionOptions{
+			InstallDeps: *installDeps,
+			DistDir:     *distDir,
+			Parallel:    *parallelBuild,
+			Target:      buildTarget,
+			BuildDir:    *buildDir,
+			ForceBuild:  *forceBuild,
+			ReportJSON:  *reportJSON,
+			MinCoverage: *minCoverage,
+			SkipTests:   *skipTests,
+		})
 	case *buildOnly:
-		err = handleBuildOnlyMode(rootDir, *installDeps)
+		err = handleBuildOnlyMode(rootDir, frontendOpts)
 	case *runOnly:
 		err = handleRunOnlyMode(rootDir)
+	case *watch:
+		err = handleWatchMode(rootDir, frontendOpts)
 	default:
-		err = handleDevelopmentMode(rootDir, *installDeps)
+		err = handleDevelopmentMode(rootDir, frontendOpts)
 	}
 
 	if err != nil {
@@ -64,7 +107,7 @@ func main() {
 	}
 
 	// Print completion summary for non-server modes
-	if !*runOnly && !isServerMode() {
+	if !*runOnly && !*selfCheck && !isServerMode() {
 		duration := time.Since(start)
 		if *production {
 			internal.PrintBuildSummary(duration, true)
@@ -88,21 +131,21 @@ func handleTestOnlyMode(rootDir, distDir string) error {
 }
 
 // handleProductionMode creates a complete production build
-func handleProductionMode(rootDir string, installDeps bool, distDir string) error {
+func handleProductionMode(rootDir string, opts internal.ProductionOptions) error {
 	internal.PrintHeader("🚀 PRODUCTION MODE")
 
-	return internal.ProductionBuild(rootDir, installDeps, distDir)
+	return internal.ProductionBuild(rootDir, opts)
 }
 
 // handleBuildOnlyMode builds the frontend without starting the server
-func handleBuildOnlyMode(rootDir string, installDeps bool) error {
+func handleBuildOnlyMode(rootDir string, opts internal.FrontendOptions) error {
 	internal.PrintHeader("🔨 BUILD MODE")
 
 	if err := internal.CheckSystemRequirements(); err != nil {
 		return fmt.Errorf("system requirements not met: %w", err)
 	}
 
-	return internal.BuildFrontend(rootDir, installDeps)
+	return internal.BuildFrontend(rootDir, opts)
 }
 
 // handleRunOnlyMode starts the server without building
@@ -125,7 +168,7 @@ func handleRunOnlyMode(rootDir string) error {
 }
 
 // handleDevelopmentMode is the default mode - build frontend and start server
-func handleDevelopmentMode(rootDir string, installDeps bool) error {
+func handleDevelopmentMode(rootDir string, opts internal.FrontendOptions) error {
 	internal.PrintHeader("🛠️ DEVELOPMENT MODE")
 
 	if err := internal.CheckSystemRequirements(); err != nil {
@@ -133,7 +176,7 @@ func handleDevelopmentMode(rootDir string, installDeps bool) error {
 	}
 
 	// Build frontend first
-	if err := internal.BuildFrontend(rootDir, installDeps); err != nil {
+	if err := internal.BuildFrontend(rootDir, opts); err != nil {
 		return fmt.Errorf("frontend build failed: %w", err)
 	}
 
@@ -152,13 +195,57 @@ func handleDevelopmentMode(rootDir string, installDeps bool) error {
 	return internal.RunServer(rootDir)
 }
 
+// handleWatchMode builds the frontend, starts the server and rebuilds the
+// frontend on source changes until interrupted
+func handleWatchMode(rootDir string, opts internal.FrontendOptions) error {
+	internal.PrintHeader("👀 WATCH MODE")
+
+	if err := internal.CheckSystemRequirements(); err != nil {
+		return fmt.Errorf("system requirements not met: %w", err)
+	}
+
+	if err := internal.BuildFrontend(rootDir, opts); err != nil {
+		return fmt.Errorf("frontend build failed: %w", err)
+	}
+
+	if err := internal.ValidateServerSetup(rootDir); err != nil {
+		return fmt.Errorf("server setup validation failed: %w", err)
+	}
+
+	if err := internal.PrepareServerEnvironment(rootDir); err != nil {
+		return fmt.Errorf("server environment preparation failed: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Stop watching if the server exits on its own
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		defer cancel()
+		serverErr <- internal.RunServerContext(ctx, rootDir)
+	}()
+
+	watchErr := internal.WatchFrontend(ctx, rootDir, opts)
+	cancel()
+
+	if err := <-serverErr; err != nil {
+		return fmt.Errorf("server failed: %w", err)
+	}
+	return watchErr
+}
+
 // isServerMode checks if we're in a mode that starts the server
 func isServerMode() bool {
 	runOnly := flag.Lookup("run-only").Value.String() == "true"
 	production := flag.Lookup("production").Value.String() == "true"
 	buildOnly := flag.Lookup("build-only").Value.String() == "true"
 	testOnly := flag.Lookup("test-only").Value.String() == "true"
+	selfCheck := flag.Lookup("selfcheck").Value.String() == "true"
 
 	// Server runs in default mode (development) and run-only mode
-	return runOnly || (!production && !buildOnly && !testOnly)
+	return runOnly || (!production && !buildOnly && !testOnly && !selfCheck)
 }
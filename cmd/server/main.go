@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 
 	app "github.com/magooney-loon/pb-ext/core"
@@ -12,10 +13,24 @@ import (
 	"pb-deployer/internal/models"
 )
 
+// Build metadata, set by the production build with
+// -ldflags "-X main.Version=... -X main.Commit=... -X main.BuildTime=..."
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
 func main() {
 	devMode := flag.Bool("dev", false, "Run in developer mode")
+	version := flag.Bool("version", false, "Print version information and exit")
 	flag.Parse()
 
+	if *version {
+		fmt.Print(buildInfo())
+		return
+	}
+
 	initApp(*devMode)
 }
 
@@ -57,8 +72,13 @@ func initApp(devMode bool) {
 
 func registerCollections(app core.App) {
 	models.RegisterCollections(app)
+	models.RegisterEncryption(app)
 }
 
 func registerHandlers(app core.App) {
-	api.RegisterHandlers(app)
+	api.RegisterHandlers(app, buildInfo())
+}
+
+func buildInfo() api.BuildInfo {
+	return api.NewBuildInfo(Version, Commit, BuildTime)
 }
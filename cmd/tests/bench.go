@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// benchThreshold is the ns/op change, in percent, below which a difference
+// is treated as noise
+const benchThreshold = 5.0
+
+// BenchResult is one benchmark's measurements, as stored in the baseline
+type BenchResult struct {
+	NsPerOp     float64 `json:"ns_per_op"`
+	BytesPerOp  float64 `json:"bytes_per_op"`
+	AllocsPerOp float64 `json:"allocs_per_op"`
+}
+
+// benchLineRegex matches a go test -benchmem result line. The -N GOMAXPROCS
+// suffix is dropped from the name so baselines compare across machines.
+var benchLineRegex = regexp.MustCompile(`^(Benchmark\S+?)(?:-\d+)?\s+\d+\s+(\d+(?:\.\d+)?) ns/op`)
+
+var (
+	benchBytesRegex  = regexp.MustCompile(`(\d+(?:\.\d+)?) B/op`)
+	benchAllocsRegex = regexp.MustCompile(`(\d+(?:\.\d+)?) allocs/op`)
+)
+
+// parseBenchOutput returns the benchmark results in go test output, keyed
+// by "package name"
+func parseBenchOutput(packagePath, output string, results map[string]BenchResult) {
+	for _, line := range strings.Split(output, "\n") {
+		matches := benchLineRegex.FindStringSubmatch(strings.TrimSpace(line))
+		if matches == nil {
+			continue
+		}
+
+		var result BenchResult
+		result.NsPerOp, _ = strconv.ParseFloat(matches[2], 64)
+		if m := benchBytesRegex.FindStringSubmatch(line); m != nil {
+			result.BytesPerOp, _ = strconv.ParseFloat(m[1], 64)
+		}
+		if m := benchAllocsRegex.FindStringSubmatch(line); m != nil {
+			result.AllocsPerOp, _ = strconv.ParseFloat(m[1], 64)
+		}
+		results[packagePath+" "+matches[1]] = result
+	}
+}
+
+// runBenchmarks runs the benchmarks of each package one at a time, since
+// concurrent packages would skew each other's timings
+func runBenchmarks(packages []string) (map[string]BenchResult, bool) {
+	fmt.Printf("⏱  %sRunning benchmarks in %d package(s)%s\n", Bold, len(packages), Reset)
+	fmt.Println()
+
+	results := make(map[string]BenchResult)
+	success := true
+	for i, pkg := range packages {
+		fmt.Printf("├─ %s[%d/%d]%s %s%s%s\n", Dim, i+1, len(packages), Reset, Bold, pkg, Reset)
+
+		output, err := exec.Command("go", "test", "-run=^$", "-bench=.", "-benchmem", pkg).CombinedOutput()
+		before := len(results)
+		parseBenchOutput(pkg, string(output), results)
+
+		if err != nil {
+			success = false
+			fmt.Printf("│  %s✗ Benchmarks failed%s\n", Red, Reset)
+			for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+				fmt.Printf("│  %s%s%s\n", Red, line, Reset)
+			}
+		} else {
+			fmt.Printf("│  %s%d benchmark(s)%s\n", Gray, len(results)-before, Reset)
+		}
+		fmt.Println("│")
+	}
+
+	return results, success
+}
+
+// loadBenchBaseline reads a saved baseline, returning nil if there is none
+func loadBenchBaseline(path string) (map[string]BenchResult, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var baseline map[string]BenchResult
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return nil, fmt.Errorf("invalid benchmark baseline %s: %w", path, err)
+	}
+	return baseline, nil
+}
+
+func saveBenchBaseline(path string, results map[string]BenchResult) error {
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// printBenchResults prints each benchmark and, when a baseline has it, the
+// change in ns/op and allocs/op
+func printBenchResults(results, baseline map[string]BenchResult) {
+	names := make([]string, 0, len(results))
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Println()
+	fmt.Printf("📈 %sBenchmarks%s\n", Bold, Reset)
+
+	var regressions, improvements int
+	for _, name := range names {
+		current := results[name]
+		line := fmt.Sprintf("   %-60s %12s %10s",
+			name, formatNs(current.NsPerOp), fmt.Sprintf("%.0f allocs", current.AllocsPerOp))
+
+		old, ok := baseline[name]
+		if !ok || old.NsPerOp == 0 {
+			if baseline != nil {
+				line += fmt.Sprintf("  %snew%s", Cyan, Reset)
+			}
+			fmt.Println(line)
+			continue
+		}
+
+		delta := (current.NsPerOp - old.NsPerOp) / old.NsPerOp * 100
+		color, mark := Gray, "~"
+		switch {
+		case delta > benchThreshold:
+			color, mark = Red, "regression"
+			regressions++
+		case delta < -benchThreshold:
+			color, mark = Green, "improvement"
+			improvements++
+		}
+		line += fmt.Sprintf("  %s%+6.1f%% %s%s", color, delta, mark, Reset)
+		if current.AllocsPerOp != old.AllocsPerOp {
+			line += fmt.Sprintf("  %sallocs %.0f → %.0f%s", Yellow, old.AllocsPerOp, current.AllocsPerOp, Reset)
+		}
+		fmt.Println(line)
+	}
+
+	if baseline != nil {
+		fmt.Println()
+		fmt.Printf("   %s%d regression(s), %d improvement(s) beyond ±%.0f%%%s\n",
+			Gray, regressions, improvements, benchThreshold, Reset)
+	}
+	fmt.Println()
+}
+
+func formatNs(ns float64) string {
+	switch {
+	case ns >= 1e9:
+		return fmt.Sprintf("%.2fs/op", ns/1e9)
+	case ns >= 1e6:
+		return fmt.Sprintf("%.2fms/op", ns/1e6)
+	case ns >= 1e3:
+		return fmt.Sprintf("%.2fµs/op", ns/1e3)
+	default:
+		return fmt.Sprintf("%.1fns/op", ns)
+	}
+}
+
+// runBenchMode runs the benchmarks, compares them with the baseline at
+// baselinePath if it exists and saves them as the new baseline if save is
+// set. It returns the process exit code.
+func runBenchMode(packages []string, baselinePath string, save bool) int {
+	baseline, err := loadBenchBaseline(baselinePath)
+	if err != nil {
+		printError("Benchmark baseline unreadable", err.Error())
+		return 1
+	}
+
+	results, success := runBenchmarks(packages)
+	if len(results) == 0 {
+		printWarning("No benchmarks found")
+		if success {
+			return 0
+		}
+		return 1
+	}
+
+	if baseline == nil && !save {
+		fmt.Printf("   %sNo baseline at %s; use -bench-save to create one%s\n", Gray, baselinePath, Reset)
+	}
+	printBenchResults(results, baseline)
+
+	if save {
+		if err := saveBenchBaseline(baselinePath, results); err != nil {
+			printError("Saving benchmark baseline failed", err.Error())
+			return 1
+		}
+		fmt.Printf("💾 %sBaseline saved to %s%s\n", Gray, baselinePath, Reset)
+		fmt.Println()
+	}
+
+	if !success {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// coverProfileName returns the per-package profile file name in the
+// temporary coverage directory
+func coverProfileName(packagePath string) string {
+	return strings.NewReplacer("/", "_", ".", "_").Replace(strings.TrimPrefix(packagePath, "./")) + ".out"
+}
+
+// mergeCoverProfiles concatenates the per-package profiles in dir into one
+// profile at path, keeping only the first "mode:" line as go tool cover
+// expects
+func mergeCoverProfiles(dir, path string) error {
+	profiles, err := filepath.Glob(filepath.Join(dir, "*.out"))
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create coverage directory: %w", err)
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create coverage profile: %w", err)
+	}
+	defer out.Close()
+
+	w := bufio.NewWriter(out)
+	wroteMode := false
+	for _, profile := range profiles {
+		data, err := os.ReadFile(profile)
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+			if strings.HasPrefix(line, "mode:") {
+				if wroteMode {
+					continue
+				}
+				wroteMode = true
+			}
+			if line != "" {
+				fmt.Fprintln(w, line)
+			}
+		}
+	}
+	if !wroteMode {
+		fmt.Fprintln(w, "mode: set")
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write coverage profile: %w", err)
+	}
+	return nil
+}
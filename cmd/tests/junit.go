@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+	SystemOut string          `xml:"system-out,omitempty"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Content string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+// writeJUnitReport serializes the suite results as JUnit XML to path
+func writeJUnitReport(suite TestSuite, path string) error {
+	report := junitTestSuites{
+		Tests:    suite.TotalTests,
+		Failures: suite.TotalFailed,
+		Time:     fmt.Sprintf("%.3f", suite.Duration.Seconds()),
+	}
+
+	for _, result := range suite.Results {
+		ts := junitTestSuite{
+			Name:     result.Package,
+			Tests:    len(result.Tests),
+			Failures: result.Failed,
+			Skipped:  result.Skipped,
+			Time:     fmt.Sprintf("%.3f", result.Duration.Seconds()),
+		}
+		report.Skipped += result.Skipped
+
+		for _, tc := range result.Tests {
+			testCase := junitTestCase{
+				Name:      tc.Name,
+				ClassName: result.Package,
+				Time:      fmt.Sprintf("%.3f", tc.Duration.Seconds()),
+			}
+
+			switch tc.Status {
+			case "fail":
+				testCase.Failure = &junitFailure{
+					Message: "test failed",
+					Content: testOutputFor(result.Output, tc.Name),
+				}
+			case "skip":
+				testCase.Skipped = &junitSkipped{}
+			}
+
+			ts.TestCases = append(ts.TestCases, testCase)
+		}
+
+		// A package can fail without any failing test, e.g. on a build error
+		if !result.Success && result.Failed == 0 {
+			ts.Failures++
+			ts.TestCases = append(ts.TestCases, junitTestCase{
+				Name:      "package",
+				ClassName: result.Package,
+				Time:      ts.Time,
+				Failure: &junitFailure{
+					Message: "package failed",
+					Content: strings.Join(result.Output, "\n"),
+				},
+			})
+			report.Failures++
+			report.Tests++
+			ts.Tests++
+		}
+
+		report.Suites = append(report.Suites, ts)
+	}
+
+	data, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode JUnit report: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create report directory: %w", err)
+	}
+
+	data = append([]byte(xml.Header), data...)
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write JUnit report: %w", err)
+	}
+
+	return nil
+}
+
+// testOutputFor returns the output lines go test printed for a single test,
+// from its "=== RUN" line up to and including its result line
+func testOutputFor(output []string, name string) string {
+	var lines []string
+	capturing := false
+
+	for _, line := range output {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "=== RUN") && strings.TrimSpace(strings.TrimPrefix(trimmed, "=== RUN")) == name {
+			capturing = true
+		}
+		if capturing {
+			lines = append(lines, line)
+			if strings.HasPrefix(trimmed, "--- FAIL: "+name+" ") || trimmed == "--- FAIL: "+name {
+				break
+			}
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
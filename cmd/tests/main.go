@@ -1,20 +1,82 @@
 package main
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
-func getTestPackages() []string {
-	return []string{
-		"./internal/api",
-		"./internal/logger",
-		"./internal/tunnel",
+// stringList is a repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// getTestPackages discovers every package in the module that contains tests,
+// optionally restricted to include and with exclude paths removed
+func getTestPackages(include, exclude []string) ([]string, error) {
+	cmd := exec.Command("go", "list", "-f", "{{if or .TestGoFiles .XTestGoFiles}}{{.Dir}}{{end}}", "./...")
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("go list failed: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("go list failed: %v", err)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
 	}
+
+	var packages []string
+	for _, dir := range strings.Fields(string(output)) {
+		rel, err := filepath.Rel(cwd, dir)
+		if err != nil {
+			continue
+		}
+		pkg := "./" + filepath.ToSlash(rel)
+
+		if len(include) > 0 && !matchesAnyPath(pkg, include) {
+			continue
+		}
+		if matchesAnyPath(pkg, exclude) {
+			continue
+		}
+		packages = append(packages, pkg)
+	}
+
+	sort.Strings(packages)
+	return packages, nil
+}
+
+// matchesAnyPath reports whether pkg equals or lives under any of the paths
+func matchesAnyPath(pkg string, paths []string) bool {
+	for _, p := range paths {
+		p = "./" + strings.TrimPrefix(strings.TrimSuffix(filepath.ToSlash(p), "/"), "./")
+		p = strings.TrimSuffix(p, "/...")
+		if pkg == p || strings.HasPrefix(pkg, p+"/") {
+			return true
+		}
+	}
+	return false
 }
 
 const (
@@ -30,6 +92,14 @@ const (
 	Dim    = "\033[2m"
 )
 
+// TestCase holds the outcome of a single test function or subtest
+type TestCase struct {
+	Name        string
+	Status      string
+	Duration    time.Duration
+	HasDuration bool
+}
+
 type TestResult struct {
 	Package     string
 	Passed      int
@@ -39,35 +109,125 @@ type TestResult struct {
 	Success     bool
 	Output      []string
 	FailedTests []string
+	// Flaky lists tests that failed and then passed when retried
+	Flaky []string
+	Tests []TestCase
+}
+
+// testOptions are the go test settings shared by every package run
+type testOptions struct {
+	race bool
+	// coverDir collects a coverage profile per package when set
+	coverDir string
+}
+
+// testArgs returns the go test arguments for a package
+func testArgs(packagePath string, opts testOptions) []string {
+	args := []string{"test", "-v"}
+	if opts.race {
+		args = append(args, "-race")
+	}
+	if opts.coverDir != "" {
+		args = append(args, "-coverprofile="+filepath.Join(opts.coverDir, coverProfileName(packagePath)))
+	}
+	return append(args, packagePath)
 }
 
 type TestSuite struct {
 	Results     []TestResult
 	TotalPassed int
 	TotalFailed int
+	TotalFlaky  int
 	TotalTests  int
 	Duration    time.Duration
 	Success     bool
 }
 
 func main() {
+	jobs := flag.Int("jobs", runtime.NumCPU(), "Number of test packages to run concurrently")
+	junitPath := flag.String("junit", "", "Write a JUnit XML report to the given path")
+	race := flag.Bool("race", false, "Run tests with the race detector")
+	vet := flag.Bool("vet", false, "Run go vet ./... first and fail the suite on its findings")
+	bench := flag.Bool("bench", false, "Run benchmarks instead of tests and compare them with the baseline")
+	benchBaseline := flag.String("bench-baseline", ".bench-baseline.json", "Benchmark baseline file used by -bench")
+	benchSave := flag.Bool("bench-save", false, "Save the -bench results as the new baseline")
+	retryFailed := flag.Int("retry-failed", 0, "Re-run failed packages up to N times and report tests that pass on retry as flaky")
+	flakyFails := flag.Bool("flaky-fails", false, "Fail the suite on flaky tests found by -retry-failed")
+	coverProfile := flag.String("coverprofile", "", "Write a merged coverage profile of all packages to the given path")
+	var include, exclude stringList
+	flag.Var(&include, "pkg", "Only run this package path (repeatable)")
+	flag.Var(&exclude, "exclude", "Skip this package path (repeatable)")
+	flag.Parse()
+
 	printHeader()
 
-	if err := checkPrerequisites(); err != nil {
+	opts := testOptions{race: *race}
+
+	if err := checkPrerequisites(opts); err != nil {
 		printError("Prerequisites check failed", err.Error())
 		os.Exit(1)
 	}
 
-	packages := getTestPackages()
+	packages, err := getTestPackages(include, exclude)
+	if err != nil {
+		printError("Test discovery failed", err.Error())
+		os.Exit(1)
+	}
 	if len(packages) == 0 {
 		printWarning("No test packages found")
 		os.Exit(0)
 	}
 
-	suite := runTestSuite(packages)
+	if *bench || *benchSave {
+		os.Exit(runBenchMode(packages, *benchBaseline, *benchSave))
+	}
+
+	if *coverProfile != "" {
+		coverDir, err := os.MkdirTemp("", "pb-deployer-cover-")
+		if err != nil {
+			printError("Coverage setup failed", err.Error())
+			os.Exit(1)
+		}
+		opts.coverDir = coverDir
+	}
+
+	var vetResult TestResult
+	if *vet {
+		vetResult = runVet()
+	}
+
+	suite := runTestSuite(packages, *jobs, opts)
+	retryFailedPackages(&suite, *retryFailed, opts, *flakyFails)
+	if *vet {
+		suite.Results = append([]TestResult{vetResult}, suite.Results...)
+		if !vetResult.Success {
+			suite.Success = false
+		}
+	}
 
 	printSummary(suite)
 
+	if opts.coverDir != "" {
+		err := mergeCoverProfiles(opts.coverDir, *coverProfile)
+		os.RemoveAll(opts.coverDir)
+		if err != nil {
+			printError("Coverage profile failed", err.Error())
+			suite.Success = false
+		} else {
+			fmt.Printf("📄 %sCoverage profile written to %s%s\n", Gray, *coverProfile, Reset)
+			fmt.Println()
+		}
+	}
+
+	if *junitPath != "" {
+		if err := writeJUnitReport(suite, *junitPath); err != nil {
+			printError("JUnit report failed", err.Error())
+		} else {
+			fmt.Printf("📄 %sJUnit report written to %s%s\n", Gray, *junitPath, Reset)
+			fmt.Println()
+		}
+	}
+
 	if suite.Success {
 		os.Exit(0)
 	} else {
@@ -82,7 +242,7 @@ func printHeader() {
 	fmt.Println()
 }
 
-func checkPrerequisites() error {
+func checkPrerequisites(opts testOptions) error {
 	fmt.Printf("🔍 %sChecking prerequisites...%s\n", Gray, Reset)
 
 	if err := checkGoTestAvailable(); err != nil {
@@ -90,24 +250,69 @@ func checkPrerequisites() error {
 	}
 
 	fmt.Printf("✓  %sGo toolchain available%s\n", Green, Reset)
+
+	if opts.race {
+		if err := checkRaceSupported(); err != nil {
+			return err
+		}
+		fmt.Printf("✓  %sRace detector available%s\n", Green, Reset)
+	}
 	fmt.Println()
 	return nil
 }
 
-// runTestSuite executes all test packages
-func runTestSuite(packages []string) TestSuite {
+// runTestSuite executes all test packages using up to jobs concurrent workers.
+// Each package's output is buffered and flushed in original package order.
+func runTestSuite(packages []string, jobs int, opts testOptions) TestSuite {
 	suite := TestSuite{
 		Results: make([]TestResult, 0, len(packages)),
 		Success: true,
 	}
 
+	if jobs < 1 {
+		jobs = 1
+	}
+	if jobs > len(packages) {
+		jobs = len(packages)
+	}
+
 	start := time.Now()
 
-	fmt.Printf("📦 %sRunning %d test package(s)%s\n", Bold, len(packages), Reset)
+	fmt.Printf("📦 %sRunning %d test package(s) with %d worker(s)%s\n", Bold, len(packages), jobs, Reset)
 	fmt.Println()
 
-	for i, pkg := range packages {
-		result := runTestPackage(pkg, i+1, len(packages))
+	results := make([]TestResult, len(packages))
+	outputs := make([]bytes.Buffer, len(packages))
+	done := make([]chan struct{}, len(packages))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				results[i] = runTestPackage(&outputs[i], packages[i], i+1, len(packages), opts)
+				close(done[i])
+			}
+		}()
+	}
+
+	go func() {
+		for i := range packages {
+			work <- i
+		}
+		close(work)
+	}()
+
+	for i := range packages {
+		<-done[i]
+		os.Stdout.Write(outputs[i].Bytes())
+
+		result := results[i]
 		suite.Results = append(suite.Results, result)
 
 		suite.TotalPassed += result.Passed
@@ -118,26 +323,27 @@ func runTestSuite(packages []string) TestSuite {
 			suite.Success = false
 		}
 	}
+	wg.Wait()
 
 	suite.Duration = time.Since(start)
 	return suite
 }
 
-// runTestPackage executes tests for a specific package
-func runTestPackage(packagePath string, current, total int) TestResult {
+// runTestPackage executes tests for a specific package, writing progress to w
+func runTestPackage(w io.Writer, packagePath string, current, total int, opts testOptions) TestResult {
 	result := TestResult{
 		Package:     packagePath,
 		Output:      []string{},
 		FailedTests: []string{},
 	}
 
-	fmt.Printf("├─ %s[%d/%d]%s %s%s%s\n",
+	fmt.Fprintf(w, "├─ %s[%d/%d]%s %s%s%s\n",
 		Dim, current, total, Reset,
 		Bold, packagePath, Reset)
 
 	start := time.Now()
 
-	cmd := exec.Command("go", "test", "-v", packagePath)
+	cmd := exec.Command("go", testArgs(packagePath, opts)...)
 	output, err := cmd.CombinedOutput()
 	result.Duration = time.Since(start)
 
@@ -150,58 +356,62 @@ func runTestPackage(packagePath string, current, total int) TestResult {
 	parseTestOutput(string(output), &result)
 
 	if result.Success {
-		fmt.Printf("│  %s✓%s %sPassed%s %s(%dms)%s\n",
+		fmt.Fprintf(w, "│  %s✓%s %sPassed%s %s(%dms)%s\n",
 			Green, Reset, Green, Reset,
 			Gray, result.Duration.Milliseconds(), Reset)
 
 		if result.Passed > 0 {
-			fmt.Printf("│  %s%d test(s) passed%s\n",
+			fmt.Fprintf(w, "│  %s%d test(s) passed%s\n",
 				Gray, result.Passed, Reset)
 		}
 	} else {
-		fmt.Printf("│  %s✗%s %sFailed%s %s(%dms)%s\n",
+		fmt.Fprintf(w, "│  %s✗%s %sFailed%s %s(%dms)%s\n",
 			Red, Reset, Red, Reset,
 			Gray, result.Duration.Milliseconds(), Reset)
 
 		if result.Failed > 0 {
-			fmt.Printf("│  %s%d test(s) failed, %d passed%s\n",
+			fmt.Fprintf(w, "│  %s%d test(s) failed, %d passed%s\n",
 				Red, result.Failed, result.Passed, Reset)
 		}
 	}
 
 	if len(result.FailedTests) > 0 {
 		for _, failedTest := range result.FailedTests {
-			fmt.Printf("│  %s└─ %s%s\n", Red, failedTest, Reset)
+			fmt.Fprintf(w, "│  %s└─ %s%s\n", Red, failedTest, Reset)
 		}
 	}
 
 	// Show skipped tests if any
 	if result.Skipped > 0 {
-		fmt.Printf("│  %s%d test(s) skipped%s\n",
+		fmt.Fprintf(w, "│  %s%d test(s) skipped%s\n",
 			Yellow, result.Skipped, Reset)
 	}
 
-	fmt.Println("│")
+	fmt.Fprintln(w, "│")
 	return result
 }
 
 func parseTestOutput(output string, result *TestResult) {
 	lines := strings.Split(output, "\n")
 
-	testPassRegex := regexp.MustCompile(`^\s*--- PASS: (\w+)`)
-	testFailRegex := regexp.MustCompile(`^\s*--- FAIL: (\w+)`)
-	testSkipRegex := regexp.MustCompile(`^\s*--- SKIP: (\w+)`)
+	// Timing is optional: go test omits it for some output formats
+	testPassRegex := regexp.MustCompile(`^\s*--- PASS: (\S+)(?: \((\d+(?:\.\d+)?)s\))?`)
+	testFailRegex := regexp.MustCompile(`^\s*--- FAIL: (\S+)(?: \((\d+(?:\.\d+)?)s\))?`)
+	testSkipRegex := regexp.MustCompile(`^\s*--- SKIP: (\S+)(?: \((\d+(?:\.\d+)?)s\))?`)
 
 	for _, line := range lines {
 		result.Output = append(result.Output, line)
 
 		if matches := testPassRegex.FindStringSubmatch(line); len(matches) > 1 {
 			result.Passed++
+			result.Tests = append(result.Tests, newTestCase(matches, "pass"))
 		} else if matches := testFailRegex.FindStringSubmatch(line); len(matches) > 1 {
 			result.Failed++
 			result.FailedTests = append(result.FailedTests, matches[1])
+			result.Tests = append(result.Tests, newTestCase(matches, "fail"))
 		} else if matches := testSkipRegex.FindStringSubmatch(line); len(matches) > 1 {
 			result.Skipped++
+			result.Tests = append(result.Tests, newTestCase(matches, "skip"))
 		} else if strings.Contains(line, "FAIL") && strings.Contains(line, "exit status") {
 			result.Success = false
 		}
@@ -212,6 +422,41 @@ func parseTestOutput(output string, result *TestResult) {
 	}
 }
 
+// newTestCase builds a TestCase from a result line match of name and optional seconds
+func newTestCase(matches []string, status string) TestCase {
+	tc := TestCase{Name: matches[1], Status: status}
+	if len(matches) > 2 && matches[2] != "" {
+		if seconds, err := strconv.ParseFloat(matches[2], 64); err == nil {
+			tc.Duration = time.Duration(seconds * float64(time.Second))
+			tc.HasDuration = true
+		}
+	}
+	return tc
+}
+
+// slowestTests returns up to n top-level tests with a non-zero timing, slowest
+// first. Subtests are left out since their time is counted in the parent.
+func slowestTests(suite TestSuite, n int) []TestCase {
+	var timed []TestCase
+	for _, result := range suite.Results {
+		for _, tc := range result.Tests {
+			if tc.HasDuration && tc.Duration > 0 && !strings.Contains(tc.Name, "/") {
+				tc.Name = result.Package + " " + tc.Name
+				timed = append(timed, tc)
+			}
+		}
+	}
+
+	sort.SliceStable(timed, func(i, j int) bool {
+		return timed[i].Duration > timed[j].Duration
+	})
+
+	if len(timed) > n {
+		timed = timed[:n]
+	}
+	return timed
+}
+
 func printSummary(suite TestSuite) {
 	fmt.Println()
 
@@ -229,10 +474,31 @@ func printSummary(suite TestSuite) {
 	if suite.TotalFailed > 0 {
 		fmt.Printf("   %sFailed:%s    %s%d%s\n", Gray, Reset, Red, suite.TotalFailed, Reset)
 	}
+	if suite.TotalFlaky > 0 {
+		fmt.Printf("   %sFlaky:%s     %s%d%s\n", Gray, Reset, Yellow, suite.TotalFlaky, Reset)
+	}
 
 	fmt.Printf("   %sDuration:%s  %s%dms%s\n", Gray, Reset, Gray, suite.Duration.Milliseconds(), Reset)
 	fmt.Printf("   %sPackages:%s  %d\n", Gray, Reset, len(suite.Results))
 
+	if slowest := slowestTests(suite, 5); len(slowest) > 0 {
+		fmt.Println()
+		fmt.Printf("🐢 %sSlowest Tests%s\n", Bold, Reset)
+		for _, tc := range slowest {
+			fmt.Printf("   %s%8s%s  %s\n", Yellow, tc.Duration.Round(time.Millisecond), Reset, tc.Name)
+		}
+	}
+
+	if suite.TotalFlaky > 0 {
+		fmt.Println()
+		fmt.Printf("🔁 %sFlaky Tests%s %s(failed, then passed on retry)%s\n", Bold+Yellow, Reset, Gray, Reset)
+		for _, result := range suite.Results {
+			for _, name := range result.Flaky {
+				fmt.Printf("   %s• %s %s%s\n", Yellow, result.Package, name, Reset)
+			}
+		}
+	}
+
 	if !suite.Success {
 		fmt.Println()
 		fmt.Printf("🚨 %sFailed Packages:%s\n", Bold+Red, Reset)
@@ -240,7 +506,7 @@ func printSummary(suite TestSuite) {
 			if !result.Success {
 				fmt.Printf("   %s• %s%s %s(%d failures)%s\n",
 					Red, result.Package, Reset,
-					Gray, result.Failed, Reset)
+					Gray, len(result.FailedTests), Reset)
 			}
 		}
 	}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// packageFailure stands in for a test name when a package failed without
+// reporting one, e.g. on a build error or a panic outside a test
+const packageFailure = "(package)"
+
+// failureSet returns the names a failed result is retried for
+func failureSet(result TestResult) map[string]bool {
+	failures := make(map[string]bool)
+	for _, name := range result.FailedTests {
+		failures[name] = true
+	}
+	if len(failures) == 0 && !result.Success {
+		failures[packageFailure] = true
+	}
+	return failures
+}
+
+// retryFailedPackages re-runs each failed package up to attempts times. A
+// test that fails every run stays failed; one that passes on any retry, or
+// only failed on some of them, is moved to the result's Flaky list. The
+// package stops being retried once no test has failed every run so far.
+// Unless flakyFails is set, a package whose failures were all flaky counts
+// as passed.
+func retryFailedPackages(suite *TestSuite, attempts int, opts testOptions, flakyFails bool) {
+	var failed []int
+	for i, result := range suite.Results {
+		if !result.Success {
+			failed = append(failed, i)
+		}
+	}
+	if attempts < 1 || len(failed) == 0 {
+		return
+	}
+
+	fmt.Printf("🔁 %sRetrying %d failed package(s) up to %d time(s)%s\n", Bold, len(failed), attempts, Reset)
+	fmt.Println()
+
+	for _, i := range failed {
+		suite.Results[i] = retryPackage(os.Stdout, suite.Results[i], attempts, opts, flakyFails)
+	}
+
+	suite.TotalPassed, suite.TotalFailed, suite.TotalFlaky, suite.TotalTests = 0, 0, 0, 0
+	suite.Success = true
+	for _, result := range suite.Results {
+		suite.TotalPassed += result.Passed
+		suite.TotalFailed += result.Failed
+		suite.TotalFlaky += len(result.Flaky)
+		suite.TotalTests += result.Passed + result.Failed + result.Skipped
+		if !result.Success {
+			suite.Success = false
+		}
+	}
+}
+
+func retryPackage(w io.Writer, first TestResult, attempts int, opts testOptions, flakyFails bool) TestResult {
+	everyRun := failureSet(first)
+	seen := failureSet(first)
+	last := first
+
+	for attempt := 1; attempt <= attempts && len(everyRun) > 0; attempt++ {
+		last = runTestPackage(w, first.Package, attempt, attempts, opts)
+
+		failures := failureSet(last)
+		for name := range failures {
+			seen[name] = true
+		}
+		for name := range everyRun {
+			if !failures[name] {
+				delete(everyRun, name)
+			}
+		}
+	}
+
+	result := last
+	result.FailedTests = sortedNames(everyRun, nil)
+	result.Flaky = sortedNames(seen, everyRun)
+	result.Failed = len(result.FailedTests)
+	result.Success = len(everyRun) == 0 && (!flakyFails || len(result.Flaky) == 0)
+	return result
+}
+
+// sortedNames returns the names in set that are not in exclude
+func sortedNames(set, exclude map[string]bool) []string {
+	names := []string{}
+	for name := range set {
+		if !exclude[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// vetPackage is the pseudo-package name go vet findings are reported under
+const vetPackage = "go vet"
+
+var vetDiagnosticRegex = regexp.MustCompile(`^\S+\.go:\d+(?::\d+)?: `)
+
+// runVet runs go vet over the whole module and returns its findings as a
+// TestResult, so they fail the suite and appear in reports like a package
+func runVet() TestResult {
+	fmt.Printf("🔎 %sRunning go vet ./...%s\n", Bold, Reset)
+
+	start := time.Now()
+	output, err := exec.Command("go", "vet", "./...").CombinedOutput()
+
+	result := TestResult{
+		Package:     vetPackage,
+		Duration:    time.Since(start),
+		Success:     err == nil,
+		Output:      strings.Split(strings.TrimRight(string(output), "\n"), "\n"),
+		FailedTests: []string{},
+	}
+	for _, line := range result.Output {
+		if vetDiagnosticRegex.MatchString(line) {
+			result.FailedTests = append(result.FailedTests, line)
+		}
+	}
+
+	if result.Success {
+		fmt.Printf("│  %s✓%s %sNo issues%s %s(%dms)%s\n",
+			Green, Reset, Green, Reset,
+			Gray, result.Duration.Milliseconds(), Reset)
+	} else {
+		fmt.Printf("│  %s✗%s %s%d issue(s)%s %s(%dms)%s\n",
+			Red, Reset, Red, len(result.FailedTests), Reset,
+			Gray, result.Duration.Milliseconds(), Reset)
+		// Build errors have no file:line diagnostics, so show the raw output
+		lines := result.FailedTests
+		if len(lines) == 0 {
+			lines = result.Output
+		}
+		for _, line := range lines {
+			fmt.Printf("│  %s└─ %s%s\n", Red, line, Reset)
+		}
+	}
+	fmt.Println("│")
+	fmt.Println()
+
+	return result
+}
+
+// checkRaceSupported fails early when the race detector cannot build, which
+// would otherwise fail every package with the same cgo error
+func checkRaceSupported() error {
+	output, err := exec.Command("go", "env", "CGO_ENABLED").Output()
+	if err != nil {
+		return fmt.Errorf("go env failed: %v", err)
+	}
+	if strings.TrimSpace(string(output)) != "1" {
+		return fmt.Errorf("-race requires cgo: set CGO_ENABLED=1 and install a C compiler")
+	}
+	return nil
+}
@@ -39,6 +39,7 @@ export interface SecurityRequest {
 	host: string;
 	port: number;
 	user: string;
+	username: string;
 	firewall_rules?: FirewallRule[];
 	ssh_config?: SSHConfig;
 	enable_fail2ban: boolean;
@@ -216,6 +217,7 @@ export class ServerSetupClient {
 			host: server.host,
 			port: server.port || 22,
 			user: server.root_username,
+			username: server.app_username,
 			enable_fail2ban: true
 			// firewall_rules and ssh_config will use defaults if not provided
 		};
@@ -4,30 +4,41 @@ package api
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"pb-deployer/internal/logger"
+	"pb-deployer/internal/models"
 	"pb-deployer/internal/tunnel"
 
+	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/core"
 )
 
+// deployRequest is the body of POST /api/deploy and one entry of a batch deploy
+type deployRequest struct {
+	AppID          string `json:"app_id"`
+	VersionID      string `json:"version_id"`
+	DeploymentID   string `json:"deployment_id"`
+	SuperuserEmail string `json:"superuser_email,omitempty"`
+	SuperuserPass  string `json:"superuser_pass,omitempty"`
+	// Optional pinning of the deployment package, see tunnel.DeploymentRequest
+	PackageSHA256      string `json:"package_sha256,omitempty"`
+	PackageSignature   string `json:"package_signature,omitempty"`
+	SignaturePublicKey string `json:"signature_public_key,omitempty"`
+}
+
 func handleDeploy(c *core.RequestEvent, app core.App) error {
-	log := logger.GetAPILogger()
+	requestID, log := requestLogger(c)
 	log.Info("Starting deployment process")
 
-	type deployRequest struct {
-		AppID          string `json:"app_id"`
-		VersionID      string `json:"version_id"`
-		DeploymentID   string `json:"deployment_id"`
-		SuperuserEmail string `json:"superuser_email,omitempty"`
-		SuperuserPass  string `json:"superuser_pass,omitempty"`
-	}
-
 	var req deployRequest
 	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
 		log.Error("Failed to decode request body: %v", err)
@@ -38,39 +49,71 @@ func handleDeploy(c *core.RequestEvent, app core.App) error {
 
 	log.Info("Received deployment request: app_id=%s, version_id=%s, deployment_id=%s", req.AppID, req.VersionID, req.DeploymentID)
 
+	deployCtx, status, err := prepareDeployment(app, getBaseURL(c.Request), req, log)
+	if err != nil {
+		return deploymentErrorResponse(c, status, err)
+	}
+	deployCtx.RequestID = requestID
+
+	if err := markDeploymentRunning(app, deployCtx); err != nil {
+		log.Error("Failed to update deployment status: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]any{
+			"error": "Failed to update deployment status",
+		})
+	}
+
+	// Start deployment in goroutine
+	go func() {
+		err := performDeployment(app, deployCtx)
+
+		if err != nil {
+			log.Error("Deployment failed: %v", err)
+			updateDeploymentStatus(app, deployCtx.DeploymentRecord, "failed", fmt.Sprintf("Deployment failed: %v", err))
+		}
+	}()
+
+	log.Success("Deployment started successfully")
+	return c.JSON(http.StatusOK, map[string]any{
+		"success":       true,
+		"message":       "Deployment started",
+		"deployment_id": req.DeploymentID,
+	})
+}
+
+// prepareDeployment validates req and loads the records it refers to. On
+// failure it returns the HTTP status to report along with the error.
+func prepareDeployment(app core.App, baseURL string, req deployRequest, log *logger.Logger) (*deploymentDeploymentContext, int, error) {
 	// Validate required fields
 	if req.AppID == "" || req.VersionID == "" || req.DeploymentID == "" {
 		log.Error("Validation failed: Missing required fields")
-		return c.JSON(http.StatusBadRequest, map[string]any{
-			"error": "app_id, version_id, and deployment_id are required",
-		})
+		return nil, http.StatusBadRequest, fmt.Errorf("app_id, version_id, and deployment_id are required")
+	}
+
+	if req.PackageSHA256 != "" {
+		if digest, err := hex.DecodeString(req.PackageSHA256); err != nil || len(digest) != sha256.Size {
+			return nil, http.StatusBadRequest, fmt.Errorf("package_sha256 must be a hex-encoded SHA256 digest")
+		}
 	}
 
 	// Get deployment record
 	deploymentRecord, err := app.FindRecordById("deployments", req.DeploymentID)
 	if err != nil {
 		log.Error("Failed to find deployment record: %v", err)
-		return c.JSON(http.StatusNotFound, map[string]any{
-			"error": "Deployment not found",
-		})
+		return nil, http.StatusNotFound, fmt.Errorf("Deployment not found")
 	}
 
 	// Get app record
 	appRecord, err := app.FindRecordById("apps", req.AppID)
 	if err != nil {
 		log.Error("Failed to find app record: %v", err)
-		return c.JSON(http.StatusNotFound, map[string]any{
-			"error": "App not found",
-		})
+		return nil, http.StatusNotFound, fmt.Errorf("App not found")
 	}
 
 	// Get version record
 	versionRecord, err := app.FindRecordById("versions", req.VersionID)
 	if err != nil {
 		log.Error("Failed to find version record: %v", err)
-		return c.JSON(http.StatusNotFound, map[string]any{
-			"error": "Version not found",
-		})
+		return nil, http.StatusNotFound, fmt.Errorf("Version not found")
 	}
 
 	// Get server record
@@ -78,18 +121,23 @@ func handleDeploy(c *core.RequestEvent, app core.App) error {
 	serverRecord, err := app.FindRecordById("servers", serverID)
 	if err != nil {
 		log.Error("Failed to find server record: %v", err)
-		return c.JSON(http.StatusNotFound, map[string]any{
-			"error": "Server not found",
-		})
+		return nil, http.StatusNotFound, fmt.Errorf("Server not found")
+	}
+
+	server, err := models.ServerFromRecord(serverRecord)
+	if err != nil {
+		log.Error("Failed to read server record: %v", err)
+		return nil, http.StatusInternalServerError, err
+	}
+	if err := server.Validate(); err != nil {
+		return nil, http.StatusBadRequest, err
 	}
 
 	// Check if server is ready for deployment
 	if !serverRecord.GetBool("setup_complete") {
 		log.Error("Server not ready for deployment: setup_complete=%v",
 			serverRecord.GetBool("setup_complete"))
-		return c.JSON(http.StatusBadRequest, map[string]any{
-			"error": "Server is not ready for deployment. Please complete server setup first.",
-		})
+		return nil, http.StatusBadRequest, fmt.Errorf("Server is not ready for deployment. Please complete server setup first.")
 	}
 
 	// Warn if server is not security locked but allow deployment
@@ -103,56 +151,49 @@ func handleDeploy(c *core.RequestEvent, app core.App) error {
 	// Check if version has deployment zip
 	if versionRecord.GetString("deployment_zip") == "" {
 		log.Error("Version has no deployment package")
-		return c.JSON(http.StatusBadRequest, map[string]any{
-			"error": "Version has no deployment package",
-		})
+		return nil, http.StatusBadRequest, fmt.Errorf("Version has no deployment package")
 	}
 
-	// Determine if this is an initial deployment based on presence of superuser credentials
-	isInitialDeploy := req.SuperuserEmail != "" && req.SuperuserPass != ""
-
-	// Build deployment ZIP URL
-	zipURL := fmt.Sprintf("%s/api/files/versions/%s/%s",
-		getBaseURL(c.Request), req.VersionID, versionRecord.GetString("deployment_zip"))
-
-	// Update deployment status to running
-	now := time.Now()
-	deploymentRecord.Set("status", "running")
-	deploymentRecord.Set("started_at", now)
-	deploymentRecord.Set("logs", "Starting deployment...\n")
+	return &deploymentDeploymentContext{
+		AppRecord:        appRecord,
+		VersionRecord:    versionRecord,
+		DeploymentRecord: deploymentRecord,
+		ServerRecord:     serverRecord,
+		// Build deployment ZIP URL
+		ZipURL: fmt.Sprintf("%s/api/files/versions/%s/%s",
+			baseURL, req.VersionID, versionRecord.GetString("deployment_zip")),
+		// Determine if this is an initial deployment based on presence of superuser credentials
+		IsInitialDeploy:    req.SuperuserEmail != "" && req.SuperuserPass != "",
+		SuperuserEmail:     req.SuperuserEmail,
+		SuperuserPass:      req.SuperuserPass,
+		PackageSHA256:      req.PackageSHA256,
+		PackageSignature:   req.PackageSignature,
+		SignaturePublicKey: req.SignaturePublicKey,
+	}, http.StatusOK, nil
+}
 
-	if err := app.Save(deploymentRecord); err != nil {
-		log.Error("Failed to update deployment status: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]any{
-			"error": "Failed to update deployment status",
-		})
+// deploymentErrorResponse reports a prepareDeployment failure, listing
+// invalid server fields when the server failed validation
+func deploymentErrorResponse(c *core.RequestEvent, status int, err error) error {
+	var validationErrs models.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		return invalidServerResponse(c, err)
 	}
+	return c.JSON(status, map[string]any{
+		"error": err.Error(),
+	})
+}
 
-	// Start deployment in goroutine
-	go func() {
-		err := performDeployment(app, &deploymentDeploymentContext{
-			AppRecord:        appRecord,
-			VersionRecord:    versionRecord,
-			DeploymentRecord: deploymentRecord,
-			ServerRecord:     serverRecord,
-			ZipURL:           zipURL,
-			IsInitialDeploy:  isInitialDeploy,
-			SuperuserEmail:   req.SuperuserEmail,
-			SuperuserPass:    req.SuperuserPass,
-		})
-
-		if err != nil {
-			log.Error("Deployment failed: %v", err)
-			updateDeploymentStatus(app, deploymentRecord, "failed", fmt.Sprintf("Deployment failed: %v", err))
-		}
-	}()
+// markDeploymentRunning records the start of a deployment
+func markDeploymentRunning(app core.App, ctx *deploymentDeploymentContext) error {
+	setDeploymentRunning(ctx.DeploymentRecord)
+	return app.Save(ctx.DeploymentRecord)
+}
 
-	log.Success("Deployment started successfully")
-	return c.JSON(http.StatusOK, map[string]any{
-		"success":       true,
-		"message":       "Deployment started",
-		"deployment_id": req.DeploymentID,
-	})
+func setDeploymentRunning(record *core.Record) {
+	record.Set("status", "running")
+	record.Set("started_at", time.Now())
+	record.Set("logs", "Starting deployment...\n")
 }
 
 type deploymentDeploymentContext struct {
@@ -164,16 +205,22 @@ type deploymentDeploymentContext struct {
 	IsInitialDeploy  bool
 	SuperuserEmail   string
 	SuperuserPass    string
+	RequestID        string
+	// Optional deployment package pinning
+	PackageSHA256      string
+	PackageSignature   string
+	SignaturePublicKey string
 }
 
 func performDeployment(app core.App, ctx *deploymentDeploymentContext) error {
-	log := logger.GetAPILogger()
+	log := logger.GetAPILogger().WithFields(requestFields(ctx.RequestID))
 
 	// Create SSH client
 	client, err := createSSHClient(
 		ctx.ServerRecord.GetString("host"),
 		ctx.ServerRecord.GetInt("port"),
 		ctx.ServerRecord.GetString("root_username"),
+		ctx.RequestID,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create SSH client: %w", err)
@@ -209,6 +256,9 @@ func performDeployment(app core.App, ctx *deploymentDeploymentContext) error {
 		SuperuserPass:        ctx.SuperuserPass,
 		AppUsername:          ctx.ServerRecord.GetString("app_username"),
 		ServerSecurityLocked: ctx.ServerRecord.GetBool("security_locked"),
+		PackageSHA256:        ctx.PackageSHA256,
+		PackageSignature:     ctx.PackageSignature,
+		SignaturePublicKey:   ctx.SignaturePublicKey,
 		ProgressCallback: func(step int, total int, message string) {
 			log.Step(step, total, message)
 		},
@@ -288,3 +338,84 @@ func getBaseURL(req *http.Request) string {
 	}
 	return fmt.Sprintf("%s://%s", scheme, req.Host)
 }
+
+func handleListServerDeployments(c *core.RequestEvent, app core.App) error {
+	log := logger.GetAPILogger()
+
+	serverID := c.Request.PathValue("id")
+	if _, err := app.FindRecordById("servers", serverID); err != nil {
+		log.Error("Failed to find server record: %v", err)
+		return c.JSON(http.StatusNotFound, map[string]any{
+			"error": "Server not found",
+		})
+	}
+
+	limit := 50
+	if raw := c.Request.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > 500 {
+			return c.JSON(http.StatusBadRequest, map[string]any{
+				"error": "limit must be between 1 and 500",
+			})
+		}
+		limit = parsed
+	}
+	includeLogs := c.Request.URL.Query().Get("logs") == "true"
+
+	records, err := app.FindRecordsByFilter(
+		"deployments",
+		"app_id.server_id = {:server}",
+		"-created",
+		limit,
+		0,
+		dbx.Params{"server": serverID},
+	)
+	if err != nil {
+		log.Error("Failed to list deployments for server %s: %v", serverID, err)
+		return c.JSON(http.StatusInternalServerError, map[string]any{
+			"error": "Failed to list deployments",
+		})
+	}
+
+	if errs := app.ExpandRecords(records, []string{"app_id", "version_id"}, nil); len(errs) > 0 {
+		log.Warning("Failed to expand deployment relations: %v", errs)
+	}
+
+	deployments := make([]map[string]any, 0, len(records))
+	for _, record := range records {
+		deployment := map[string]any{
+			"id":           record.Id,
+			"app_id":       record.GetString("app_id"),
+			"version_id":   record.GetString("version_id"),
+			"status":       record.GetString("status"),
+			"created":      record.GetDateTime("created"),
+			"started_at":   record.GetDateTime("started_at"),
+			"completed_at": record.GetDateTime("completed_at"),
+			"data_backup":  record.GetString("data_backup"),
+		}
+
+		if appRecord := record.ExpandedOne("app_id"); appRecord != nil {
+			deployment["app_name"] = appRecord.GetString("name")
+		}
+		if versionRecord := record.ExpandedOne("version_id"); versionRecord != nil {
+			deployment["version_number"] = versionRecord.GetString("version_number")
+		}
+
+		started := record.GetDateTime("started_at")
+		completed := record.GetDateTime("completed_at")
+		if !started.IsZero() && !completed.IsZero() {
+			deployment["duration_ms"] = completed.Time().Sub(started.Time()).Milliseconds()
+		}
+
+		if includeLogs {
+			deployment["logs"] = record.GetString("logs")
+		}
+
+		deployments = append(deployments, deployment)
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"server_id":   serverID,
+		"deployments": deployments,
+	})
+}
@@ -3,11 +3,19 @@ package api
 // API_SOURCE
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"pb-deployer/internal/logger"
+
 	"github.com/magooney-loon/pb-ext/core/server/api"
 	"github.com/pocketbase/pocketbase/core"
 )
 
-func RegisterHandlers(pbApp core.App) {
+// requestIDHeader carries the correlation ID shared by every log line of a request
+const requestIDHeader = "X-Request-ID"
+
+func RegisterHandlers(pbApp core.App, build BuildInfo) {
 	v1Config := &api.APIDocsConfig{
 		Title:       "pb-deployer legacy",
 		Version:     "1.0.0",
@@ -28,6 +36,18 @@ func RegisterHandlers(pbApp core.App) {
 			return err
 		}
 
+		v1Router.GET("/api/healthz", func(c *core.RequestEvent) error {
+			return handleHealthz(c)
+		})
+
+		v1Router.GET("/api/readyz", func(c *core.RequestEvent) error {
+			return handleReadyz(c, pbApp)
+		})
+
+		v1Router.GET("/api/version", func(c *core.RequestEvent) error {
+			return handleVersion(c, build)
+		})
+
 		v1Router.POST("/api/setup/server", func(c *core.RequestEvent) error {
 			return handleServerSetup(c, pbApp)
 		})
@@ -44,8 +64,58 @@ func RegisterHandlers(pbApp core.App) {
 			return handleDeploy(c, pbApp)
 		})
 
+		v1Router.POST("/api/deploy/batch", func(c *core.RequestEvent) error {
+			return handleBatchDeploy(c, pbApp)
+		})
+
+		v1Router.GET("/api/servers/{id}/deployments", func(c *core.RequestEvent) error {
+			return handleListServerDeployments(c, pbApp)
+		})
+
 		return e.Next()
 	})
 
 	versionManager.RegisterWithServer(pbApp)
 }
+
+// requestLogger returns the correlation ID for this request, reusing a
+// well-formed incoming X-Request-ID, and an API logger tagged with it. The ID
+// is echoed in the response so clients can match it to server logs.
+func requestLogger(c *core.RequestEvent) (string, *logger.Logger) {
+	requestID := c.Request.Header.Get(requestIDHeader)
+	if !validRequestID(requestID) {
+		requestID = newRequestID()
+	}
+	c.Response.Header().Set(requestIDHeader, requestID)
+	return requestID, logger.GetAPILogger().WithFields(requestFields(requestID))
+}
+
+// requestFields returns the log fields for a correlation ID, nil if unset
+func requestFields(requestID string) map[string]any {
+	if requestID == "" {
+		return nil
+	}
+	return map[string]any{"request_id": requestID}
+}
+
+func newRequestID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(buf)
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
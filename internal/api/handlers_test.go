@@ -0,0 +1,54 @@
+package api
+
+import "testing"
+
+func TestValidRequestID(t *testing.T) {
+	tests := []struct {
+		id    string
+		valid bool
+	}{
+		{"3f2a9c01d4e5b678", true},
+		{"req-123_abc", true},
+		{"", false},
+		{"has space", false},
+		{"inject\nnewline", false},
+		{string(make([]byte, 65)), false},
+	}
+
+	for _, tt := range tests {
+		if got := validRequestID(tt.id); got != tt.valid {
+			t.Errorf("validRequestID(%q) = %v, want %v", tt.id, got, tt.valid)
+		}
+	}
+}
+
+func TestNewRequestIDIsValidAndUnique(t *testing.T) {
+	first, second := newRequestID(), newRequestID()
+	if !validRequestID(first) {
+		t.Errorf("newRequestID() = %q, not a valid request ID", first)
+	}
+	if first == second {
+		t.Errorf("newRequestID() returned %q twice", first)
+	}
+}
+
+func TestRequestFields(t *testing.T) {
+	if fields := requestFields(""); fields != nil {
+		t.Errorf("requestFields(\"\") = %v, want nil", fields)
+	}
+	if fields := requestFields("abc"); fields["request_id"] != "abc" {
+		t.Errorf("requestFields(\"abc\") = %v, want request_id=abc", fields)
+	}
+}
+
+func TestBuildInfo(t *testing.T) {
+	build := NewBuildInfo("v1.2.3", "abc1234", "2026-01-02T03:04:05Z")
+	if build.GoVersion == "" {
+		t.Error("NewBuildInfo() left GoVersion empty")
+	}
+
+	want := "pb-deployer v1.2.3\ncommit: abc1234\nbuilt: 2026-01-02T03:04:05Z\ngo: " + build.GoVersion + "\n"
+	if got := build.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
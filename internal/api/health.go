@@ -0,0 +1,71 @@
+package api
+
+// API_SOURCE
+
+import (
+	"net/http"
+
+	"pb-deployer/internal/models"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// readinessCollections are the collections RegisterCollections creates; the
+// server is not ready to take requests until all of them exist
+var readinessCollections = []string{
+	models.NewServer().TableName(),
+	models.NewApp().TableName(),
+	models.NewVersion().TableName(),
+	models.NewDeployment().TableName(),
+}
+
+// handleHealthz reports that the process is up and serving requests
+func handleHealthz(c *core.RequestEvent) error {
+	return c.JSON(http.StatusOK, map[string]any{
+		"status": "ok",
+	})
+}
+
+// handleReadyz reports whether the database is reachable and the app's
+// collections are registered. It answers 503 until both hold.
+func handleReadyz(c *core.RequestEvent, app core.App) error {
+	ready, checks := readiness(
+		func() error {
+			_, err := app.DB().NewQuery("SELECT 1").Execute()
+			return err
+		},
+		func(name string) bool {
+			_, err := app.FindCollectionByNameOrId(name)
+			return err == nil
+		},
+	)
+
+	status, code := "ok", http.StatusOK
+	if !ready {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+	return c.JSON(code, map[string]any{
+		"status": status,
+		"checks": checks,
+	})
+}
+
+// readiness runs the readiness checks and returns each one's outcome. The
+// collection check is skipped while the database is unreachable.
+func readiness(pingDB func() error, hasCollection func(name string) bool) (bool, map[string]string) {
+	checks := map[string]string{"database": "ok", "collections": "ok"}
+
+	if err := pingDB(); err != nil {
+		checks["database"] = err.Error()
+		checks["collections"] = "skipped"
+		return false, checks
+	}
+
+	for _, name := range readinessCollections {
+		if !hasCollection(name) {
+			checks["collections"] = "missing " + name
+			return false, checks
+		}
+	}
+	return true, checks
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReadinessReady(t *testing.T) {
+	ready, checks := readiness(
+		func() error { return nil },
+		func(string) bool { return true },
+	)
+	if !ready {
+		t.Errorf("Expected ready, got checks %v", checks)
+	}
+	if checks["database"] != "ok" || checks["collections"] != "ok" {
+		t.Errorf("Expected all checks ok, got %v", checks)
+	}
+}
+
+func TestReadinessDatabaseDown(t *testing.T) {
+	probed := false
+	ready, checks := readiness(
+		func() error { return errors.New("database is locked") },
+		func(string) bool { probed = true; return true },
+	)
+	if ready {
+		t.Error("Expected not ready with the database down")
+	}
+	if checks["database"] != "database is locked" || checks["collections"] != "skipped" {
+		t.Errorf("Unexpected checks %v", checks)
+	}
+	if probed {
+		t.Error("Expected collections not to be checked without a database")
+	}
+}
+
+func TestReadinessMissingCollection(t *testing.T) {
+	ready, checks := readiness(
+		func() error { return nil },
+		func(name string) bool { return name != "deployments" },
+	)
+	if ready {
+		t.Error("Expected not ready with a collection missing")
+	}
+	if checks["collections"] != "missing deployments" {
+		t.Errorf("Unexpected checks %v", checks)
+	}
+}
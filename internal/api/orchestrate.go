@@ -0,0 +1,279 @@
+package api
+
+// API_SOURCE
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"pb-deployer/internal/logger"
+	"pb-deployer/internal/models"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// defaultMaxParallel bounds concurrent deployments when none is requested
+const defaultMaxParallel = 3
+
+// MultiDeployOptions controls how a deployment is rolled out across servers
+type MultiDeployOptions struct {
+	// MaxParallel is the number of servers deployed at once (default 3)
+	MaxParallel int `json:"max_parallel"`
+	// FailFast stops starting new deployments after the first failure.
+	// Deployments already running are left to finish or roll back.
+	FailFast bool `json:"fail_fast"`
+	// Canary deploys to the first server alone and continues with the rest
+	// only if it succeeds, including its health verification
+	Canary bool `json:"canary"`
+}
+
+// ServerDeployResult is the outcome of deploying to one server
+type ServerDeployResult struct {
+	ServerID     string        `json:"server_id"`
+	Host         string        `json:"host"`
+	DeploymentID string        `json:"deployment_id,omitempty"`
+	Status       string        `json:"status"` // success, failed or skipped
+	Duration     time.Duration `json:"duration"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// deployToServers runs deploy for every server according to opts and returns
+// one result per server, in input order
+func deployToServers(ctx context.Context, servers []*models.Server, opts MultiDeployOptions, deploy func(context.Context, *models.Server) error) []ServerDeployResult {
+	results := make([]ServerDeployResult, len(servers))
+	for i, server := range servers {
+		results[i] = ServerDeployResult{ServerID: server.ID, Host: server.Host, Status: "skipped"}
+	}
+
+	run := func(ctx context.Context, i int) bool {
+		start := time.Now()
+		err := deploy(ctx, servers[i])
+		results[i].Duration = time.Since(start)
+		if err != nil {
+			results[i].Status = "failed"
+			results[i].Error = err.Error()
+			return false
+		}
+		results[i].Status = "success"
+		return true
+	}
+
+	remaining := make([]int, 0, len(servers))
+	for i := range servers {
+		remaining = append(remaining, i)
+	}
+
+	if opts.Canary && len(servers) > 1 {
+		if !run(ctx, 0) {
+			for _, i := range remaining[1:] {
+				results[i].Error = "canary deployment failed"
+			}
+			return results
+		}
+		remaining = remaining[1:]
+	}
+
+	maxParallel := opts.MaxParallel
+	if maxParallel <= 0 {
+		maxParallel = defaultMaxParallel
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sem := make(chan struct{}, maxParallel)
+	var wg sync.WaitGroup
+	for _, i := range remaining {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			results[i].Error = "not started after an earlier failure"
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if !run(ctx, i) && opts.FailFast {
+				cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// handleBatchDeploy starts several deployments, typically of the same version
+// to apps on different servers, and rolls them out with MultiDeployOptions.
+// It returns once every deployment is validated and marked running; progress
+// is tracked on each deployment record.
+func handleBatchDeploy(c *core.RequestEvent, app core.App) error {
+	requestID, log := requestLogger(c)
+	log.Info("Starting batch deployment")
+
+	var req struct {
+		MultiDeployOptions
+		Deployments []deployRequest `json:"deployments"`
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		log.Error("Failed to decode request body: %v", err)
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "Invalid request body",
+		})
+	}
+
+	if len(req.Deployments) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "deployments is required",
+		})
+	}
+
+	if err := checkBatchDuplicates(req.Deployments); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	baseURL := getBaseURL(c.Request)
+	servers := make([]*models.Server, 0, len(req.Deployments))
+	ordered := make([]*deploymentDeploymentContext, 0, len(req.Deployments))
+	contexts := make(map[*models.Server]*deploymentDeploymentContext, len(req.Deployments))
+	targets := make(map[string]int, len(req.Deployments))
+	for i, entry := range req.Deployments {
+		deployCtx, status, err := prepareDeployment(app, baseURL, entry, log)
+		if err != nil {
+			return deploymentErrorResponse(c, status, fmt.Errorf("deployments[%d]: %w", i, err))
+		}
+		deployCtx.RequestID = requestID
+
+		// Different app records can still share a directory on one server
+		target := deployCtx.ServerRecord.Id + "/" + deployCtx.AppRecord.GetString("name")
+		if j, ok := targets[target]; ok {
+			return c.JSON(http.StatusBadRequest, map[string]any{
+				"error": fmt.Sprintf("deployments[%d]: app %s on server %s is already deployed by deployments[%d]",
+					i, deployCtx.AppRecord.GetString("name"), deployCtx.ServerRecord.Id, j),
+			})
+		}
+		targets[target] = i
+
+		server, err := models.ServerFromRecord(deployCtx.ServerRecord)
+		if err != nil {
+			return deploymentErrorResponse(c, http.StatusInternalServerError, fmt.Errorf("deployments[%d]: %w", i, err))
+		}
+		servers = append(servers, server)
+		ordered = append(ordered, deployCtx)
+		contexts[server] = deployCtx
+	}
+
+	if err := markBatchRunning(ordered, app.Save); err != nil {
+		log.Error("Failed to update deployment status: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]any{
+			"error": "Failed to update deployment status",
+		})
+	}
+
+	go func() {
+		results := deployToServers(context.Background(), servers, req.MultiDeployOptions, func(ctx context.Context, server *models.Server) error {
+			return performDeployment(app, contexts[server])
+		})
+		logBatchResults(app, log, servers, contexts, results)
+	}()
+
+	deploymentIDs := make([]string, 0, len(req.Deployments))
+	for _, entry := range req.Deployments {
+		deploymentIDs = append(deploymentIDs, entry.DeploymentID)
+	}
+
+	log.Success("Batch deployment started for %d server(s)", len(servers))
+	return c.JSON(http.StatusAccepted, map[string]any{
+		"success":        true,
+		"message":        "Batch deployment started",
+		"deployment_ids": deploymentIDs,
+	})
+}
+
+// checkBatchDuplicates rejects a batch naming the same deployment or app
+// twice, which would run two deployments into one app directory at once.
+// Missing IDs are left to prepareDeployment.
+func checkBatchDuplicates(entries []deployRequest) error {
+	deployments := make(map[string]int, len(entries))
+	apps := make(map[string]int, len(entries))
+	for i, entry := range entries {
+		if j, ok := deployments[entry.DeploymentID]; ok && entry.DeploymentID != "" {
+			return fmt.Errorf("deployments[%d]: deployment_id %s is already used by deployments[%d]", i, entry.DeploymentID, j)
+		}
+		if j, ok := apps[entry.AppID]; ok && entry.AppID != "" {
+			return fmt.Errorf("deployments[%d]: app_id %s is already deployed by deployments[%d]", i, entry.AppID, j)
+		}
+		deployments[entry.DeploymentID] = i
+		apps[entry.AppID] = i
+	}
+	return nil
+}
+
+// markBatchRunning marks the deployments running in input order. If a save
+// fails, the deployments marked so far are reset to their previous state so
+// that none is left running without a deployment behind it.
+func markBatchRunning(contexts []*deploymentDeploymentContext, save func(core.Model) error) error {
+	fields := []string{"status", "started_at", "logs"}
+	previous := make([]map[string]any, 0, len(contexts))
+
+	for i, deployCtx := range contexts {
+		record := deployCtx.DeploymentRecord
+		state := make(map[string]any, len(fields))
+		for _, field := range fields {
+			state[field] = record.Get(field)
+		}
+		previous = append(previous, state)
+
+		setDeploymentRunning(record)
+		if err := save(record); err != nil {
+			for j := i; j >= 0; j-- {
+				reset := contexts[j].DeploymentRecord
+				for field, value := range previous[j] {
+					reset.Set(field, value)
+				}
+				if j < i {
+					if resetErr := save(reset); resetErr != nil {
+						logger.GetAPILogger().Error("Failed to reset deployment %s: %v", reset.Id, resetErr)
+					}
+				}
+			}
+			return fmt.Errorf("deployment %s: %w", record.Id, err)
+		}
+	}
+	return nil
+}
+
+// logBatchResults marks skipped deployments as failed and logs a summary.
+// performDeployment has already recorded the failures it returned.
+func logBatchResults(app core.App, log *logger.Logger, servers []*models.Server, contexts map[*models.Server]*deploymentDeploymentContext, results []ServerDeployResult) {
+	var succeeded, failed, skipped int
+	for i, result := range results {
+		deployCtx := contexts[servers[i]]
+		result.DeploymentID = deployCtx.DeploymentRecord.Id
+
+		switch result.Status {
+		case "success":
+			succeeded++
+			log.Success("Batch deployment %s to %s succeeded in %s", result.DeploymentID, result.Host, result.Duration.Round(time.Second))
+		case "failed":
+			failed++
+			log.Error("Batch deployment %s to %s failed: %s", result.DeploymentID, result.Host, result.Error)
+		default:
+			skipped++
+			updateDeploymentStatus(app, deployCtx.DeploymentRecord, "failed", fmt.Sprintf("Deployment skipped: %s", result.Error))
+			log.Warning("Batch deployment %s to %s skipped: %s", result.DeploymentID, result.Host, result.Error)
+		}
+	}
+
+	log.Info("Batch deployment finished: %d succeeded, %d failed, %d skipped", succeeded, failed, skipped)
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"pb-deployer/internal/models"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func testServers(hosts ...string) []*models.Server {
+	servers := make([]*models.Server, 0, len(hosts))
+	for _, host := range hosts {
+		servers = append(servers, &models.Server{ID: host, Host: host})
+	}
+	return servers
+}
+
+func TestDeployToServersAllSucceed(t *testing.T) {
+	servers := testServers("a", "b", "c")
+
+	results := deployToServers(context.Background(), servers, MultiDeployOptions{}, func(ctx context.Context, server *models.Server) error {
+		return nil
+	})
+
+	for i, result := range results {
+		if result.Status != "success" {
+			t.Errorf("Expected %s to succeed, got %s", servers[i].Host, result.Status)
+		}
+		if result.Host != servers[i].Host {
+			t.Errorf("Expected results in input order, got %s at %d", result.Host, i)
+		}
+	}
+}
+
+func TestDeployToServersRespectsMaxParallel(t *testing.T) {
+	servers := testServers("a", "b", "c", "d", "e")
+	var running, peak atomic.Int32
+
+	deployToServers(context.Background(), servers, MultiDeployOptions{MaxParallel: 2}, func(ctx context.Context, server *models.Server) error {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		running.Add(-1)
+		return nil
+	})
+
+	if peak.Load() > 2 {
+		t.Errorf("Expected at most 2 concurrent deployments, got %d", peak.Load())
+	}
+}
+
+func TestDeployToServersCanaryFailureSkipsRest(t *testing.T) {
+	servers := testServers("canary", "b", "c")
+	var calls atomic.Int32
+
+	results := deployToServers(context.Background(), servers, MultiDeployOptions{Canary: true}, func(ctx context.Context, server *models.Server) error {
+		calls.Add(1)
+		return errors.New("health check failed")
+	})
+
+	if calls.Load() != 1 {
+		t.Errorf("Expected only the canary to be deployed, got %d deployments", calls.Load())
+	}
+	if results[0].Status != "failed" || results[0].Error != "health check failed" {
+		t.Errorf("Expected canary failure to be reported, got %+v", results[0])
+	}
+	for _, result := range results[1:] {
+		if result.Status != "skipped" {
+			t.Errorf("Expected %s to be skipped, got %s", result.Host, result.Status)
+		}
+	}
+}
+
+func TestDeployToServersFailFast(t *testing.T) {
+	servers := testServers("a", "b", "c", "d")
+
+	results := deployToServers(context.Background(), servers, MultiDeployOptions{MaxParallel: 1, FailFast: true}, func(ctx context.Context, server *models.Server) error {
+		if server.Host == "b" {
+			return errors.New("boom")
+		}
+		return nil
+	})
+
+	want := []string{"success", "failed", "skipped", "skipped"}
+	for i, result := range results {
+		if result.Status != want[i] {
+			t.Errorf("Expected %s to be %s, got %s", result.Host, want[i], result.Status)
+		}
+	}
+}
+
+func TestDeployToServersWithoutFailFastContinues(t *testing.T) {
+	servers := testServers("a", "b", "c")
+
+	results := deployToServers(context.Background(), servers, MultiDeployOptions{MaxParallel: 1}, func(ctx context.Context, server *models.Server) error {
+		if server.Host == "a" {
+			return errors.New("boom")
+		}
+		return nil
+	})
+
+	if results[0].Status != "failed" || results[1].Status != "success" || results[2].Status != "success" {
+		t.Errorf("Expected later servers to deploy after a failure, got %+v", results)
+	}
+}
+
+func TestCheckBatchDuplicates(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []deployRequest
+		wantErr string
+	}{
+		{"distinct", []deployRequest{{AppID: "a", DeploymentID: "d1"}, {AppID: "b", DeploymentID: "d2"}}, ""},
+		{"same deployment", []deployRequest{{AppID: "a", DeploymentID: "d1"}, {AppID: "b", DeploymentID: "d1"}}, "deployment_id d1"},
+		{"same app", []deployRequest{{AppID: "a", DeploymentID: "d1"}, {AppID: "a", DeploymentID: "d2"}}, "app_id a"},
+		{"missing ids left to validation", []deployRequest{{}, {}}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkBatchDuplicates(tt.entries)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.HasPrefix(err.Error(), "deployments[1]") {
+				t.Errorf("Expected an error about deployments[1] and %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func batchContexts(ids ...string) []*deploymentDeploymentContext {
+	collection := core.NewBaseCollection("deployments")
+	contexts := make([]*deploymentDeploymentContext, 0, len(ids))
+	for _, id := range ids {
+		record := core.NewRecord(collection)
+		record.Id = id
+		record.Set("status", "pending")
+		record.Set("logs", "queued\n")
+		contexts = append(contexts, &deploymentDeploymentContext{DeploymentRecord: record})
+	}
+	return contexts
+}
+
+func TestMarkBatchRunningInOrder(t *testing.T) {
+	contexts := batchContexts("d1", "d2", "d3")
+
+	var saved []string
+	err := markBatchRunning(contexts, func(model core.Model) error {
+		saved = append(saved, model.PK().(string))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("markBatchRunning() error = %v", err)
+	}
+
+	if want := []string{"d1", "d2", "d3"}; !slices.Equal(saved, want) {
+		t.Errorf("Expected saves in input order %q, got %q", want, saved)
+	}
+	for _, deployCtx := range contexts {
+		if status := deployCtx.DeploymentRecord.GetString("status"); status != "running" {
+			t.Errorf("Expected %s to be running, got %q", deployCtx.DeploymentRecord.Id, status)
+		}
+	}
+}
+
+func TestMarkBatchRunningResetsOnFailure(t *testing.T) {
+	contexts := batchContexts("d1", "d2", "d3")
+
+	var saved []string
+	err := markBatchRunning(contexts, func(model core.Model) error {
+		record := model.(*core.Record)
+		saved = append(saved, record.Id+"="+record.GetString("status"))
+		if record.Id == "d2" {
+			return errors.New("database is locked")
+		}
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "d2") {
+		t.Fatalf("Expected the d2 save error, got %v", err)
+	}
+
+	if want := []string{"d1=running", "d2=running", "d1=pending"}; !slices.Equal(saved, want) {
+		t.Errorf("Expected d1 to be reset after d2 failed, saves were %q", saved)
+	}
+	for _, deployCtx := range contexts {
+		record := deployCtx.DeploymentRecord
+		if record.GetString("status") != "pending" || record.GetString("logs") != "queued\n" {
+			t.Errorf("Expected %s to keep its previous state, got status=%q logs=%q", record.Id, record.GetString("status"), record.GetString("logs"))
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+// API_SOURCE
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// SSH endpoints may be called this many times per host in a burst, refilling
+// over sshRateWindow. Repeated failed logins from the deployer could otherwise
+// get it banned by fail2ban on the target.
+const (
+	sshRateBurst  = 5
+	sshRateWindow = time.Minute
+)
+
+// maxIdleBuckets is how many buckets are kept before full ones are dropped
+const maxIdleBuckets = 1024
+
+var sshLimiter = newHostLimiter(sshRateBurst, sshRateWindow)
+
+// hostLimiter is an in-memory token bucket per host
+type hostLimiter struct {
+	burst    float64
+	interval time.Duration // time to refill one token
+	buckets  map[string]*tokenBucket
+	now      func() time.Time
+	mu       sync.Mutex
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func newHostLimiter(burst int, window time.Duration) *hostLimiter {
+	return &hostLimiter{
+		burst:    float64(burst),
+		interval: window / time.Duration(burst),
+		buckets:  make(map[string]*tokenBucket),
+		now:      time.Now,
+	}
+}
+
+// allow takes a token for key and reports whether the call may proceed. When
+// it may not, it returns how long until the next token is available.
+func (l *hostLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if len(l.buckets) >= maxIdleBuckets {
+		l.dropFullBuckets(now)
+	}
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[key] = bucket
+	}
+
+	bucket.tokens = l.refill(bucket, now)
+	bucket.updated = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - bucket.tokens) * float64(l.interval))
+	return false, wait
+}
+
+func (l *hostLimiter) refill(bucket *tokenBucket, now time.Time) float64 {
+	elapsed := now.Sub(bucket.updated)
+	return math.Min(l.burst, bucket.tokens+float64(elapsed)/float64(l.interval))
+}
+
+func (l *hostLimiter) dropFullBuckets(now time.Time) {
+	for key, bucket := range l.buckets {
+		if l.refill(bucket, now) >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// tooManyRequestsResponse rejects an SSH request for host with 429 and a
+// Retry-After header in whole seconds
+func tooManyRequestsResponse(c *core.RequestEvent, host string, wait time.Duration) error {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Response.Header().Set("Retry-After", strconv.Itoa(seconds))
+	return c.JSON(http.StatusTooManyRequests, map[string]any{
+		"error":       fmt.Sprintf("Too many SSH requests for %s, retry in %ds", host, seconds),
+		"retry_after": seconds,
+	})
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHostLimiterBurstAndRefill(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := newHostLimiter(3, 30*time.Second)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.allow("a"); !ok {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+	}
+
+	ok, wait := limiter.allow("a")
+	if ok {
+		t.Fatal("Expected request beyond burst to be rejected")
+	}
+	if wait != 10*time.Second {
+		t.Errorf("Expected 10s wait, got %s", wait)
+	}
+
+	if ok, _ := limiter.allow("b"); !ok {
+		t.Error("Expected other hosts to have their own bucket")
+	}
+
+	now = now.Add(10 * time.Second)
+	if ok, _ := limiter.allow("a"); !ok {
+		t.Error("Expected a token to be refilled after the interval")
+	}
+	if ok, _ := limiter.allow("a"); ok {
+		t.Error("Expected only one token to be refilled")
+	}
+}
+
+func TestHostLimiterDropsFullBuckets(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := newHostLimiter(1, time.Second)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < maxIdleBuckets; i++ {
+		limiter.allow(fmt.Sprintf("host-%d", i))
+	}
+
+	now = now.Add(time.Second)
+	limiter.allow("new")
+	if len(limiter.buckets) != 1 {
+		t.Errorf("Expected refilled buckets to be dropped, %d left", len(limiter.buckets))
+	}
+}
+
+func TestHostLimiterConcurrent(t *testing.T) {
+	limiter := newHostLimiter(10, time.Hour)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _ := limiter.allow("a"); ok {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 10 {
+		t.Errorf("Expected exactly 10 requests allowed, got %d", allowed)
+	}
+}
@@ -4,22 +4,23 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"pb-deployer/internal/logger"
+	"pb-deployer/internal/models"
 	"pb-deployer/internal/tunnel"
 
 	"github.com/pocketbase/pocketbase/core"
 )
 
 func handleServerSetup(c *core.RequestEvent, app core.App) error {
-	log := logger.GetAPILogger()
+	requestID, log := requestLogger(c)
 	log.Info("Starting server setup process")
 
 	type setupRequest struct {
@@ -67,6 +68,16 @@ func handleServerSetup(c *core.RequestEvent, app core.App) error {
 		req.Port = 22
 	}
 
+	server := &models.Server{Host: req.Host, Port: req.Port, RootUsername: req.User, UseSSHAgent: true}
+	if err := server.Validate(); err != nil {
+		return invalidServerResponse(c, err)
+	}
+
+	if ok, wait := sshLimiter.allow(req.Host); !ok {
+		log.Warning("Rate limit exceeded for %s", req.Host)
+		return tooManyRequestsResponse(c, req.Host, wait)
+	}
+
 	sendStep(1, "Checking SSH agent and creating connection")
 
 	if !tunnel.IsAgentAvailable() {
@@ -76,7 +87,7 @@ func handleServerSetup(c *core.RequestEvent, app core.App) error {
 		})
 	}
 
-	client, err := createSSHClient(req.Host, req.Port, req.User)
+	client, err := createSSHClient(req.Host, req.Port, req.User, requestID)
 	if err != nil {
 		log.Error("Failed to create SSH client: %v", err)
 		return c.JSON(http.StatusInternalServerError, map[string]any{
@@ -101,7 +112,7 @@ func handleServerSetup(c *core.RequestEvent, app core.App) error {
 	sendStep(2, "Connecting to server")
 	if err := client.Connect(); err != nil {
 		// Handle host key unknown errors
-		if strings.Contains(err.Error(), "key is unknown") {
+		if errors.Is(err, tunnel.ErrHostKeyUnknown) {
 			if addErr := addHostKeyManually(req.Host, req.Port); addErr != nil {
 				return c.JSON(http.StatusInternalServerError, map[string]any{
 					"error": "Host key verification failed",
@@ -112,9 +123,13 @@ func handleServerSetup(c *core.RequestEvent, app core.App) error {
 					"error": "Connection failed after host key addition",
 				})
 			}
-		} else if strings.Contains(err.Error(), "known_hosts") {
+		} else if errors.Is(err, tunnel.ErrHostKeyMismatch) {
 			return c.JSON(http.StatusInternalServerError, map[string]any{
-				"error": "Corrupted known_hosts file",
+				"error": "Host key mismatch",
+			})
+		} else if errors.Is(err, tunnel.ErrAuthFailed) {
+			return c.JSON(http.StatusInternalServerError, map[string]any{
+				"error": "Authentication failed",
 			})
 		} else {
 			return c.JSON(http.StatusInternalServerError, map[string]any{
@@ -174,16 +189,26 @@ func handleServerSetup(c *core.RequestEvent, app core.App) error {
 }
 
 func handleServerSecurity(c *core.RequestEvent, app core.App) error {
-	log := logger.GetAPILogger()
+	requestID, log := requestLogger(c)
 	log.Info("Starting server security hardening process")
 
 	type securityRequest struct {
 		Host           string                `json:"host"`
 		Port           int                   `json:"port"`
 		User           string                `json:"user"`
+		Username       string                `json:"username"`
 		FirewallRules  []tunnel.FirewallRule `json:"firewall_rules"`
 		SSHConfig      *tunnel.SSHConfig     `json:"ssh_config"`
 		EnableFail2ban bool                  `json:"enable_fail2ban"`
+		// AutoInstallFirewall installs PreferredFirewall (default ufw) on
+		// servers that have no firewall
+		AutoInstallFirewall bool   `json:"auto_install_firewall"`
+		PreferredFirewall   string `json:"preferred_firewall"`
+		// AutomaticUpdates enables unattended security updates where supported
+		AutomaticUpdates      bool   `json:"automatic_updates"`
+		AutomaticUpdatesEmail string `json:"automatic_updates_email"`
+		// DryRun returns the commands that would run without changing the server
+		DryRun bool `json:"dry_run"`
 	}
 
 	sendStep := func(step int, message string) {
@@ -198,7 +223,7 @@ func handleServerSecurity(c *core.RequestEvent, app core.App) error {
 		})
 	}
 
-	log.Info("Received security request for host: %s, port: %d, user: %s", req.Host, req.Port, req.User)
+	log.Info("Received security request for host: %s, port: %d, user: %s, username: %s", req.Host, req.Port, req.User, req.Username)
 
 	if req.Host == "" {
 		log.Error("Validation failed: Host is required")
@@ -212,18 +237,34 @@ func handleServerSecurity(c *core.RequestEvent, app core.App) error {
 			"error": "User is required",
 		})
 	}
+	if req.Username == "" {
+		log.Error("Validation failed: Username is required")
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error": "Username is required",
+		})
+	}
 
 	if req.Port == 0 {
 		req.Port = 22
 	}
 
+	server := &models.Server{Host: req.Host, Port: req.Port, RootUsername: req.User, UseSSHAgent: true}
+	if err := server.Validate(); err != nil {
+		return invalidServerResponse(c, err)
+	}
+
+	if ok, wait := sshLimiter.allow(req.Host); !ok {
+		log.Warning("Rate limit exceeded for %s", req.Host)
+		return tooManyRequestsResponse(c, req.Host, wait)
+	}
+
 	sendStep(1, "Connecting to server")
 	if !tunnel.IsAgentAvailable() {
 		return c.JSON(http.StatusBadRequest, map[string]any{
 			"error": "SSH agent required",
 		})
 	}
-	client, err := createSSHClient(req.Host, req.Port, req.User)
+	client, err := createSSHClient(req.Host, req.Port, req.User, requestID)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]any{
 			"error": "Failed to create SSH client",
@@ -254,7 +295,15 @@ func handleServerSecurity(c *core.RequestEvent, app core.App) error {
 	manager := tunnel.NewManager(client)
 	cleanup.AddCloser(manager)
 
-	securityManager := tunnel.NewSecurityManager(manager)
+	securityOpts := []tunnel.SecurityOption{
+		tunnel.WithProgressCallback(func(update tunnel.ProgressUpdate) {
+			log.Info("Security %s %s (%d%%): %s", update.Step, update.Status, update.Percent, update.Message)
+		}),
+	}
+	if req.DryRun {
+		securityOpts = append(securityOpts, tunnel.WithDryRun())
+	}
+	securityManager := tunnel.NewSecurityManager(manager, securityOpts...)
 	cleanup.AddCloser(securityManager)
 
 	if len(req.FirewallRules) == 0 {
@@ -274,6 +323,23 @@ func handleServerSecurity(c *core.RequestEvent, app core.App) error {
 		HardenSSH:      true,
 		SSHConfig:      sshConfig,
 		EnableFail2ban: req.EnableFail2ban,
+		Fail2banConfig: securityManager.GetDefaultFail2banConfig(),
+
+		AutoInstallFirewall: req.AutoInstallFirewall,
+		PreferredFirewall:   req.PreferredFirewall,
+		SSHPort:             req.Port,
+		VerifyUser:          req.Username,
+
+		AutomaticUpdates:      req.AutomaticUpdates,
+		AutomaticUpdatesEmail: req.AutomaticUpdatesEmail,
+	}
+
+	if err := tunnel.ValidateSecurityConfig(securityConfig); err != nil {
+		log.Error("Security configuration rejected: %v", err)
+		return c.JSON(http.StatusBadRequest, map[string]any{
+			"error":   "Invalid security configuration",
+			"details": strings.Split(err.Error(), "\n"),
+		})
 	}
 
 	err = securityManager.SecureServer(securityConfig)
@@ -283,24 +349,43 @@ func handleServerSecurity(c *core.RequestEvent, app core.App) error {
 		})
 	}
 
+	if req.DryRun {
+		return c.JSON(http.StatusOK, map[string]any{
+			"success":  true,
+			"message":  "Dry run completed, no changes were made",
+			"commands": securityManager.DryRunCommands(),
+		})
+	}
+
 	sendStep(4, "Updating database")
 	err = updateServerSetupStatus(app, req.Host, false, true)
 	if err != nil {
 		log.Warning("Failed to update server security status: %v", err)
 	}
+
+	sshPort := req.Port
+	if sshConfig.Port != 0 && sshConfig.Port != req.Port {
+		sshPort = sshConfig.Port
+		if err := updateServerPort(app, req.Host, sshPort); err != nil {
+			log.Warning("Failed to record new SSH port %d: %v", sshPort, err)
+		}
+	}
+
 	return c.JSON(http.StatusOK, map[string]any{
 		"success": true,
 		"message": "Server security hardening completed successfully",
 		"applied_config": map[string]any{
-			"firewall_rules":   req.FirewallRules,
-			"ssh_hardened":     true,
-			"fail2ban_enabled": req.EnableFail2ban,
+			"firewall_rules":    req.FirewallRules,
+			"ssh_hardened":      true,
+			"ssh_port":          sshPort,
+			"fail2ban_enabled":  req.EnableFail2ban,
+			"automatic_updates": req.AutomaticUpdates,
 		},
 	})
 }
 
 func handleServerValidation(c *core.RequestEvent) error {
-	log := logger.GetAPILogger()
+	requestID, log := requestLogger(c)
 	log.Info("Starting server validation process")
 
 	type validationRequest struct {
@@ -343,6 +428,16 @@ func handleServerValidation(c *core.RequestEvent) error {
 		req.Port = 22
 	}
 
+	server := &models.Server{Host: req.Host, Port: req.Port, RootUsername: req.User, UseSSHAgent: true}
+	if err := server.Validate(); err != nil {
+		return invalidServerResponse(c, err)
+	}
+
+	if ok, wait := sshLimiter.allow(req.Host); !ok {
+		log.Warning("Rate limit exceeded for %s", req.Host)
+		return tooManyRequestsResponse(c, req.Host, wait)
+	}
+
 	log.Debug("Checking SSH agent availability")
 	if !tunnel.IsAgentAvailable() {
 		log.Error("SSH agent is not available")
@@ -353,7 +448,7 @@ func handleServerValidation(c *core.RequestEvent) error {
 	log.Debug("SSH agent is available")
 
 	log.Debug("Creating SSH client for %s@%s:%d", req.User, req.Host, req.Port)
-	client, err := createSSHClient(req.Host, req.Port, req.User)
+	client, err := createSSHClient(req.Host, req.Port, req.User, requestID)
 	if err != nil {
 		log.Error("Failed to create SSH client: %v", err)
 		return c.JSON(http.StatusInternalServerError, map[string]any{
@@ -440,35 +535,35 @@ func addHostKeyManually(host string, port int) error {
 	log := logger.GetAPILogger()
 	log.Info("Adding host key manually for %s:%d", host, port)
 
-	cmd := fmt.Sprintf("ssh-keyscan -p %d %s", port, host)
-
-	result, err := exec.Command("bash", "-c", cmd).Output()
-	if err != nil {
-		return fmt.Errorf("failed to scan host key: %w", err)
-	}
-
-	if len(result) == 0 {
-		return fmt.Errorf("no host key found for %s", host)
-	}
-
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return fmt.Errorf("failed to get home directory: %w", err)
 	}
-
 	knownHostsPath := filepath.Join(home, ".ssh", "known_hosts")
-	file, err := os.OpenFile(knownHostsPath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+
+	keys, err := tunnel.ScanHostKeys(host, port, knownHostsPath, 10*time.Second)
 	if err != nil {
-		return fmt.Errorf("failed to open known_hosts file: %w", err)
+		return fmt.Errorf("failed to scan host key: %w", err)
 	}
-	defer file.Close()
 
-	_, err = file.Write(result)
+	for _, key := range keys {
+		switch {
+		case key.Conflict:
+			log.Warning("HOST KEY CHANGED for %s (%s %s): known_hosts has a different key, remove the old entry with: ssh-keygen -R %s",
+				host, key.Algorithm, key.Fingerprint, host)
+		case key.Known:
+			log.Debug("Host key already trusted for %s: %s %s", host, key.Algorithm, key.Fingerprint)
+		default:
+			log.Info("Scanned host key for %s: %s %s", host, key.Algorithm, key.Fingerprint)
+		}
+	}
+
+	added, err := tunnel.AddScannedHostKeys(knownHostsPath, keys)
 	if err != nil {
-		return fmt.Errorf("failed to write host key: %w", err)
+		return err
 	}
 
-	log.Success("Successfully added host key for %s to known_hosts", host)
+	log.Success("Successfully added %d host key(s) for %s to known_hosts", added, host)
 	return nil
 }
 
@@ -501,8 +596,29 @@ func updateServerSetupStatus(app core.App, host string, setupComplete, securityL
 	return nil
 }
 
-func createSSHClient(host string, port int, user string) (*tunnel.Client, error) {
-	log := logger.GetAPILogger()
+// updateServerPort records the port sshd listens on after SecureServer moved it
+func updateServerPort(app core.App, host string, port int) error {
+	serverRecord, err := app.FindFirstRecordByFilter(
+		"servers",
+		"host = {:host}",
+		map[string]any{"host": host},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to find server record: %w", err)
+	}
+
+	serverRecord.Set("port", port)
+	if err := app.Save(serverRecord); err != nil {
+		return fmt.Errorf("failed to save server record: %w", err)
+	}
+
+	logger.GetAPILogger().Success("Server %s now uses SSH port %d", host, port)
+	return nil
+}
+
+// createSSHClient creates a tunnel client whose logs carry requestID, if set
+func createSSHClient(host string, port int, user string, requestID string) (*tunnel.Client, error) {
+	log := logger.GetAPILogger().WithFields(requestFields(requestID))
 	log.Debug("Creating SSH client config: host=%s, port=%d, user=%s", host, port, user)
 
 	config := tunnel.Config{
@@ -512,6 +628,7 @@ func createSSHClient(host string, port int, user string) (*tunnel.Client, error)
 		Timeout:    30 * time.Second,
 		RetryCount: 3,
 		RetryDelay: 5 * time.Second,
+		LogFields:  requestFields(requestID),
 	}
 
 	createClient := func() (*tunnel.Client, error) {
@@ -608,3 +725,18 @@ func getPublicKeysForSetup(publicKeys []string) []string {
 
 	return validKeys
 }
+
+// invalidServerResponse reports server validation errors per field
+func invalidServerResponse(c *core.RequestEvent, err error) error {
+	log := logger.GetAPILogger()
+	log.Error("Server validation failed: %v", err)
+
+	response := map[string]any{
+		"error": fmt.Sprintf("Invalid server configuration: %v", err),
+	}
+	var validationErrs models.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		response["fields"] = validationErrs.Fields()
+	}
+	return c.JSON(http.StatusBadRequest, response)
+}
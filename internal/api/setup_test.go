@@ -106,7 +106,7 @@ func TestCreateSSHClient_InvalidInputs(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			client, err := createSSHClient(tt.host, tt.port, tt.user)
+			client, err := createSSHClient(tt.host, tt.port, tt.user, "")
 
 			if tt.wantErr && err == nil {
 				t.Error("Expected error but got none")
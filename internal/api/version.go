@@ -0,0 +1,38 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// BuildInfo describes the running binary. The server's main package fills it
+// from the values the production build stamps in with -ldflags.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// NewBuildInfo returns the build metadata with the Go version of the running
+// binary
+func NewBuildInfo(version, commit, buildTime string) BuildInfo {
+	return BuildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+	}
+}
+
+// String formats the metadata as printed by the server's --version flag
+func (b BuildInfo) String() string {
+	return fmt.Sprintf("pb-deployer %s\ncommit: %s\nbuilt: %s\ngo: %s\n", b.Version, b.Commit, b.BuildTime, b.GoVersion)
+}
+
+func handleVersion(c *core.RequestEvent, build BuildInfo) error {
+	return c.JSON(http.StatusOK, build)
+}
@@ -1,15 +1,112 @@
 package logger
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
+	"maps"
 	"os"
+	"slices"
 	"strings"
 	"time"
 )
 
 type Logger struct {
 	prefix string
+	fields map[string]any
+}
+
+// Level is the minimum severity a message needs to be logged
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarning
+	LevelError
+)
+
+// Environment variables controlling log output
+const (
+	// LevelEnvVar sets the minimum level: debug, info, warning or error
+	LevelEnvVar = "PB_DEPLOYER_LOG_LEVEL"
+	// FormatEnvVar selects "json" output instead of the default colored text
+	FormatEnvVar = "PB_DEPLOYER_LOG_FORMAT"
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelWarning:
+		return "warning"
+	case LevelError:
+		return "error"
+	default:
+		return "info"
+	}
+}
+
+// ParseLevel parses a level name, accepting "warn" for warning
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarning, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, fmt.Errorf("unknown log level: %s", name)
+	}
+}
+
+// minLevel returns the configured minimum level. The legacy DEBUG variable
+// enables debug output when PB_DEPLOYER_LOG_LEVEL is not set.
+func minLevel() Level {
+	if name := os.Getenv(LevelEnvVar); name != "" {
+		if level, err := ParseLevel(name); err == nil {
+			return level
+		}
+	}
+	if os.Getenv("DEBUG") != "" {
+		return LevelDebug
+	}
+	return LevelInfo
+}
+
+func jsonOutput() bool {
+	return strings.EqualFold(os.Getenv(FormatEnvVar), "json")
+}
+
+// levelFor maps a message kind to the level used for filtering
+func levelFor(kind string) Level {
+	switch kind {
+	case "DEBUG":
+		return LevelDebug
+	case "WARNING":
+		return LevelWarning
+	case "ERROR":
+		return LevelError
+	default:
+		return LevelInfo
+	}
+}
+
+// Enabled reports whether messages at level would be logged
+func (l *Logger) Enabled(level Level) bool {
+	return level >= minLevel()
+}
+
+// WithFields returns a logger that attaches fields to every message. Fields
+// of the receiver are kept, with the new values taking precedence.
+func (l *Logger) WithFields(fields map[string]any) *Logger {
+	merged := make(map[string]any, len(l.fields)+len(fields))
+	maps.Copy(merged, l.fields)
+	maps.Copy(merged, fields)
+	return &Logger{prefix: l.prefix, fields: merged}
 }
 
 const (
@@ -52,13 +149,23 @@ func GetTunnelLogger() *Logger {
 }
 
 func (l *Logger) formatMessage(level, symbol, color, message string, args ...any) {
-	timestamp := time.Now().Format("15:04:05.000")
+	severity := levelFor(level)
+	if !l.Enabled(severity) {
+		return
+	}
 
 	if len(args) > 0 {
 		message = fmt.Sprintf(message, args...)
 	}
 
-	// Format: [15:04:05.000] ✓ [API] Message
+	if jsonOutput() {
+		l.writeJSON(severity, level, message)
+		return
+	}
+
+	timestamp := time.Now().Format("15:04:05.000")
+
+	// Format: [15:04:05.000] ✓ [API] Message key=value
 	logLine := fmt.Sprintf("%s[%s]%s %s%s%s %s[%s]%s %s",
 		Dim, timestamp, Reset,
 		color, symbol, Reset,
@@ -66,9 +173,39 @@ func (l *Logger) formatMessage(level, symbol, color, message string, args ...any
 		message,
 	)
 
+	for _, key := range slices.Sorted(maps.Keys(l.fields)) {
+		logLine += fmt.Sprintf(" %s%s=%s%v", Dim, key, Reset, l.fields[key])
+	}
+
 	log.Print(logLine)
 }
 
+// writeJSON writes one JSON object per line. encoding/json sorts map keys,
+// so fields are always emitted in the same order.
+func (l *Logger) writeJSON(severity Level, kind, message string) {
+	entry := map[string]any{
+		"time":   time.Now().UTC().Format(time.RFC3339Nano),
+		"level":  severity.String(),
+		"kind":   strings.ToLower(kind),
+		"logger": l.prefix,
+		"msg":    message,
+	}
+	if len(l.fields) > 0 {
+		entry["fields"] = l.fields
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		line, _ = json.Marshal(map[string]any{
+			"level":  LevelError.String(),
+			"logger": l.prefix,
+			"msg":    fmt.Sprintf("failed to encode log entry: %v", err),
+		})
+	}
+
+	fmt.Fprintln(log.Writer(), string(line))
+}
+
 func (l *Logger) Info(message string, args ...any) {
 	l.formatMessage("INFO", SymbolInfo, Blue, message, args...)
 }
@@ -86,9 +223,7 @@ func (l *Logger) Error(message string, args ...any) {
 }
 
 func (l *Logger) Debug(message string, args ...any) {
-	if os.Getenv("DEBUG") != "" {
-		l.formatMessage("DEBUG", SymbolDebug, Gray, message, args...)
-	}
+	l.formatMessage("DEBUG", SymbolDebug, Gray, message, args...)
 }
 
 func (l *Logger) Step(step int, total int, message string, args ...any) {
@@ -184,7 +319,7 @@ func (l *Logger) FileTransfer(operation, local, remote string) {
 
 func (l *Logger) FileTransferComplete(operation string, err error) {
 	if err != nil {
-		l.formatMessage("FILE", SymbolError, Red, "%s failed: %v", operation, err)
+		l.formatMessage("ERROR", SymbolError, Red, "%s failed: %v", operation, err)
 	} else {
 		l.formatMessage("FILE", SymbolSuccess, Green, "%s completed", operation)
 	}
@@ -194,6 +329,10 @@ func (l *Logger) SystemOperation(operation string) {
 	l.formatMessage("SYS", SymbolDebug, Yellow, operation)
 }
 
+func WithFields(fields map[string]any) *Logger {
+	return defaultLogger.WithFields(fields)
+}
+
 func Info(message string, args ...any) {
 	defaultLogger.Info(message, args...)
 }
@@ -2,6 +2,7 @@ package logger
 
 import (
 	"bytes"
+	"encoding/json"
 	"log"
 	"os"
 	"strings"
@@ -424,3 +425,147 @@ func TestSymbols(t *testing.T) {
 		}
 	}
 }
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected Level
+		wantErr  bool
+	}{
+		{"debug", LevelDebug, false},
+		{"INFO", LevelInfo, false},
+		{"warn", LevelWarning, false},
+		{"warning", LevelWarning, false},
+		{" error ", LevelError, false},
+		{"verbose", LevelInfo, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, err := ParseLevel(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLevel(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+			if level != tt.expected {
+				t.Errorf("ParseLevel(%q) = %v, want %v", tt.name, level, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMinimumLevel(t *testing.T) {
+	logger := NewLogger("TEST")
+	t.Setenv(LevelEnvVar, "warning")
+
+	output := captureLogOutput(func() {
+		logger.Debug("debug message")
+		logger.Info("info message")
+		logger.Success("success message")
+		logger.Warning("warning message")
+		logger.Error("error message")
+	})
+
+	for _, skipped := range []string{"debug message", "info message", "success message"} {
+		if strings.Contains(output, skipped) {
+			t.Errorf("Expected %q to be filtered at warning level, got: %s", skipped, output)
+		}
+	}
+	for _, logged := range []string{"warning message", "error message"} {
+		if !strings.Contains(output, logged) {
+			t.Errorf("Expected %q at warning level, got: %s", logged, output)
+		}
+	}
+}
+
+func TestLevelOverridesDebugEnv(t *testing.T) {
+	logger := NewLogger("TEST")
+	t.Setenv("DEBUG", "1")
+	t.Setenv(LevelEnvVar, "info")
+
+	output := captureLogOutput(func() {
+		logger.Debug("debug message")
+	})
+
+	if output != "" {
+		t.Errorf("Expected %s=info to suppress debug output, got: %s", LevelEnvVar, output)
+	}
+}
+
+func TestWithFieldsComposes(t *testing.T) {
+	base := NewLogger("TEST")
+	first := base.WithFields(map[string]any{"host": "example.com", "port": 22})
+	second := first.WithFields(map[string]any{"port": 2222, "user": "root"})
+
+	if len(base.fields) != 0 {
+		t.Errorf("Expected base logger to be unchanged, got fields: %v", base.fields)
+	}
+	if first.fields["port"] != 22 {
+		t.Errorf("Expected first logger to keep port 22, got: %v", first.fields["port"])
+	}
+
+	expected := map[string]any{"host": "example.com", "port": 2222, "user": "root"}
+	for key, value := range expected {
+		if second.fields[key] != value {
+			t.Errorf("Expected field %s=%v, got %v", key, value, second.fields[key])
+		}
+	}
+	if second.prefix != "TEST" {
+		t.Errorf("Expected prefix to be kept, got: %s", second.prefix)
+	}
+}
+
+func TestWithFieldsTextOutputIsSorted(t *testing.T) {
+	logger := NewLogger("TEST").WithFields(map[string]any{"zeta": 1, "alpha": 2, "mid": 3})
+
+	for range 5 {
+		output := captureLogOutput(func() {
+			logger.Info("fields message")
+		})
+
+		alpha := strings.Index(output, "alpha=")
+		mid := strings.Index(output, "mid=")
+		zeta := strings.Index(output, "zeta=")
+		if alpha == -1 || !(alpha < mid && mid < zeta) {
+			t.Fatalf("Expected fields in sorted order, got: %s", output)
+		}
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	t.Setenv(FormatEnvVar, "json")
+	logger := NewLogger("TEST").WithFields(map[string]any{"host": "example.com", "port": 22})
+
+	output := captureLogOutput(func() {
+		logger.Warning("disk %s", "low")
+	})
+
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(strings.TrimSpace(output)), &entry); err != nil {
+		t.Fatalf("Expected a single JSON line, got %q: %v", output, err)
+	}
+
+	expected := map[string]any{
+		"level":  "warning",
+		"kind":   "warning",
+		"logger": "TEST",
+		"msg":    "disk low",
+	}
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Errorf("Expected %s=%v, got %v", key, value, entry[key])
+		}
+	}
+
+	fields, ok := entry["fields"].(map[string]any)
+	if !ok || fields["host"] != "example.com" || fields["port"] != float64(22) {
+		t.Errorf("Expected fields in JSON output, got: %v", entry["fields"])
+	}
+
+	if _, err := time.Parse(time.RFC3339Nano, entry["time"].(string)); err != nil {
+		t.Errorf("Expected RFC3339 time, got: %v", entry["time"])
+	}
+
+	if strings.Contains(output, "\033[") {
+		t.Errorf("Expected no ANSI color codes in JSON output: %s", output)
+	}
+}
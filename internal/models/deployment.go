@@ -17,6 +17,7 @@ type Deployment struct {
 	Logs        string     `json:"logs" db:"logs"`
 	StartedAt   *time.Time `json:"started_at" db:"started_at"`
 	CompletedAt *time.Time `json:"completed_at" db:"completed_at"`
+	DataBackup  string     `json:"data_backup" db:"data_backup"` // remote pb_data snapshot taken before the deploy
 }
 
 func (d *Deployment) TableName() string {
@@ -89,7 +90,7 @@ func (d *Deployment) CreateCollection(app core.App) error {
 	existingCollection, err := app.FindCollectionByNameOrId("deployments")
 	if err == nil && existingCollection != nil {
 		app.Logger().Info("createDeploymentsCollection: Deployments collection already exists")
-		return nil
+		return ensureDeploymentBackupField(app, existingCollection)
 	}
 
 	appsCollection, err := app.FindCollectionByNameOrId("apps")
@@ -138,6 +139,8 @@ func (d *Deployment) CreateCollection(app core.App) error {
 		Max:  100000, // 100KB of logs
 	})
 
+	collection.Fields.Add(dataBackupField())
+
 	collection.Fields.Add(&core.DateField{
 		Name: "started_at",
 	})
@@ -171,3 +174,26 @@ func (d *Deployment) CreateCollection(app core.App) error {
 	app.Logger().Info("createDeploymentsCollection: Successfully created deployments collection")
 	return nil
 }
+
+func dataBackupField() *core.TextField {
+	return &core.TextField{
+		Name: "data_backup",
+		Max:  500,
+	}
+}
+
+// ensureDeploymentBackupField adds data_backup to collections created before it existed
+func ensureDeploymentBackupField(app core.App, collection *core.Collection) error {
+	if collection.Fields.GetByName("data_backup") != nil {
+		return nil
+	}
+
+	collection.Fields.Add(dataBackupField())
+	if err := app.Save(collection); err != nil {
+		app.Logger().Error("createDeploymentsCollection: Failed to add data_backup field", "error", err)
+		return err
+	}
+
+	app.Logger().Info("createDeploymentsCollection: Added data_backup field")
+	return nil
+}
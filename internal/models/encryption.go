@@ -0,0 +1,222 @@
+package models
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// SecretEnvVar holds the secret used to encrypt sensitive fields at rest
+const SecretEnvVar = "PB_DEPLOYER_SECRET"
+
+// encryptedPrefix marks an encrypted field value and its format version
+const encryptedPrefix = "enc:v1:"
+
+// serverEncryptedFields are the servers collection fields encrypted at rest
+var serverEncryptedFields = []string{"manual_key_path"}
+
+var (
+	fieldCipherOnce sync.Once
+	fieldCipher     cipher.AEAD
+	fieldCipherErr  error
+)
+
+// getFieldCipher returns the AES-GCM cipher derived from PB_DEPLOYER_SECRET,
+// or nil when the secret is not set
+func getFieldCipher() (cipher.AEAD, error) {
+	fieldCipherOnce.Do(func() {
+		secret := os.Getenv(SecretEnvVar)
+		if secret == "" {
+			return
+		}
+		fieldCipher, fieldCipherErr = newFieldCipher(secret)
+	})
+	return fieldCipher, fieldCipherErr
+}
+
+// newFieldCipher derives a 256-bit AES-GCM key from a secret
+func newFieldCipher(secret string) (cipher.AEAD, error) {
+	key, err := hkdf.Key(sha256.New, []byte(secret), nil, "pb-deployer field encryption", 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive encryption key: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// IsEncrypted reports whether a field value was written by encryptField
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// encryptField encrypts a plaintext value, leaving empty and already
+// encrypted values unchanged
+func encryptField(aead cipher.AEAD, value string) (string, error) {
+	if value == "" || IsEncrypted(value) {
+		return value, nil
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(value), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptField decrypts a value written by encryptField. Plaintext values
+// from before encryption was enabled are returned unchanged.
+func decryptField(aead cipher.AEAD, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %w", err)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("invalid encrypted value: too short")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value (wrong %s?): %w", SecretEnvVar, err)
+	}
+	return string(plaintext), nil
+}
+
+// decryptedString returns a record field, decrypting it when encrypted
+func decryptedString(record *core.Record, field string, getCipher func() (cipher.AEAD, error)) (string, error) {
+	value := record.GetString(field)
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	aead, err := getCipher()
+	if err != nil {
+		return "", err
+	}
+	if aead == nil {
+		return "", fmt.Errorf("%s is encrypted but %s is not set", field, SecretEnvVar)
+	}
+	return decryptField(aead, value)
+}
+
+// RegisterEncryption encrypts sensitive server fields on save when
+// PB_DEPLOYER_SECRET is set and decrypts them for API responses. Plaintext
+// records written before the secret was configured are encrypted the next
+// time they are saved. Startup fails when encrypted records exist but the
+// secret is missing or does not decrypt them.
+func RegisterEncryption(app core.App) {
+	registerEncryption(app, getFieldCipher)
+}
+
+func registerEncryption(app core.App, getCipher func() (cipher.AEAD, error)) {
+	app.OnServe().BindFunc(func(e *core.ServeEvent) error {
+		if err := checkEncryptedRecords(app, getCipher); err != nil {
+			app.Logger().Error("RegisterEncryption: Encrypted server fields cannot be read", "error", err)
+			return err
+		}
+		return e.Next()
+	})
+
+	encryptOnSave := func(e *core.RecordEvent) error {
+		aead, err := getCipher()
+		if err != nil {
+			return err
+		}
+		if aead == nil {
+			return e.Next()
+		}
+
+		plaintext := make(map[string]string, len(serverEncryptedFields))
+		for _, field := range serverEncryptedFields {
+			value, err := decryptField(aead, e.Record.GetString(field))
+			if err != nil {
+				return err
+			}
+			encrypted, err := encryptField(aead, value)
+			if err != nil {
+				return err
+			}
+			plaintext[field] = value
+			e.Record.Set(field, encrypted)
+		}
+
+		err = e.Next()
+
+		// Callers keep working with plaintext after the save
+		for field, value := range plaintext {
+			e.Record.Set(field, value)
+		}
+		return err
+	}
+
+	app.OnRecordCreate("servers").BindFunc(encryptOnSave)
+	app.OnRecordUpdate("servers").BindFunc(encryptOnSave)
+
+	app.OnRecordEnrich("servers").BindFunc(func(e *core.RecordEnrichEvent) error {
+		for _, field := range serverEncryptedFields {
+			value, err := decryptedString(e.Record, field, getCipher)
+			if err != nil {
+				app.Logger().Error("RegisterEncryption: Failed to decrypt server field",
+					"record", e.Record.Id, "field", field, "error", err)
+			}
+			e.Record.Set(field, value)
+		}
+		return e.Next()
+	})
+}
+
+// checkEncryptedRecords verifies encrypted server fields can be decrypted
+// with the configured secret
+func checkEncryptedRecords(app core.App, getCipher func() (cipher.AEAD, error)) error {
+	aead, err := getCipher()
+	if err != nil {
+		return err
+	}
+
+	for _, field := range serverEncryptedFields {
+		records, err := app.FindRecordsByFilter(
+			"servers",
+			field+" ~ {:prefix}",
+			"",
+			1,
+			0,
+			dbx.Params{"prefix": encryptedPrefix + "%"},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to check encrypted servers: %w", err)
+		}
+		if len(records) == 0 {
+			continue
+		}
+
+		if aead == nil {
+			return fmt.Errorf("servers contain encrypted %s values but %s is not set", field, SecretEnvVar)
+		}
+		if _, err := decryptField(aead, records[0].GetString(field)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
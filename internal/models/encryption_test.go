@@ -0,0 +1,196 @@
+package models
+
+import (
+	"crypto/cipher"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+func testCipher(t *testing.T, secret string) cipher.AEAD {
+	t.Helper()
+	aead, err := newFieldCipher(secret)
+	if err != nil {
+		t.Fatalf("newFieldCipher() error = %v", err)
+	}
+	return aead
+}
+
+// cipherGetter returns a getCipher func for registerEncryption and friends
+func cipherGetter(aead cipher.AEAD) func() (cipher.AEAD, error) {
+	return func() (cipher.AEAD, error) { return aead, nil }
+}
+
+// newServersApp returns a test app with the servers collection
+func newServersApp(t *testing.T) *tests.TestApp {
+	t.Helper()
+	app, err := tests.NewTestApp(t.TempDir())
+	if err != nil {
+		t.Fatalf("tests.NewTestApp() error = %v", err)
+	}
+	t.Cleanup(app.Cleanup)
+
+	if err := NewServer().CreateCollection(app); err != nil {
+		t.Fatalf("CreateCollection() error = %v", err)
+	}
+	return app
+}
+
+func saveServer(t *testing.T, app core.App, manualKeyPath string) *core.Record {
+	t.Helper()
+	collection, err := app.FindCollectionByNameOrId("servers")
+	if err != nil {
+		t.Fatalf("servers collection missing: %v", err)
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("name", "test")
+	record.Set("host", "example.com")
+	record.Set("port", 22)
+	record.Set("root_username", "root")
+	record.Set("app_username", "pocketbase")
+	record.Set("manual_key_path", manualKeyPath)
+	if err := app.Save(record); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	return record
+}
+
+func storedKeyPath(t *testing.T, app core.App, id string) string {
+	t.Helper()
+	record, err := app.FindRecordById("servers", id)
+	if err != nil {
+		t.Fatalf("FindRecordById() error = %v", err)
+	}
+	return record.GetString("manual_key_path")
+}
+
+func TestEncryptFieldRoundTrip(t *testing.T) {
+	aead := testCipher(t, "secret")
+
+	encrypted, err := encryptField(aead, "/home/deploy/.ssh/id_ed25519")
+	if err != nil {
+		t.Fatalf("encryptField() error = %v", err)
+	}
+	if !IsEncrypted(encrypted) || strings.Contains(encrypted, "id_ed25519") {
+		t.Errorf("encryptField() = %q, want an encrypted value", encrypted)
+	}
+
+	again, err := encryptField(aead, encrypted)
+	if err != nil || again != encrypted {
+		t.Errorf("encryptField() of an encrypted value = %q, %v; want it unchanged", again, err)
+	}
+
+	decrypted, err := decryptField(aead, encrypted)
+	if err != nil {
+		t.Fatalf("decryptField() error = %v", err)
+	}
+	if decrypted != "/home/deploy/.ssh/id_ed25519" {
+		t.Errorf("decryptField() = %q, want the original value", decrypted)
+	}
+}
+
+func TestDecryptFieldPassesPlaintextThrough(t *testing.T) {
+	aead := testCipher(t, "secret")
+
+	for _, value := range []string{"", "/home/deploy/.ssh/id_rsa"} {
+		got, err := decryptField(aead, value)
+		if err != nil || got != value {
+			t.Errorf("decryptField(%q) = %q, %v; want it unchanged", value, got, err)
+		}
+	}
+}
+
+func TestDecryptFieldWrongSecret(t *testing.T) {
+	encrypted, err := encryptField(testCipher(t, "secret"), "/home/deploy/.ssh/id_rsa")
+	if err != nil {
+		t.Fatalf("encryptField() error = %v", err)
+	}
+
+	_, err = decryptField(testCipher(t, "other"), encrypted)
+	if err == nil || !strings.Contains(err.Error(), SecretEnvVar) {
+		t.Errorf("decryptField() with the wrong secret error = %v, want one naming %s", err, SecretEnvVar)
+	}
+
+	if _, err := decryptField(testCipher(t, "secret"), encryptedPrefix+"not base64!"); err == nil {
+		t.Error("Expected a malformed value to fail")
+	}
+}
+
+func TestLegacyPlaintextEncryptedOnSave(t *testing.T) {
+	app := newServersApp(t)
+
+	// Saved before encryption was enabled
+	record := saveServer(t, app, "/home/deploy/.ssh/id_rsa")
+
+	aead := testCipher(t, "secret")
+	registerEncryption(app, cipherGetter(aead))
+
+	if got := storedKeyPath(t, app, record.Id); got != "/home/deploy/.ssh/id_rsa" {
+		t.Fatalf("Expected the legacy value to be stored as plaintext, got %q", got)
+	}
+
+	if err := app.Save(record); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if got := record.GetString("manual_key_path"); got != "/home/deploy/.ssh/id_rsa" {
+		t.Errorf("Expected the saved record to keep the plaintext, got %q", got)
+	}
+
+	stored := storedKeyPath(t, app, record.Id)
+	if !IsEncrypted(stored) {
+		t.Fatalf("Expected the value to be encrypted on save, got %q", stored)
+	}
+	if got, err := decryptField(aead, stored); err != nil || got != "/home/deploy/.ssh/id_rsa" {
+		t.Errorf("decryptField() of the stored value = %q, %v", got, err)
+	}
+}
+
+func TestCheckEncryptedRecords(t *testing.T) {
+	app := newServersApp(t)
+	aead := testCipher(t, "secret")
+
+	if err := checkEncryptedRecords(app, cipherGetter(nil)); err != nil {
+		t.Errorf("Expected no error without encrypted records, got %v", err)
+	}
+
+	registerEncryption(app, cipherGetter(aead))
+	saveServer(t, app, "/home/deploy/.ssh/id_rsa")
+
+	if err := checkEncryptedRecords(app, cipherGetter(aead)); err != nil {
+		t.Errorf("Expected the configured secret to pass, got %v", err)
+	}
+
+	err := checkEncryptedRecords(app, cipherGetter(nil))
+	if err == nil || !strings.Contains(err.Error(), "is not set") {
+		t.Errorf("Expected startup to fail without the secret, got %v", err)
+	}
+
+	if err := checkEncryptedRecords(app, cipherGetter(testCipher(t, "other"))); err == nil {
+		t.Error("Expected startup to fail with the wrong secret")
+	}
+}
+
+func TestServerFromRecordReportsDecryptionFailure(t *testing.T) {
+	app := newServersApp(t)
+	registerEncryption(app, cipherGetter(testCipher(t, "secret")))
+	record := saveServer(t, app, "/home/deploy/.ssh/id_rsa")
+
+	stored, err := app.FindRecordById("servers", record.Id)
+	if err != nil {
+		t.Fatalf("FindRecordById() error = %v", err)
+	}
+
+	// PB_DEPLOYER_SECRET is not set in tests, so the value cannot be read
+	t.Setenv(SecretEnvVar, "")
+	_, err = ServerFromRecord(stored)
+	if err == nil || !strings.Contains(err.Error(), SecretEnvVar) {
+		t.Errorf("ServerFromRecord() error = %v, want a decryption error naming %s", err, SecretEnvVar)
+	}
+
+	if _, err := decryptedString(stored, "manual_key_path", cipherGetter(testCipher(t, "other"))); err == nil {
+		t.Error("Expected decryptedString() to fail with the wrong secret")
+	}
+}
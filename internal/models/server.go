@@ -2,6 +2,8 @@ package models
 
 import (
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/pocketbase/pocketbase/core"
@@ -23,6 +25,36 @@ type Server struct {
 	SecurityLocked bool      `json:"security_locked" db:"security_locked"`
 }
 
+// FieldError describes a single invalid model field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ValidationErrors is returned by Validate when one or more fields are invalid
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	messages := make([]string, len(v))
+	for i, fieldErr := range v {
+		messages[i] = fieldErr.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Fields returns the validation messages keyed by field name
+func (v ValidationErrors) Fields() map[string]string {
+	fields := make(map[string]string, len(v))
+	for _, fieldErr := range v {
+		fields[fieldErr.Field] = fieldErr.Message
+	}
+	return fields
+}
+
 func (s *Server) TableName() string {
 	return "servers"
 }
@@ -38,6 +70,61 @@ func NewServer() *Server {
 	}
 }
 
+// ServerFromRecord builds a Server from a servers collection record. It fails
+// when an encrypted field cannot be decrypted with PB_DEPLOYER_SECRET.
+func ServerFromRecord(record *core.Record) (*Server, error) {
+	manualKeyPath, err := decryptedString(record, "manual_key_path", getFieldCipher)
+	if err != nil {
+		return nil, fmt.Errorf("server %s: %w", record.Id, err)
+	}
+
+	return &Server{
+		ID:             record.Id,
+		Created:        record.GetDateTime("created").Time(),
+		Updated:        record.GetDateTime("updated").Time(),
+		Name:           record.GetString("name"),
+		Host:           record.GetString("host"),
+		Port:           record.GetInt("port"),
+		RootUsername:   record.GetString("root_username"),
+		AppUsername:    record.GetString("app_username"),
+		UseSSHAgent:    record.GetBool("use_ssh_agent"),
+		ManualKeyPath:  manualKeyPath,
+		SetupComplete:  record.GetBool("setup_complete"),
+		SecurityLocked: record.GetBool("security_locked"),
+	}, nil
+}
+
+// Validate checks the fields needed to open an SSH connection and returns
+// ValidationErrors listing every invalid field
+func (s *Server) Validate() error {
+	var errs ValidationErrors
+
+	if strings.TrimSpace(s.Host) == "" {
+		errs = append(errs, FieldError{Field: "host", Message: "is required"})
+	}
+
+	if s.Port < 1 || s.Port > 65535 {
+		errs = append(errs, FieldError{Field: "port", Message: "must be between 1 and 65535"})
+	}
+
+	if s.ManualKeyPath != "" {
+		if file, err := os.Open(s.ManualKeyPath); err != nil {
+			errs = append(errs, FieldError{Field: "manual_key_path", Message: fmt.Sprintf("is not readable: %v", err)})
+		} else {
+			file.Close()
+		}
+	}
+
+	if !s.UseSSHAgent && s.ManualKeyPath == "" {
+		errs = append(errs, FieldError{Field: "use_ssh_agent", Message: "SSH agent or a manual key path is required"})
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
 func (s *Server) GetSSHAddress() string {
 	if s.Port == 22 {
 		return s.Host
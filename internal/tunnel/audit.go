@@ -0,0 +1,220 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AuditCheck is the result of a single hardening check
+type AuditCheck struct {
+	Name     string
+	Expected string
+	Actual   string
+	Passed   bool
+}
+
+// SecurityAudit reports the live hardening state of a server
+type SecurityAudit struct {
+	Checks        []AuditCheck
+	Firewall      string
+	FirewallRules []string
+	Fail2banJails []string
+	// Score is the percentage of passed checks
+	Score int
+}
+
+// Passed reports whether every check passed
+func (a *SecurityAudit) Passed() bool {
+	for _, check := range a.Checks {
+		if !check.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *SecurityAudit) add(name, expected, actual string, passed bool) {
+	a.Checks = append(a.Checks, AuditCheck{
+		Name:     name,
+		Expected: expected,
+		Actual:   actual,
+		Passed:   passed,
+	})
+}
+
+// AuditConfiguration reads the live sshd, firewall and fail2ban state and
+// compares it against the defaults applied by SecureServer, without changing
+// anything on the server.
+func (s *SecurityManager) AuditConfiguration(ctx context.Context) (*SecurityAudit, error) {
+	s.logger.SystemOperation("Auditing server security configuration")
+
+	audit := &SecurityAudit{}
+
+	if err := s.auditSSH(audit); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.auditFirewall(audit); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.auditFail2ban(audit)
+
+	passed := 0
+	for _, check := range audit.Checks {
+		if check.Passed {
+			passed++
+		}
+	}
+	if len(audit.Checks) > 0 {
+		audit.Score = passed * 100 / len(audit.Checks)
+	}
+
+	s.logger.Info("Security audit: %d/%d checks passed (score %d)", passed, len(audit.Checks), audit.Score)
+	return audit, nil
+}
+
+// auditSSH compares the effective sshd configuration reported by "sshd -T"
+// against GetDefaultSSHConfig
+func (s *SecurityManager) auditSSH(audit *SecurityAudit) error {
+	result, err := s.manager.client.ExecuteSudo("sshd -T")
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return &Error{
+			Type:    ErrorExecution,
+			Message: fmt.Sprintf("failed to read sshd configuration: %s", result.Stderr),
+		}
+	}
+
+	settings := map[string]string{}
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if ok {
+			settings[key] = strings.TrimSpace(value)
+		}
+	}
+
+	expected := s.GetDefaultSSHConfig()
+
+	yesNoChecks := []struct {
+		name  string
+		key   string
+		value bool
+	}{
+		{"SSH PasswordAuthentication", "passwordauthentication", expected.PasswordAuth},
+		{"SSH PermitRootLogin", "permitrootlogin", expected.RootLogin},
+		{"SSH PubkeyAuthentication", "pubkeyauthentication", expected.PubkeyAuth},
+	}
+	for _, check := range yesNoChecks {
+		actual := settings[check.key]
+		// permitrootlogin may also be prohibit-password, which is neither
+		passed := (actual == "yes" || actual == "no") && yesNoToBool(actual) == check.value
+		audit.add(check.name, boolToYesNo(check.value), actual, passed)
+	}
+
+	maxAuthTries, err := strconv.Atoi(settings["maxauthtries"])
+	audit.add("SSH MaxAuthTries",
+		fmt.Sprintf("<= %d", expected.MaxAuthTries),
+		settings["maxauthtries"],
+		err == nil && maxAuthTries <= expected.MaxAuthTries)
+
+	return nil
+}
+
+// auditFirewall checks that the detected firewall is enabled and records
+// its active rules
+func (s *SecurityManager) auditFirewall(audit *SecurityAudit) error {
+	audit.Firewall = s.detectFirewall()
+
+	var enabled bool
+	switch audit.Firewall {
+	case "":
+		// No firewall installed
+	case "ufw":
+		status, err := s.manager.client.ExecuteSudo("ufw status")
+		if err != nil {
+			return err
+		}
+		enabled = strings.Contains(status.Stdout, "Status: active")
+
+		added, err := s.manager.client.ExecuteSudo("ufw show added")
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(added.Stdout, "\n") {
+			if line = strings.TrimSpace(line); strings.HasPrefix(line, "ufw ") {
+				audit.FirewallRules = append(audit.FirewallRules, strings.TrimPrefix(line, "ufw "))
+			}
+		}
+
+	case "firewalld":
+		state, err := s.manager.client.ExecuteSudo("firewall-cmd --state")
+		if err != nil {
+			return err
+		}
+		enabled = strings.TrimSpace(state.Stdout) == "running"
+
+		ports, err := s.manager.client.ExecuteSudo("firewall-cmd --list-ports")
+		if err != nil {
+			return err
+		}
+		for _, port := range strings.Fields(ports.Stdout) {
+			audit.FirewallRules = append(audit.FirewallRules, "allow "+strings.Replace(port, "-", ":", 1)+" from any")
+		}
+
+		rich, err := s.manager.client.ExecuteSudo("firewall-cmd --list-rich-rules")
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(rich.Stdout, "\n") {
+			if key := richRuleKey(line); key != "" {
+				audit.FirewallRules = append(audit.FirewallRules, key)
+			}
+		}
+
+	default:
+		rules, err := s.manager.client.ExecuteSudo("iptables -S INPUT")
+		if err != nil {
+			return err
+		}
+		enabled = strings.Contains(rules.Stdout, "-P INPUT DROP")
+
+		for _, line := range strings.Split(rules.Stdout, "\n") {
+			if key := iptablesRuleKey(line); key != "" {
+				audit.FirewallRules = append(audit.FirewallRules, key)
+			}
+		}
+	}
+
+	actual := "inactive"
+	if enabled {
+		actual = "active"
+	}
+	audit.add("Firewall enabled ("+audit.Firewall+")", "active", actual, enabled)
+	audit.add("Firewall rules present", "> 0",
+		strconv.Itoa(len(audit.FirewallRules)), len(audit.FirewallRules) > 0)
+
+	return nil
+}
+
+// auditFail2ban checks that fail2ban is running with an sshd jail
+func (s *SecurityManager) auditFail2ban(audit *SecurityAudit) {
+	jails, err := s.verifyFail2banJail("sshd", 1)
+	if err != nil {
+		audit.add("fail2ban sshd jail", "active", "inactive", false)
+		return
+	}
+
+	audit.Fail2banJails = jails
+	audit.add("fail2ban sshd jail", "active", "active", true)
+}
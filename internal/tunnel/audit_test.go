@@ -0,0 +1,301 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const hardenedSSHD = "port 22\n" +
+	"permitrootlogin no\n" +
+	"pubkeyauthentication yes\n" +
+	"passwordauthentication no\n" +
+	"maxauthtries 3\n"
+
+const fail2banStatus = "Status\n|- Number of jail:\t2\n`- Jail list:\tsshd, recidive\n"
+
+func TestAuditConfigurationHardenedServer(t *testing.T) {
+	client := &scriptedClient{results: []*Result{
+		{Stdout: hardenedSSHD},
+		{ExitCode: 0}, // which ufw
+		{Stdout: "Status: active\n"},
+		{Stdout: "Added user rules (see 'ufw status' for running firewall):\nufw allow 22/tcp\nufw allow from 10.0.0.0/8 to any port 8090 proto tcp\n"},
+		{Stdout: fail2banStatus},
+		{ExitCode: 0}, // fail2ban-client status sshd
+	}}
+	security := NewSecurityManager(NewManager(client))
+
+	audit, err := security.AuditConfiguration(context.Background())
+	if err != nil {
+		t.Fatalf("AuditConfiguration failed: %v", err)
+	}
+
+	if !audit.Passed() || audit.Score != 100 {
+		t.Errorf("Expected every check to pass, got score %d: %+v", audit.Score, audit.Checks)
+	}
+	if audit.Firewall != "ufw" {
+		t.Errorf("Firewall = %q, want ufw", audit.Firewall)
+	}
+	if want := []string{"allow 22/tcp", "allow from 10.0.0.0/8 to any port 8090 proto tcp"}; !slices.Equal(audit.FirewallRules, want) {
+		t.Errorf("FirewallRules = %q, want %q", audit.FirewallRules, want)
+	}
+	if want := []string{"sshd", "recidive"}; !slices.Equal(audit.Fail2banJails, want) {
+		t.Errorf("Fail2banJails = %q, want %q", audit.Fail2banJails, want)
+	}
+
+	want := []string{
+		"sudo sshd -T",
+		"which ufw",
+		"sudo ufw status",
+		"sudo ufw show added",
+		"sudo fail2ban-client status",
+		"sudo fail2ban-client status sshd",
+	}
+	if !slices.Equal(client.commands, want) {
+		t.Errorf("Expected only read commands:\n got %q\nwant %q", client.commands, want)
+	}
+}
+
+func TestAuditSSHParsing(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		failed []string
+	}{
+		{
+			name:   "hardened",
+			output: hardenedSSHD,
+		},
+		{
+			name:   "prohibit-password is not a yes or no",
+			output: strings.Replace(hardenedSSHD, "permitrootlogin no", "permitrootlogin prohibit-password", 1),
+			failed: []string{"SSH PermitRootLogin"},
+		},
+		{
+			name: "password login and too many tries",
+			output: strings.NewReplacer(
+				"passwordauthentication no", "passwordauthentication yes",
+				"maxauthtries 3", "maxauthtries 6",
+			).Replace(hardenedSSHD),
+			failed: []string{"SSH PasswordAuthentication", "SSH MaxAuthTries"},
+		},
+		{
+			name:   "missing settings fail",
+			output: "port 22\n",
+			failed: []string{"SSH PasswordAuthentication", "SSH PermitRootLogin", "SSH PubkeyAuthentication", "SSH MaxAuthTries"},
+		},
+		{
+			name:   "non-numeric MaxAuthTries",
+			output: strings.Replace(hardenedSSHD, "maxauthtries 3", "maxauthtries three", 1),
+			failed: []string{"SSH MaxAuthTries"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &scriptedClient{results: []*Result{{Stdout: tt.output}}}
+			security := NewSecurityManager(NewManager(client))
+
+			audit := &SecurityAudit{}
+			if err := security.auditSSH(audit); err != nil {
+				t.Fatalf("auditSSH failed: %v", err)
+			}
+			if len(audit.Checks) != 4 {
+				t.Fatalf("Expected 4 SSH checks, got %+v", audit.Checks)
+			}
+
+			var failed []string
+			for _, check := range audit.Checks {
+				if !check.Passed {
+					failed = append(failed, check.Name)
+				}
+			}
+			if !slices.Equal(failed, tt.failed) {
+				t.Errorf("Failed checks = %q, want %q", failed, tt.failed)
+			}
+		})
+	}
+}
+
+func TestAuditFirewallBackends(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []*Result
+		want    string
+		enabled bool
+		rules   []string
+	}{
+		{
+			name: "inactive ufw",
+			results: []*Result{
+				{ExitCode: 0}, // which ufw
+				{Stdout: "Status: inactive\n"},
+				{Stdout: "Added user rules (see 'ufw status' for running firewall):\n(None)\n"},
+			},
+			want: "ufw",
+		},
+		{
+			name: "firewalld",
+			results: []*Result{
+				{ExitCode: 1}, // which ufw
+				{ExitCode: 0}, // which firewall-cmd
+				{Stdout: "running\n"},
+				{Stdout: "22/tcp 6000-6007/tcp\n"},
+				{Stdout: `rule family="ipv4" source address="10.0.0.0/8" port protocol="tcp" port="8090" accept` + "\n"},
+			},
+			want:    "firewalld",
+			enabled: true,
+			rules:   []string{"allow 22/tcp from any", "allow 6000:6007/tcp from any", "allow 8090/tcp from 10.0.0.0/8"},
+		},
+		{
+			name: "iptables with a DROP policy",
+			results: []*Result{
+				{ExitCode: 1}, // which ufw
+				{ExitCode: 1}, // which firewall-cmd
+				{ExitCode: 0}, // which iptables
+				{Stdout: "-P INPUT DROP\n-A INPUT -i lo -j ACCEPT\n-A INPUT -p tcp -m tcp --dport 22 -j ACCEPT\n-A INPUT -s 10.0.0.0/8 -p tcp -m tcp --dport 8090 -j DROP\n"},
+			},
+			want:    "iptables",
+			enabled: true,
+			rules:   []string{"allow 22/tcp from any", "deny 8090/tcp from 10.0.0.0/8"},
+		},
+		{
+			name: "iptables accepting by default",
+			results: []*Result{
+				{ExitCode: 1},
+				{ExitCode: 1},
+				{ExitCode: 0},
+				{Stdout: "-P INPUT ACCEPT\n"},
+			},
+			want: "iptables",
+		},
+		{
+			name:    "no firewall",
+			results: []*Result{{ExitCode: 1}, {ExitCode: 1}, {ExitCode: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &scriptedClient{results: tt.results}
+			security := NewSecurityManager(NewManager(client))
+
+			audit := &SecurityAudit{}
+			if err := security.auditFirewall(audit); err != nil {
+				t.Fatalf("auditFirewall failed: %v", err)
+			}
+
+			if audit.Firewall != tt.want {
+				t.Errorf("Firewall = %q, want %q", audit.Firewall, tt.want)
+			}
+			if !slices.Equal(audit.FirewallRules, tt.rules) {
+				t.Errorf("FirewallRules = %q, want %q", audit.FirewallRules, tt.rules)
+			}
+			if len(audit.Checks) != 2 {
+				t.Fatalf("Expected 2 firewall checks, got %+v", audit.Checks)
+			}
+			if audit.Checks[0].Passed != tt.enabled {
+				t.Errorf("Enabled check = %+v, want passed %v", audit.Checks[0], tt.enabled)
+			}
+			if audit.Checks[1].Passed != (len(tt.rules) > 0) {
+				t.Errorf("Rules check = %+v, want passed %v", audit.Checks[1], len(tt.rules) > 0)
+			}
+		})
+	}
+}
+
+func TestAuditFail2ban(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []*Result
+		passed  bool
+		jails   []string
+	}{
+		{
+			name:    "sshd jail active",
+			results: []*Result{{Stdout: fail2banStatus}, {ExitCode: 0}},
+			passed:  true,
+			jails:   []string{"sshd", "recidive"},
+		},
+		{
+			name:    "no sshd jail",
+			results: []*Result{{Stdout: "Status\n`- Jail list:\trecidive\n"}},
+		},
+		{
+			name:    "fail2ban not running",
+			results: []*Result{{ExitCode: 255, Stderr: "Failed to access socket path"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &scriptedClient{results: tt.results}
+			security := NewSecurityManager(NewManager(client))
+
+			audit := &SecurityAudit{}
+			security.auditFail2ban(audit)
+
+			if len(audit.Checks) != 1 || audit.Checks[0].Passed != tt.passed {
+				t.Errorf("Checks = %+v, want passed %v", audit.Checks, tt.passed)
+			}
+			if !slices.Equal(audit.Fail2banJails, tt.jails) {
+				t.Errorf("Fail2banJails = %q, want %q", audit.Fail2banJails, tt.jails)
+			}
+		})
+	}
+}
+
+func TestAuditConfigurationFailures(t *testing.T) {
+	t.Run("sshd -T fails", func(t *testing.T) {
+		client := &scriptedClient{results: []*Result{{ExitCode: 1, Stderr: "sshd: command not found"}}}
+		security := NewSecurityManager(NewManager(client))
+
+		audit, err := security.AuditConfiguration(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "sshd: command not found") || audit != nil {
+			t.Errorf("Expected the sshd error and no audit, got %v, %+v", err, audit)
+		}
+	})
+
+	t.Run("connection error", func(t *testing.T) {
+		client := &scriptedClient{errs: []error{errors.New("connection reset")}}
+		security := NewSecurityManager(NewManager(client))
+
+		if _, err := security.AuditConfiguration(context.Background()); err == nil || err.Error() != "connection reset" {
+			t.Errorf("Expected the connection error, got %v", err)
+		}
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		client := &scriptedClient{results: []*Result{{Stdout: hardenedSSHD}}}
+		security := NewSecurityManager(NewManager(client))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := security.AuditConfiguration(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+		if len(client.commands) != 1 {
+			t.Errorf("Expected the audit to stop after sshd, ran %q", client.commands)
+		}
+	})
+
+	t.Run("partial hardening scores the passed checks", func(t *testing.T) {
+		client := &scriptedClient{results: []*Result{
+			{Stdout: strings.Replace(hardenedSSHD, "passwordauthentication no", "passwordauthentication yes", 1)},
+			{ExitCode: 1}, {ExitCode: 1}, {ExitCode: 1}, // no firewall
+			{ExitCode: 255},
+		}}
+		security := NewSecurityManager(NewManager(client))
+
+		audit, err := security.AuditConfiguration(context.Background())
+		if err != nil {
+			t.Fatalf("AuditConfiguration failed: %v", err)
+		}
+		// 3 of 7 checks pass: root login, pubkey and MaxAuthTries
+		if audit.Passed() || audit.Score != 42 {
+			t.Errorf("Expected score 42, got %d: %+v", audit.Score, audit.Checks)
+		}
+	})
+}
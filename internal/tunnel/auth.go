@@ -3,10 +3,12 @@ package tunnel
 import (
 	"bufio"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -335,9 +337,9 @@ func createEnhancedHostKeyCallback(knownHostsPath string, config AuthConfig) ssh
 		}
 
 		if hostFound {
-			return fmt.Errorf("host key verification failed: key mismatch for %s", hostname)
+			return fmt.Errorf("host key verification failed: %w for %s", ErrHostKeyMismatch, hostname)
 		}
-		return fmt.Errorf("host key verification failed: %s not found in known_hosts", hostname)
+		return fmt.Errorf("host key verification failed: %w, %s not found in known_hosts", ErrHostKeyUnknown, hostname)
 	}
 }
 
@@ -479,9 +481,8 @@ func wrapWithAutoAdd(callback ssh.HostKeyCallback, knownHostsPath string, debug
 	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
 		err := callback(hostname, remote, key)
 		if err != nil {
-			if strings.Contains(err.Error(), "not found") ||
-				strings.Contains(err.Error(), "no matching host key") ||
-				strings.Contains(err.Error(), "key is unknown") {
+			var keyErr *knownhosts.KeyError
+			if errors.As(err, &keyErr) && len(keyErr.Want) == 0 {
 				if debug {
 					fmt.Printf("[AUTH] Auto-adding unknown host key for %s\n", hostname)
 				}
@@ -692,3 +693,175 @@ func DiagnoseAuth(host, user string) (*AuthInfo, error) {
 
 	return info, nil
 }
+
+// HostKeyInfo describes a host key presented by a server during a scan
+type HostKeyInfo struct {
+	Algorithm   string
+	Fingerprint string
+	Line        string
+	Known       bool
+	Conflict    bool
+	Key         ssh.PublicKey
+}
+
+// scanHostKeyAlgorithms lists the host key algorithms requested one at a time
+// so that every key type the server offers is captured
+var scanHostKeyAlgorithms = []string{
+	ssh.KeyAlgoED25519,
+	ssh.KeyAlgoECDSA256,
+	ssh.KeyAlgoECDSA384,
+	ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoRSASHA512,
+}
+
+// errHostKeyCaptured aborts a scan handshake once the host key has been read
+var errHostKeyCaptured = errors.New("host key captured")
+
+// ScanHostKeys connects to the server once per supported host key algorithm
+// and returns each distinct key it presents, compared against knownHostsPath.
+// An empty knownHostsPath uses ~/.ssh/known_hosts.
+func ScanHostKeys(host string, port int, knownHostsPath string, timeout time.Duration) ([]HostKeyInfo, error) {
+	if port == 0 {
+		port = 22
+	}
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+
+	if knownHostsPath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get home directory: %w", err)
+		}
+		knownHostsPath = filepath.Join(home, ".ssh", "known_hosts")
+	}
+
+	addr := net.JoinHostPort(host, fmt.Sprintf("%d", port))
+	var keys []HostKeyInfo
+	var lastErr error
+
+	for _, algo := range scanHostKeyAlgorithms {
+		var captured ssh.PublicKey
+		config := &ssh.ClientConfig{
+			User:              "pb-deployer-keyscan",
+			HostKeyAlgorithms: []string{algo},
+			Timeout:           timeout,
+			HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+				captured = key
+				return errHostKeyCaptured
+			},
+		}
+
+		client, err := ssh.Dial("tcp", addr, config)
+		if client != nil {
+			client.Close()
+		}
+		if captured == nil {
+			// The server does not offer this algorithm, or is unreachable
+			lastErr = err
+			continue
+		}
+
+		if slices.ContainsFunc(keys, func(k HostKeyInfo) bool { return k.Algorithm == captured.Type() }) {
+			continue
+		}
+
+		known, conflict := CheckKnownHostKey(knownHostsPath, addr, captured)
+		keys = append(keys, HostKeyInfo{
+			Algorithm:   captured.Type(),
+			Fingerprint: ssh.FingerprintSHA256(captured),
+			Line:        knownhosts.Line([]string{knownhosts.Normalize(addr)}, captured),
+			Known:       known,
+			Conflict:    conflict,
+			Key:         captured,
+		})
+	}
+
+	if len(keys) == 0 {
+		return nil, &Error{
+			Type:    ErrorConnection,
+			Message: fmt.Sprintf("no host keys could be scanned from %s", addr),
+			Cause:   lastErr,
+		}
+	}
+
+	return keys, nil
+}
+
+// CheckKnownHostKey reports whether key is already trusted for addr, and
+// whether known_hosts holds a different key of the same type (a changed key)
+func CheckKnownHostKey(knownHostsPath, addr string, key ssh.PublicKey) (known, conflict bool) {
+	if _, err := os.Stat(knownHostsPath); err != nil {
+		return false, false
+	}
+
+	cleanedPath, _, err := cleanKnownHostsFile(knownHostsPath, false)
+	if err != nil {
+		return false, false
+	}
+	defer os.Remove(cleanedPath)
+
+	callback, err := knownhosts.New(cleanedPath)
+	if err != nil {
+		return false, false
+	}
+
+	err = callback(addr, &net.TCPAddr{}, key)
+	if err == nil {
+		return true, false
+	}
+
+	var keyErr *knownhosts.KeyError
+	if errors.As(err, &keyErr) {
+		for _, want := range keyErr.Want {
+			if want.Key.Type() == key.Type() {
+				return false, true
+			}
+		}
+	}
+
+	return false, false
+}
+
+// AddScannedHostKeys appends known_hosts lines for scanned keys that are not
+// yet trusted. Conflicting keys are never written; an ErrorVerification is
+// returned instead so callers can warn about a possibly changed host key.
+func AddScannedHostKeys(knownHostsPath string, keys []HostKeyInfo) (int, error) {
+	if err := ensureKnownHostsFile(knownHostsPath); err != nil {
+		return 0, fmt.Errorf("failed to ensure known_hosts file: %w", err)
+	}
+
+	var conflicts []string
+	var lines []string
+	for _, key := range keys {
+		switch {
+		case key.Conflict:
+			conflicts = append(conflicts, fmt.Sprintf("%s %s", key.Algorithm, key.Fingerprint))
+		case !key.Known:
+			lines = append(lines, key.Line)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return 0, &Error{
+			Type:    ErrorVerification,
+			Message: fmt.Sprintf("host key changed, known_hosts has a different key for: %s", strings.Join(conflicts, ", ")),
+		}
+	}
+
+	if len(lines) == 0 {
+		return 0, nil
+	}
+
+	file, err := os.OpenFile(knownHostsPath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open known_hosts file for writing: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(strings.Join(lines, "\n") + "\n"); err != nil {
+		return 0, fmt.Errorf("failed to write host keys: %w", err)
+	}
+
+	return len(lines), nil
+}
@@ -1,6 +1,8 @@
 package tunnel
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
 	"io"
 	"os"
 	"path/filepath"
@@ -9,6 +11,7 @@ import (
 	"time"
 
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 func TestIsValidKnownHostsLine(t *testing.T) {
@@ -616,3 +619,84 @@ func (m *mockSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
 		Blob:   []byte("mock-signature"),
 	}, nil
 }
+
+func TestCheckKnownHostKey(t *testing.T) {
+	newKey := func() ssh.PublicKey {
+		pub, _, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatalf("Failed to generate key: %v", err)
+		}
+		key, err := ssh.NewPublicKey(pub)
+		if err != nil {
+			t.Fatalf("Failed to create public key: %v", err)
+		}
+		return key
+	}
+
+	trusted := newKey()
+	other := newKey()
+
+	tempDir := t.TempDir()
+	knownHostsPath := filepath.Join(tempDir, "known_hosts")
+	content := knownhosts.Line([]string{"example.com"}, trusted) + "\n" +
+		knownhosts.Line([]string{"[example.com]:2222"}, other) + "\n"
+	if err := os.WriteFile(knownHostsPath, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write known_hosts: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		addr         string
+		key          ssh.PublicKey
+		wantKnown    bool
+		wantConflict bool
+	}{
+		{"trusted key", "example.com:22", trusted, true, false},
+		{"changed key", "example.com:22", other, false, true},
+		{"trusted key on custom port", "example.com:2222", other, true, false},
+		{"unknown host", "other.example.com:22", trusted, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			known, conflict := CheckKnownHostKey(knownHostsPath, tt.addr, tt.key)
+			if known != tt.wantKnown {
+				t.Errorf("Expected known=%v, got %v", tt.wantKnown, known)
+			}
+			if conflict != tt.wantConflict {
+				t.Errorf("Expected conflict=%v, got %v", tt.wantConflict, conflict)
+			}
+		})
+	}
+}
+
+func TestAddScannedHostKeys(t *testing.T) {
+	tempDir := t.TempDir()
+	knownHostsPath := filepath.Join(tempDir, "known_hosts")
+
+	keys := []HostKeyInfo{
+		{Algorithm: "ssh-ed25519", Line: "example.com ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIA=="},
+		{Algorithm: "ecdsa-sha2-nistp256", Line: "example.com ecdsa-sha2-nistp256 AAAAE2VjZHNh", Known: true},
+	}
+
+	added, err := AddScannedHostKeys(knownHostsPath, keys)
+	if err != nil {
+		t.Fatalf("AddScannedHostKeys failed: %v", err)
+	}
+	if added != 1 {
+		t.Errorf("Expected 1 key added, got %d", added)
+	}
+
+	content, err := os.ReadFile(knownHostsPath)
+	if err != nil {
+		t.Fatalf("Failed to read known_hosts: %v", err)
+	}
+	if !strings.Contains(string(content), "ssh-ed25519") || strings.Contains(string(content), "ecdsa") {
+		t.Errorf("Unexpected known_hosts content: %q", content)
+	}
+
+	keys = append(keys, HostKeyInfo{Algorithm: "ssh-rsa", Fingerprint: "SHA256:abc", Conflict: true})
+	if _, err := AddScannedHostKeys(knownHostsPath, keys); err == nil {
+		t.Error("Expected error when a host key conflicts")
+	}
+}
@@ -0,0 +1,147 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Configuration files written by SetupAutomaticUpdates
+const (
+	aptAutoUpgradesPath       = "/etc/apt/apt.conf.d/20auto-upgrades"
+	aptUnattendedUpgradesPath = "/etc/apt/apt.conf.d/52pb-deployer-unattended-upgrades"
+	dnfAutomaticPath          = "/etc/dnf/automatic.conf"
+)
+
+// SetupAutomaticUpdates installs unattended-upgrades (apt) or dnf-automatic
+// (dnf) and configures it to apply security updates only. Results are logged
+// on the server and, when email is set, mailed there, which needs a working
+// local MTA. Other package managers return an error wrapping ErrUnsupported.
+func (s *SecurityManager) SetupAutomaticUpdates(email string) error {
+	s.logger.SystemOperation("Setting up automatic security updates")
+
+	pm, err := s.manager.PackageManager()
+	if err != nil {
+		return err
+	}
+
+	var files []struct{ path, content string }
+	var packages []string
+	var timer string
+	switch pm.Name() {
+	case "apt":
+		packages = []string{"unattended-upgrades"}
+		files = []struct{ path, content string }{
+			{aptAutoUpgradesPath, aptAutoUpgradesConfig},
+			{aptUnattendedUpgradesPath, buildUnattendedUpgradesConfig(email)},
+		}
+		timer = "apt-daily-upgrade.timer"
+	case "dnf":
+		packages = []string{"dnf-automatic"}
+		files = []struct{ path, content string }{
+			{dnfAutomaticPath, buildDNFAutomaticConfig(email)},
+		}
+		timer = "dnf-automatic.timer"
+	default:
+		return &Error{
+			Type:    ErrorNotFound,
+			Message: fmt.Sprintf("automatic security updates with %s", pm.Name()),
+			Cause:   ErrUnsupported,
+		}
+	}
+
+	if err := pm.Install(context.Background(), packages...); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		result, err := s.manager.client.ExecuteSudo(writeFileCommand(file.path, file.content))
+		if err != nil {
+			return err
+		}
+		if result.ExitCode != 0 {
+			return &Error{
+				Type:    ErrorExecution,
+				Message: fmt.Sprintf("failed to write %s: %s", file.path, result.Stderr),
+			}
+		}
+	}
+
+	if err := s.manager.ServiceEnable(timer); err != nil {
+		return err
+	}
+	if err := s.manager.ServiceStart(timer); err != nil {
+		return err
+	}
+
+	s.logger.Success("Automatic security updates enabled with %s", packages[0])
+	return nil
+}
+
+const aptAutoUpgradesConfig = `APT::Periodic::Update-Package-Lists "1";
+APT::Periodic::Unattended-Upgrade "1";
+`
+
+// buildUnattendedUpgradesConfig replaces the origins of the distribution's
+// 50unattended-upgrades with the security archives. Lists in apt.conf.d are
+// merged across files, hence the #clear.
+func buildUnattendedUpgradesConfig(email string) string {
+	var b strings.Builder
+	b.WriteString(`#clear Unattended-Upgrade::Allowed-Origins;
+#clear Unattended-Upgrade::Origins-Pattern;
+Unattended-Upgrade::Origins-Pattern {
+	"origin=${distro_id},archive=${distro_codename}-security";
+	"origin=Debian,codename=${distro_codename}-security,label=Debian-Security";
+	"origin=Debian,codename=${distro_codename},label=Debian-Security";
+};
+Unattended-Upgrade::SyslogEnable "true";
+`)
+	if email != "" {
+		fmt.Fprintf(&b, "Unattended-Upgrade::Mail %q;\n", email)
+		b.WriteString("Unattended-Upgrade::MailReport \"on-change\";\n")
+	}
+	return b.String()
+}
+
+// buildDNFAutomaticConfig renders automatic.conf applying security updates
+func buildDNFAutomaticConfig(email string) string {
+	emitVia := "stdio"
+	if email != "" {
+		emitVia = "stdio,email"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `[commands]
+upgrade_type = security
+random_sleep = 300
+download_updates = yes
+apply_updates = yes
+
+[emitters]
+emit_via = %s
+`, emitVia)
+	if email != "" {
+		fmt.Fprintf(&b, `
+[email]
+email_from = root@localhost
+email_to = %s
+email_host = localhost
+`, email)
+	}
+	return b.String()
+}
+
+// validateUpdateEmail rejects addresses that would break the generated
+// configuration files
+func validateUpdateEmail(email string) error {
+	if email == "" {
+		return nil
+	}
+	if strings.ContainsAny(email, " \t\r\n\"'`;$\\") || !strings.Contains(email, "@") {
+		return &Error{
+			Type:    ErrorVerification,
+			Message: fmt.Sprintf("invalid automatic updates email %q", email),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package tunnel
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSetupAutomaticUpdatesApt(t *testing.T) {
+	client := &scriptedClient{}
+	security := NewSecurityManager(NewManager(client))
+
+	if err := security.SetupAutomaticUpdates("ops@example.com"); err != nil {
+		t.Fatalf("SetupAutomaticUpdates failed: %v", err)
+	}
+
+	commands := strings.Join(client.commands, "\n")
+	for _, want := range []string{
+		"sudo DEBIAN_FRONTEND=noninteractive apt-get install -y 'unattended-upgrades'",
+		"sudo " + writeFileCommand(aptAutoUpgradesPath, aptAutoUpgradesConfig),
+		"sudo " + writeFileCommand(aptUnattendedUpgradesPath, buildUnattendedUpgradesConfig("ops@example.com")),
+		"sudo systemctl enable apt-daily-upgrade.timer",
+	} {
+		if !strings.Contains(commands, want) {
+			t.Errorf("Expected a command containing %q, got:\n%s", want, commands)
+		}
+	}
+}
+
+func TestSetupAutomaticUpdatesUnsupported(t *testing.T) {
+	client := &scriptedClient{results: []*Result{{ExitCode: 1}, {ExitCode: 1}, {ExitCode: 1}, {ExitCode: 0}}}
+	security := NewSecurityManager(NewManager(client))
+
+	err := security.SetupAutomaticUpdates("")
+	if !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported for pacman, got %v", err)
+	}
+	if len(client.commands) != 4 {
+		t.Errorf("Expected nothing to run after detection, got %q", client.commands)
+	}
+}
+
+func TestAutomaticUpdatesConfigSecurityOnly(t *testing.T) {
+	apt := buildUnattendedUpgradesConfig("")
+	if !strings.Contains(apt, "${distro_codename}-security") || strings.Contains(apt, "Mail ") {
+		t.Errorf("Unexpected unattended-upgrades config:\n%s", apt)
+	}
+	if !strings.Contains(buildUnattendedUpgradesConfig("ops@example.com"), `Unattended-Upgrade::Mail "ops@example.com";`) {
+		t.Error("Expected the report to be mailed")
+	}
+
+	dnf := buildDNFAutomaticConfig("ops@example.com")
+	for _, want := range []string{"upgrade_type = security", "apply_updates = yes", "emit_via = stdio,email", "email_to = ops@example.com"} {
+		if !strings.Contains(dnf, want) {
+			t.Errorf("Expected dnf-automatic config to contain %q:\n%s", want, dnf)
+		}
+	}
+}
+
+func TestValidateUpdateEmail(t *testing.T) {
+	for _, email := range []string{"", "ops@example.com"} {
+		if err := validateUpdateEmail(email); err != nil {
+			t.Errorf("validateUpdateEmail(%q) = %v", email, err)
+		}
+	}
+	for _, email := range []string{"ops", `ops@example.com"; rm -rf /`, "ops @example.com"} {
+		if err := validateUpdateEmail(email); err == nil {
+			t.Errorf("Expected %q to be rejected", email)
+		}
+	}
+}
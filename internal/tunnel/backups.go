@@ -0,0 +1,196 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dataBackupRoot holds pb_data snapshots, one directory per app
+const dataBackupRoot = "/opt/pocketbase/backups/data"
+
+// appDataDir is where both deployment layouts keep an app's pb_data
+func appDataDir(appName string) string {
+	return fmt.Sprintf("/opt/pocketbase/apps/%s/pb_data", appName)
+}
+
+func dataBackupDir(appName string) string {
+	return path.Join(dataBackupRoot, appName)
+}
+
+// dataBackupName matches the file names backupData gives its snapshots
+var dataBackupName = regexp.MustCompile(`^pb_data-[0-9]+\.tar\.gz$`)
+
+// isDataBackupOf reports whether archive names a snapshot of appName taken
+// by backupData
+func isDataBackupOf(archive, appName string) bool {
+	clean := path.Clean(archive)
+	return path.Dir(clean) == dataBackupDir(appName) && dataBackupName.MatchString(path.Base(clean))
+}
+
+// backupData snapshots pb_data into a timestamped tar.gz before the new
+// binary starts, so a bad migration can be undone with RestoreBackup. The
+// archive path is recorded on the deployment record and old snapshots are
+// pruned to KeepDataBackups.
+func (d *DeploymentManager) backupData(ctx context.Context, deployCtx *DeploymentContext) error {
+	req := deployCtx.Request
+	dataDir := appDataDir(req.AppName)
+
+	result, err := d.manager.client.Execute("test -d " + shellQuote(dataDir))
+	if err != nil || result.ExitCode != 0 {
+		d.logProgress(req, "No pb_data to back up (initial deployment)")
+		return nil
+	}
+
+	backupDir := dataBackupDir(req.AppName)
+	archive := fmt.Sprintf("%s/pb_data-%d.tar.gz", backupDir, time.Now().Unix())
+
+	d.logProgress(req, fmt.Sprintf("Backing up %s to %s", dataDir, archive))
+	result, err = d.manager.client.ExecuteSudo(
+		bashScript(fmt.Sprintf("mkdir -p %[1]s && chmod 700 %[1]s && tar -czf %[2]s -C %[3]s %[4]s",
+			shellQuote(backupDir), shellQuote(archive), shellQuote(path.Dir(dataDir)), shellQuote(path.Base(dataDir)))),
+		WithTimeout(10*time.Minute))
+	if err != nil || result.ExitCode != 0 {
+		return fmt.Errorf("failed to back up pb_data: %s", resultStderr(result))
+	}
+
+	size, err := d.verifyDataBackup(archive)
+	if err != nil {
+		d.manager.client.ExecuteSudo("rm -f " + shellQuote(archive))
+		return err
+	}
+
+	deployCtx.DataBackupPath = archive
+	d.recordDataBackup(req.DeploymentID, archive)
+	d.logProgress(req, fmt.Sprintf("pb_data backup created: %s (%d bytes)", archive, size))
+
+	d.pruneDataBackups(req)
+	return nil
+}
+
+// verifyDataBackup checks that the archive is non-empty and readable
+func (d *DeploymentManager) verifyDataBackup(archive string) (int64, error) {
+	result, err := d.manager.client.ExecuteSudo("stat -c%s " + shellQuote(archive))
+	if err != nil || result.ExitCode != 0 {
+		return 0, fmt.Errorf("pb_data backup missing: %s", resultStderr(result))
+	}
+	size, _ := strconv.ParseInt(strings.TrimSpace(result.Stdout), 10, 64)
+	if size == 0 {
+		return 0, fmt.Errorf("pb_data backup is empty: %s", archive)
+	}
+
+	result, err = d.manager.client.ExecuteSudo(bashScript(fmt.Sprintf("tar -tzf %s | head -n 1", shellQuote(archive))))
+	if err != nil || result.ExitCode != 0 || strings.TrimSpace(result.Stdout) == "" {
+		return 0, fmt.Errorf("pb_data backup is not a readable archive: %s", archive)
+	}
+
+	return size, nil
+}
+
+func (d *DeploymentManager) recordDataBackup(deploymentID, archive string) {
+	if d.app == nil || deploymentID == "" {
+		return
+	}
+
+	record, err := d.app.FindRecordById("deployments", deploymentID)
+	if err != nil {
+		d.logger.Warning("Failed to find deployment record: %v", err)
+		return
+	}
+
+	record.Set("data_backup", archive)
+	if err := d.app.Save(record); err != nil {
+		d.logger.Warning("Failed to record pb_data backup: %v", err)
+	}
+}
+
+// pruneDataBackups removes all but the newest KeepDataBackups snapshots
+func (d *DeploymentManager) pruneDataBackups(req *DeploymentRequest) {
+	keep := req.KeepDataBackups
+	if keep <= 0 {
+		keep = 5
+	}
+
+	cmd := bashScript(fmt.Sprintf("cd %s && ls -1t pb_data-*.tar.gz | tail -n +%d | xargs -r rm -f",
+		shellQuote(dataBackupDir(req.AppName)), keep+1))
+	if _, err := d.manager.client.ExecuteSudo(cmd); err != nil {
+		d.logger.Warning("Failed to prune old pb_data backups: %v", err)
+	}
+}
+
+// ListDataBackups returns the pb_data snapshots of an app, newest first
+func (d *DeploymentManager) ListDataBackups(appName string) ([]string, error) {
+	backupDir := dataBackupDir(appName)
+	result, err := d.manager.client.ExecuteSudo(bashScript(fmt.Sprintf("cd %s && ls -1t pb_data-*.tar.gz", shellQuote(backupDir))))
+	if err != nil {
+		return nil, err
+	}
+	if result.ExitCode != 0 {
+		return nil, &Error{
+			Type:    ErrorNotFound,
+			Message: fmt.Sprintf("no pb_data backups found for %s", appName),
+		}
+	}
+
+	var backups []string
+	for _, name := range strings.Fields(result.Stdout) {
+		backups = append(backups, path.Join(backupDir, name))
+	}
+	return backups, nil
+}
+
+// RestoreBackup replaces an app's pb_data with a snapshot taken by a
+// previous deployment. The service is stopped while the data is swapped and
+// started again afterwards. The replaced pb_data is kept next to the
+// original as pb_data.pre-restore-<timestamp> until the restore succeeds.
+func (d *DeploymentManager) RestoreBackup(ctx context.Context, appName, serviceName, archive string) error {
+	d.logger.SystemOperation(fmt.Sprintf("Restoring pb_data for %s from %s", appName, archive))
+
+	if !isDataBackupOf(archive, appName) {
+		return &Error{
+			Type:    ErrorPermission,
+			Message: fmt.Sprintf("%s is not a pb_data backup of %s", archive, appName),
+		}
+	}
+	if _, err := d.verifyDataBackup(archive); err != nil {
+		return err
+	}
+
+	dataDir := appDataDir(appName)
+	workingDir := path.Dir(dataDir)
+	previous := fmt.Sprintf("%s.pre-restore-%d", dataDir, time.Now().Unix())
+
+	result, err := d.manager.client.ExecuteSudo("systemctl stop " + shellQuote(serviceName))
+	if err != nil || result.ExitCode != 0 {
+		return fmt.Errorf("failed to stop service: %s", resultStderr(result))
+	}
+
+	result, err = d.manager.client.ExecuteSudo(bashScript(fmt.Sprintf("if [ -d %[1]s ]; then mv %[1]s %[2]s; fi", shellQuote(dataDir), shellQuote(previous))))
+	if err != nil || result.ExitCode != 0 {
+		d.manager.client.ExecuteSudo("systemctl start " + shellQuote(serviceName))
+		return fmt.Errorf("failed to move current pb_data aside: %s", resultStderr(result))
+	}
+
+	result, err = d.manager.client.ExecuteSudo(
+		bashScript(fmt.Sprintf("tar -xzf %[1]s -C %[2]s && chown -R --reference=%[2]s %[3]s", shellQuote(archive), shellQuote(workingDir), shellQuote(dataDir))),
+		WithTimeout(10*time.Minute))
+	if err != nil || result.ExitCode != 0 {
+		restoreErr := fmt.Errorf("failed to extract pb_data backup: %s", resultStderr(result))
+		d.manager.client.ExecuteSudo(bashScript(fmt.Sprintf("rm -rf %[1]s && if [ -d %[2]s ]; then mv %[2]s %[1]s; fi", shellQuote(dataDir), shellQuote(previous))))
+		d.manager.client.ExecuteSudo("systemctl start " + shellQuote(serviceName))
+		return restoreErr
+	}
+
+	result, err = d.manager.client.ExecuteSudo("systemctl start " + shellQuote(serviceName))
+	if err != nil || result.ExitCode != 0 {
+		return fmt.Errorf("pb_data restored but service failed to start (previous data kept at %s): %s", previous, resultStderr(result))
+	}
+
+	d.manager.client.ExecuteSudo("rm -rf " + shellQuote(previous))
+	d.logger.Success("Restored pb_data for %s from %s", appName, archive)
+	return nil
+}
@@ -0,0 +1,62 @@
+package tunnel
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestVerifyDataBackupQuotesArchive(t *testing.T) {
+	client := &scriptedClient{results: []*Result{{Stdout: "42\n"}, {Stdout: "pb_data/\n"}}}
+	deployer := NewDeploymentManager(NewManager(client), nil)
+
+	archive := "/opt/pocketbase/backups/data/my app/pb_data-1;reboot;.tar.gz"
+	size, err := deployer.verifyDataBackup(archive)
+	if err != nil {
+		t.Fatalf("verifyDataBackup() error = %v", err)
+	}
+	if size != 42 {
+		t.Errorf("verifyDataBackup() size = %d, want 42", size)
+	}
+
+	want := []string{
+		`sudo stat -c%s '/opt/pocketbase/backups/data/my app/pb_data-1;reboot;.tar.gz'`,
+		`sudo bash -c 'tar -tzf '\''/opt/pocketbase/backups/data/my app/pb_data-1;reboot;.tar.gz'\'' | head -n 1'`,
+	}
+	if !slices.Equal(client.commands, want) {
+		t.Errorf("Unexpected commands:\n got %q\nwant %q", client.commands, want)
+	}
+}
+
+func TestIsDataBackupOf(t *testing.T) {
+	tests := []struct {
+		archive string
+		want    bool
+	}{
+		{"/opt/pocketbase/backups/data/app/pb_data-1700000000.tar.gz", true},
+		{"/opt/pocketbase/backups/data/app/./pb_data-1.tar.gz", true},
+		{"/opt/pocketbase/backups/data/app/pb_data-1;reboot;.tar.gz", false},
+		{"/opt/pocketbase/backups/data/app/pb_data-$(id).tar.gz", false},
+		{"/opt/pocketbase/backups/data/app/other.tar.gz", false},
+		{"/opt/pocketbase/backups/data/other/pb_data-1.tar.gz", false},
+		{"/opt/pocketbase/backups/data/app/../other/pb_data-1.tar.gz", false},
+	}
+
+	for _, tt := range tests {
+		if got := isDataBackupOf(tt.archive, "app"); got != tt.want {
+			t.Errorf("isDataBackupOf(%q) = %v, want %v", tt.archive, got, tt.want)
+		}
+	}
+}
+
+func TestRestoreBackupRejectsForeignArchive(t *testing.T) {
+	client := &scriptedClient{}
+	deployer := NewDeploymentManager(NewManager(client), nil)
+
+	err := deployer.RestoreBackup(t.Context(), "app", "app", "/opt/pocketbase/backups/data/app/pb_data-1;reboot;.tar.gz")
+	if err == nil {
+		t.Fatal("Expected RestoreBackup to reject the archive")
+	}
+	if len(client.commands) != 0 {
+		t.Errorf("Expected no commands for a rejected archive, got %q", client.commands)
+	}
+}
@@ -0,0 +1,88 @@
+package tunnel
+
+import (
+	"sync"
+	"time"
+)
+
+// capabilityCache records what probes have found out about the server: the
+// commands on the PATH and the services that are active. It lives on the
+// Manager, which wraps a single connection, so repeated probes during a run
+// cost one round-trip. Probes that fail to run are not cached.
+type capabilityCache struct {
+	mu      sync.Mutex
+	entries map[string]bool
+}
+
+func (c *capabilityCache) lookup(key string) (value, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, ok = c.entries[key]
+	return value, ok
+}
+
+func (c *capabilityCache) store(key string, value bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]bool)
+	}
+	c.entries[key] = value
+}
+
+func (c *capabilityCache) forget(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+func (c *capabilityCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = nil
+}
+
+// HasCommand reports whether binary is on the server's PATH
+func (m *Manager) HasCommand(binary string) bool {
+	key := "command " + binary
+	if found, ok := m.capabilities.lookup(key); ok {
+		return found
+	}
+
+	result, err := m.client.Execute("which "+binary, WithTimeout(5*time.Second))
+	if err != nil {
+		return false
+	}
+	found := result.ExitCode == 0
+	m.capabilities.store(key, found)
+	return found
+}
+
+// ServiceActive reports whether a systemd unit is active. The cached state
+// is dropped when the service is started, stopped or restarted through the
+// Manager.
+func (m *Manager) ServiceActive(name string) bool {
+	key := "service " + name
+	if active, ok := m.capabilities.lookup(key); ok {
+		return active
+	}
+
+	result, err := m.client.ExecuteSudo("systemctl is-active --quiet " + name)
+	if err != nil {
+		return false
+	}
+	active := result.ExitCode == 0
+	m.capabilities.store(key, active)
+	return active
+}
+
+// InvalidateCapabilities drops every cached probe result. Call it after
+// changing the server in a way the cache cannot see, such as installing
+// packages outside PackageManager.
+func (m *Manager) InvalidateCapabilities() {
+	m.capabilities.clear()
+}
+
+func (m *Manager) invalidateService(name string) {
+	m.capabilities.forget("service " + name)
+}
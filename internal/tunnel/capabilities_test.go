@@ -0,0 +1,75 @@
+package tunnel
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestHasCommandCachesResults(t *testing.T) {
+	client := &scriptedClient{results: []*Result{
+		{ExitCode: 1}, // which ufw
+		{ExitCode: 0}, // which iptables
+	}}
+	manager := NewManager(client)
+
+	for range 3 {
+		if manager.HasCommand("ufw") {
+			t.Error("Expected ufw to be missing")
+		}
+		if !manager.HasCommand("iptables") {
+			t.Error("Expected iptables to be present")
+		}
+	}
+
+	if want := []string{"which ufw", "which iptables"}; !slices.Equal(client.commands, want) {
+		t.Errorf("Expected one probe per command, got %q", client.commands)
+	}
+}
+
+func TestHasCommandDoesNotCacheFailedProbes(t *testing.T) {
+	client := &scriptedClient{errs: []error{errors.New("connection reset")}}
+	manager := NewManager(client)
+
+	if manager.HasCommand("ufw") {
+		t.Error("Expected a failed probe to report the command missing")
+	}
+	if !manager.HasCommand("ufw") {
+		t.Error("Expected the second probe to run and find ufw")
+	}
+	if len(client.commands) != 2 {
+		t.Errorf("Expected the probe to be retried, got %q", client.commands)
+	}
+}
+
+func TestCapabilitiesInvalidatedByChanges(t *testing.T) {
+	client := &scriptedClient{results: []*Result{
+		{ExitCode: 1}, // which ufw
+		{ExitCode: 3}, // systemctl is-active
+	}}
+	manager := NewManager(client)
+
+	manager.HasCommand("ufw")
+	manager.ServiceActive("fail2ban")
+
+	manager.ServiceRestart("fail2ban")
+	if !manager.ServiceActive("fail2ban") {
+		t.Error("Expected the service to be probed again after a restart")
+	}
+
+	manager.InvalidateCapabilities()
+	if !manager.HasCommand("ufw") {
+		t.Error("Expected the command to be probed again after invalidation")
+	}
+
+	want := []string{
+		"which ufw",
+		"sudo systemctl is-active --quiet fail2ban",
+		"sudo systemctl restart fail2ban",
+		"sudo systemctl is-active --quiet fail2ban",
+		"which ufw",
+	}
+	if !slices.Equal(client.commands, want) {
+		t.Errorf("Unexpected commands %q", client.commands)
+	}
+}
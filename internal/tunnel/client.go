@@ -4,11 +4,14 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -18,6 +21,7 @@ import (
 
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 type Client struct {
@@ -31,6 +35,9 @@ type Client struct {
 	ctx     context.Context
 	cancel  context.CancelFunc
 	closed  bool
+
+	// authMethod is set by Connect from the auth methods it offered
+	authMethod string
 }
 
 func NewClient(config Config) (*Client, error) {
@@ -72,7 +79,7 @@ func NewClient(config Config) (*Client, error) {
 	client := &Client{
 		config: config,
 		tracer: &NoOpTracer{},
-		logger: logger.GetTunnelLogger(),
+		logger: logger.GetTunnelLogger().WithFields(config.LogFields),
 		ctx:    ctx,
 		cancel: cancel,
 	}
@@ -83,6 +90,17 @@ func NewClient(config Config) (*Client, error) {
 	return client, nil
 }
 
+// Logger returns the client's logger, carrying Config.LogFields
+func (c *Client) Logger() *logger.Logger {
+	return c.logger
+}
+
+// AuthMethod returns how the client authenticated, e.g. "ssh-agent", or ""
+// before Connect
+func (c *Client) AuthMethod() string {
+	return c.authMethod
+}
+
 func (c *Client) SetTracer(tracer Tracer) {
 	if tracer != nil {
 		c.tracer = tracer
@@ -133,6 +151,7 @@ func (c *Client) Connect() error {
 	c.logger.Info("SSH Agent: %d keys available (%v)", authResult.Info.KeysInAgent, authResult.Info.KeyTypes)
 
 	sshConfig.Auth = authResult.Methods
+	c.authMethod = authResult.Info.AuthMethod
 
 	var lastErr error
 	for i := 0; i <= c.config.RetryCount; i++ {
@@ -152,8 +171,10 @@ func (c *Client) Connect() error {
 			return nil
 		}
 
+		err = classifyConnectError(err)
+
 		// Retry with insecure mode for unknown host key errors
-		if strings.Contains(err.Error(), "key is unknown") && !usingInsecureMode {
+		if errors.Is(err, ErrHostKeyUnknown) && !usingInsecureMode {
 			c.logger.Warning("Host key unknown, retrying with insecure verification")
 			sshConfig.HostKeyCallback = ssh.InsecureIgnoreHostKey()
 			usingInsecureMode = true
@@ -164,16 +185,57 @@ func (c *Client) Connect() error {
 
 		lastErr = err
 		c.tracer.OnError("connect", err)
+
+		// Retrying a rejected key or a changed host key cannot succeed and
+		// repeated failed logins can get us banned by fail2ban
+		if errors.Is(err, ErrAuthFailed) || errors.Is(err, ErrHostKeyMismatch) {
+			break
+		}
 	}
 
 	c.tracer.OnDisconnect(c.config.Host)
+
+	errType := ErrorConnection
+	switch {
+	case errors.Is(lastErr, ErrAuthFailed), errors.Is(lastErr, ErrHostKeyMismatch):
+		errType = ErrorAuth
+	case errors.Is(lastErr, ErrTimeout):
+		errType = ErrorTimeout
+	}
 	return &Error{
-		Type:    ErrorConnection,
-		Message: fmt.Sprintf("failed to connect after %d attempts", c.config.RetryCount+1),
+		Type:    errType,
+		Message: fmt.Sprintf("failed to connect to %s:%d", c.config.Host, c.config.Port),
 		Cause:   lastErr,
 	}
 }
 
+// classifyConnectError wraps an ssh.Dial error with the matching ErrXxx
+// sentinel while keeping the original error in the chain
+func classifyConnectError(err error) error {
+	var keyErr *knownhosts.KeyError
+	var netErr net.Error
+	var sentinel error
+	switch {
+	case errors.Is(err, ErrHostKeyUnknown), errors.Is(err, ErrHostKeyMismatch):
+		return err
+	case errors.As(err, &keyErr):
+		sentinel = ErrHostKeyUnknown
+		if len(keyErr.Want) > 0 {
+			sentinel = ErrHostKeyMismatch
+		}
+	case errors.Is(err, syscall.ECONNREFUSED):
+		sentinel = ErrConnectionRefused
+	case errors.Is(err, os.ErrDeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		sentinel = ErrTimeout
+	case strings.Contains(err.Error(), "ssh: unable to authenticate"):
+		// x/crypto/ssh reports exhausted auth methods only as text
+		sentinel = ErrAuthFailed
+	default:
+		return err
+	}
+	return fmt.Errorf("%w: %w", sentinel, err)
+}
+
 func (c *Client) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -405,12 +467,15 @@ func (c *Client) ExecuteSudo(cmd string, opts ...ExecOption) (*Result, error) {
 		opt(cfg)
 	}
 
-	sudoCmd := "sudo "
+	// Answer the password prompt on a PTY rather than piping it through the
+	// command line, where it would be logged
 	if cfg.sudoPass != "" {
-		sudoCmd = fmt.Sprintf("echo '%s' | sudo -S ", cfg.sudoPass)
+		ctx, cancel := context.WithTimeout(c.ctx, cfg.timeout)
+		defer cancel()
+		return c.ExecuteWithPTY(ctx, c.buildCommand("sudo "+cmd, cfg), SudoPasswordResponder(cfg.sudoPass))
 	}
 
-	return c.Execute(sudoCmd+cmd, opts...)
+	return c.Execute("sudo "+cmd, opts...)
 }
 
 func (c *Client) Upload(localPath, remotePath string, opts ...FileOption) error {
@@ -424,7 +489,8 @@ func (c *Client) Upload(localPath, remotePath string, opts ...FileOption) error
 		opt(cfg)
 	}
 
-	if err := c.ensureSFTP(); err != nil {
+	sftpClient, err := c.ensureSFTP()
+	if err != nil {
 		c.tracer.OnUploadComplete(localPath, remotePath, err)
 		return err
 	}
@@ -452,13 +518,20 @@ func (c *Client) Upload(localPath, remotePath string, opts ...FileOption) error
 		return err
 	}
 
-	remoteFile, err := c.sftp.Create(remotePath)
+	if cfg.checkDiskSpace {
+		if err := c.checkRemoteDiskSpace(remotePath, stat.Size()); err != nil {
+			c.tracer.OnUploadComplete(localPath, remotePath, err)
+			return err
+		}
+	}
+
+	remoteFile, err := sftpClient.Create(remotePath)
 	if err != nil {
 		// Create parent directory and retry
 		remoteDir := filepath.Dir(remotePath)
-		c.sftp.MkdirAll(remoteDir)
+		sftpClient.MkdirAll(remoteDir)
 
-		remoteFile, err = c.sftp.Create(remotePath)
+		remoteFile, err = sftpClient.Create(remotePath)
 		if err != nil {
 			err = &Error{
 				Type:    ErrorFileTransfer,
@@ -471,10 +544,11 @@ func (c *Client) Upload(localPath, remotePath string, opts ...FileOption) error
 	}
 	defer remoteFile.Close()
 
+	src := c.throttle(localFile, cfg.bytesPerSecond)
 	if cfg.progress != nil {
-		err = c.copyWithProgress(localFile, remoteFile, stat.Size(), cfg.progress)
+		err = c.copyWithProgress(src, remoteFile, stat.Size(), cfg.progress)
 	} else {
-		_, err = io.Copy(remoteFile, localFile)
+		_, err = io.Copy(remoteFile, src)
 	}
 
 	if err != nil {
@@ -541,12 +615,13 @@ func (c *Client) Download(remotePath, localPath string, opts ...FileOption) erro
 		opt(cfg)
 	}
 
-	if err := c.ensureSFTP(); err != nil {
+	sftpClient, err := c.ensureSFTP()
+	if err != nil {
 		c.tracer.OnDownloadComplete(remotePath, localPath, err)
 		return err
 	}
 
-	remoteFile, err := c.sftp.Open(remotePath)
+	remoteFile, err := sftpClient.Open(remotePath)
 	if err != nil {
 		err = &Error{
 			Type:    ErrorFileTransfer,
@@ -588,10 +663,11 @@ func (c *Client) Download(remotePath, localPath string, opts ...FileOption) erro
 	}
 	defer localFile.Close()
 
+	src := c.throttle(remoteFile, cfg.bytesPerSecond)
 	if cfg.progress != nil {
-		err = c.copyWithProgress(remoteFile, localFile, stat.Size(), cfg.progress)
+		err = c.copyWithProgress(src, localFile, stat.Size(), cfg.progress)
 	} else {
-		_, err = io.Copy(localFile, remoteFile)
+		_, err = io.Copy(localFile, src)
 	}
 
 	if err != nil {
@@ -613,6 +689,210 @@ func (c *Client) Download(remotePath, localPath string, opts ...FileOption) erro
 	return nil
 }
 
+// checkRemoteDiskSpace returns an error when the filesystem holding remotePath
+// has fewer than size bytes available. Upload writes the file in place, so
+// the full size is required even when it replaces an existing file.
+func (c *Client) checkRemoteDiskSpace(remotePath string, size int64) error {
+	// Walk up to the nearest existing directory since the target may not exist yet
+	cmd := fmt.Sprintf(`d=%s; while [ ! -d "$d" ]; do d=$(dirname "$d"); done; df -Pk "$d" | tail -1`, shellQuote(filepath.Dir(remotePath)))
+	result, err := c.Execute(cmd, WithTimeout(10*time.Second))
+	if err != nil {
+		return err
+	}
+
+	if result.ExitCode != 0 {
+		return &Error{
+			Type:    ErrorFileTransfer,
+			Message: fmt.Sprintf("failed to determine free disk space for %s", remotePath),
+		}
+	}
+
+	return checkDiskSpace(result.Stdout, remotePath, size)
+}
+
+// checkDiskSpace parses the last line of `df -Pk` output and returns an error
+// when its filesystem has fewer than size bytes available.
+func checkDiskSpace(output, remotePath string, size int64) error {
+	fields := strings.Fields(output)
+	if len(fields) < 6 {
+		return &Error{
+			Type:    ErrorFileTransfer,
+			Message: fmt.Sprintf("failed to determine free disk space for %s", remotePath),
+		}
+	}
+
+	availableKB, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return &Error{
+			Type:    ErrorFileTransfer,
+			Message: fmt.Sprintf("failed to parse free disk space %q", fields[3]),
+			Cause:   err,
+		}
+	}
+
+	available := availableKB * 1024
+	if available < size {
+		return &Error{
+			Type:    ErrorFileTransfer,
+			Message: fmt.Sprintf("insufficient disk space on %s: need %d bytes, have %d bytes", fields[len(fields)-1], size, available),
+		}
+	}
+
+	return nil
+}
+
+// DownloadDirectory recursively downloads remotePath into localPath, recreating
+// directories and downloading every file unconditionally. Progress is reported
+// across the whole tree. Per-file failures are collected in the result rather
+// than aborting the transfer.
+func (c *Client) DownloadDirectory(remotePath, localPath string, opts ...FileOption) (*DirectoryTransferResult, error) {
+	c.tracer.OnDownload(remotePath, localPath)
+	c.logger.FileTransfer("Download directory", remotePath, localPath)
+
+	cfg := &fileTransferConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	sftpClient, err := c.ensureSFTP()
+	if err != nil {
+		c.tracer.OnDownloadComplete(remotePath, localPath, err)
+		return nil, err
+	}
+
+	type remoteEntry struct {
+		path string
+		rel  string
+		info os.FileInfo
+	}
+
+	// Walk the tree first so progress can be reported against the total size
+	var files []remoteEntry
+	var totalBytes int64
+	result := &DirectoryTransferResult{}
+
+	walker := sftpClient.Walk(remotePath)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("%s: %w", walker.Path(), err))
+			continue
+		}
+
+		rel, err := filepath.Rel(remotePath, walker.Path())
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("%s: %w", walker.Path(), err))
+			continue
+		}
+
+		info := walker.Stat()
+		if info.IsDir() {
+			if err := os.MkdirAll(filepath.Join(localPath, rel), 0755); err != nil {
+				result.Errors = append(result.Errors, fmt.Errorf("%s: %w", walker.Path(), err))
+				walker.SkipDir()
+			}
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		files = append(files, remoteEntry{path: walker.Path(), rel: rel, info: info})
+		totalBytes += info.Size()
+	}
+
+	if len(files) == 0 && len(result.Errors) > 0 {
+		err := &Error{
+			Type:    ErrorFileTransfer,
+			Message: "failed to read remote directory",
+			Cause:   result.Errors[0],
+		}
+		c.tracer.OnDownloadComplete(remotePath, localPath, err)
+		return result, err
+	}
+
+	var written int64
+	for _, file := range files {
+		n, err := c.downloadTreeFile(sftpClient, file.path, filepath.Join(localPath, file.rel), file.info, cfg, func(n int64) {
+			written += n
+			if cfg.progress != nil && totalBytes > 0 {
+				cfg.progress(int((written * 100) / totalBytes))
+			}
+		})
+		if err != nil {
+			c.logger.Warning("Failed to download %s: %v", file.path, err)
+			result.Errors = append(result.Errors, fmt.Errorf("%s: %w", file.path, err))
+			continue
+		}
+
+		result.Files++
+		result.Bytes += n
+	}
+
+	var transferErr error
+	if len(result.Errors) > 0 {
+		transferErr = &Error{
+			Type:    ErrorFileTransfer,
+			Message: fmt.Sprintf("%d of %d file(s) failed to download", len(result.Errors), len(files)),
+			Cause:   result.Errors[0],
+		}
+	}
+
+	c.logger.Info("Downloaded %d file(s), %d bytes from %s", result.Files, result.Bytes, remotePath)
+	c.logger.FileTransferComplete("Download directory", transferErr)
+	c.tracer.OnDownloadComplete(remotePath, localPath, transferErr)
+	return result, transferErr
+}
+
+// downloadTreeFile downloads a single file for DownloadDirectory, reporting
+// copied bytes through onWrite
+func (c *Client) downloadTreeFile(sftpClient *sftp.Client, remotePath, localPath string, info os.FileInfo, cfg *fileTransferConfig, onWrite func(int64)) (int64, error) {
+	remoteFile, err := sftpClient.Open(remotePath)
+	if err != nil {
+		return 0, err
+	}
+	defer remoteFile.Close()
+
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return 0, err
+	}
+
+	localFile, err := os.Create(localPath)
+	if err != nil {
+		return 0, err
+	}
+	defer localFile.Close()
+
+	n, err := io.Copy(&progressWriter{w: localFile, onWrite: onWrite}, c.throttle(remoteFile, cfg.bytesPerSecond))
+	if err != nil {
+		return n, err
+	}
+
+	if cfg.preserve {
+		if err := localFile.Chmod(info.Mode()); err != nil {
+			return n, fmt.Errorf("failed to preserve mode: %w", err)
+		}
+		if err := os.Chtimes(localPath, info.ModTime(), info.ModTime()); err != nil {
+			return n, fmt.Errorf("failed to preserve modification time: %w", err)
+		}
+	}
+
+	return n, nil
+}
+
+// progressWriter reports the number of bytes written through onWrite
+type progressWriter struct {
+	w       io.Writer
+	onWrite func(int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	if n > 0 {
+		p.onWrite(int64(n))
+	}
+	return n, err
+}
+
 // addCleanup adds a cleanup function to be called when the client is closed
 func (c *Client) addCleanup(cleanup func()) {
 	c.mu.Lock()
@@ -644,11 +924,11 @@ func (c *Client) buildCommand(cmd string, cfg *execConfig) string {
 	var parts []string
 
 	for k, v := range cfg.env {
-		parts = append(parts, fmt.Sprintf("export %s='%s';", k, v))
+		parts = append(parts, fmt.Sprintf("export %s=%s;", k, shellQuote(v)))
 	}
 
 	if cfg.workDir != "" {
-		parts = append(parts, fmt.Sprintf("cd '%s';", cfg.workDir))
+		parts = append(parts, fmt.Sprintf("cd %s;", shellQuote(cfg.workDir)))
 	}
 
 	parts = append(parts, cmd)
@@ -656,29 +936,34 @@ func (c *Client) buildCommand(cmd string, cfg *execConfig) string {
 	return strings.Join(parts, " ")
 }
 
-func (c *Client) ensureSFTP() error {
+// ensureSFTP returns the client's shared SFTP session, creating it on first
+// use. The session is reused across transfers and released by Close.
+func (c *Client) ensureSFTP() (*sftp.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	if c.sftp != nil {
-		return nil
+		return c.sftp, nil
 	}
 
-	if c.conn == nil {
-		return &Error{
+	if c.closed || c.conn == nil {
+		return nil, &Error{
 			Type:    ErrorConnection,
 			Message: "not connected",
 		}
 	}
 
-	sftp, err := sftp.NewClient(c.conn)
+	sftpClient, err := sftp.NewClient(c.conn)
 	if err != nil {
-		return &Error{
+		return nil, &Error{
 			Type:    ErrorFileTransfer,
 			Message: "failed to create SFTP client",
 			Cause:   err,
 		}
 	}
 
-	c.sftp = sftp
-	return nil
+	c.sftp = sftpClient
+	return sftpClient, nil
 }
 
 func (c *Client) streamOutput(reader io.Reader, handler func(string)) {
@@ -721,6 +1006,62 @@ func (c *Client) copyWithProgress(src io.Reader, dst io.Writer, total int64, pro
 	return nil
 }
 
+// throttle wraps r with a rate limiter when bytesPerSecond is positive
+func (c *Client) throttle(r io.Reader, bytesPerSecond int64) io.Reader {
+	if bytesPerSecond <= 0 {
+		return r
+	}
+	return &throttledReader{
+		ctx:  c.ctx,
+		r:    r,
+		rate: bytesPerSecond,
+		last: time.Now(),
+	}
+}
+
+// throttledReader limits reads to a byte rate using a token bucket that holds
+// at most one second worth of tokens. Waiting is aborted when ctx is cancelled.
+type throttledReader struct {
+	ctx    context.Context
+	r      io.Reader
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > t.rate {
+		p = p[:t.rate]
+	}
+
+	for {
+		now := time.Now()
+		t.tokens += now.Sub(t.last).Seconds() * float64(t.rate)
+		t.last = now
+		if t.tokens > float64(t.rate) {
+			t.tokens = float64(t.rate)
+		}
+
+		need := float64(len(p))
+		if t.tokens >= need {
+			break
+		}
+
+		wait := time.Duration((need - t.tokens) / float64(t.rate) * float64(time.Second))
+		timer := time.NewTimer(wait)
+		select {
+		case <-t.ctx.Done():
+			timer.Stop()
+			return 0, t.ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	n, err := t.r.Read(p)
+	t.tokens -= float64(n)
+	return n, err
+}
+
 func (c *Client) Ping() error {
 	result, err := c.Execute("echo ping", WithTimeout(5*time.Second))
 	if err != nil {
@@ -0,0 +1,287 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"pb-deployer/internal/logger"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestClassifyConnectError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{
+			name: "connection refused",
+			err:  &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)},
+			want: ErrConnectionRefused,
+		},
+		{
+			name: "dial timeout",
+			err:  &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded},
+			want: ErrTimeout,
+		},
+		{
+			name: "unknown host key",
+			err:  fmt.Errorf("ssh: handshake failed: %w", &knownhosts.KeyError{}),
+			want: ErrHostKeyUnknown,
+		},
+		{
+			name: "changed host key",
+			err:  fmt.Errorf("ssh: handshake failed: %w", &knownhosts.KeyError{Want: []knownhosts.KnownKey{{Filename: "known_hosts", Line: 1}}}),
+			want: ErrHostKeyMismatch,
+		},
+		{
+			name: "authentication failed",
+			err:  errors.New("ssh: handshake failed: ssh: unable to authenticate, attempted methods [none publickey], no supported methods remain"),
+			want: ErrAuthFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classifyConnectError(tt.err)
+			if !errors.Is(got, tt.want) {
+				t.Errorf("Expected %v to classify as %v, got %v", tt.err, tt.want, got)
+			}
+			if !errors.Is(got, tt.err) {
+				t.Errorf("Expected the original error to stay in the chain")
+			}
+		})
+	}
+
+	other := errors.New("ssh: handshake failed: EOF")
+	if got := classifyConnectError(other); got != other {
+		t.Errorf("Expected unclassified errors to be returned unchanged, got %v", got)
+	}
+}
+
+func TestErrorIsTimeout(t *testing.T) {
+	err := fmt.Errorf("deploy: %w", &Error{Type: ErrorTimeout, Message: "command timed out"})
+	if !errors.Is(err, ErrTimeout) {
+		t.Error("Expected ErrorTimeout to match ErrTimeout")
+	}
+	if errors.Is(&Error{Type: ErrorExecution, Message: "failed"}, ErrTimeout) {
+		t.Error("Expected other error types not to match ErrTimeout")
+	}
+}
+
+func TestThrottledReaderLimitsRate(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 5000)
+	client := &Client{ctx: context.Background()}
+	reader := client.throttle(bytes.NewReader(data), 10000)
+
+	start := time.Now()
+	n, err := io.Copy(io.Discard, reader)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+	if n != int64(len(data)) {
+		t.Errorf("Read %d bytes, want %d", n, len(data))
+	}
+	// The bucket starts empty, so 5000 bytes at 10000 B/s take half a second
+	if elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("Expected about 500ms at 10000 B/s, took %v", elapsed)
+	}
+}
+
+func TestThrottledReaderCapsReadsAtRate(t *testing.T) {
+	client := &Client{ctx: context.Background()}
+	reader := client.throttle(bytes.NewReader(make([]byte, 100)), 10)
+
+	n, err := reader.Read(make([]byte, 100))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if n != 10 {
+		t.Errorf("Expected a read of at most one second of data, got %d bytes", n)
+	}
+}
+
+func TestThrottledReaderStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	client := &Client{ctx: ctx}
+	reader := client.throttle(bytes.NewReader(make([]byte, 100)), 1)
+	cancel()
+
+	if _, err := reader.Read(make([]byte, 1)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestThrottleWithoutLimit(t *testing.T) {
+	source := bytes.NewReader(nil)
+	if got := (&Client{}).throttle(source, 0); got != io.Reader(source) {
+		t.Errorf("Expected the reader unchanged without a limit, got %T", got)
+	}
+}
+
+func TestCheckDiskSpace(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		size    int64
+		wantErr string
+	}{
+		{
+			name:   "enough space",
+			output: "/dev/sda1        41152736 20000000  19039524      52% /\n",
+			size:   1 << 30,
+		},
+		{
+			name:   "exactly enough",
+			output: "/dev/sda1 100 50 1 99% /opt\n",
+			size:   1024,
+		},
+		{
+			name:    "insufficient space",
+			output:  "/dev/sda1 100 99 1 99% /opt\n",
+			size:    1025,
+			wantErr: "insufficient disk space on /opt: need 1025 bytes, have 1024 bytes",
+		},
+		{
+			name:    "empty output",
+			output:  "",
+			wantErr: "failed to determine free disk space for /opt/app/pb.zip",
+		},
+		{
+			name:    "truncated line",
+			output:  "/dev/sda1 100 50\n",
+			wantErr: "failed to determine free disk space for /opt/app/pb.zip",
+		},
+		{
+			name:    "non-numeric available",
+			output:  "/dev/sda1 100 50 n/a 50% /\n",
+			wantErr: `failed to parse free disk space "n/a"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkDiskSpace(tt.output, "/opt/app/pb.zip", tt.size)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected enough space, got %v", err)
+				}
+				return
+			}
+
+			var tunnelErr *Error
+			if !errors.As(err, &tunnelErr) || tunnelErr.Type != ErrorFileTransfer || tunnelErr.Message != tt.wantErr {
+				t.Errorf("Expected file transfer error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// sftpTestClient returns a Client whose SFTP session is served in-process
+// from the local filesystem
+func sftpTestClient(t *testing.T) *Client {
+	t.Helper()
+	clientConn, serverConn := net.Pipe()
+	server, err := sftp.NewServer(serverConn)
+	if err != nil {
+		t.Fatalf("Failed to create SFTP server: %v", err)
+	}
+	go server.Serve()
+
+	sftpClient, err := sftp.NewClientPipe(clientConn, clientConn)
+	if err != nil {
+		t.Fatalf("Failed to create SFTP client: %v", err)
+	}
+	t.Cleanup(func() {
+		sftpClient.Close()
+		server.Close()
+	})
+
+	return &Client{
+		ctx:    context.Background(),
+		sftp:   sftpClient,
+		tracer: &NoOpTracer{},
+		logger: logger.GetTunnelLogger(),
+	}
+}
+
+func TestDownloadDirectoryPreservesMetadata(t *testing.T) {
+	remote := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(remote, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(remote, "sub", "data.db")
+	if err := os.WriteFile(path, []byte("contents"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	local := t.TempDir()
+	result, err := sftpTestClient(t).DownloadDirectory(remote, local, WithPreserve())
+	if err != nil {
+		t.Fatalf("DownloadDirectory failed: %v", err)
+	}
+	if result.Files != 1 || result.Bytes != int64(len("contents")) {
+		t.Errorf("Expected 1 file of 8 bytes, got %+v", result)
+	}
+
+	info, err := os.Stat(filepath.Join(local, "sub", "data.db"))
+	if err != nil {
+		t.Fatalf("Downloaded file missing: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Mode = %v, want 0600", info.Mode().Perm())
+	}
+	if !info.ModTime().Equal(modTime) {
+		t.Errorf("ModTime = %v, want %v", info.ModTime(), modTime)
+	}
+}
+
+func TestDownloadDirectoryReportsPreserveErrors(t *testing.T) {
+	remote := t.TempDir()
+	if err := os.WriteFile(filepath.Join(remote, "data.db"), []byte("contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Removing the local copy mid-transfer makes restoring its times fail
+	local := t.TempDir()
+	target := filepath.Join(local, "data.db")
+	result, err := sftpTestClient(t).DownloadDirectory(remote, local, WithPreserve(), WithProgress(func(int) {
+		os.Remove(target)
+	}))
+
+	var tunnelErr *Error
+	if !errors.As(err, &tunnelErr) || tunnelErr.Type != ErrorFileTransfer {
+		t.Fatalf("Expected a file transfer error, got %v", err)
+	}
+	if result.Files != 0 || len(result.Errors) != 1 || !errors.Is(result.Errors[0], os.ErrNotExist) {
+		t.Errorf("Expected the preserve failure in the result, got %+v", result)
+	}
+}
+
+func BenchmarkCopyWithProgress(b *testing.B) {
+	data := bytes.Repeat([]byte("x"), 8<<20)
+	client := &Client{}
+	b.SetBytes(int64(len(data)))
+
+	for b.Loop() {
+		if err := client.copyWithProgress(bytes.NewReader(data), io.Discard, int64(len(data)), func(int) {}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
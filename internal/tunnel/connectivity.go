@@ -0,0 +1,80 @@
+package tunnel
+
+import (
+	"time"
+)
+
+// ConnectionCheck is the outcome of connecting to a server as one user
+type ConnectionCheck struct {
+	User       string `json:"user"`
+	Success    bool   `json:"success"`
+	AuthMethod string `json:"auth_method,omitempty"`
+	// SudoWorks reports whether the user can run sudo without a password
+	SudoWorks bool `json:"sudo_works"`
+	// Latency is the round-trip time of a command on the open connection
+	Latency time.Duration `json:"latency_ns"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// DualConnectionResult reports how the root and app user connections to one
+// server behave
+type DualConnectionResult struct {
+	Host    string          `json:"host"`
+	Root    ConnectionCheck `json:"root"`
+	AppUser ConnectionCheck `json:"app_user"`
+}
+
+// TestBothConnections connects to config.Host as rootUser and as appUser and
+// reports for each whether it connected, how it authenticated, whether sudo
+// works and the latency. A user that cannot connect is reported in its check;
+// the error is only for a config no client can be built from.
+func TestBothConnections(config Config, rootUser, appUser string) (*DualConnectionResult, error) {
+	result := &DualConnectionResult{Host: config.Host}
+
+	for _, target := range []struct {
+		user  string
+		check *ConnectionCheck
+	}{
+		{rootUser, &result.Root},
+		{appUser, &result.AppUser},
+	} {
+		userConfig := config
+		userConfig.User = target.user
+
+		client, err := NewClient(userConfig)
+		if err != nil {
+			return nil, err
+		}
+		*target.check = checkConnection(client, target.user)
+		client.Close()
+	}
+
+	return result, nil
+}
+
+// checkConnection connects client and probes it. The auth method is read
+// from clients that report it, like *Client.
+func checkConnection(client SSHClient, user string) ConnectionCheck {
+	check := ConnectionCheck{User: user}
+
+	if err := client.Connect(); err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	if reporter, ok := client.(interface{ AuthMethod() string }); ok {
+		check.AuthMethod = reporter.AuthMethod()
+	}
+
+	start := time.Now()
+	if err := client.Ping(); err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	check.Latency = time.Since(start)
+	check.Success = true
+
+	result, err := client.Execute("sudo -n true", WithTimeout(10*time.Second))
+	check.SudoWorks = err == nil && result.ExitCode == 0
+
+	return check
+}
@@ -0,0 +1,94 @@
+package tunnel
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// probeClient is an SSHClient for connection checks. It fails Connect with
+// connectErr, answers every command with result and records the commands.
+type probeClient struct {
+	connectErr error
+	result     *Result
+	commands   []string
+}
+
+func (p *probeClient) Connect() error            { return p.connectErr }
+func (p *probeClient) Close() error              { return nil }
+func (p *probeClient) IsConnected() bool         { return p.connectErr == nil }
+func (p *probeClient) Ping() error               { return nil }
+func (p *probeClient) SetTracer(Tracer)          {}
+func (p *probeClient) HostInfo() (string, error) { return "test", nil }
+
+func (p *probeClient) Upload(localPath, remotePath string, opts ...FileOption) error {
+	return nil
+}
+
+func (p *probeClient) Download(remotePath, localPath string, opts ...FileOption) error {
+	return nil
+}
+
+func (p *probeClient) Execute(cmd string, opts ...ExecOption) (*Result, error) {
+	p.commands = append(p.commands, cmd)
+	if p.result == nil {
+		return &Result{}, nil
+	}
+	return p.result, nil
+}
+
+func (p *probeClient) ExecuteSudo(cmd string, opts ...ExecOption) (*Result, error) {
+	return p.Execute("sudo "+cmd, opts...)
+}
+
+// agentClient is a probeClient that reports an auth method
+type agentClient struct {
+	probeClient
+}
+
+func (c *agentClient) AuthMethod() string { return "ssh-agent" }
+
+func TestCheckConnectionReportsSudo(t *testing.T) {
+	client := &agentClient{probeClient{result: &Result{ExitCode: 0}}}
+
+	check := checkConnection(client, "pocketbase")
+	if !check.Success || !check.SudoWorks {
+		t.Errorf("Expected success with sudo, got %+v", check)
+	}
+	if check.AuthMethod != "ssh-agent" {
+		t.Errorf("Expected auth method ssh-agent, got %q", check.AuthMethod)
+	}
+	if want := []string{"sudo -n true"}; !slices.Equal(client.commands, want) {
+		t.Errorf("Expected %q, got %q", want, client.commands)
+	}
+}
+
+func TestCheckConnectionWithoutSudo(t *testing.T) {
+	client := &probeClient{result: &Result{ExitCode: 1, Stderr: "sudo: a password is required"}}
+
+	check := checkConnection(client, "pocketbase")
+	if !check.Success {
+		t.Errorf("Expected the connection to succeed, got %+v", check)
+	}
+	if check.SudoWorks {
+		t.Error("Expected sudo to be reported as not working")
+	}
+	if check.AuthMethod != "" {
+		t.Errorf("Expected no auth method from a client that does not report one, got %q", check.AuthMethod)
+	}
+}
+
+func TestCheckConnectionFailure(t *testing.T) {
+	client := &probeClient{connectErr: errors.New("ssh: unable to authenticate")}
+
+	check := checkConnection(client, "root")
+	if check.Success || check.SudoWorks {
+		t.Errorf("Expected a failed check, got %+v", check)
+	}
+	if check.Error != "ssh: unable to authenticate" {
+		t.Errorf("Expected the connect error, got %q", check.Error)
+	}
+	if len(client.commands) != 0 {
+		t.Errorf("Expected no commands after a failed connect, got %q", client.commands)
+	}
+}
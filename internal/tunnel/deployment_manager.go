@@ -16,6 +16,15 @@ import (
 	"github.com/pocketbase/pocketbase/core"
 )
 
+// Endpoints polled by verifyDeployment
+const (
+	// ReadinessPath answers 200 once the app's database and collections are up
+	ReadinessPath = "/api/readyz"
+	// HealthPath is PocketBase's built-in health check, used for apps that
+	// do not serve ReadinessPath
+	HealthPath = "/api/health"
+)
+
 type DeploymentManager struct {
 	manager *Manager
 	logger  *logger.Logger
@@ -41,6 +50,18 @@ type DeploymentRequest struct {
 	ServerSecurityLocked bool
 	ProgressCallback     func(int, int, string)
 	LogCallback          func(string)
+	// HealthCheckTimeout bounds the post-start health polling (default 30s)
+	HealthCheckTimeout time.Duration
+	// KeepReleases is the number of releases DeployWithRollback retains (default 5)
+	KeepReleases int
+	// KeepDataBackups is the number of pb_data snapshots retained (default 5)
+	KeepDataBackups int
+	// PackageSHA256, when set, is the expected hex SHA256 of the deployment package
+	PackageSHA256 string
+	// PackageSignature and SignaturePublicKey, when set, are a minisign
+	// signature of the deployment package and the key it must verify against
+	PackageSignature   string
+	SignaturePublicKey string
 }
 
 type DeploymentContext struct {
@@ -53,13 +74,17 @@ type DeploymentContext struct {
 	SystemdService    string
 	RollbackNeeded    bool
 	ServiceWasRunning bool
+	ReleasePath       string
+	PreviousRelease   string
+	DataDir           string
+	DataBackupPath    string
 	useRootFallback   bool
 }
 
 func NewDeploymentManager(manager *Manager, app core.App) *DeploymentManager {
 	return &DeploymentManager{
 		manager: manager,
-		logger:  logger.GetTunnelLogger(),
+		logger:  manager.logger,
 		app:     app,
 	}
 }
@@ -85,7 +110,7 @@ func (d *DeploymentManager) Deploy(ctx context.Context, req *DeploymentRequest)
 			d.logger.Warning("Deployment failed, performing rollback")
 			d.rollback(deployCtx)
 			// Clean up current staging on failure
-			d.manager.client.ExecuteSudo(fmt.Sprintf("rm -rf %s", deployCtx.StagingPath))
+			d.manager.client.ExecuteSudo("rm -rf " + shellQuote(deployCtx.StagingPath))
 		}
 		// Note: Successful deployments clean up staging in finalizeDeployment
 	}()
@@ -106,17 +131,18 @@ func (d *DeploymentManager) Deploy(ctx context.Context, req *DeploymentRequest)
 		message string
 		fn      func(context.Context, *DeploymentContext) error
 	}{
-		{1, 11, "Downloading and staging deployment package", d.downloadAndStageVersion},
-		{2, 11, "Checking service status", d.checkServiceStatus},
-		{3, 11, "Stopping existing service", d.stopService},
-		{4, 11, "Creating backup of current deployment", d.backupCurrentDeployment},
-		{5, 11, "Preparing deployment directory", d.prepareDeploymentDir},
-		{6, 11, "Installing new version", d.swapDeployment},
-		{7, 11, "Creating/updating systemd service", d.createSystemdService},
-		{8, 11, "Creating superuser (if initial deployment)", d.createSuperuser},
-		{9, 11, "Starting service", d.startService},
-		{10, 11, "Verifying deployment health", d.verifyDeployment},
-		{11, 11, "Finalizing deployment", d.finalizeDeployment},
+		{1, 12, "Downloading and staging deployment package", d.downloadAndStageVersion},
+		{2, 12, "Checking service status", d.checkServiceStatus},
+		{3, 12, "Stopping existing service", d.stopService},
+		{4, 12, "Backing up pb_data", d.backupData},
+		{5, 12, "Creating backup of current deployment", d.backupCurrentDeployment},
+		{6, 12, "Preparing deployment directory", d.prepareDeploymentDir},
+		{7, 12, "Installing new version", d.swapDeployment},
+		{8, 12, "Creating/updating systemd service", d.createSystemdService},
+		{9, 12, "Creating superuser (if initial deployment)", d.createSuperuser},
+		{10, 12, "Starting service", d.startService},
+		{11, 12, "Verifying deployment health", d.verifyDeployment},
+		{12, 12, "Finalizing deployment", d.finalizeDeployment},
 	}
 
 	for _, step := range steps {
@@ -143,7 +169,7 @@ func (d *DeploymentManager) downloadAndStageVersion(ctx context.Context, deployC
 	req := deployCtx.Request
 
 	// Create staging directory
-	result, err := d.manager.client.ExecuteSudo(fmt.Sprintf("mkdir -p %s", deployCtx.StagingPath))
+	result, err := d.manager.client.ExecuteSudo("mkdir -p " + shellQuote(deployCtx.StagingPath))
 	if err != nil || result.ExitCode != 0 {
 		return fmt.Errorf("failed to create staging directory: %w", err)
 	}
@@ -174,6 +200,10 @@ func (d *DeploymentManager) downloadAndStageVersion(ctx context.Context, deployC
 		return fmt.Errorf("failed to save deployment package: %w", err)
 	}
 
+	if err := d.verifyPackage(req, localZipPath); err != nil {
+		return err
+	}
+
 	// Upload to staging directory
 	d.logProgress(req, "Uploading deployment package to server...")
 	remoteZipPath := fmt.Sprintf("%s/deployment.zip", deployCtx.StagingPath)
@@ -182,16 +212,23 @@ func (d *DeploymentManager) downloadAndStageVersion(ctx context.Context, deployC
 		return fmt.Errorf("failed to upload deployment package: %w", err)
 	}
 
+	if req.PackageSHA256 != "" {
+		if err := d.verifyRemoteChecksum(remoteZipPath, req.PackageSHA256); err != nil {
+			return err
+		}
+		d.logProgress(req, "Uploaded package checksum verified on server")
+	}
+
 	// Extract the ZIP file
 	d.logProgress(req, "Extracting deployment package...")
-	result, err = d.manager.client.ExecuteSudo(fmt.Sprintf("bash -c \"cd %s && unzip -o deployment.zip\"", deployCtx.StagingPath))
+	result, err = d.manager.client.ExecuteSudo(bashScript("cd " + shellQuote(deployCtx.StagingPath) + " && unzip -o deployment.zip"))
 	if err != nil || result.ExitCode != 0 {
 		return fmt.Errorf("failed to extract deployment package: %s", result.Stderr)
 	}
 
 	// Find executable binary (could be named anything)
 	d.logProgress(req, "Locating executable binary...")
-	result, err = d.manager.client.Execute(fmt.Sprintf("find %s -type f -executable ! -name '*.zip' ! -name '*.txt' ! -name '*.md' ! -name '*.json'", deployCtx.StagingPath))
+	result, err = d.manager.client.Execute(fmt.Sprintf("find %s -type f -executable ! -name '*.zip' ! -name '*.txt' ! -name '*.md' ! -name '*.json'", shellQuote(deployCtx.StagingPath)))
 	if err != nil || result.ExitCode != 0 {
 		return fmt.Errorf("failed to find executable binary in package")
 	}
@@ -206,7 +243,7 @@ func (d *DeploymentManager) downloadAndStageVersion(ctx context.Context, deployC
 			continue
 		}
 		// Get file size
-		sizeResult, err := d.manager.client.Execute(fmt.Sprintf("stat -f%%z %s 2>/dev/null || stat -c%%s %s 2>/dev/null", executable, executable))
+		sizeResult, err := d.manager.client.Execute(fmt.Sprintf("stat -f%%z %[1]s 2>/dev/null || stat -c%%s %[1]s 2>/dev/null", shellQuote(executable)))
 		if err == nil && sizeResult.ExitCode == 0 {
 			var size int64
 			fmt.Sscanf(strings.TrimSpace(sizeResult.Stdout), "%d", &size)
@@ -228,13 +265,14 @@ func (d *DeploymentManager) downloadAndStageVersion(ctx context.Context, deployC
 	newBinaryPath := fmt.Sprintf("%s/%s", deployCtx.StagingPath, req.AppName)
 	d.logProgress(req, fmt.Sprintf("Renaming binary from %s to %s", pocketbasePath, newBinaryPath))
 
-	result, err = d.manager.client.ExecuteSudo(fmt.Sprintf("bash -c \"mv %s %s && chmod +x %s\"", pocketbasePath, newBinaryPath, newBinaryPath))
+	result, err = d.manager.client.ExecuteSudo(bashScript(fmt.Sprintf("mv %[1]s %[2]s && chmod +x %[2]s",
+		shellQuote(pocketbasePath), shellQuote(newBinaryPath))))
 	if err != nil || result.ExitCode != 0 {
 		return fmt.Errorf("failed to rename binary: %s", result.Stderr)
 	}
 
 	// Debug: Verify staging directory contents after rename
-	stagingResult, _ := d.manager.client.Execute(fmt.Sprintf("ls -la %s", deployCtx.StagingPath))
+	stagingResult, _ := d.manager.client.Execute("ls -la " + shellQuote(deployCtx.StagingPath))
 	if stagingResult != nil {
 		d.logProgress(req, fmt.Sprintf("Staging directory after rename: %s", strings.TrimSpace(stagingResult.Stdout)))
 	}
@@ -242,8 +280,57 @@ func (d *DeploymentManager) downloadAndStageVersion(ctx context.Context, deployC
 	return nil
 }
 
+// verifyPackage checks the downloaded package against the expected checksum
+// and signature, if configured, before anything is installed
+func (d *DeploymentManager) verifyPackage(req *DeploymentRequest, localZipPath string) error {
+	if req.PackageSHA256 != "" {
+		d.logProgress(req, "Verifying deployment package checksum...")
+		if err := VerifyChecksum(localZipPath, req.PackageSHA256); err != nil {
+			return fmt.Errorf("deployment package verification failed: %w", err)
+		}
+		d.logProgress(req, "Deployment package checksum verified")
+	}
+
+	if req.PackageSignature != "" || req.SignaturePublicKey != "" {
+		if req.PackageSignature == "" || req.SignaturePublicKey == "" {
+			return &Error{
+				Type:    ErrorVerification,
+				Message: "signature verification requires both a signature and a public key",
+			}
+		}
+		d.logProgress(req, "Verifying deployment package signature...")
+		if err := VerifyMinisignSignature(localZipPath, req.PackageSignature, req.SignaturePublicKey); err != nil {
+			return fmt.Errorf("deployment package verification failed: %w", err)
+		}
+		d.logProgress(req, "Deployment package signature verified")
+	}
+
+	return nil
+}
+
+// verifyRemoteChecksum confirms the uploaded file is the one verified locally
+func (d *DeploymentManager) verifyRemoteChecksum(remotePath, expected string) error {
+	result, err := d.manager.client.Execute("sha256sum " + shellQuote(remotePath))
+	if err != nil || result.ExitCode != 0 {
+		return &Error{
+			Type:    ErrorVerification,
+			Message: fmt.Sprintf("failed to checksum uploaded package: %s", resultStderr(result)),
+			Cause:   err,
+		}
+	}
+
+	fields := strings.Fields(result.Stdout)
+	if len(fields) == 0 || !strings.EqualFold(fields[0], strings.TrimSpace(expected)) {
+		return &Error{
+			Type:    ErrorVerification,
+			Message: fmt.Sprintf("uploaded package checksum mismatch: expected %s, got %s", expected, strings.TrimSpace(result.Stdout)),
+		}
+	}
+	return nil
+}
+
 func (d *DeploymentManager) checkServiceStatus(ctx context.Context, deployCtx *DeploymentContext) error {
-	result, err := d.manager.client.Execute(fmt.Sprintf("systemctl is-active %s", deployCtx.SystemdService))
+	result, err := d.manager.client.Execute("systemctl is-active " + shellQuote(deployCtx.SystemdService))
 	if err == nil && result.ExitCode == 0 && strings.TrimSpace(result.Stdout) == "active" {
 		deployCtx.ServiceWasRunning = true
 		d.logProgress(deployCtx.Request, fmt.Sprintf("Service %s is currently running", deployCtx.SystemdService))
@@ -261,7 +348,7 @@ func (d *DeploymentManager) stopService(ctx context.Context, deployCtx *Deployme
 	}
 
 	d.logProgress(deployCtx.Request, fmt.Sprintf("Stopping service: %s", deployCtx.SystemdService))
-	result, err := d.manager.client.ExecuteSudo(fmt.Sprintf("systemctl stop %s", deployCtx.SystemdService))
+	result, err := d.manager.client.ExecuteSudo("systemctl stop " + shellQuote(deployCtx.SystemdService))
 	if err != nil || result.ExitCode != 0 {
 		return fmt.Errorf("failed to stop service: %s", result.Stderr)
 	}
@@ -269,7 +356,7 @@ func (d *DeploymentManager) stopService(ctx context.Context, deployCtx *Deployme
 	// Wait for service to stop
 	for i := 0; i < 10; i++ {
 		time.Sleep(1 * time.Second)
-		result, err = d.manager.client.Execute(fmt.Sprintf("systemctl is-active %s", deployCtx.SystemdService))
+		result, err = d.manager.client.Execute("systemctl is-active " + shellQuote(deployCtx.SystemdService))
 		if err != nil || result.ExitCode != 0 || strings.TrimSpace(result.Stdout) != "active" {
 			break
 		}
@@ -280,22 +367,22 @@ func (d *DeploymentManager) stopService(ctx context.Context, deployCtx *Deployme
 
 func (d *DeploymentManager) backupCurrentDeployment(ctx context.Context, deployCtx *DeploymentContext) error {
 	// Check if deployment directory exists
-	result, err := d.manager.client.Execute(fmt.Sprintf("test -d %s", deployCtx.WorkingDir))
+	result, err := d.manager.client.Execute("test -d " + shellQuote(deployCtx.WorkingDir))
 	if err != nil || result.ExitCode != 0 {
 		d.logProgress(deployCtx.Request, "No existing deployment to backup")
 		return nil
 	}
 
 	// Check if directory has any files to backup
-	result, err = d.manager.client.Execute(fmt.Sprintf("find %s -mindepth 1 -maxdepth 1 | head -1", deployCtx.WorkingDir))
+	result, err = d.manager.client.Execute(fmt.Sprintf("find %s -mindepth 1 -maxdepth 1 | head -1", shellQuote(deployCtx.WorkingDir)))
 	if err != nil || result.ExitCode != 0 || strings.TrimSpace(result.Stdout) == "" {
 		d.logProgress(deployCtx.Request, "No existing deployment files to backup (initial deployment)")
 		return nil
 	}
 
 	d.logProgress(deployCtx.Request, "Creating backup of current deployment...")
-	result, err = d.manager.client.ExecuteSudo(fmt.Sprintf("bash -c \"mkdir -p %s && cp -r %s/* %s/\"",
-		deployCtx.BackupPath, deployCtx.WorkingDir, deployCtx.BackupPath))
+	result, err = d.manager.client.ExecuteSudo(bashScript(fmt.Sprintf("mkdir -p %[1]s && cp -r %[2]s/* %[1]s/",
+		shellQuote(deployCtx.BackupPath), shellQuote(deployCtx.WorkingDir))))
 	if err != nil || result.ExitCode != 0 {
 		return fmt.Errorf("failed to create backup: %s", result.Stderr)
 	}
@@ -308,7 +395,7 @@ func (d *DeploymentManager) prepareDeploymentDir(ctx context.Context, deployCtx
 	d.logProgress(deployCtx.Request, "Preparing deployment directory...")
 
 	// Create deployment directory if it doesn't exist
-	result, err := d.manager.client.ExecuteSudo(fmt.Sprintf("mkdir -p %s", deployCtx.WorkingDir))
+	result, err := d.manager.client.ExecuteSudo("mkdir -p " + shellQuote(deployCtx.WorkingDir))
 	if err != nil || result.ExitCode != 0 {
 		return fmt.Errorf("failed to create deployment directory: %s", result.Stderr)
 	}
@@ -320,15 +407,15 @@ func (d *DeploymentManager) prepareDeploymentDir(ctx context.Context, deployCtx
 	}
 
 	// Set appropriate ownership and permissions
-	result, err = d.manager.client.ExecuteSudo(fmt.Sprintf("bash -c \"chown -R %s:%s %s && chmod 755 %s\"",
-		deployCtx.Request.AppUsername, deployCtx.Request.AppUsername, deployCtx.WorkingDir, deployCtx.WorkingDir))
+	result, err = d.manager.client.ExecuteSudo(bashScript(fmt.Sprintf("chown -R %[1]s %[2]s && chmod 755 %[2]s",
+		shellQuote(deployCtx.Request.AppUsername+":"+deployCtx.Request.AppUsername), shellQuote(deployCtx.WorkingDir))))
 	if err != nil || result.ExitCode != 0 {
 		return fmt.Errorf("failed to set directory permissions: %s", result.Stderr)
 	}
 
 	// Set permissions for logs directory
-	result, err = d.manager.client.ExecuteSudo(fmt.Sprintf("bash -c \"chown -R %s:%s /opt/pocketbase/logs && chmod 755 /opt/pocketbase/logs\"",
-		deployCtx.Request.AppUsername, deployCtx.Request.AppUsername))
+	result, err = d.manager.client.ExecuteSudo(bashScript(fmt.Sprintf("chown -R %s /opt/pocketbase/logs && chmod 755 /opt/pocketbase/logs",
+		shellQuote(deployCtx.Request.AppUsername+":"+deployCtx.Request.AppUsername))))
 	if err != nil || result.ExitCode != 0 {
 		return fmt.Errorf("failed to set logs directory permissions: %s", result.Stderr)
 	}
@@ -343,24 +430,24 @@ func (d *DeploymentManager) swapDeployment(ctx context.Context, deployCtx *Deplo
 
 	// Copy all files and directories preserving structure from staging to working directory
 	d.logProgress(req, "Copying deployment files...")
-	result, err := d.manager.client.ExecuteSudo(fmt.Sprintf("bash -c \"cd %s && cp -r . %s/\"",
-		deployCtx.StagingPath, deployCtx.WorkingDir))
+	result, err := d.manager.client.ExecuteSudo(bashScript(fmt.Sprintf("cd %s && cp -r . %s/",
+		shellQuote(deployCtx.StagingPath), shellQuote(deployCtx.WorkingDir))))
 	if err != nil || result.ExitCode != 0 {
 		return fmt.Errorf("failed to copy deployment files: %s", result.Stderr)
 	}
 
 	// Remove deployment.zip from working directory
-	d.manager.client.ExecuteSudo(fmt.Sprintf("rm -f %s/deployment.zip", deployCtx.WorkingDir))
+	d.manager.client.ExecuteSudo("rm -f " + shellQuote(deployCtx.WorkingDir+"/deployment.zip"))
 
 	// Debug: Check what files are in the working directory
 	d.logProgress(req, "Debugging: Checking working directory contents...")
-	debugResult, _ := d.manager.client.Execute(fmt.Sprintf("ls -la %s", deployCtx.WorkingDir))
+	debugResult, _ := d.manager.client.Execute("ls -la " + shellQuote(deployCtx.WorkingDir))
 	if debugResult != nil {
 		d.logProgress(req, fmt.Sprintf("Working directory contents: %s", strings.TrimSpace(debugResult.Stdout)))
 	}
 
 	// Debug: Check if binary exists at expected path
-	binaryCheckResult, _ := d.manager.client.Execute(fmt.Sprintf("ls -la %s", deployCtx.BinaryPath))
+	binaryCheckResult, _ := d.manager.client.Execute("ls -la " + shellQuote(deployCtx.BinaryPath))
 	if binaryCheckResult != nil && binaryCheckResult.ExitCode == 0 {
 		d.logProgress(req, fmt.Sprintf("Binary found: %s", strings.TrimSpace(binaryCheckResult.Stdout)))
 	} else {
@@ -368,43 +455,52 @@ func (d *DeploymentManager) swapDeployment(ctx context.Context, deployCtx *Deplo
 	}
 
 	// Ensure binary is executable
-	result, err = d.manager.client.ExecuteSudo(fmt.Sprintf("chmod +x %s", deployCtx.BinaryPath))
+	result, err = d.manager.client.ExecuteSudo("chmod +x " + shellQuote(deployCtx.BinaryPath))
 	if err != nil || result.ExitCode != 0 {
 		return fmt.Errorf("failed to make binary executable: %s", result.Stderr)
 	}
 
 	// Debug: Verify binary is executable after chmod
-	execCheckResult, _ := d.manager.client.Execute(fmt.Sprintf("test -x %s && echo 'executable' || echo 'not executable'", deployCtx.BinaryPath))
+	execCheckResult, _ := d.manager.client.Execute(fmt.Sprintf("test -x %s && echo 'executable' || echo 'not executable'", shellQuote(deployCtx.BinaryPath)))
 	if execCheckResult != nil {
 		d.logProgress(req, fmt.Sprintf("Binary executable check: %s", strings.TrimSpace(execCheckResult.Stdout)))
 	}
 
-	// Grant capability to bind to privileged ports (80, 443) for non-root user
+	d.grantPortCapability(deployCtx, deployCtx.BinaryPath)
+
+	return nil
+}
+
+// grantPortCapability lets the binary bind privileged ports (80, 443) as the
+// app user, falling back to running the service as root when setcap fails
+func (d *DeploymentManager) grantPortCapability(deployCtx *DeploymentContext, binaryPath string) {
+	req := deployCtx.Request
+
 	d.logProgress(req, "Granting port binding capabilities...")
 
 	// First check if setcap is available
-	setcapResult, setcapErr := d.manager.client.Execute("which setcap")
-	if setcapErr != nil || setcapResult.ExitCode != 0 {
+	if !d.manager.HasCommand("setcap") {
 		d.logProgress(req, "setcap not available, installing libcap2-bin...")
 		installResult, installErr := d.manager.client.ExecuteSudo("apt update && apt install -y libcap2-bin")
+		d.manager.InvalidateCapabilities()
 		if installErr != nil || installResult.ExitCode != 0 {
 			d.logProgress(req, "Warning: Could not install libcap2-bin, will use root fallback")
 		}
 	}
 
 	// Try to set capabilities
-	result, err = d.manager.client.ExecuteSudo(fmt.Sprintf("setcap 'cap_net_bind_service=+ep' %s", deployCtx.BinaryPath))
+	result, err := d.manager.client.ExecuteSudo("setcap 'cap_net_bind_service=+ep' " + shellQuote(binaryPath))
 	if err != nil || result.ExitCode != 0 {
 		d.logProgress(req, "Warning: Failed to set port capabilities, falling back to root user")
-		d.logProgress(req, fmt.Sprintf("setcap error: %s", result.Stderr))
+		if result != nil {
+			d.logProgress(req, fmt.Sprintf("setcap error: %s", result.Stderr))
+		}
 
 		// Fallback: Update systemd service to run as root
 		deployCtx.useRootFallback = true
 	} else {
 		d.logProgress(req, "Port binding capabilities granted successfully")
 	}
-
-	return nil
 }
 
 func (d *DeploymentManager) createSystemdService(ctx context.Context, deployCtx *DeploymentContext) error {
@@ -424,6 +520,12 @@ func (d *DeploymentManager) createSystemdService(ctx context.Context, deployCtx
 		d.logProgress(req, "Creating systemd service with app user")
 	}
 
+	// Releases keep pb_data outside the swapped release directory
+	var dataDirFlag string
+	if deployCtx.DataDir != "" {
+		dataDirFlag = " --dir=" + deployCtx.DataDir
+	}
+
 	serviceContent := fmt.Sprintf(`[Unit]
 Description=%s PocketBase Server
 After=network.target
@@ -438,14 +540,14 @@ RestartSec=5s
 StandardOutput=append:/opt/pocketbase/logs/%s.log
 StandardError=append:/opt/pocketbase/logs/%s.log
 WorkingDirectory=%s
-ExecStart=%s serve %s
+ExecStart=%s serve %s%s
 
 [Install]
 WantedBy=multi-user.target
-`, req.AppName, serviceUser, serviceGroup, req.AppName, req.AppName, deployCtx.WorkingDir, deployCtx.BinaryPath, req.Domain)
+`, req.AppName, serviceUser, serviceGroup, req.AppName, req.AppName, deployCtx.WorkingDir, deployCtx.BinaryPath, req.Domain, dataDirFlag)
 
 	// Write service file
-	result, err := d.manager.client.ExecuteSudo(fmt.Sprintf("cat > %s << 'EOF'\n%sEOF", deployCtx.ServicePath, serviceContent))
+	result, err := d.manager.client.ExecuteSudo(bashScript(fmt.Sprintf("cat > %s << 'EOF'\n%sEOF", shellQuote(deployCtx.ServicePath), serviceContent)))
 	if err != nil || result.ExitCode != 0 {
 		return fmt.Errorf("failed to create systemd service: %s", result.Stderr)
 	}
@@ -456,7 +558,7 @@ WantedBy=multi-user.target
 		return fmt.Errorf("failed to reload systemd: %s", result.Stderr)
 	}
 
-	result, err = d.manager.client.ExecuteSudo(fmt.Sprintf("systemctl enable %s", deployCtx.SystemdService))
+	result, err = d.manager.client.ExecuteSudo("systemctl enable " + shellQuote(deployCtx.SystemdService))
 	if err != nil || result.ExitCode != 0 {
 		return fmt.Errorf("failed to enable service: %s", result.Stderr)
 	}
@@ -467,7 +569,7 @@ WantedBy=multi-user.target
 func (d *DeploymentManager) startService(ctx context.Context, deployCtx *DeploymentContext) error {
 	d.logProgress(deployCtx.Request, fmt.Sprintf("Starting service: %s", deployCtx.SystemdService))
 
-	result, err := d.manager.client.ExecuteSudo(fmt.Sprintf("systemctl start %s", deployCtx.SystemdService))
+	result, err := d.manager.client.ExecuteSudo("systemctl start " + shellQuote(deployCtx.SystemdService))
 	if err != nil || result.ExitCode != 0 {
 		return fmt.Errorf("failed to start service: %s", result.Stderr)
 	}
@@ -475,7 +577,7 @@ func (d *DeploymentManager) startService(ctx context.Context, deployCtx *Deploym
 	// Wait for service to start
 	for i := 0; i < 30; i++ {
 		time.Sleep(2 * time.Second)
-		result, err = d.manager.client.Execute(fmt.Sprintf("systemctl is-active %s", deployCtx.SystemdService))
+		result, err = d.manager.client.Execute("systemctl is-active " + shellQuote(deployCtx.SystemdService))
 		if err == nil && result.ExitCode == 0 && strings.TrimSpace(result.Stdout) == "active" {
 			d.logProgress(deployCtx.Request, "Service started successfully")
 			return nil
@@ -498,8 +600,8 @@ func (d *DeploymentManager) createSuperuser(ctx context.Context, deployCtx *Depl
 	// Wait a bit for PocketBase to fully initialize
 	time.Sleep(5 * time.Second)
 
-	cmd := fmt.Sprintf("bash -c \"cd %s && ./%s superuser create %s %s\"",
-		deployCtx.WorkingDir, req.AppName, req.SuperuserEmail, req.SuperuserPass)
+	cmd := bashScript(fmt.Sprintf("cd %s && %s superuser create %s %s",
+		shellQuote(deployCtx.WorkingDir), shellQuote("./"+req.AppName), shellQuote(req.SuperuserEmail), shellQuote(req.SuperuserPass)))
 
 	result, err := d.manager.client.ExecuteSudo(cmd, WithTimeout(30*time.Second))
 	if err != nil || result.ExitCode != 0 {
@@ -516,16 +618,14 @@ func (d *DeploymentManager) verifyDeployment(ctx context.Context, deployCtx *Dep
 	d.logProgress(req, "Verifying deployment health...")
 
 	// Debug: Check service status first
-	result, err := d.manager.client.Execute(fmt.Sprintf("systemctl status %s", deployCtx.SystemdService))
+	result, err := d.manager.client.Execute("systemctl status " + shellQuote(deployCtx.SystemdService))
 	if err == nil {
 		d.logProgress(req, fmt.Sprintf("Service status: %s", strings.TrimSpace(result.Stdout)))
 	}
 
-	// Debug: Check service logs for any errors
-	logResult, logErr := d.manager.client.Execute(fmt.Sprintf("tail -10 /opt/pocketbase/logs/%s.log", req.AppName))
-	if logErr == nil && strings.TrimSpace(logResult.Stdout) != "" {
-		d.logProgress(req, fmt.Sprintf("Service logs: %s", strings.TrimSpace(logResult.Stdout)))
-	}
+	// Stream the service log while waiting so a failed start shows its cause
+	stopLogs := d.streamServiceLogs(ctx, req)
+	defer stopLogs()
 
 	// Debug: Check if any process is listening on port 80 or 8080
 	portResult, portErr := d.manager.client.Execute("netstat -tulpn | grep ':80\\|:8080'")
@@ -533,38 +633,106 @@ func (d *DeploymentManager) verifyDeployment(ctx context.Context, deployCtx *Dep
 		d.logProgress(req, fmt.Sprintf("Listening ports: %s", strings.TrimSpace(portResult.Stdout)))
 	}
 
-	// Health check URLs to try in order
-	healthUrls := []struct {
-		url         string
+	// Endpoints to probe in order
+	healthTargets := []struct {
+		baseURL     string
 		description string
 	}{
-		{"http://localhost:8080/api/health", "localhost:8080"},
-		{"http://localhost:80/api/health", "localhost:80"},
-		{"https://localhost:443/api/health", "localhost:443"},
-		{fmt.Sprintf("http://%s/api/health", req.Domain), fmt.Sprintf("HTTP %s", req.Domain)},
-		{fmt.Sprintf("https://%s/api/health", req.Domain), fmt.Sprintf("HTTPS %s", req.Domain)},
+		{"http://localhost:8080", "localhost:8080"},
+		{"http://localhost:80", "localhost:80"},
+		{"https://localhost:443", "localhost:443"},
+		{fmt.Sprintf("http://%s", req.Domain), fmt.Sprintf("HTTP %s", req.Domain)},
+		{fmt.Sprintf("https://%s", req.Domain), fmt.Sprintf("HTTPS %s", req.Domain)},
+	}
+
+	attempts := 15
+	if req.HealthCheckTimeout > 0 {
+		attempts = max(1, int(req.HealthCheckTimeout/(2*time.Second)))
 	}
 
-	for i := 0; i < 15; i++ {
+	for i := 0; i < attempts; i++ {
 		time.Sleep(2 * time.Second)
 
-		// Try each URL in order
-		for _, healthCheck := range healthUrls {
-			result, err := d.manager.client.Execute(fmt.Sprintf("curl -s -f -m 10 -k %s", healthCheck.url), WithTimeout(15*time.Second))
-			if err == nil && result.ExitCode == 0 {
-				d.logProgress(req, fmt.Sprintf("Health check passed (%s)", healthCheck.description))
+		// Try each endpoint in order
+		for _, target := range healthTargets {
+			healthy, detail := d.probeHealth(target.baseURL)
+			if healthy {
+				d.logProgress(req, fmt.Sprintf("Health check passed (%s, %s)", target.description, detail))
 				return nil
 			}
-			// Debug: Log curl error details for first attempt
+			// Debug: Log probe details for first attempt
 			if i == 0 {
-				d.logProgress(req, fmt.Sprintf("Health check failed for %s: exit=%d, stderr=%s", healthCheck.description, result.ExitCode, strings.TrimSpace(result.Stderr)))
+				d.logProgress(req, fmt.Sprintf("Health check failed for %s: %s", target.description, detail))
 			}
 		}
 
-		d.logProgress(req, fmt.Sprintf("Health check attempt %d/15 failed, retrying...", i+1))
+		d.logProgress(req, fmt.Sprintf("Health check attempt %d/%d failed, retrying...", i+1, attempts))
+	}
+
+	return fmt.Errorf("deployment health verification failed after %d attempts", attempts)
+}
+
+// probeHealth checks an app's readiness endpoint. Apps that do not serve
+// ReadinessPath (it answers 404) are checked on PocketBase's HealthPath
+// instead. The returned detail names the path that passed or why it failed.
+func (d *DeploymentManager) probeHealth(baseURL string) (bool, string) {
+	cmd := fmt.Sprintf("curl -s -k -m 10 -o /dev/null -w '%%{http_code}' %s", shellQuote(baseURL+ReadinessPath))
+	result, err := d.manager.client.Execute(cmd, WithTimeout(15*time.Second))
+	if err != nil {
+		return false, err.Error()
+	}
+
+	switch code := strings.TrimSpace(result.Stdout); code {
+	case "200":
+		return true, ReadinessPath
+	case "404":
+		// Fall back to the PocketBase health endpoint below
+	case "", "000":
+		return false, fmt.Sprintf("no response: exit=%d, stderr=%s", result.ExitCode, strings.TrimSpace(result.Stderr))
+	default:
+		return false, fmt.Sprintf("%s returned %s", ReadinessPath, code)
 	}
 
-	return fmt.Errorf("deployment health verification failed after 15 attempts")
+	result, err = d.manager.client.Execute(fmt.Sprintf("curl -s -f -m 10 -k %s", shellQuote(baseURL+HealthPath)), WithTimeout(15*time.Second))
+	if err != nil {
+		return false, err.Error()
+	}
+	if result.ExitCode != 0 {
+		return false, fmt.Sprintf("%s failed: exit=%d, stderr=%s", HealthPath, result.ExitCode, strings.TrimSpace(result.Stderr))
+	}
+	return true, HealthPath
+}
+
+// streamServiceLogs relays the app's service log to the deployment log until
+// the returned function is called, which waits for the relay to finish
+func (d *DeploymentManager) streamServiceLogs(ctx context.Context, req *DeploymentRequest) func() {
+	client, ok := d.manager.client.(*Client)
+	if !ok {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	lines, err := client.TailRemoteFile(ctx, fmt.Sprintf("/opt/pocketbase/logs/%s.log", req.AppName), 10, true)
+	if err != nil {
+		cancel()
+		d.logger.Warning("Failed to stream service logs: %v", err)
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for line := range lines {
+			if strings.TrimSpace(line) != "" {
+				d.logProgress(req, "[service] "+line)
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
 }
 
 func (d *DeploymentManager) finalizeDeployment(ctx context.Context, deployCtx *DeploymentContext) error {
@@ -572,13 +740,13 @@ func (d *DeploymentManager) finalizeDeployment(ctx context.Context, deployCtx *D
 
 	// Clean up old backups (keep last 5)
 	backupDir := filepath.Dir(deployCtx.BackupPath)
-	_, err := d.manager.client.ExecuteSudo(fmt.Sprintf("bash -c \"cd %s && ls -1t | tail -n +6 | xargs -r rm -rf\"", backupDir))
+	_, err := d.manager.client.ExecuteSudo(bashScript("cd " + shellQuote(backupDir) + " && ls -1t | tail -n +6 | xargs -r rm -rf"))
 	if err != nil {
 		d.logger.Warning("Failed to clean up old backups: %v", err)
 	}
 
 	// Clean up current staging directory on successful deployment
-	d.manager.client.ExecuteSudo(fmt.Sprintf("rm -rf %s", deployCtx.StagingPath))
+	d.manager.client.ExecuteSudo("rm -rf " + shellQuote(deployCtx.StagingPath))
 
 	// Update app status to online and set current version
 	d.updateAppStatus(deployCtx.Request.AppID, "online", deployCtx.Request.VersionID)
@@ -591,18 +759,18 @@ func (d *DeploymentManager) rollback(deployCtx *DeploymentContext) error {
 	d.logger.SystemOperation(fmt.Sprintf("Rolling back deployment: %s", deployCtx.Request.AppName))
 
 	// Stop the service
-	d.manager.client.ExecuteSudo(fmt.Sprintf("systemctl stop %s", deployCtx.SystemdService))
+	d.manager.client.ExecuteSudo("systemctl stop " + shellQuote(deployCtx.SystemdService))
 
 	// Check if backup exists
-	result, err := d.manager.client.Execute(fmt.Sprintf("test -d %s", deployCtx.BackupPath))
+	result, err := d.manager.client.Execute("test -d " + shellQuote(deployCtx.BackupPath))
 	if err != nil || result.ExitCode != 0 {
 		d.logger.Error("No backup found for rollback")
 		return fmt.Errorf("rollback failed: no backup found")
 	}
 
 	// Restore from backup
-	result, err = d.manager.client.ExecuteSudo(fmt.Sprintf("bash -c \"rm -rf %s/* && cp -r %s/* %s/\"",
-		deployCtx.WorkingDir, deployCtx.BackupPath, deployCtx.WorkingDir))
+	result, err = d.manager.client.ExecuteSudo(bashScript(fmt.Sprintf("rm -rf %[1]s/* && cp -r %[2]s/* %[1]s/",
+		shellQuote(deployCtx.WorkingDir), shellQuote(deployCtx.BackupPath))))
 	if err != nil || result.ExitCode != 0 {
 		d.logger.Error("Failed to restore from backup: %s", result.Stderr)
 		return fmt.Errorf("rollback failed: %s", result.Stderr)
@@ -610,7 +778,7 @@ func (d *DeploymentManager) rollback(deployCtx *DeploymentContext) error {
 
 	// Restart service if it was running
 	if deployCtx.ServiceWasRunning {
-		d.manager.client.ExecuteSudo(fmt.Sprintf("systemctl start %s", deployCtx.SystemdService))
+		d.manager.client.ExecuteSudo("systemctl start " + shellQuote(deployCtx.SystemdService))
 	}
 
 	// Update app status to offline due to rollback
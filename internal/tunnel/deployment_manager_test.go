@@ -0,0 +1,81 @@
+package tunnel
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestPrepareDeploymentDirQuotesPathsAndUser(t *testing.T) {
+	client := &scriptedClient{}
+	deployer := NewDeploymentManager(NewManager(client), nil)
+
+	deployCtx := &DeploymentContext{
+		Request:    &DeploymentRequest{AppName: "my app", AppUsername: "pb;id"},
+		WorkingDir: "/opt/pocketbase/apps/my app",
+	}
+	if err := deployer.prepareDeploymentDir(context.Background(), deployCtx); err != nil {
+		t.Fatalf("prepareDeploymentDir() error = %v", err)
+	}
+
+	want := []string{
+		`sudo mkdir -p '/opt/pocketbase/apps/my app'`,
+		`sudo mkdir -p /opt/pocketbase/logs`,
+		`sudo bash -c 'chown -R '\''pb;id:pb;id'\'' '\''/opt/pocketbase/apps/my app'\'' && chmod 755 '\''/opt/pocketbase/apps/my app'\'''`,
+		`sudo bash -c 'chown -R '\''pb;id:pb;id'\'' /opt/pocketbase/logs && chmod 755 /opt/pocketbase/logs'`,
+	}
+	if !slices.Equal(client.commands, want) {
+		t.Errorf("Unexpected commands:\n got %q\nwant %q", client.commands, want)
+	}
+}
+
+func TestBackupCurrentDeploymentQuotesPaths(t *testing.T) {
+	client := &scriptedClient{results: []*Result{{}, {Stdout: "/opt/pocketbase/apps/$(reboot)/pb_data\n"}}}
+	deployer := NewDeploymentManager(NewManager(client), nil)
+
+	deployCtx := &DeploymentContext{
+		Request:    &DeploymentRequest{AppName: "$(reboot)"},
+		WorkingDir: "/opt/pocketbase/apps/$(reboot)",
+		BackupPath: "/opt/pocketbase/backups/$(reboot)-1",
+	}
+	if err := deployer.backupCurrentDeployment(context.Background(), deployCtx); err != nil {
+		t.Fatalf("backupCurrentDeployment() error = %v", err)
+	}
+
+	want := []string{
+		`test -d '/opt/pocketbase/apps/$(reboot)'`,
+		`find '/opt/pocketbase/apps/$(reboot)' -mindepth 1 -maxdepth 1 | head -1`,
+		`sudo bash -c 'mkdir -p '\''/opt/pocketbase/backups/$(reboot)-1'\'' && cp -r '\''/opt/pocketbase/apps/$(reboot)'\''/* '\''/opt/pocketbase/backups/$(reboot)-1'\''/'`,
+	}
+	if !slices.Equal(client.commands, want) {
+		t.Errorf("Unexpected commands:\n got %q\nwant %q", client.commands, want)
+	}
+}
+
+func TestServiceCommandsQuoteServiceName(t *testing.T) {
+	client := &scriptedClient{results: []*Result{{Stdout: "active\n"}}}
+	deployer := NewDeploymentManager(NewManager(client), nil)
+
+	deployCtx := &DeploymentContext{
+		Request:        &DeploymentRequest{AppName: "app"},
+		SystemdService: "app;reboot",
+	}
+	if err := deployer.checkServiceStatus(context.Background(), deployCtx); err != nil {
+		t.Fatalf("checkServiceStatus() error = %v", err)
+	}
+	if !deployCtx.ServiceWasRunning {
+		t.Fatal("Expected the service to be reported running")
+	}
+	if err := deployer.stopService(context.Background(), deployCtx); err != nil {
+		t.Fatalf("stopService() error = %v", err)
+	}
+
+	want := []string{
+		`systemctl is-active 'app;reboot'`,
+		`sudo systemctl stop 'app;reboot'`,
+		`systemctl is-active 'app;reboot'`,
+	}
+	if !slices.Equal(client.commands, want) {
+		t.Errorf("Unexpected commands:\n got %q\nwant %q", client.commands, want)
+	}
+}
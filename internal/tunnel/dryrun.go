@@ -0,0 +1,97 @@
+package tunnel
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"pb-deployer/internal/logger"
+)
+
+// dryRunReadOnly are sudo commands that only inspect the server. They still
+// run in dry-run mode so the preview is based on the real state.
+var dryRunReadOnly = []string{
+	"cat ",
+	"test ",
+	"stat ",
+	"sshd -t",
+	"ufw status",
+	"ufw show ",
+	"firewall-cmd --state",
+	"firewall-cmd --list-",
+	"firewall-cmd --permanent --list-",
+	"iptables -S",
+	"ip6tables -S",
+	"fail2ban-client status",
+	"systemctl is-active",
+}
+
+// dryRunClient wraps an SSHClient so commands that change the server are
+// logged and recorded instead of run, and reported as successful. Commands
+// run without sudo only inspect the server and are passed through.
+type dryRunClient struct {
+	SSHClient
+	logger   *logger.Logger
+	commands []string
+	mu       sync.Mutex
+}
+
+func newDryRunClient(client SSHClient, log *logger.Logger) *dryRunClient {
+	return &dryRunClient{SSHClient: client, logger: log}
+}
+
+func (d *dryRunClient) ExecuteSudo(cmd string, opts ...ExecOption) (*Result, error) {
+	for _, prefix := range dryRunReadOnly {
+		if strings.HasPrefix(cmd, prefix) {
+			return d.SSHClient.ExecuteSudo(cmd, opts...)
+		}
+	}
+	return d.record("sudo " + cmd), nil
+}
+
+func (d *dryRunClient) Upload(localPath, remotePath string, opts ...FileOption) error {
+	d.record(fmt.Sprintf("upload %s -> %s", localPath, remotePath))
+	return nil
+}
+
+func (d *dryRunClient) record(cmd string) *Result {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.commands = append(d.commands, cmd)
+	d.logger.Info("[dry-run] %s", cmd)
+	return &Result{}
+}
+
+// Commands returns the recorded commands in order
+func (d *dryRunClient) Commands() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.commands...)
+}
+
+// WithDryRun makes the security manager record the commands that would
+// change the server instead of running them. Checks that need the changes
+// applied, such as SSH login and fail2ban verification, are skipped. Use
+// DryRunCommands to read the preview.
+func WithDryRun() SecurityOption {
+	return func(s *SecurityManager) {
+		s.dryRun = newDryRunClient(s.manager.client, s.logger)
+		manager := NewManager(s.dryRun)
+		manager.tracer = s.manager.tracer
+		s.manager = manager
+	}
+}
+
+// IsDryRun reports whether the security manager only records commands
+func (s *SecurityManager) IsDryRun() bool {
+	return s.dryRun != nil
+}
+
+// DryRunCommands returns the commands recorded in dry-run mode
+func (s *SecurityManager) DryRunCommands() []string {
+	if s.dryRun == nil {
+		return nil
+	}
+	return s.dryRun.Commands()
+}
@@ -0,0 +1,54 @@
+package tunnel
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDryRunRecordsChangesAndRunsReads(t *testing.T) {
+	client := &scriptedClient{}
+	security := NewSecurityManager(NewManager(client), WithDryRun())
+
+	if !security.IsDryRun() {
+		t.Fatal("Expected dry-run mode")
+	}
+
+	security.manager.client.ExecuteSudo("ufw status")
+	security.manager.client.Execute("which ufw")
+	result, err := security.manager.client.ExecuteSudo("ufw --force enable")
+	if err != nil || result.ExitCode != 0 {
+		t.Errorf("Expected synthetic success, got %v, %+v", err, result)
+	}
+
+	if len(client.commands) != 2 || client.commands[0] != "sudo ufw status" || client.commands[1] != "which ufw" {
+		t.Errorf("Expected only read-only commands to run, got %q", client.commands)
+	}
+	if got := security.DryRunCommands(); len(got) != 1 || got[0] != "sudo ufw --force enable" {
+		t.Errorf("Expected the change to be recorded, got %q", got)
+	}
+}
+
+func TestDryRunSetupFirewallPreview(t *testing.T) {
+	client := &scriptedClient{results: []*Result{
+		{ExitCode: 0},                      // which ufw
+		{Stdout: "203.0.113.7 51234 22\n"}, // echo $SSH_CLIENT
+	}}
+	security := NewSecurityManager(NewManager(client), WithDryRun())
+
+	err := security.SetupFirewall([]FirewallRule{{Port: 22, Protocol: "tcp", Action: "allow"}})
+	if err != nil {
+		t.Fatalf("SetupFirewall failed: %v", err)
+	}
+
+	preview := strings.Join(security.DryRunCommands(), "\n")
+	for _, want := range []string{"sudo ufw --force reset", "sudo ufw allow 22/tcp", "sudo ufw --force enable"} {
+		if !strings.Contains(preview, want) {
+			t.Errorf("Expected preview to contain %q, got:\n%s", want, preview)
+		}
+	}
+	for _, cmd := range client.commands {
+		if strings.Contains(cmd, "reset") || strings.Contains(cmd, "enable") {
+			t.Errorf("Expected %q not to run in dry-run mode", cmd)
+		}
+	}
+}
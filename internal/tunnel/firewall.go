@@ -0,0 +1,910 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// FirewallDiff describes the changes made by an idempotent firewall run.
+// Rules are described in the form "allow 80/tcp from any".
+type FirewallDiff struct {
+	Added     []string
+	Removed   []string
+	Unchanged []string
+}
+
+// Changed reports whether the run added or removed any rule
+func (d *FirewallDiff) Changed() bool {
+	return len(d.Added) > 0 || len(d.Removed) > 0
+}
+
+// firewallPackages maps each supported firewall to the package providing it
+var firewallPackages = map[string]string{
+	"ufw":       "ufw",
+	"firewalld": "firewalld",
+	"iptables":  "iptables",
+}
+
+// detectFirewall returns the firewall backend available on the server, or ""
+// if there is none
+func (s *SecurityManager) detectFirewall() string {
+	for _, fw := range []struct{ name, binary string }{
+		{"ufw", "ufw"},
+		{"firewalld", "firewall-cmd"},
+		{"iptables", "iptables"},
+	} {
+		if s.manager.HasCommand(fw.binary) {
+			return fw.name
+		}
+	}
+	return ""
+}
+
+// requireFirewall returns the detected firewall or an error naming the
+// options when the server has none
+func (s *SecurityManager) requireFirewall() (string, error) {
+	if firewall := s.detectFirewall(); firewall != "" {
+		return firewall, nil
+	}
+	return "", &Error{
+		Type:    ErrorNotFound,
+		Message: "no supported firewall found (ufw, firewalld or iptables); install one or set SecurityConfig.AutoInstallFirewall",
+	}
+}
+
+// InstallFirewall installs preferred (ufw if empty) when the server has no
+// supported firewall and returns the firewall in use afterwards
+func (s *SecurityManager) InstallFirewall(preferred string) (string, error) {
+	if firewall := s.detectFirewall(); firewall != "" {
+		return firewall, nil
+	}
+
+	if preferred == "" {
+		preferred = "ufw"
+	}
+	pkg, ok := firewallPackages[preferred]
+	if !ok {
+		return "", &Error{
+			Type:    ErrorVerification,
+			Message: fmt.Sprintf("unsupported firewall %q, expected ufw, firewalld or iptables", preferred),
+		}
+	}
+
+	s.logger.SystemOperation(fmt.Sprintf("No firewall found, installing %s", preferred))
+	pm, err := s.manager.PackageManager()
+	if err != nil {
+		return "", fmt.Errorf("cannot install %s: %w", preferred, err)
+	}
+	if err := pm.Install(context.Background(), pkg); err != nil {
+		return "", fmt.Errorf("failed to install %s with %s: %w", preferred, pm.Name(), err)
+	}
+	if preferred == "firewalld" {
+		s.manager.ServiceEnable("firewalld")
+		s.manager.ServiceStart("firewalld")
+	}
+
+	firewall, err := s.requireFirewall()
+	if err != nil {
+		return "", fmt.Errorf("%s was installed but not detected: %w", preferred, err)
+	}
+	s.logger.Success("Installed %s firewall with %s", firewall, pm.Name())
+	return firewall, nil
+}
+
+// SyncFirewall reads the current firewall state and only applies the rules
+// that differ from the desired set. Unlike SetupFirewall it never resets or
+// flushes the firewall, so a working configuration is left untouched.
+func (s *SecurityManager) SyncFirewall(rules []FirewallRule) (*FirewallDiff, error) {
+	s.logger.SystemOperation(fmt.Sprintf("Synchronizing firewall with %d rules", len(rules)))
+
+	if err := validateFirewallRules(rules); err != nil {
+		return nil, err
+	}
+
+	firewall, err := s.requireFirewall()
+	if err != nil {
+		return nil, err
+	}
+	rules = s.ensureSSHAllowed(rules, 0)
+
+	var diff *FirewallDiff
+	switch firewall {
+	case "ufw":
+		diff, err = s.syncUFW(rules)
+	case "firewalld":
+		diff, err = s.syncFirewalld(rules)
+	default:
+		diff, err = s.syncIPTables(rules)
+	}
+	if err != nil {
+		return diff, err
+	}
+
+	for _, rule := range diff.Added {
+		s.logger.Info("Firewall rule added: %s", rule)
+	}
+	for _, rule := range diff.Removed {
+		s.logger.Info("Firewall rule removed: %s", rule)
+	}
+	for _, rule := range diff.Unchanged {
+		s.logger.Debug("Firewall rule unchanged: %s", rule)
+	}
+
+	if diff.Changed() {
+		s.logger.Success("Firewall synchronized: %d added, %d removed, %d unchanged",
+			len(diff.Added), len(diff.Removed), len(diff.Unchanged))
+	} else {
+		s.logger.Success("Firewall already up to date (%d rules)", len(diff.Unchanged))
+	}
+	return diff, nil
+}
+
+// chainEntry is one rule of a firewall chain in evaluation order. key is
+// the rule's comparable form, or "" for a rule the sync does not manage.
+type chainEntry struct {
+	key      string
+	catchAll bool
+}
+
+// firewallRemoval is a managed rule to delete, at its 1-based position in
+// the chain as read
+type firewallRemoval struct {
+	key      string
+	position int
+}
+
+// firewallInsert is a missing rule to add at a 1-based chain position, or
+// to append when position is 0
+type firewallInsert struct {
+	key      string
+	position int
+}
+
+// planFirewallOrder works out the changes that make the managed rules of
+// chain match desired in order, ahead of any catch-all rule, without
+// touching unmanaged rules. Managed rules that are not desired, out of
+// order or shadowed by a catch-all are removed; a moved rule therefore
+// shows up in both removals and inserts. Missing rules are inserted right
+// after the rule preceding them in desired. Insert positions assume all
+// removals were made first.
+func planFirewallOrder(chain []chainEntry, desired []string) (removals []firewallRemoval, inserts []firewallInsert, unchanged []string) {
+	rank := map[string]int{}
+	for i, key := range desired {
+		if _, ok := rank[key]; !ok {
+			rank[key] = i
+		}
+	}
+
+	var kept []chainEntry
+	last, shadowed := -1, false
+	for i, entry := range chain {
+		if entry.key == "" {
+			shadowed = shadowed || entry.catchAll
+			kept = append(kept, entry)
+			continue
+		}
+		r, ok := rank[entry.key]
+		if !ok || r <= last || shadowed {
+			removals = append(removals, firewallRemoval{key: entry.key, position: i + 1})
+			continue
+		}
+		last = r
+		kept = append(kept, entry)
+	}
+
+	indexOf := func(key string) int {
+		return slices.IndexFunc(kept, func(entry chainEntry) bool { return entry.key == key })
+	}
+
+	for i, key := range desired {
+		if rank[key] != i {
+			continue
+		}
+		if indexOf(key) >= 0 {
+			unchanged = append(unchanged, key)
+			continue
+		}
+
+		var at int
+		if i > 0 {
+			at = indexOf(desired[i-1]) + 1
+		} else {
+			// The first rule goes before any other managed rule or catch-all
+			at = slices.IndexFunc(kept, func(entry chainEntry) bool { return entry.key != "" || entry.catchAll })
+			if at < 0 {
+				at = len(kept)
+			}
+		}
+
+		position := 0
+		if at < len(kept) {
+			position = at + 1
+		}
+		inserts = append(inserts, firewallInsert{key: key, position: position})
+		kept = slices.Insert(kept, at, chainEntry{key: key})
+	}
+
+	return removals, inserts, unchanged
+}
+
+// parseRuleSource validates a rule source as an IP address or CIDR block and
+// reports whether it is IPv6. An empty source matches any address.
+func parseRuleSource(source string) (ipv6 bool, err error) {
+	if source == "" {
+		return false, nil
+	}
+
+	if strings.Contains(source, "/") {
+		prefix, err := netip.ParsePrefix(source)
+		if err != nil {
+			return false, &Error{
+				Type:    ErrorVerification,
+				Message: fmt.Sprintf("invalid firewall rule source %q: not a valid CIDR block", source),
+				Cause:   err,
+			}
+		}
+		return !prefix.Addr().Unmap().Is4(), nil
+	}
+
+	addr, err := netip.ParseAddr(source)
+	if err != nil {
+		return false, &Error{
+			Type:    ErrorVerification,
+			Message: fmt.Sprintf("invalid firewall rule source %q: not a valid IP address", source),
+			Cause:   err,
+		}
+	}
+	return !addr.Unmap().Is4(), nil
+}
+
+// validateFirewallRules checks every rule before any firewall command runs
+func validateFirewallRules(rules []FirewallRule) error {
+	for _, rule := range rules {
+		if rule.Port < 1 || rule.Port > 65535 {
+			return &Error{
+				Type:    ErrorVerification,
+				Message: fmt.Sprintf("invalid firewall rule port %d: must be between 1 and 65535", rule.Port),
+			}
+		}
+		if rule.PortEnd != 0 && (rule.PortEnd < rule.Port || rule.PortEnd > 65535) {
+			return &Error{
+				Type:    ErrorVerification,
+				Message: fmt.Sprintf("invalid firewall rule port range %d-%d: end must be between start and 65535", rule.Port, rule.PortEnd),
+			}
+		}
+		if _, err := parseRuleSource(rule.Source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// portSpec returns the port or port range of a rule joined with the range
+// separator of a backend: ":" for ufw and iptables, "-" for firewalld
+func portSpec(rule FirewallRule, sep string) string {
+	if rule.PortEnd != 0 && rule.PortEnd != rule.Port {
+		return fmt.Sprintf("%d%s%d", rule.Port, sep, rule.PortEnd)
+	}
+	return strconv.Itoa(rule.Port)
+}
+
+// isIPv6Rule reports whether a validated rule is restricted to an IPv6 source
+func isIPv6Rule(rule FirewallRule) bool {
+	ipv6, _ := parseRuleSource(rule.Source)
+	return ipv6
+}
+
+// hasIPv6Rules reports whether any rule is restricted to an IPv6 source
+func hasIPv6Rules(rules []FirewallRule) bool {
+	return slices.ContainsFunc(rules, isIPv6Rule)
+}
+
+// canonicalSource returns a rule source the way firewalls print it back:
+// CIDR blocks with their host bits cleared, single-host prefixes as plain
+// addresses and IPv6 addresses in their shortest form. A source that does
+// not parse is returned as is.
+func canonicalSource(source string) string {
+	if ip, network, err := net.ParseCIDR(source); err == nil {
+		if ones, bits := network.Mask.Size(); ones == bits {
+			return ip.String()
+		}
+		return network.String()
+	}
+	if ip := net.ParseIP(source); ip != nil {
+		return ip.String()
+	}
+	return source
+}
+
+// normalizeSource returns the canonical source of a rule, or "any" when it
+// has none, so desired rules compare equal to the ones read back
+func normalizeSource(source string) string {
+	if source == "" {
+		return "any"
+	}
+	return canonicalSource(source)
+}
+
+// describeRule returns the human-readable form used in FirewallDiff
+func describeRule(rule FirewallRule) string {
+	return fmt.Sprintf("%s %s/%s from %s",
+		rule.Action, portSpec(rule, ":"), rule.Protocol, normalizeSource(rule.Source))
+}
+
+// ufwRuleArgs returns the ufw arguments for a rule, matching the format
+// printed by "ufw show added"
+func ufwRuleArgs(rule FirewallRule) string {
+	if rule.Source != "" {
+		return fmt.Sprintf("%s from %s to any port %s proto %s",
+			rule.Action, canonicalSource(rule.Source), portSpec(rule, ":"), rule.Protocol)
+	}
+	return fmt.Sprintf("%s %s/%s", rule.Action, portSpec(rule, ":"), rule.Protocol)
+}
+
+// ufwEntry is a rule listed by "ufw status numbered"
+type ufwEntry struct {
+	chainEntry
+	number int
+	v6     bool
+}
+
+var ufwNumberedRegex = regexp.MustCompile(`^\[\s*(\d+)\]\s+(.+?)\s+(ALLOW|DENY|REJECT|LIMIT)(?:\s+(IN|OUT|FWD))?\s+(.+?)(?:\s+#.*)?$`)
+
+// parseUFWNumbered reads the rules of "ufw status numbered" with keys in the
+// ufwRuleArgs form. A rule the sync cannot express is keyed on its listing,
+// so it is never desired and gets removed.
+func parseUFWNumbered(output string) []ufwEntry {
+	var entries []ufwEntry
+	for _, line := range strings.Split(output, "\n") {
+		m := ufwNumberedRegex.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		number, _ := strconv.Atoi(m[1])
+		to := strings.TrimSpace(strings.TrimSuffix(m[2], "(v6)"))
+		from := strings.TrimSpace(strings.TrimSuffix(m[5], "(v6)"))
+		ipv6, _ := parseRuleSource(from)
+		entry := ufwEntry{number: number, v6: to != m[2] || from != m[5] || ipv6}
+
+		action := strings.ToLower(m[3])
+		port, protocol, ok := strings.Cut(to, "/")
+		switch {
+		case m[4] == "OUT" || m[4] == "FWD" || !ok || strings.Contains(port, " "):
+			entry.key = strings.Join(strings.Fields(line[strings.Index(line, "]")+1:]), " ")
+		case from == "Anywhere":
+			entry.key = fmt.Sprintf("%s %s/%s", action, port, protocol)
+		default:
+			entry.key = fmt.Sprintf("%s from %s to any port %s proto %s", action, canonicalSource(from), port, protocol)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func (s *SecurityManager) syncUFW(rules []FirewallRule) (*FirewallDiff, error) {
+	diff := &FirewallDiff{}
+
+	if hasIPv6Rules(rules) {
+		if err := s.enableUFWIPv6(); err != nil {
+			return diff, err
+		}
+	}
+
+	var desired, desiredV4, desiredV6 []string
+	descriptions := map[string]string{}
+	for _, rule := range rules {
+		args := ufwRuleArgs(rule)
+		desired = append(desired, args)
+		descriptions[args] = describeRule(rule)
+		if !isIPv6Rule(rule) {
+			desiredV4 = append(desiredV4, args)
+		}
+		if rule.Source == "" || isIPv6Rule(rule) {
+			desiredV6 = append(desiredV6, args)
+		}
+	}
+
+	status, err := s.readUFWStatus()
+	if err != nil {
+		return diff, err
+	}
+
+	// An inactive UFW has no numbered listing, so its rules are read from
+	// "ufw show added" instead
+	if !strings.Contains(status, "Status: active") {
+		if err := s.syncUFWAdded(desired, descriptions, diff); err != nil {
+			return diff, err
+		}
+		cmds := []string{
+			"ufw default deny incoming",
+			"ufw default allow outgoing",
+			"ufw --force enable",
+		}
+		for _, cmd := range cmds {
+			if err := s.execFirewall(cmd, "UFW setup failed"); err != nil {
+				return diff, err
+			}
+		}
+		return diff, nil
+	}
+
+	// "ufw status numbered" lists every IPv4 rule before the IPv6 ones and
+	// "ufw insert" counts in that listing. IPv4 is synced first: inserting a
+	// rule without a source also adds its IPv6 copy, so IPv6 is planned on a
+	// fresh listing afterwards.
+	changed, err := s.syncUFWFamily(parseUFWNumbered(status), false, desiredV4, descriptions, diff)
+	if err != nil {
+		return diff, err
+	}
+	if changed {
+		if status, err = s.readUFWStatus(); err != nil {
+			return diff, err
+		}
+	}
+	entries := parseUFWNumbered(status)
+	if hasIPv6Rules(rules) || slices.ContainsFunc(entries, func(entry ufwEntry) bool { return entry.v6 }) {
+		if _, err := s.syncUFWFamily(entries, true, desiredV6, descriptions, diff); err != nil {
+			return diff, err
+		}
+	}
+
+	return diff, nil
+}
+
+// readUFWStatus returns the output of "ufw status numbered"
+func (s *SecurityManager) readUFWStatus() (string, error) {
+	result, err := s.manager.client.ExecuteSudo("ufw status numbered")
+	if err != nil {
+		return "", err
+	}
+	if result.ExitCode != 0 {
+		return "", &Error{
+			Type:    ErrorExecution,
+			Message: fmt.Sprintf("failed to read UFW rules: %s", result.Stderr),
+		}
+	}
+	return result.Stdout, nil
+}
+
+// syncUFWFamily makes the IPv4 or IPv6 rules of an active UFW match desired,
+// deleting and inserting by "ufw status numbered" position. It reports
+// whether it changed anything.
+func (s *SecurityManager) syncUFWFamily(entries []ufwEntry, v6 bool, desired []string, descriptions map[string]string, diff *FirewallDiff) (bool, error) {
+	// IPv6 positions continue after the last IPv4 rule
+	var family []ufwEntry
+	offset := 0
+	for _, entry := range entries {
+		switch {
+		case entry.v6 == v6:
+			family = append(family, entry)
+		case v6:
+			offset++
+		}
+	}
+
+	chain := make([]chainEntry, len(family))
+	for i, entry := range family {
+		chain[i] = entry.chainEntry
+	}
+	removals, inserts, unchanged := planFirewallOrder(chain, desired)
+
+	// Delete from the bottom up so the numbers of earlier rules stay valid
+	for i := len(removals) - 1; i >= 0; i-- {
+		cmd := fmt.Sprintf("ufw --force delete %d", family[removals[i].position-1].number)
+		if err := s.execFirewall(cmd, "failed to remove UFW rule"); err != nil {
+			return true, err
+		}
+	}
+	for _, removal := range removals {
+		appendOnce(&diff.Removed, removal.key)
+	}
+
+	for _, insert := range inserts {
+		cmd := "ufw " + insert.key
+		if insert.position > 0 {
+			cmd = fmt.Sprintf("ufw insert %d %s", offset+insert.position, insert.key)
+		}
+		if err := s.execFirewall(cmd, "failed to add UFW rule"); err != nil {
+			return true, err
+		}
+		appendOnce(&diff.Added, descriptions[insert.key])
+	}
+	for _, args := range unchanged {
+		appendOnce(&diff.Unchanged, descriptions[args])
+	}
+
+	return len(removals) > 0 || len(inserts) > 0, nil
+}
+
+// syncUFWAdded syncs an inactive UFW from "ufw show added", whose order is
+// the order of the rules files
+func (s *SecurityManager) syncUFWAdded(desired []string, descriptions map[string]string, diff *FirewallDiff) error {
+	result, err := s.manager.client.ExecuteSudo("ufw show added")
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return &Error{
+			Type:    ErrorExecution,
+			Message: fmt.Sprintf("failed to read UFW rules: %s", result.Stderr),
+		}
+	}
+
+	// ufw refuses duplicate rules, so each rule is its own key
+	var chain []chainEntry
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "ufw ") {
+			chain = append(chain, chainEntry{key: strings.TrimPrefix(line, "ufw ")})
+		}
+	}
+
+	removals, inserts, unchanged := planFirewallOrder(chain, desired)
+	for _, removal := range removals {
+		if err := s.execFirewall("ufw delete "+removal.key, "failed to remove UFW rule"); err != nil {
+			return err
+		}
+		diff.Removed = append(diff.Removed, removal.key)
+	}
+	for _, insert := range inserts {
+		cmd := "ufw " + insert.key
+		if insert.position > 0 {
+			cmd = fmt.Sprintf("ufw insert %d %s", insert.position, insert.key)
+		}
+		if err := s.execFirewall(cmd, "failed to add UFW rule"); err != nil {
+			return err
+		}
+		diff.Added = append(diff.Added, descriptions[insert.key])
+	}
+	for _, args := range unchanged {
+		diff.Unchanged = append(diff.Unchanged, descriptions[args])
+	}
+	return nil
+}
+
+// appendOnce appends value to list unless it is already there. A rule that
+// applies to both address families is listed twice by UFW but reported once.
+func appendOnce(list *[]string, value string) {
+	if !slices.Contains(*list, value) {
+		*list = append(*list, value)
+	}
+}
+
+// enableUFWIPv6 makes sure UFW also manages ip6tables so IPv6 rules apply
+func (s *SecurityManager) enableUFWIPv6() error {
+	return s.execFirewall("sed -i 's/^IPV6=.*/IPV6=yes/' /etc/default/ufw", "failed to enable UFW IPv6 support")
+}
+
+var (
+	richRuleFamilyRegex   = regexp.MustCompile(`family="(ipv4|ipv6)"`)
+	richRuleSourceRegex   = regexp.MustCompile(`source address="([^"]+)"`)
+	richRulePortRegex     = regexp.MustCompile(`port="(\d+(?:-\d+)?)"`)
+	richRuleProtocolRegex = regexp.MustCompile(`protocol="(\w+)"`)
+)
+
+// firewalldRichRule returns the rich rule used for a source-restricted allow rule
+func firewalldRichRule(rule FirewallRule) string {
+	family := "ipv4"
+	if isIPv6Rule(rule) {
+		family = "ipv6"
+	}
+	return fmt.Sprintf(`rule family="%s" source address="%s" port protocol="%s" port="%s" accept`,
+		family, rule.Source, rule.Protocol, portSpec(rule, "-"))
+}
+
+// richRuleKey extracts a comparable description from a firewalld rich rule
+func richRuleKey(line string) string {
+	source := richRuleSourceRegex.FindStringSubmatch(line)
+	port := richRulePortRegex.FindStringSubmatch(line)
+	protocol := richRuleProtocolRegex.FindStringSubmatch(line)
+	if source == nil || port == nil || protocol == nil || !strings.HasSuffix(strings.TrimSpace(line), "accept") {
+		return ""
+	}
+	if richRuleFamilyRegex.FindStringSubmatch(line) == nil {
+		return ""
+	}
+	return fmt.Sprintf("allow %s/%s from %s",
+		strings.Replace(port[1], "-", ":", 1), protocol[1], normalizeSource(source[1]))
+}
+
+func (s *SecurityManager) syncFirewalld(rules []FirewallRule) (*FirewallDiff, error) {
+	diff := &FirewallDiff{}
+	s.manager.ServiceStart("firewalld")
+
+	portsResult, err := s.manager.client.ExecuteSudo("firewall-cmd --permanent --list-ports")
+	if err != nil {
+		return diff, err
+	}
+	currentPorts := strings.Fields(portsResult.Stdout)
+
+	richResult, err := s.manager.client.ExecuteSudo("firewall-cmd --permanent --list-rich-rules")
+	if err != nil {
+		return diff, err
+	}
+	currentRich := map[string]string{}
+	for _, line := range strings.Split(richResult.Stdout, "\n") {
+		if key := richRuleKey(line); key != "" {
+			currentRich[key] = strings.TrimSpace(line)
+		}
+	}
+
+	var desiredPorts, desiredRich []string
+	for _, rule := range rules {
+		// Matches SetupFirewall: firewalld only manages allow rules
+		if rule.Action != "allow" {
+			continue
+		}
+		description := describeRule(rule)
+
+		if rule.Source != "" {
+			desiredRich = append(desiredRich, description)
+			if _, ok := currentRich[description]; ok {
+				diff.Unchanged = append(diff.Unchanged, description)
+				continue
+			}
+			cmd := fmt.Sprintf("firewall-cmd --permanent --add-rich-rule='%s'", firewalldRichRule(rule))
+			if err := s.execFirewall(cmd, "failed to add firewalld rule"); err != nil {
+				return diff, err
+			}
+			diff.Added = append(diff.Added, description)
+			continue
+		}
+
+		port := fmt.Sprintf("%s/%s", portSpec(rule, "-"), rule.Protocol)
+		desiredPorts = append(desiredPorts, port)
+		if slices.Contains(currentPorts, port) {
+			diff.Unchanged = append(diff.Unchanged, description)
+			continue
+		}
+		cmd := fmt.Sprintf("firewall-cmd --permanent --add-port=%s", port)
+		if err := s.execFirewall(cmd, "failed to add firewalld rule"); err != nil {
+			return diff, err
+		}
+		diff.Added = append(diff.Added, description)
+	}
+
+	for _, port := range currentPorts {
+		if slices.Contains(desiredPorts, port) {
+			continue
+		}
+		cmd := fmt.Sprintf("firewall-cmd --permanent --remove-port=%s", port)
+		if err := s.execFirewall(cmd, "failed to remove firewalld rule"); err != nil {
+			return diff, err
+		}
+		diff.Removed = append(diff.Removed, "allow "+strings.Replace(port, "-", ":", 1)+" from any")
+	}
+
+	for key, line := range currentRich {
+		if slices.Contains(desiredRich, key) {
+			continue
+		}
+		cmd := fmt.Sprintf("firewall-cmd --permanent --remove-rich-rule='%s'", line)
+		if err := s.execFirewall(cmd, "failed to remove firewalld rule"); err != nil {
+			return diff, err
+		}
+		diff.Removed = append(diff.Removed, key)
+	}
+
+	if diff.Changed() {
+		if err := s.execFirewall("firewall-cmd --reload", "failed to reload firewalld"); err != nil {
+			return diff, err
+		}
+	}
+
+	return diff, nil
+}
+
+// iptablesRuleKey extracts a comparable description from an "iptables -S"
+// INPUT rule with a destination port, or "" for any other rule
+func iptablesRuleKey(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != "-A" || fields[1] != "INPUT" {
+		return ""
+	}
+
+	var protocol, port, source, target string
+	for i := 2; i < len(fields)-1; i++ {
+		switch fields[i] {
+		case "-p":
+			protocol = fields[i+1]
+		case "--dport":
+			port = fields[i+1]
+		case "-s":
+			source = fields[i+1]
+		case "-j":
+			target = fields[i+1]
+		}
+	}
+
+	if port == "" || protocol == "" {
+		return ""
+	}
+
+	var action string
+	switch target {
+	case "ACCEPT":
+		action = "allow"
+	case "DROP":
+		action = "deny"
+	default:
+		return ""
+	}
+
+	return fmt.Sprintf("%s %s/%s from %s", action, port, protocol, normalizeSource(source))
+}
+
+// iptablesCatchAll reports whether an "iptables -S" INPUT rule rejects or
+// drops traffic without matching on protocol, port, source or interface, so
+// no rule after it is ever reached by new connections
+func iptablesCatchAll(line string) bool {
+	fields := strings.Fields(line)
+	target := ""
+	for i, field := range fields {
+		switch field {
+		case "-p", "--dport", "-s", "-i", "-m":
+			return false
+		case "-j":
+			if i+1 < len(fields) {
+				target = fields[i+1]
+			}
+		}
+	}
+	return target == "REJECT" || target == "DROP"
+}
+
+// iptablesRuleSpec returns the iptables match and target arguments for a rule
+func iptablesRuleSpec(rule FirewallRule) string {
+	action := "ACCEPT"
+	if rule.Action == "deny" {
+		action = "DROP"
+	}
+	if rule.Source != "" {
+		return fmt.Sprintf("-p %s --dport %s -s %s -j %s", rule.Protocol, portSpec(rule, ":"), rule.Source, action)
+	}
+	return fmt.Sprintf("-p %s --dport %s -j %s", rule.Protocol, portSpec(rule, ":"), action)
+}
+
+func (s *SecurityManager) syncIPTables(rules []FirewallRule) (*FirewallDiff, error) {
+	diff := &FirewallDiff{}
+
+	for _, binary := range iptablesBinaries(rules) {
+		if err := s.syncIPTablesFamily(binary, iptablesRulesFor(binary, rules), diff); err != nil {
+			return diff, err
+		}
+	}
+
+	return diff, nil
+}
+
+// syncIPTablesFamily synchronizes the INPUT chain of iptables or ip6tables
+func (s *SecurityManager) syncIPTablesFamily(binary string, rules []FirewallRule, diff *FirewallDiff) error {
+	// Base rules are checked with -C and inserted at the top when missing,
+	// ahead of any catch-all that would shadow them
+	baseRules := []string{
+		"-i lo -j ACCEPT",
+		"-m state --state ESTABLISHED,RELATED -j ACCEPT",
+	}
+	for i, spec := range baseRules {
+		check, err := s.manager.client.ExecuteSudo(binary + " -C INPUT " + spec)
+		if err == nil && check.ExitCode == 0 {
+			continue
+		}
+		if err := s.execFirewall(fmt.Sprintf("%s -I INPUT %d %s", binary, i+1, spec), "failed to add iptables rule"); err != nil {
+			return err
+		}
+	}
+
+	result, err := s.manager.client.ExecuteSudo(binary + " -S INPUT")
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return &Error{
+			Type:    ErrorExecution,
+			Message: fmt.Sprintf("failed to read %s rules: %s", binary, result.Stderr),
+		}
+	}
+
+	var chain []chainEntry
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "-A INPUT") {
+			chain = append(chain, chainEntry{key: iptablesRuleKey(line), catchAll: iptablesCatchAll(line)})
+		}
+	}
+
+	var desired []string
+	specs := map[string]string{}
+	for _, rule := range rules {
+		description := describeRule(rule)
+		desired = append(desired, description)
+		specs[description] = iptablesRuleSpec(rule)
+	}
+
+	removals, inserts, unchanged := planFirewallOrder(chain, desired)
+
+	// Delete by position from the bottom up so earlier positions stay valid
+	// and a duplicate rule is removed rather than its first copy
+	for i := len(removals) - 1; i >= 0; i-- {
+		cmd := fmt.Sprintf("%s -D INPUT %d", binary, removals[i].position)
+		if err := s.execFirewall(cmd, "failed to remove iptables rule"); err != nil {
+			return err
+		}
+	}
+	for _, removal := range removals {
+		diff.Removed = append(diff.Removed, removal.key)
+	}
+
+	for _, insert := range inserts {
+		cmd := binary + " -A INPUT " + specs[insert.key]
+		if insert.position > 0 {
+			cmd = fmt.Sprintf("%s -I INPUT %d %s", binary, insert.position, specs[insert.key])
+		}
+		if err := s.execFirewall(cmd, "failed to add iptables rule"); err != nil {
+			return err
+		}
+		diff.Added = append(diff.Added, insert.key)
+	}
+	diff.Unchanged = append(diff.Unchanged, unchanged...)
+
+	// Tighten the policy last so the allow rules are in place first
+	if err := s.execFirewall(binary+" -P INPUT DROP", "failed to set iptables policy"); err != nil {
+		return err
+	}
+
+	if diff.Changed() {
+		s.manager.client.ExecuteSudo(iptablesSaveCommand(binary))
+	}
+
+	return nil
+}
+
+// iptablesBinaries returns the iptables commands needed for a rule set;
+// ip6tables is only managed when at least one rule has an IPv6 source
+func iptablesBinaries(rules []FirewallRule) []string {
+	if hasIPv6Rules(rules) {
+		return []string{"iptables", "ip6tables"}
+	}
+	return []string{"iptables"}
+}
+
+// iptablesRulesFor returns the rules that apply to an iptables binary. Rules
+// without a source apply to both address families.
+func iptablesRulesFor(binary string, rules []FirewallRule) []FirewallRule {
+	ipv6 := binary == "ip6tables"
+	var filtered []FirewallRule
+	for _, rule := range rules {
+		if rule.Source == "" || isIPv6Rule(rule) == ipv6 {
+			filtered = append(filtered, rule)
+		}
+	}
+	return filtered
+}
+
+// iptablesSaveCommand returns the command persisting the rules of a binary
+func iptablesSaveCommand(binary string) string {
+	if binary == "ip6tables" {
+		return "ip6tables-save > /etc/iptables/rules.v6"
+	}
+	return "iptables-save > /etc/iptables/rules.v4"
+}
+
+// execFirewall runs a firewall command with sudo and wraps a non-zero exit
+func (s *SecurityManager) execFirewall(cmd, message string) error {
+	result, err := s.manager.client.ExecuteSudo(cmd)
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return &Error{
+			Type:    ErrorExecution,
+			Message: fmt.Sprintf("%s: %s", message, result.Stderr),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,401 @@
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestInstallFirewallWhenNoneDetected(t *testing.T) {
+	client := &scriptedClient{results: []*Result{
+		{ExitCode: 1}, // which ufw
+		{ExitCode: 1}, // which firewall-cmd
+		{ExitCode: 1}, // which iptables
+		{ExitCode: 0}, // command -v apt-get
+		{ExitCode: 0}, // apt-get update
+		{ExitCode: 0}, // apt-get install
+		{ExitCode: 0}, // which ufw
+	}}
+	security := NewSecurityManager(NewManager(client))
+
+	firewall, err := security.InstallFirewall("")
+	if err != nil {
+		t.Fatalf("InstallFirewall failed: %v", err)
+	}
+	if firewall != "ufw" {
+		t.Errorf("Expected ufw, got %q", firewall)
+	}
+	if !strings.HasSuffix(client.commands[5], "apt-get install -y 'ufw'") {
+		t.Errorf("Expected ufw to be installed, got %q", client.commands[5])
+	}
+}
+
+func TestInstallFirewallKeepsExisting(t *testing.T) {
+	client := &scriptedClient{results: []*Result{{ExitCode: 1}, {ExitCode: 0}}}
+	security := NewSecurityManager(NewManager(client))
+
+	firewall, err := security.InstallFirewall("ufw")
+	if err != nil || firewall != "firewalld" {
+		t.Errorf("Expected existing firewalld to be used, got %q, %v", firewall, err)
+	}
+	if len(client.commands) != 2 {
+		t.Errorf("Expected no install, got %q", client.commands)
+	}
+}
+
+func TestInstallFirewallRejectsUnknown(t *testing.T) {
+	client := &scriptedClient{results: []*Result{{ExitCode: 1}, {ExitCode: 1}, {ExitCode: 1}}}
+	security := NewSecurityManager(NewManager(client))
+
+	if _, err := security.InstallFirewall("nftables"); err == nil {
+		t.Error("Expected unsupported firewall to be rejected")
+	}
+}
+
+func TestSetupFirewallWithoutFirewall(t *testing.T) {
+	client := &scriptedClient{results: []*Result{{ExitCode: 1}, {ExitCode: 1}, {ExitCode: 1}}}
+	security := NewSecurityManager(NewManager(client))
+
+	err := security.SetupFirewall([]FirewallRule{{Port: 22, Protocol: "tcp", Action: "allow"}})
+	var tunnelErr *Error
+	if !errors.As(err, &tunnelErr) || tunnelErr.Type != ErrorNotFound {
+		t.Errorf("Expected ErrorNotFound, got %v", err)
+	}
+}
+
+func TestPlanFirewallOrder(t *testing.T) {
+	managed := func(keys ...string) []chainEntry {
+		var chain []chainEntry
+		for _, key := range keys {
+			chain = append(chain, chainEntry{key: key})
+		}
+		return chain
+	}
+	catchAll := chainEntry{catchAll: true}
+
+	tests := []struct {
+		name      string
+		chain     []chainEntry
+		desired   []string
+		removals  []firewallRemoval
+		inserts   []firewallInsert
+		unchanged []string
+	}{
+		{
+			name:      "in sync",
+			chain:     managed("a", "b"),
+			desired:   []string{"a", "b"},
+			unchanged: []string{"a", "b"},
+		},
+		{
+			name:      "missing rule goes before its successor",
+			chain:     managed("deny"),
+			desired:   []string{"allow", "deny"},
+			inserts:   []firewallInsert{{"allow", 1}},
+			unchanged: []string{"deny"},
+		},
+		{
+			name:      "missing rule goes after its predecessor",
+			chain:     append(managed("a"), catchAll),
+			desired:   []string{"a", "b"},
+			inserts:   []firewallInsert{{"b", 2}},
+			unchanged: []string{"a"},
+		},
+		{
+			name:    "first rule goes before a catch-all",
+			chain:   []chainEntry{{}, catchAll},
+			desired: []string{"a"},
+			inserts: []firewallInsert{{"a", 2}},
+		},
+		{
+			name:    "appended to an empty chain",
+			desired: []string{"a", "b"},
+			inserts: []firewallInsert{{"a", 0}, {"b", 0}},
+		},
+		{
+			name:     "shadowed rule is moved ahead of the catch-all",
+			chain:    []chainEntry{{}, catchAll, {key: "a"}},
+			desired:  []string{"a"},
+			removals: []firewallRemoval{{"a", 3}},
+			inserts:  []firewallInsert{{"a", 2}},
+		},
+		{
+			name:      "out of order rule is moved",
+			chain:     managed("b", "a"),
+			desired:   []string{"a", "b"},
+			removals:  []firewallRemoval{{"a", 2}},
+			inserts:   []firewallInsert{{"a", 1}},
+			unchanged: []string{"b"},
+		},
+		{
+			name:      "undesired rule and duplicate are removed",
+			chain:     managed("a", "x", "a"),
+			desired:   []string{"a"},
+			removals:  []firewallRemoval{{"x", 2}, {"a", 3}},
+			unchanged: []string{"a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			removals, inserts, unchanged := planFirewallOrder(tt.chain, tt.desired)
+			if !reflect.DeepEqual(removals, tt.removals) {
+				t.Errorf("removals = %v, want %v", removals, tt.removals)
+			}
+			if !reflect.DeepEqual(inserts, tt.inserts) {
+				t.Errorf("inserts = %v, want %v", inserts, tt.inserts)
+			}
+			if !slices.Equal(unchanged, tt.unchanged) {
+				t.Errorf("unchanged = %q, want %q", unchanged, tt.unchanged)
+			}
+		})
+	}
+}
+
+// ufwNumbered returns "ufw status numbered" output for an active firewall
+func ufwNumbered(rows ...string) string {
+	out := "Status: active\n\n     To                         Action      From\n     --                         ------      ----\n"
+	for i, row := range rows {
+		out += fmt.Sprintf("[%2d] %s\n", i+1, row)
+	}
+	return out
+}
+
+func TestSyncUFWInsertsAllowBeforeExistingDeny(t *testing.T) {
+	client := &scriptedClient{results: []*Result{
+		{Stdout: ufwNumbered(
+			"8080/tcp                   DENY IN     Anywhere",
+			"8080/tcp (v6)              DENY IN     Anywhere (v6)",
+		)},
+		{}, // ufw insert
+		{Stdout: ufwNumbered(
+			"8080/tcp                   ALLOW IN    10.0.0.1",
+			"8080/tcp                   DENY IN     Anywhere",
+			"8080/tcp (v6)              DENY IN     Anywhere (v6)",
+		)},
+	}}
+	security := NewSecurityManager(NewManager(client))
+
+	diff, err := security.syncUFW([]FirewallRule{
+		{Port: 8080, Protocol: "tcp", Source: "10.0.0.1", Action: "allow"},
+		{Port: 8080, Protocol: "tcp", Action: "deny"},
+	})
+	if err != nil {
+		t.Fatalf("syncUFW failed: %v", err)
+	}
+
+	want := []string{
+		"sudo ufw status numbered",
+		"sudo ufw insert 1 allow from 10.0.0.1 to any port 8080 proto tcp",
+		"sudo ufw status numbered",
+	}
+	if !slices.Equal(client.commands, want) {
+		t.Errorf("Unexpected commands:\n got %q\nwant %q", client.commands, want)
+	}
+	if want := []string{"allow 8080/tcp from 10.0.0.1"}; !slices.Equal(diff.Added, want) {
+		t.Errorf("Added = %q, want %q", diff.Added, want)
+	}
+	if want := []string{"deny 8080/tcp from any"}; !slices.Equal(diff.Unchanged, want) {
+		t.Errorf("Unchanged = %q, want %q", diff.Unchanged, want)
+	}
+}
+
+func TestSyncUFWNumbersIPv6AfterIPv4(t *testing.T) {
+	client := &scriptedClient{results: []*Result{
+		{}, // enable IPv6
+		{Stdout: ufwNumbered(
+			"22/tcp                     ALLOW IN    Anywhere",
+			"80/tcp                     ALLOW IN    Anywhere",
+			"22/tcp (v6)                ALLOW IN    Anywhere (v6)",
+			"80/tcp (v6)                ALLOW IN    Anywhere (v6)",
+			"8090/tcp                   ALLOW IN    2001:db8::/32",
+		)},
+		{}, // ufw --force delete
+		{}, // ufw insert
+	}}
+	security := NewSecurityManager(NewManager(client))
+
+	diff, err := security.syncUFW([]FirewallRule{
+		{Port: 22, Protocol: "tcp", Action: "allow"},
+		{Port: 8090, Protocol: "tcp", Source: "2001:db8::/32", Action: "deny"},
+		{Port: 80, Protocol: "tcp", Action: "allow"},
+	})
+	if err != nil {
+		t.Fatalf("syncUFW failed: %v", err)
+	}
+
+	// The IPv6 deny belongs between the IPv6 copies of 22 and 80, which are
+	// rules 3 and 4 of the listing
+	want := []string{
+		"sudo sed -i 's/^IPV6=.*/IPV6=yes/' /etc/default/ufw",
+		"sudo ufw status numbered",
+		"sudo ufw --force delete 5",
+		"sudo ufw insert 4 deny from 2001:db8::/32 to any port 8090 proto tcp",
+	}
+	if !slices.Equal(client.commands, want) {
+		t.Errorf("Unexpected commands:\n got %q\nwant %q", client.commands, want)
+	}
+	if want := []string{"allow from 2001:db8::/32 to any port 8090 proto tcp"}; !slices.Equal(diff.Removed, want) {
+		t.Errorf("Removed = %q, want %q", diff.Removed, want)
+	}
+	if want := []string{"allow 22/tcp from any", "allow 80/tcp from any"}; !slices.Equal(diff.Unchanged, want) {
+		t.Errorf("Unchanged = %q, want %q", diff.Unchanged, want)
+	}
+}
+
+func TestSyncUFWInactiveUsesAddedRules(t *testing.T) {
+	client := &scriptedClient{results: []*Result{
+		{Stdout: "Status: inactive\n"},
+		{Stdout: "Added user rules (see 'ufw status' for running firewall):\nufw allow 22/tcp\nufw allow 3000/tcp\n"},
+	}}
+	security := NewSecurityManager(NewManager(client))
+
+	diff, err := security.syncUFW([]FirewallRule{{Port: 22, Protocol: "tcp", Action: "allow"}})
+	if err != nil {
+		t.Fatalf("syncUFW failed: %v", err)
+	}
+
+	want := []string{
+		"sudo ufw status numbered",
+		"sudo ufw show added",
+		"sudo ufw delete allow 3000/tcp",
+		"sudo ufw default deny incoming",
+		"sudo ufw default allow outgoing",
+		"sudo ufw --force enable",
+	}
+	if !slices.Equal(client.commands, want) {
+		t.Errorf("Unexpected commands:\n got %q\nwant %q", client.commands, want)
+	}
+	if want := []string{"allow 3000/tcp"}; !slices.Equal(diff.Removed, want) {
+		t.Errorf("Removed = %q, want %q", diff.Removed, want)
+	}
+}
+
+func TestParseUFWNumbered(t *testing.T) {
+	output := ufwNumbered(
+		"22/tcp                     LIMIT IN    Anywhere",
+		"6000:6007/tcp              ALLOW IN    10.0.0.0/8                 # app",
+		"443                        ALLOW IN    Anywhere",
+		"53/udp                     ALLOW OUT   Anywhere (out)",
+		"22/tcp (v6)                LIMIT IN    Anywhere (v6)",
+		"8090/tcp                   DENY IN     2001:db8::/32",
+	)
+
+	want := []ufwEntry{
+		{chainEntry{key: "limit 22/tcp"}, 1, false},
+		{chainEntry{key: "allow from 10.0.0.0/8 to any port 6000:6007 proto tcp"}, 2, false},
+		{chainEntry{key: "443 ALLOW IN Anywhere"}, 3, false},
+		{chainEntry{key: "53/udp ALLOW OUT Anywhere (out)"}, 4, false},
+		{chainEntry{key: "limit 22/tcp"}, 5, true},
+		{chainEntry{key: "deny from 2001:db8::/32 to any port 8090 proto tcp"}, 6, true},
+	}
+	if got := parseUFWNumbered(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseUFWNumbered() =\n%+v\nwant\n%+v", got, want)
+	}
+	if got := parseUFWNumbered("Status: inactive\n"); len(got) != 0 {
+		t.Errorf("Expected no rules from an inactive UFW, got %+v", got)
+	}
+}
+
+func TestSyncIPTablesInsertsAllowBeforeCatchAll(t *testing.T) {
+	client := &scriptedClient{results: []*Result{
+		{}, // -C lo
+		{}, // -C established
+		{Stdout: strings.Join([]string{
+			"-P INPUT ACCEPT",
+			"-A INPUT -i lo -j ACCEPT",
+			"-A INPUT -m state --state RELATED,ESTABLISHED -j ACCEPT",
+			"-A INPUT -p tcp -m tcp --dport 22 -j ACCEPT",
+			"-A INPUT -j REJECT --reject-with icmp-host-prohibited",
+		}, "\n")},
+	}}
+	security := NewSecurityManager(NewManager(client))
+
+	diff := &FirewallDiff{}
+	err := security.syncIPTablesFamily("iptables", []FirewallRule{
+		{Port: 22, Protocol: "tcp", Action: "allow"},
+		{Port: 80, Protocol: "tcp", Action: "allow"},
+	}, diff)
+	if err != nil {
+		t.Fatalf("syncIPTablesFamily failed: %v", err)
+	}
+
+	if want := "sudo iptables -I INPUT 4 -p tcp --dport 80 -j ACCEPT"; client.commands[3] != want {
+		t.Errorf("Expected %q, got %q", want, client.commands[3])
+	}
+	if want := []string{"allow 80/tcp from any"}; !slices.Equal(diff.Added, want) {
+		t.Errorf("Added = %q, want %q", diff.Added, want)
+	}
+	if len(diff.Removed) != 0 {
+		t.Errorf("Expected the unmanaged catch-all to be kept, removed %q", diff.Removed)
+	}
+}
+
+func TestIPTablesCatchAll(t *testing.T) {
+	tests := map[string]bool{
+		"-A INPUT -j REJECT --reject-with icmp-host-prohibited": true,
+		"-A INPUT -j DROP":                          true,
+		"-A INPUT -p tcp -m tcp --dport 22 -j DROP": false,
+		"-A INPUT -s 10.0.0.0/8 -j REJECT":          false,
+		"-A INPUT -i lo -j ACCEPT":                  false,
+		"-A INPUT -j ACCEPT":                        false,
+	}
+	for line, want := range tests {
+		if got := iptablesCatchAll(line); got != want {
+			t.Errorf("iptablesCatchAll(%q) = %v, want %v", line, got, want)
+		}
+	}
+}
+
+func TestCanonicalSource(t *testing.T) {
+	tests := map[string]string{
+		"10.0.0.1/8":          "10.0.0.0/8",
+		"10.0.0.0/8":          "10.0.0.0/8",
+		"192.168.1.7/32":      "192.168.1.7",
+		"192.168.1.7":         "192.168.1.7",
+		"2001:DB8::1/32":      "2001:db8::/32",
+		"2001:db8:0:0::1/128": "2001:db8::1",
+		"2001:0db8::0001":     "2001:db8::1",
+		"not-an-address":      "not-an-address",
+	}
+	for source, want := range tests {
+		if got := canonicalSource(source); got != want {
+			t.Errorf("canonicalSource(%q) = %q, want %q", source, got, want)
+		}
+	}
+}
+
+func TestSyncIPTablesMatchesNonCanonicalSource(t *testing.T) {
+	client := &scriptedClient{results: []*Result{
+		{}, // -C lo
+		{}, // -C established
+		{Stdout: strings.Join([]string{
+			"-P INPUT DROP",
+			"-A INPUT -i lo -j ACCEPT",
+			"-A INPUT -m state --state RELATED,ESTABLISHED -j ACCEPT",
+			"-A INPUT -s 10.0.0.0/8 -p tcp -m tcp --dport 22 -j ACCEPT",
+			"-A INPUT -s 192.168.1.7/32 -p tcp -m tcp --dport 8090 -j ACCEPT",
+		}, "\n")},
+	}}
+	security := NewSecurityManager(NewManager(client))
+
+	diff := &FirewallDiff{}
+	err := security.syncIPTablesFamily("iptables", []FirewallRule{
+		{Port: 22, Protocol: "tcp", Source: "10.0.0.1/8", Action: "allow"},
+		{Port: 8090, Protocol: "tcp", Source: "192.168.1.7/32", Action: "allow"},
+	}, diff)
+	if err != nil {
+		t.Fatalf("syncIPTablesFamily failed: %v", err)
+	}
+
+	if diff.Changed() {
+		t.Errorf("Expected no changes, added %q and removed %q", diff.Added, diff.Removed)
+	}
+	want := []string{"allow 22/tcp from 10.0.0.0/8", "allow 8090/tcp from 192.168.1.7"}
+	if !slices.Equal(diff.Unchanged, want) {
+		t.Errorf("Unchanged = %q, want %q", diff.Unchanged, want)
+	}
+}
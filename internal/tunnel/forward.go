@@ -0,0 +1,201 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"pb-deployer/internal/logger"
+)
+
+// LocalForward is an SSH local port forward opened by OpenLocalForward
+type LocalForward struct {
+	listener   net.Listener
+	remoteAddr string
+	dial       func(network, addr string) (net.Conn, error)
+	logger     *logger.Logger
+
+	mu        sync.Mutex
+	conns     map[net.Conn]struct{}
+	closed    bool
+	stop      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// OpenLocalForward listens on localAddr and tunnels every connection to
+// remoteAddr as dialed from the server, e.g. "127.0.0.1:8090" for a
+// PocketBase admin UI that is only reachable on the server's localhost. Use
+// port 0 in localAddr to pick a free port and read it from Addr.
+//
+// remoteAddr is dialed once before listening so a refused forward fails
+// here rather than on the first connection. The forward stops when ctx is
+// cancelled, when Close is called or when the client is closed. Any number
+// of forwards may share one client.
+func (c *Client) OpenLocalForward(ctx context.Context, localAddr, remoteAddr string) (*LocalForward, error) {
+	if c.conn == nil {
+		return nil, &Error{
+			Type:    ErrorConnection,
+			Message: "not connected",
+		}
+	}
+
+	f, err := newLocalForward(ctx, localAddr, remoteAddr, c.conn.Dial, c.logger)
+	if err != nil {
+		return nil, err
+	}
+	c.addCleanup(func() { f.Close() })
+
+	c.logger.Success("Forwarding %s to %s on %s", f.Addr(), remoteAddr, c.config.Host)
+	return f, nil
+}
+
+func newLocalForward(ctx context.Context, localAddr, remoteAddr string, dial func(network, addr string) (net.Conn, error), log *logger.Logger) (*LocalForward, error) {
+	probe, err := dial("tcp", remoteAddr)
+	if err != nil {
+		return nil, &Error{
+			Type:    ErrorConnection,
+			Message: fmt.Sprintf("server refused forwarding to %s", remoteAddr),
+			Cause:   err,
+		}
+	}
+	probe.Close()
+
+	var lc net.ListenConfig
+	listener, err := lc.Listen(ctx, "tcp", localAddr)
+	if err != nil {
+		return nil, &Error{
+			Type:    ErrorConnection,
+			Message: fmt.Sprintf("failed to listen on %s", localAddr),
+			Cause:   err,
+		}
+	}
+
+	f := &LocalForward{
+		listener:   listener,
+		remoteAddr: remoteAddr,
+		dial:       dial,
+		logger:     log,
+		conns:      make(map[net.Conn]struct{}),
+		stop:       make(chan struct{}),
+	}
+
+	f.wg.Add(1)
+	go f.acceptLoop()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			f.Close()
+		case <-f.stop:
+		}
+	}()
+
+	return f, nil
+}
+
+// Addr returns the local address the forward listens on
+func (f *LocalForward) Addr() net.Addr {
+	return f.listener.Addr()
+}
+
+// Close stops listening, closes all forwarded connections and waits for
+// them to finish
+func (f *LocalForward) Close() error {
+	var err error
+	f.closeOnce.Do(func() {
+		close(f.stop)
+
+		f.mu.Lock()
+		f.closed = true
+		err = f.listener.Close()
+		for conn := range f.conns {
+			conn.Close()
+		}
+		f.mu.Unlock()
+
+		f.wg.Wait()
+	})
+	return err
+}
+
+func (f *LocalForward) acceptLoop() {
+	defer f.wg.Done()
+
+	for {
+		local, err := f.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				f.logger.Warning("Port forward to %s stopped accepting: %v", f.remoteAddr, err)
+			}
+			return
+		}
+
+		f.wg.Add(1)
+		go f.forward(local)
+	}
+}
+
+// forward copies data between a local connection and a new connection to
+// remoteAddr until either side closes
+func (f *LocalForward) forward(local net.Conn) {
+	defer f.wg.Done()
+
+	remote, err := f.dial("tcp", f.remoteAddr)
+	if err != nil {
+		f.logger.Warning("Server refused forwarding to %s: %v", f.remoteAddr, err)
+		local.Close()
+		return
+	}
+
+	if !f.track(local, remote) {
+		local.Close()
+		remote.Close()
+		return
+	}
+	defer f.untrack(local, remote)
+
+	done := make(chan struct{}, 2)
+	pipe := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		// Pass EOF on so the other direction can finish its response
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		} else {
+			dst.Close()
+		}
+		done <- struct{}{}
+	}
+	go pipe(remote, local)
+	go pipe(local, remote)
+	<-done
+	<-done
+
+	local.Close()
+	remote.Close()
+}
+
+func (f *LocalForward) track(conns ...net.Conn) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return false
+	}
+	for _, conn := range conns {
+		f.conns[conn] = struct{}{}
+	}
+	return true
+}
+
+func (f *LocalForward) untrack(conns ...net.Conn) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, conn := range conns {
+		delete(f.conns, conn)
+	}
+}
@@ -0,0 +1,116 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"pb-deployer/internal/logger"
+)
+
+// startEchoServer stands in for the service behind the SSH server
+func startEchoServer(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					conn.Write([]byte("echo: " + scanner.Text() + "\n"))
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestLocalForwardConcurrentConnections(t *testing.T) {
+	remote := startEchoServer(t)
+	f, err := newLocalForward(context.Background(), "127.0.0.1:0", remote, net.Dial, logger.GetTunnelLogger())
+	if err != nil {
+		t.Fatalf("newLocalForward failed: %v", err)
+	}
+	defer f.Close()
+
+	var wg sync.WaitGroup
+	for i := range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := net.Dial("tcp", f.Addr().String())
+			if err != nil {
+				t.Errorf("dial %d: %v", i, err)
+				return
+			}
+			defer conn.Close()
+
+			conn.Write([]byte("ping\n"))
+			reply, err := bufio.NewReader(conn).ReadString('\n')
+			if err != nil || reply != "echo: ping\n" {
+				t.Errorf("connection %d: got %q, %v", i, reply, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestLocalForwardRefusedRemote(t *testing.T) {
+	refused := func(network, addr string) (net.Conn, error) {
+		return nil, errors.New("ssh: rejected: connect failed (Connection refused)")
+	}
+
+	_, err := newLocalForward(context.Background(), "127.0.0.1:0", "127.0.0.1:8090", refused, logger.GetTunnelLogger())
+	var tunnelErr *Error
+	if !errors.As(err, &tunnelErr) || tunnelErr.Type != ErrorConnection {
+		t.Fatalf("Expected a connection error, got %v", err)
+	}
+}
+
+func TestLocalForwardStopsOnContextCancel(t *testing.T) {
+	remote := startEchoServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	f, err := newLocalForward(ctx, "127.0.0.1:0", remote, net.Dial, logger.GetTunnelLogger())
+	if err != nil {
+		t.Fatalf("newLocalForward failed: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", f.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("ping\n"))
+	bufio.NewReader(conn).ReadString('\n')
+
+	cancel()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		probe, err := net.Dial("tcp", f.Addr().String())
+		if err != nil {
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			if _, err := conn.Read(make([]byte, 1)); err == nil {
+				t.Error("Expected the forwarded connection to be closed")
+			}
+			return
+		}
+		probe.Close()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Expected the forward to stop listening after cancel")
+}
@@ -0,0 +1,68 @@
+package tunnel
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestProbeHealthUsesReadiness(t *testing.T) {
+	client := &scriptedClient{results: []*Result{{Stdout: "200"}}}
+	deployer := NewDeploymentManager(NewManager(client), nil)
+
+	healthy, detail := deployer.probeHealth("http://localhost:8080")
+	if !healthy || detail != ReadinessPath {
+		t.Errorf("probeHealth() = %v, %q; want true, %q", healthy, detail, ReadinessPath)
+	}
+	if len(client.commands) != 1 || !strings.Contains(client.commands[0], "'http://localhost:8080/api/readyz'") {
+		t.Errorf("Expected a single readiness probe, got %q", client.commands)
+	}
+}
+
+func TestProbeHealthNotReady(t *testing.T) {
+	client := &scriptedClient{results: []*Result{{Stdout: "503"}}}
+	deployer := NewDeploymentManager(NewManager(client), nil)
+
+	healthy, detail := deployer.probeHealth("http://localhost:8080")
+	if healthy {
+		t.Error("Expected a 503 from readyz to fail the probe")
+	}
+	if detail != "/api/readyz returned 503" {
+		t.Errorf("Unexpected detail %q", detail)
+	}
+	if len(client.commands) != 1 {
+		t.Errorf("Expected no fallback when readyz answers, got %q", client.commands)
+	}
+}
+
+func TestProbeHealthFallsBackWithoutReadiness(t *testing.T) {
+	client := &scriptedClient{results: []*Result{{Stdout: "404"}, {ExitCode: 0}}}
+	deployer := NewDeploymentManager(NewManager(client), nil)
+
+	healthy, detail := deployer.probeHealth("https://example.com")
+	if !healthy || detail != HealthPath {
+		t.Errorf("probeHealth() = %v, %q; want true, %q", healthy, detail, HealthPath)
+	}
+	if len(client.commands) != 2 || !strings.Contains(client.commands[1], "'https://example.com/api/health'") {
+		t.Errorf("Expected a fallback to the PocketBase health check, got %q", client.commands)
+	}
+}
+
+func TestProbeHealthNoResponse(t *testing.T) {
+	client := &scriptedClient{
+		results: []*Result{{Stdout: "000", ExitCode: 7}, nil},
+		errs:    []error{nil, errors.New("connection reset")},
+	}
+	deployer := NewDeploymentManager(NewManager(client), nil)
+
+	if healthy, _ := deployer.probeHealth("http://localhost:80"); healthy {
+		t.Error("Expected an unreachable app to fail the probe")
+	}
+	if healthy, detail := deployer.probeHealth("http://localhost:80"); healthy || detail != "connection reset" {
+		t.Errorf("probeHealth() = %v, %q; want false, \"connection reset\"", healthy, detail)
+	}
+	if !slices.ContainsFunc(client.commands, func(cmd string) bool { return strings.Contains(cmd, ReadinessPath) }) {
+		t.Errorf("Expected readiness probes, got %q", client.commands)
+	}
+}
@@ -1,6 +1,7 @@
 package tunnel
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"sync"
@@ -16,6 +17,9 @@ type Manager struct {
 	cleanup []func()
 	mu      sync.Mutex
 	closed  bool
+
+	packages     *PackageManager
+	capabilities capabilityCache
 }
 
 func NewManager(client SSHClient) *Manager {
@@ -25,8 +29,16 @@ func NewManager(client SSHClient) *Manager {
 	return &Manager{
 		client: client,
 		tracer: &NoOpTracer{},
-		logger: logger.GetTunnelLogger(),
+		logger: clientLogger(client),
+	}
+}
+
+// clientLogger reuses the client's logger so managers share its log fields
+func clientLogger(client SSHClient) *logger.Logger {
+	if c, ok := client.(interface{ Logger() *logger.Logger }); ok {
+		return c.Logger()
 	}
+	return logger.GetTunnelLogger()
 }
 
 func (m *Manager) SetTracer(tracer Tracer) {
@@ -47,7 +59,7 @@ func (m *Manager) CreateUser(username string, opts ...UserOption) error {
 		opt(cfg)
 	}
 
-	result, err := m.client.Execute(fmt.Sprintf("id %s", username), WithTimeout(5*time.Second))
+	result, err := m.client.Execute("id "+shellQuote(username), WithTimeout(5*time.Second))
 	if err == nil && result.ExitCode == 0 {
 
 		return nil
@@ -58,12 +70,12 @@ func (m *Manager) CreateUser(username string, opts ...UserOption) error {
 		cmd += " -r"
 	}
 	if cfg.home != "" {
-		cmd += fmt.Sprintf(" -d '%s' -m", cfg.home)
+		cmd += fmt.Sprintf(" -d %s -m", shellQuote(cfg.home))
 	}
 	if cfg.shell != "" {
-		cmd += fmt.Sprintf(" -s '%s'", cfg.shell)
+		cmd += fmt.Sprintf(" -s %s", shellQuote(cfg.shell))
 	}
-	cmd += fmt.Sprintf(" '%s'", username)
+	cmd += " " + shellQuote(username)
 
 	m.logger.SSHCommand(fmt.Sprintf("sudo %s", cmd))
 	result, err = m.client.ExecuteSudo(cmd)
@@ -79,7 +91,7 @@ func (m *Manager) CreateUser(username string, opts ...UserOption) error {
 
 	if len(cfg.groups) > 0 {
 		groupList := strings.Join(cfg.groups, ",")
-		cmd = fmt.Sprintf("usermod -aG '%s' '%s'", groupList, username)
+		cmd = fmt.Sprintf("usermod -aG %s %s", shellQuote(groupList), shellQuote(username))
 		m.logger.SystemOperation(fmt.Sprintf("Adding user %s to groups: %s", username, groupList))
 		result, err = m.client.ExecuteSudo(cmd)
 		if err != nil {
@@ -95,7 +107,7 @@ func (m *Manager) CreateUser(username string, opts ...UserOption) error {
 
 	if cfg.sudoAccess {
 		sudoLine := fmt.Sprintf("%s ALL=(ALL:ALL) NOPASSWD:ALL", username)
-		cmd = fmt.Sprintf("echo '%s' > /etc/sudoers.d/%s", sudoLine, username)
+		cmd = fmt.Sprintf("echo %s > %s", shellQuote(sudoLine), shellQuote("/etc/sudoers.d/"+username))
 		m.logger.SystemOperation(fmt.Sprintf("Granting sudo access to user: %s", username))
 		result, err = m.client.ExecuteSudo(cmd)
 		if err != nil {
@@ -123,7 +135,7 @@ func (m *Manager) SetupSSHKeys(username string, keys []string) error {
 
 	m.logger.SystemOperation(fmt.Sprintf("Setting up SSH keys for user: %s (%d keys)", username, len(keys)))
 
-	result, err := m.client.Execute(fmt.Sprintf("getent passwd %s | cut -d: -f6", username))
+	result, err := m.client.Execute(fmt.Sprintf("getent passwd %s | cut -d: -f6", shellQuote(username)))
 	if err != nil {
 		return err
 	}
@@ -135,16 +147,18 @@ func (m *Manager) SetupSSHKeys(username string, keys []string) error {
 	sshDir := fmt.Sprintf("%s/.ssh", homeDir)
 	authKeysFile := fmt.Sprintf("%s/authorized_keys", sshDir)
 
-	cmd := fmt.Sprintf("mkdir -p '%s' && chmod 700 '%s' && chown '%s:%s' '%s'",
-		sshDir, sshDir, username, username, sshDir)
+	dir, owner := shellQuote(sshDir), shellQuote(username+":"+username)
+	cmd := fmt.Sprintf("mkdir -p %s && chmod 700 %s && chown %s %s",
+		dir, dir, owner, dir)
 	result, err = m.client.ExecuteSudo(cmd)
 	if err != nil {
 		return err
 	}
 
 	keysContent := strings.Join(keys, "\n")
-	cmd = fmt.Sprintf("echo '%s' > '%s' && chmod 600 '%s' && chown '%s:%s' '%s'",
-		keysContent, authKeysFile, authKeysFile, username, username, authKeysFile)
+	file := shellQuote(authKeysFile)
+	cmd = fmt.Sprintf("echo %s > %s && chmod 600 %s && chown %s %s",
+		shellQuote(keysContent), file, file, owner, file)
 	result, err = m.client.ExecuteSudo(cmd)
 	if err != nil {
 		return err
@@ -162,7 +176,7 @@ func (m *Manager) SetupSSHKeys(username string, keys []string) error {
 func (m *Manager) CreateDirectory(path, permissions, owner, group string) error {
 	m.logger.SystemOperation(fmt.Sprintf("Creating directory: %s", path))
 
-	cmd := fmt.Sprintf("mkdir -p '%s'", path)
+	cmd := "mkdir -p " + shellQuote(path)
 	result, err := m.client.ExecuteSudo(cmd)
 	if err != nil {
 		return err
@@ -175,12 +189,12 @@ func (m *Manager) CreateDirectory(path, permissions, owner, group string) error
 	}
 
 	if permissions != "" {
-		cmd = fmt.Sprintf("chmod %s '%s'", permissions, path)
+		cmd = fmt.Sprintf("chmod %s %s", shellQuote(permissions), shellQuote(path))
 		m.client.ExecuteSudo(cmd)
 	}
 
 	if owner != "" && group != "" {
-		cmd = fmt.Sprintf("chown %s:%s '%s'", owner, group, path)
+		cmd = fmt.Sprintf("chown %s %s", shellQuote(owner+":"+group), shellQuote(path))
 		m.client.ExecuteSudo(cmd)
 	}
 
@@ -190,7 +204,8 @@ func (m *Manager) CreateDirectory(path, permissions, owner, group string) error
 func (m *Manager) ServiceStart(name string) error {
 	m.logger.SystemOperation(fmt.Sprintf("Starting service: %s", name))
 	cmd := fmt.Sprintf("systemctl start %s", name)
-	result, err := m.client.ExecuteSudo(cmd)
+	defer m.invalidateService(name)
+	result, err := m.RunCommandWithRetry(context.Background(), cmd, RetryPolicy{}, WithSudo())
 	if err != nil {
 		return err
 	}
@@ -206,6 +221,7 @@ func (m *Manager) ServiceStart(name string) error {
 func (m *Manager) ServiceStop(name string) error {
 	m.logger.SystemOperation(fmt.Sprintf("Stopping service: %s", name))
 	cmd := fmt.Sprintf("systemctl stop %s", name)
+	defer m.invalidateService(name)
 	result, err := m.client.ExecuteSudo(cmd)
 	if err != nil {
 		return err
@@ -222,7 +238,8 @@ func (m *Manager) ServiceStop(name string) error {
 func (m *Manager) ServiceRestart(name string) error {
 	m.logger.SystemOperation(fmt.Sprintf("Restarting service: %s", name))
 	cmd := fmt.Sprintf("systemctl restart %s", name)
-	result, err := m.client.ExecuteSudo(cmd)
+	defer m.invalidateService(name)
+	result, err := m.RunCommandWithRetry(context.Background(), cmd, RetryPolicy{}, WithSudo())
 	if err != nil {
 		return err
 	}
@@ -238,7 +255,7 @@ func (m *Manager) ServiceRestart(name string) error {
 func (m *Manager) ServiceEnable(name string) error {
 	m.logger.SystemOperation(fmt.Sprintf("Enabling service: %s", name))
 	cmd := fmt.Sprintf("systemctl enable %s", name)
-	result, err := m.client.ExecuteSudo(cmd)
+	result, err := m.RunCommandWithRetry(context.Background(), cmd, RetryPolicy{}, WithSudo())
 	if err != nil {
 		return err
 	}
@@ -251,50 +268,17 @@ func (m *Manager) ServiceEnable(name string) error {
 	return nil
 }
 
+// InstallPackages installs packages with the detected package manager
 func (m *Manager) InstallPackages(packages ...string) error {
 	if len(packages) == 0 {
 		return nil
 	}
 
-	m.logger.SystemOperation(fmt.Sprintf("Installing packages: %s", strings.Join(packages, ", ")))
-
-	result, err := m.client.Execute("which apt", WithTimeout(5*time.Second))
-	if err == nil && result.ExitCode == 0 {
-		// Debian/Ubuntu
-		cmd := fmt.Sprintf("apt update && apt install -y %s", strings.Join(packages, " "))
-		result, err = m.client.ExecuteSudo(cmd, WithTimeout(5*time.Minute))
-	} else {
-		result, err = m.client.Execute("which yum", WithTimeout(5*time.Second))
-		if err == nil && result.ExitCode == 0 {
-			// RHEL/CentOS
-			cmd := fmt.Sprintf("yum install -y %s", strings.Join(packages, " "))
-			result, err = m.client.ExecuteSudo(cmd, WithTimeout(5*time.Minute))
-		} else {
-			result, err = m.client.Execute("which dnf", WithTimeout(5*time.Second))
-			if err == nil && result.ExitCode == 0 {
-				// Fedora
-				cmd := fmt.Sprintf("dnf install -y %s", strings.Join(packages, " "))
-				result, err = m.client.ExecuteSudo(cmd, WithTimeout(5*time.Minute))
-			} else {
-				return &Error{
-					Type:    ErrorNotFound,
-					Message: "no supported package manager found",
-				}
-			}
-		}
-	}
-
+	pm, err := m.PackageManager()
 	if err != nil {
 		return err
 	}
-	if result.ExitCode != 0 {
-		return &Error{
-			Type:    ErrorExecution,
-			Message: fmt.Sprintf("failed to install packages: %s", result.Stderr),
-		}
-	}
-
-	return nil
+	return pm.Install(context.Background(), packages...)
 }
 
 func (m *Manager) SystemInfo() (*SystemInfo, error) {
@@ -0,0 +1,138 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// packageManagerSpec describes the commands of one system package manager
+type packageManagerSpec struct {
+	name      string
+	binary    string
+	update    string
+	install   string
+	installed string // command format that exits 0 if %s is installed
+	// updateFirst refreshes the index before the first install, since
+	// apt cannot install anything on a fresh image without it
+	updateFirst bool
+}
+
+// packageManagerSpecs are probed in order; dnf comes before yum because
+// newer RHEL releases ship both
+var packageManagerSpecs = []packageManagerSpec{
+	{
+		name:        "apt",
+		binary:      "apt-get",
+		update:      "apt-get update",
+		install:     "DEBIAN_FRONTEND=noninteractive apt-get install -y",
+		installed:   "dpkg-query -W -f='${Status}' %s 2>/dev/null | grep -q 'install ok installed'",
+		updateFirst: true,
+	},
+	{name: "dnf", binary: "dnf", update: "dnf makecache", install: "dnf install -y", installed: "rpm -q %s"},
+	{name: "yum", binary: "yum", update: "yum makecache", install: "yum install -y", installed: "rpm -q %s"},
+	{name: "pacman", binary: "pacman", update: "pacman -Sy", install: "pacman -S --noconfirm --needed", installed: "pacman -Q %s"},
+	{name: "zypper", binary: "zypper", update: "zypper --non-interactive refresh", install: "zypper --non-interactive install", installed: "rpm -q %s"},
+}
+
+// PackageManager installs system packages with the server's package manager
+type PackageManager struct {
+	manager *Manager
+	spec    packageManagerSpec
+	updated bool
+}
+
+// PackageManager detects the server's package manager on first use and
+// returns the same instance afterwards
+func (m *Manager) PackageManager() (*PackageManager, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.packages != nil {
+		return m.packages, nil
+	}
+
+	for _, spec := range packageManagerSpecs {
+		result, err := m.client.Execute("command -v "+spec.binary, WithTimeout(5*time.Second))
+		if err == nil && result.ExitCode == 0 {
+			m.logger.Debug("Detected package manager: %s", spec.name)
+			m.packages = &PackageManager{manager: m, spec: spec}
+			return m.packages, nil
+		}
+	}
+
+	return nil, &Error{
+		Type:    ErrorNotFound,
+		Message: "no supported package manager found",
+	}
+}
+
+// Name returns the detected package manager, such as "apt" or "dnf"
+func (p *PackageManager) Name() string {
+	return p.spec.name
+}
+
+// Update refreshes the package index
+func (p *PackageManager) Update(ctx context.Context) error {
+	p.manager.logger.SystemOperation("Updating package index")
+	result, err := p.manager.RunCommandWithRetry(ctx, p.spec.update, RetryPolicy{}, WithSudo(), WithTimeout(5*time.Minute))
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return &Error{
+			Type:    ErrorExecution,
+			Message: fmt.Sprintf("failed to update package index: %s", resultStderr(result)),
+		}
+	}
+	p.updated = true
+	return nil
+}
+
+// Install installs packages, refreshing the index first where the package
+// manager requires it
+func (p *PackageManager) Install(ctx context.Context, packages ...string) error {
+	if len(packages) == 0 {
+		return nil
+	}
+
+	if p.spec.updateFirst && !p.updated {
+		if err := p.Update(ctx); err != nil {
+			return err
+		}
+	}
+
+	p.manager.logger.SystemOperation(fmt.Sprintf("Installing packages: %s", strings.Join(packages, ", ")))
+	cmd := p.spec.install + " " + quoteAll(packages)
+	// Even a failed install may have added some of the commands
+	defer p.manager.InvalidateCapabilities()
+	result, err := p.manager.RunCommandWithRetry(ctx, cmd, RetryPolicy{}, WithSudo(), WithTimeout(5*time.Minute))
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return &Error{
+			Type:    ErrorExecution,
+			Message: fmt.Sprintf("failed to install packages: %s", resultStderr(result)),
+		}
+	}
+	return nil
+}
+
+// IsInstalled reports whether pkg is installed
+func (p *PackageManager) IsInstalled(ctx context.Context, pkg string) (bool, error) {
+	result, err := p.manager.client.Execute(fmt.Sprintf(p.spec.installed, shellQuote(pkg)), WithTimeout(10*time.Second))
+	if err != nil {
+		return false, err
+	}
+	return result.ExitCode == 0, nil
+}
+
+func quoteAll(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,73 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPackageManagerDetectsAndUpdatesAptOnce(t *testing.T) {
+	client := &scriptedClient{}
+	manager := NewManager(client)
+
+	if err := manager.InstallPackages("fail2ban"); err != nil {
+		t.Fatalf("InstallPackages failed: %v", err)
+	}
+	if err := manager.InstallPackages("ufw", "it's"); err != nil {
+		t.Fatalf("InstallPackages failed: %v", err)
+	}
+
+	want := []string{
+		"command -v apt-get",
+		"sudo apt-get update",
+		"sudo DEBIAN_FRONTEND=noninteractive apt-get install -y 'fail2ban'",
+		`sudo DEBIAN_FRONTEND=noninteractive apt-get install -y 'ufw' 'it'\''s'`,
+	}
+	if len(client.commands) != len(want) {
+		t.Fatalf("Expected commands %q, got %q", want, client.commands)
+	}
+	for i := range want {
+		if client.commands[i] != want[i] {
+			t.Errorf("Command %d: expected %q, got %q", i, want[i], client.commands[i])
+		}
+	}
+}
+
+func TestPackageManagerFallsBackToDnf(t *testing.T) {
+	client := &scriptedClient{results: []*Result{{ExitCode: 1}, {ExitCode: 0}, {ExitCode: 1}}}
+	manager := NewManager(client)
+
+	pm, err := manager.PackageManager()
+	if err != nil {
+		t.Fatalf("PackageManager failed: %v", err)
+	}
+	if pm.Name() != "dnf" {
+		t.Errorf("Expected dnf, got %s", pm.Name())
+	}
+
+	installed, err := pm.IsInstalled(context.Background(), "ufw")
+	if err != nil || installed {
+		t.Errorf("Expected ufw not to be installed, got %v, %v", installed, err)
+	}
+	if last := client.commands[len(client.commands)-1]; last != "rpm -q 'ufw'" {
+		t.Errorf("Unexpected query command %q", last)
+	}
+
+	if again, _ := manager.PackageManager(); again != pm {
+		t.Error("Expected the detected package manager to be cached")
+	}
+}
+
+func TestPackageManagerNoneFound(t *testing.T) {
+	results := make([]*Result, len(packageManagerSpecs))
+	for i := range results {
+		results[i] = &Result{ExitCode: 1}
+	}
+	manager := NewManager(&scriptedClient{results: results})
+
+	err := manager.InstallPackages("ufw")
+	var tunnelErr *Error
+	if !errors.As(err, &tunnelErr) || tunnelErr.Type != ErrorNotFound {
+		t.Errorf("Expected ErrorNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package tunnel
+
+import "sync"
+
+// Progress statuses
+const (
+	ProgressRunning = "running"
+	ProgressSuccess = "success"
+	ProgressFailed  = "failed"
+	ProgressSkipped = "skipped"
+)
+
+// progressBuffer is how many updates may wait for a slow consumer before
+// newer ones are dropped
+const progressBuffer = 32
+
+// ProgressUpdate reports the state of one step of a long-running operation
+type ProgressUpdate struct {
+	Step    string `json:"step"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Percent int    `json:"percent"`
+}
+
+// SecurityOption configures a SecurityManager
+type SecurityOption func(*SecurityManager)
+
+// WithProgressCallback delivers progress updates to callback on a separate
+// goroutine, so a slow callback never stalls the operation. Updates that
+// arrive while progressBuffer updates are pending are dropped.
+func WithProgressCallback(callback func(ProgressUpdate)) SecurityOption {
+	return func(s *SecurityManager) {
+		if callback != nil {
+			s.progress = newProgressRelay(callback)
+		}
+	}
+}
+
+// progressRelay hands updates to a callback without blocking the sender
+type progressRelay struct {
+	updates chan ProgressUpdate
+	mu      sync.Mutex
+	closed  bool
+	dropped int
+}
+
+func newProgressRelay(callback func(ProgressUpdate)) *progressRelay {
+	r := &progressRelay{updates: make(chan ProgressUpdate, progressBuffer)}
+	go func() {
+		for update := range r.updates {
+			callback(update)
+		}
+	}()
+	return r
+}
+
+// send queues update and reports false if it was dropped
+func (r *progressRelay) send(update ProgressUpdate) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return false
+	}
+	select {
+	case r.updates <- update:
+		return true
+	default:
+		r.dropped++
+		return false
+	}
+}
+
+// close stops accepting updates; queued ones are still delivered
+func (r *progressRelay) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.closed {
+		r.closed = true
+		close(r.updates)
+	}
+}
@@ -0,0 +1,93 @@
+package tunnel
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProgressRelayDeliversInOrder(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	done := make(chan struct{})
+
+	relay := newProgressRelay(func(update ProgressUpdate) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, update.Step)
+		if update.Step == "complete" {
+			close(done)
+		}
+	})
+
+	for _, step := range []string{"firewall", "ssh", "complete"} {
+		if !relay.send(ProgressUpdate{Step: step}) {
+			t.Fatalf("Expected %s to be queued", step)
+		}
+	}
+	relay.close()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for updates")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 3 || got[0] != "firewall" || got[2] != "complete" {
+		t.Errorf("Unexpected updates %q", got)
+	}
+}
+
+func TestProgressRelayDropsWhenConsumerIsSlow(t *testing.T) {
+	release := make(chan struct{})
+	relay := newProgressRelay(func(ProgressUpdate) { <-release })
+	defer close(release)
+
+	start := time.Now()
+	sent := 0
+	for i := 0; i < progressBuffer*2; i++ {
+		if relay.send(ProgressUpdate{Step: "step"}) {
+			sent++
+		}
+	}
+	if time.Since(start) > time.Second {
+		t.Error("Expected sends not to block on a slow consumer")
+	}
+	if sent > progressBuffer+1 {
+		t.Errorf("Expected at most %d queued updates, got %d", progressBuffer+1, sent)
+	}
+	if relay.dropped == 0 {
+		t.Error("Expected updates to be dropped")
+	}
+
+	relay.close()
+	if relay.send(ProgressUpdate{Step: "late"}) {
+		t.Error("Expected sends after close to be rejected")
+	}
+}
+
+func TestSecureServerReportsValidationFailure(t *testing.T) {
+	updates := make(chan ProgressUpdate, 8)
+	security := NewSecurityManager(NewManager(&scriptedClient{}), WithProgressCallback(func(update ProgressUpdate) {
+		updates <- update
+	}))
+	defer security.Close()
+
+	err := security.SecureServer(SecurityConfig{HardenSSH: true})
+	if err == nil {
+		t.Fatal("Expected validation to fail")
+	}
+
+	for _, want := range []string{ProgressRunning, ProgressFailed} {
+		select {
+		case update := <-updates:
+			if update.Step != "validate" || update.Status != want {
+				t.Errorf("Expected validate %s, got %+v", want, update)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for validate %s", want)
+		}
+	}
+}
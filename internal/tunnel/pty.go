@@ -0,0 +1,235 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sudoPrompt is the start of sudo's default password prompt
+const sudoPrompt = "[sudo] password"
+
+// redacted replaces responses that would otherwise appear in output
+const redacted = "********"
+
+// PromptResponder returns the answer to an interactive prompt, the text
+// since the last newline, and false if it does not handle the prompt
+type PromptResponder func(prompt string) (string, bool)
+
+// SudoPasswordResponder answers sudo's password prompt with password
+func SudoPasswordResponder(password string) PromptResponder {
+	return func(prompt string) (string, bool) {
+		if strings.Contains(prompt, sudoPrompt) {
+			return password, true
+		}
+		return "", false
+	}
+}
+
+// ExecuteWithPTY runs cmd on a pseudo-terminal and answers prompts through
+// responder. Each prompt is answered once; a repeated prompt (such as a
+// rejected sudo password) closes stdin so the command fails instead of
+// waiting forever. Answers are never logged and are removed from the
+// output. A PTY merges stderr into stdout, so Result.Stderr is empty.
+func (c *Client) ExecuteWithPTY(ctx context.Context, cmd string, responder PromptResponder) (*Result, error) {
+	if c.conn == nil {
+		return nil, &Error{
+			Type:    ErrorConnection,
+			Message: "not connected",
+		}
+	}
+
+	c.tracer.OnExecute(cmd)
+	c.logger.SSHCommand(cmd)
+
+	session, err := c.conn.NewSession()
+	if err != nil {
+		c.tracer.OnError("create_session", err)
+		return nil, &Error{
+			Type:    ErrorExecution,
+			Message: "failed to create session",
+			Cause:   err,
+		}
+	}
+	defer session.Close()
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          0,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	if err := session.RequestPty("xterm", 40, 120, modes); err != nil {
+		return nil, &Error{
+			Type:    ErrorExecution,
+			Message: "failed to request pseudo-terminal",
+			Cause:   err,
+		}
+	}
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return nil, &Error{
+			Type:    ErrorExecution,
+			Message: "failed to create stdin pipe",
+			Cause:   err,
+		}
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return nil, &Error{
+			Type:    ErrorExecution,
+			Message: "failed to create stdout pipe",
+			Cause:   err,
+		}
+	}
+
+	if err := session.Start(cmd); err != nil {
+		c.tracer.OnError("start_command", err)
+		return nil, &Error{
+			Type:    ErrorExecution,
+			Message: "failed to start command",
+			Cause:   err,
+		}
+	}
+
+	watcher := newPromptWatcher(responder)
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		buf := make([]byte, 4096)
+		for {
+			n, err := stdout.Read(buf)
+			if n > 0 {
+				answer, action := watcher.feed(string(buf[:n]))
+				switch action {
+				case promptAnswer:
+					io.WriteString(stdin, answer+"\n")
+				case promptGiveUp:
+					stdin.Close()
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	done := make(chan error, 1)
+	start := time.Now()
+	go func() {
+		err := session.Wait()
+		<-readDone
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		duration := time.Since(start)
+		result := &Result{
+			Stdout:   watcher.output(),
+			Duration: duration,
+		}
+		if err != nil {
+			var exitErr *ssh.ExitError
+			if !errors.As(err, &exitErr) {
+				c.logger.SSHCommandResult(cmd, -1, duration)
+				c.tracer.OnExecuteResult(cmd, nil, err)
+				return nil, &Error{
+					Type:    ErrorExecution,
+					Message: "command failed",
+					Cause:   err,
+				}
+			}
+			result.ExitCode = exitErr.ExitStatus()
+		}
+		c.logger.SSHCommandResult(cmd, result.ExitCode, duration)
+		c.tracer.OnExecuteResult(cmd, result, nil)
+		return result, nil
+
+	case <-ctx.Done():
+		session.Signal(ssh.SIGKILL)
+		c.tracer.OnExecuteResult(cmd, nil, ctx.Err())
+		return nil, &Error{
+			Type:    ErrorTimeout,
+			Message: fmt.Sprintf("command cancelled: %s", cmd),
+			Cause:   ctx.Err(),
+		}
+	}
+}
+
+type promptAction int
+
+const (
+	promptNone promptAction = iota
+	promptAnswer
+	promptGiveUp
+)
+
+// promptWatcher scans PTY output for prompts and collects the output with
+// prompts and answers removed
+type promptWatcher struct {
+	responder PromptResponder
+	answered  map[string]bool
+	answers   []string
+	out       strings.Builder
+	pending   string
+	mu        sync.Mutex
+}
+
+func newPromptWatcher(responder PromptResponder) *promptWatcher {
+	return &promptWatcher{
+		responder: responder,
+		answered:  make(map[string]bool),
+	}
+}
+
+// feed consumes a chunk of output and reports whether to answer a prompt
+func (w *promptWatcher) feed(chunk string) (string, promptAction) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	text := w.pending + strings.ReplaceAll(chunk, "\r\n", "\n")
+	if i := strings.LastIndex(text, "\n"); i >= 0 {
+		w.out.WriteString(text[:i+1])
+		text = text[i+1:]
+	}
+	w.pending = text
+
+	if w.responder == nil || w.pending == "" {
+		return "", promptNone
+	}
+
+	answer, ok := w.responder(w.pending)
+	if !ok {
+		return "", promptNone
+	}
+
+	prompt := w.pending
+	w.pending = ""
+	if w.answered[prompt] {
+		return "", promptGiveUp
+	}
+	w.answered[prompt] = true
+	if answer != "" {
+		w.answers = append(w.answers, answer)
+	}
+	return answer, promptAnswer
+}
+
+// output returns everything read so far with any answers redacted
+func (w *promptWatcher) output() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	out := w.out.String() + w.pending
+	for _, answer := range w.answers {
+		out = strings.ReplaceAll(out, answer, redacted)
+	}
+	return out
+}
@@ -0,0 +1,61 @@
+package tunnel
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPromptWatcherAnswersSudoPrompt(t *testing.T) {
+	w := newPromptWatcher(SudoPasswordResponder("s3cret"))
+
+	if _, action := w.feed("starting\r\n"); action != promptNone {
+		t.Fatalf("expected no action for plain output, got %v", action)
+	}
+
+	answer, action := w.feed("[sudo] password for app: ")
+	if action != promptAnswer || answer != "s3cret" {
+		t.Fatalf("expected password answer, got %q (%v)", answer, action)
+	}
+
+	w.feed("\r\nroot\r\n")
+	out := w.output()
+	if strings.Contains(out, "[sudo] password") {
+		t.Errorf("output should not contain the prompt: %q", out)
+	}
+	if out != "starting\n\nroot\n" {
+		t.Errorf("unexpected output: %q", out)
+	}
+}
+
+func TestPromptWatcherGivesUpOnRepeatedPrompt(t *testing.T) {
+	w := newPromptWatcher(SudoPasswordResponder("wrong"))
+
+	if _, action := w.feed("[sudo] password for app: "); action != promptAnswer {
+		t.Fatalf("expected first prompt to be answered, got %v", action)
+	}
+	if _, action := w.feed("\r\nSorry, try again.\r\n[sudo] password for app: "); action != promptGiveUp {
+		t.Fatalf("expected repeated prompt to give up, got %v", action)
+	}
+}
+
+func TestPromptWatcherRedactsEchoedAnswers(t *testing.T) {
+	w := newPromptWatcher(SudoPasswordResponder("s3cret"))
+
+	w.feed("[sudo] password for app: ")
+	w.feed("s3cret\r\nok\r\n")
+
+	if out := w.output(); strings.Contains(out, "s3cret") {
+		t.Errorf("password leaked into output: %q", out)
+	}
+}
+
+func TestPromptWatcherWithoutResponder(t *testing.T) {
+	w := newPromptWatcher(nil)
+
+	if _, action := w.feed("[sudo] password for app: "); action != promptNone {
+		t.Errorf("expected no action without a responder, got %v", action)
+	}
+	if out := w.output(); out != "[sudo] password for app: " {
+		t.Errorf("unexpected output: %q", out)
+	}
+}
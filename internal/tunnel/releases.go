@@ -0,0 +1,302 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DeployWithRollback deploys into a versioned release directory and switches
+// a "current" symlink to it, so the previous release stays on disk untouched.
+// The service is restarted in place and the app's health endpoint is polled;
+// if it does not come up healthy the symlink is pointed back at the previous
+// release and the service restarted again.
+//
+// Layout under the app directory:
+//
+//	releases/<timestamp>/   extracted deployment package
+//	current -> releases/<timestamp>
+//	pb_data/                shared data, passed to the binary with --dir
+//
+// The service is stopped while pb_data is snapshotted before the switch, so
+// the live SQLite database and its WAL are not copied mid-write; see
+// backupData. If the new release fails after it was started, the snapshot is
+// restored for the previous release, as the new binary may already have
+// migrated pb_data. Data written by the failed release is lost then.
+func (d *DeploymentManager) DeployWithRollback(ctx context.Context, req *DeploymentRequest) error {
+	d.logger.SystemOperation(fmt.Sprintf("Starting release deployment: %s (version: %s)", req.AppName, req.VersionID))
+
+	timestamp := time.Now().Unix()
+	workingDir := fmt.Sprintf("/opt/pocketbase/apps/%s", req.AppName)
+	releasePath := fmt.Sprintf("%s/releases/%d", workingDir, timestamp)
+
+	deployCtx := &DeploymentContext{
+		Request:        req,
+		StagingPath:    fmt.Sprintf("/opt/pocketbase/staging/%s-%d", req.AppName, timestamp),
+		ServicePath:    fmt.Sprintf("/etc/systemd/system/%s.service", req.ServiceName),
+		BinaryPath:     fmt.Sprintf("%s/current/%s", workingDir, req.AppName),
+		WorkingDir:     workingDir,
+		SystemdService: req.ServiceName,
+		ReleasePath:    releasePath,
+		DataDir:        workingDir + "/pb_data",
+	}
+
+	d.cleanupOldStagingDirs()
+	defer d.manager.client.ExecuteSudo("rm -rf " + shellQuote(deployCtx.StagingPath))
+
+	d.updateDeploymentStatus(req.DeploymentID, "running", "")
+
+	steps := []struct {
+		step    int
+		total   int
+		message string
+		fn      func(context.Context, *DeploymentContext) error
+	}{
+		{1, 9, "Downloading and staging deployment package", d.downloadAndStageVersion},
+		{2, 9, "Checking service status", d.checkServiceStatus},
+		{3, 9, "Preparing deployment directory", d.prepareDeploymentDir},
+		{4, 9, "Installing release", d.installRelease},
+		{5, 9, "Creating/updating systemd service", d.createSystemdService},
+		{6, 9, "Stopping service and backing up pb_data", d.stopAndBackupData},
+		{7, 9, "Switching current release", d.switchCurrentRelease},
+		{8, 9, "Restarting service", d.restartService},
+		{9, 9, "Verifying deployment health", d.verifyDeployment},
+	}
+
+	for _, step := range steps {
+		if req.ProgressCallback != nil {
+			req.ProgressCallback(step.step, step.total, step.message)
+		}
+
+		d.logProgress(req, step.message)
+
+		if err := ctx.Err(); err != nil {
+			return d.failRelease(deployCtx, step.step, step.message, err)
+		}
+
+		if err := step.fn(ctx, deployCtx); err != nil {
+			return d.failRelease(deployCtx, step.step, step.message, err)
+		}
+	}
+
+	d.pruneReleases(deployCtx)
+	d.updateAppStatus(req.AppID, "online", req.VersionID)
+
+	d.logger.Success("Release deployment completed successfully: %s", req.AppName)
+	d.updateDeploymentStatus(req.DeploymentID, "success", "")
+	return nil
+}
+
+// failRelease restores the previous release once the current symlink may
+// have moved, and records the failure
+func (d *DeploymentManager) failRelease(deployCtx *DeploymentContext, step int, message string, err error) error {
+	errMsg := fmt.Sprintf("deployment failed at step %d (%s): %v", step, message, err)
+
+	// Steps before the symlink switch leave the running release untouched.
+	// Once the new release has been started, it may have changed pb_data.
+	if step >= 7 {
+		d.logger.Warning("Release deployment failed, restoring previous release")
+		if rollbackErr := d.rollbackRelease(deployCtx, step >= 8); rollbackErr != nil {
+			errMsg = fmt.Sprintf("%s; rollback failed: %v", errMsg, rollbackErr)
+		}
+	}
+
+	d.manager.client.ExecuteSudo("rm -rf " + shellQuote(deployCtx.ReleasePath))
+	d.updateDeploymentStatus(deployCtx.Request.DeploymentID, "failed", errMsg)
+	return fmt.Errorf("%s", errMsg)
+}
+
+// stopAndBackupData stops the service for the pb_data snapshot. The service
+// stays down until restartService starts the new release, unless the backup
+// fails, in which case the running release is started again.
+func (d *DeploymentManager) stopAndBackupData(ctx context.Context, deployCtx *DeploymentContext) error {
+	if err := d.stopService(ctx, deployCtx); err != nil {
+		return err
+	}
+
+	if err := d.backupData(ctx, deployCtx); err != nil {
+		if deployCtx.ServiceWasRunning {
+			d.manager.client.ExecuteSudo("systemctl start " + shellQuote(deployCtx.SystemdService))
+		}
+		return err
+	}
+	return nil
+}
+
+func (d *DeploymentManager) installRelease(ctx context.Context, deployCtx *DeploymentContext) error {
+	req := deployCtx.Request
+
+	current := deployCtx.WorkingDir + "/current"
+	result, err := d.manager.client.Execute("readlink -f " + shellQuote(current))
+	if err == nil && result.ExitCode == 0 {
+		if previous := strings.TrimSpace(result.Stdout); previous != "" && previous != current {
+			deployCtx.PreviousRelease = previous
+			d.logProgress(req, fmt.Sprintf("Previous release: %s", previous))
+		}
+	}
+
+	d.logProgress(req, fmt.Sprintf("Installing release to %s", deployCtx.ReleasePath))
+	result, err = d.manager.client.ExecuteSudo(bashScript(fmt.Sprintf("mkdir -p %[1]s && cd %[2]s && cp -r . %[1]s/ && rm -f %[3]s",
+		shellQuote(deployCtx.ReleasePath), shellQuote(deployCtx.StagingPath), shellQuote(deployCtx.ReleasePath+"/deployment.zip"))))
+	if err != nil || result.ExitCode != 0 {
+		return fmt.Errorf("failed to install release: %s", resultStderr(result))
+	}
+
+	result, err = d.manager.client.ExecuteSudo(bashScript(fmt.Sprintf("mkdir -p %[1]s && chown -R %[2]s %[3]s %[1]s",
+		shellQuote(deployCtx.DataDir), shellQuote(req.AppUsername+":"+req.AppUsername), shellQuote(deployCtx.ReleasePath))))
+	if err != nil || result.ExitCode != 0 {
+		return fmt.Errorf("failed to set release permissions: %s", resultStderr(result))
+	}
+
+	binaryPath := path.Join(deployCtx.ReleasePath, req.AppName)
+	result, err = d.manager.client.ExecuteSudo("chmod +x " + shellQuote(binaryPath))
+	if err != nil || result.ExitCode != 0 {
+		return fmt.Errorf("failed to make binary executable: %s", resultStderr(result))
+	}
+
+	// setcap does not follow symlinks, so it is applied to the release binary
+	d.grantPortCapability(deployCtx, binaryPath)
+
+	return nil
+}
+
+func (d *DeploymentManager) switchCurrentRelease(ctx context.Context, deployCtx *DeploymentContext) error {
+	d.logProgress(deployCtx.Request, fmt.Sprintf("Pointing current at %s", deployCtx.ReleasePath))
+	return d.pointCurrentAt(deployCtx, deployCtx.ReleasePath)
+}
+
+// pointCurrentAt atomically replaces the current symlink via rename
+func (d *DeploymentManager) pointCurrentAt(deployCtx *DeploymentContext, releasePath string) error {
+	current := deployCtx.WorkingDir + "/current"
+	result, err := d.manager.client.ExecuteSudo(bashScript(fmt.Sprintf("ln -sfn %[1]s %[2]s && mv -Tf %[2]s %[3]s",
+		shellQuote(releasePath), shellQuote(current+".tmp"), shellQuote(current))))
+	if err != nil || result.ExitCode != 0 {
+		return fmt.Errorf("failed to switch current release: %s", resultStderr(result))
+	}
+	return nil
+}
+
+func (d *DeploymentManager) restartService(ctx context.Context, deployCtx *DeploymentContext) error {
+	d.logProgress(deployCtx.Request, fmt.Sprintf("Restarting service: %s", deployCtx.SystemdService))
+
+	result, err := d.manager.client.ExecuteSudo("systemctl restart " + shellQuote(deployCtx.SystemdService))
+	if err != nil || result.ExitCode != 0 {
+		return fmt.Errorf("failed to restart service: %s", resultStderr(result))
+	}
+	return nil
+}
+
+// rollbackRelease points current back at the previous release and restarts
+// the service. With restoreData set, pb_data is first replaced with the
+// snapshot taken by stopAndBackupData. Without a previous release the
+// service is stopped instead and the snapshot is left for RestoreBackup.
+func (d *DeploymentManager) rollbackRelease(deployCtx *DeploymentContext, restoreData bool) error {
+	req := deployCtx.Request
+	d.logger.SystemOperation(fmt.Sprintf("Rolling back release: %s", req.AppName))
+
+	if deployCtx.PreviousRelease == "" {
+		d.manager.client.ExecuteSudo("systemctl stop " + shellQuote(deployCtx.SystemdService))
+		d.updateAppStatus(req.AppID, "offline", "")
+		if deployCtx.DataBackupPath != "" {
+			return fmt.Errorf("no previous release to roll back to (pb_data snapshot kept at %s)", deployCtx.DataBackupPath)
+		}
+		return fmt.Errorf("no previous release to roll back to")
+	}
+
+	if err := d.pointCurrentAt(deployCtx, deployCtx.PreviousRelease); err != nil {
+		return err
+	}
+
+	if restoreData && deployCtx.DataBackupPath != "" {
+		// RestoreBackup stops the service, swaps pb_data and starts it again
+		d.logProgress(req, fmt.Sprintf("Restoring pb_data from %s", deployCtx.DataBackupPath))
+		if err := d.RestoreBackup(context.Background(), req.AppName, deployCtx.SystemdService, deployCtx.DataBackupPath); err != nil {
+			return err
+		}
+	} else if err := d.restartService(context.Background(), deployCtx); err != nil {
+		return err
+	}
+
+	d.logProgress(deployCtx.Request, fmt.Sprintf("Rolled back to %s", deployCtx.PreviousRelease))
+	d.logger.Success("Release rollback completed")
+	return nil
+}
+
+// pruneReleases removes all but the newest KeepReleases releases, never
+// removing the one current points at or the one it replaced
+func (d *DeploymentManager) pruneReleases(deployCtx *DeploymentContext) {
+	keep := deployCtx.Request.KeepReleases
+	if keep <= 0 {
+		keep = 5
+	}
+
+	releasesDir := deployCtx.WorkingDir + "/releases"
+	result, err := d.manager.client.ExecuteSudo("ls -1t " + shellQuote(releasesDir))
+	if err != nil || result.ExitCode != 0 {
+		d.logger.Warning("Failed to list releases for pruning: %s", resultStderr(result))
+		return
+	}
+
+	names := strings.Split(strings.TrimSpace(result.Stdout), "\n")
+	prune := releasesToPrune(names, keep, path.Base(deployCtx.ReleasePath), path.Base(deployCtx.PreviousRelease))
+	if len(prune) == 0 {
+		return
+	}
+
+	cmd := "rm -rf"
+	for _, name := range prune {
+		cmd += " " + shellQuote(path.Join(releasesDir, name))
+	}
+	if _, err := d.manager.client.ExecuteSudo(cmd); err != nil {
+		d.logger.Warning("Failed to prune old releases: %v", err)
+	}
+}
+
+// releasesToPrune returns the release names, given newest first, that fall
+// outside the newest keep. Protected names and anything that is not a plain
+// directory name are never returned.
+func releasesToPrune(names []string, keep int, protected ...string) []string {
+	var prune []string
+	for i, name := range names {
+		if i < keep || name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+			continue
+		}
+		if slices.Contains(protected, name) {
+			continue
+		}
+		prune = append(prune, name)
+	}
+	return prune
+}
+
+// ListReleases returns the release directories of an app, newest first
+func (d *DeploymentManager) ListReleases(appName string) ([]string, error) {
+	releasesDir := fmt.Sprintf("/opt/pocketbase/apps/%s/releases", appName)
+	result, err := d.manager.client.Execute("ls -1t " + shellQuote(releasesDir))
+	if err != nil {
+		return nil, err
+	}
+	if result.ExitCode != 0 {
+		return nil, &Error{
+			Type:    ErrorNotFound,
+			Message: fmt.Sprintf("no releases found for %s", appName),
+		}
+	}
+
+	var releases []string
+	for _, name := range strings.Fields(result.Stdout) {
+		releases = append(releases, path.Join(releasesDir, name))
+	}
+	return releases, nil
+}
+
+// resultStderr returns the stderr of a possibly nil result
+func resultStderr(result *Result) string {
+	if result == nil {
+		return ""
+	}
+	return result.Stderr
+}
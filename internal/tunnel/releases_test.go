@@ -0,0 +1,125 @@
+package tunnel
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func rollbackContext() *DeploymentContext {
+	return &DeploymentContext{
+		Request:         &DeploymentRequest{AppName: "app"},
+		WorkingDir:      "/opt/pocketbase/apps/app",
+		SystemdService:  "app",
+		PreviousRelease: "/opt/pocketbase/apps/app/releases/100",
+		DataBackupPath:  "/opt/pocketbase/backups/data/app/pb_data-200.tar.gz",
+	}
+}
+
+func TestRollbackReleaseRestoresData(t *testing.T) {
+	client := &scriptedClient{results: []*Result{
+		{},                     // switch current
+		{Stdout: "42\n"},       // stat backup
+		{Stdout: "pb_data/\n"}, // list backup
+	}}
+	deployer := NewDeploymentManager(NewManager(client), nil)
+
+	if err := deployer.rollbackRelease(rollbackContext(), true); err != nil {
+		t.Fatalf("rollbackRelease() error = %v", err)
+	}
+
+	all := strings.Join(client.commands, "\n")
+	if !strings.Contains(all, "tar -xzf '\\''/opt/pocketbase/backups/data/app/pb_data-200.tar.gz'\\''") {
+		t.Errorf("Expected the snapshot to be extracted, got %q", client.commands)
+	}
+	if strings.Contains(all, "systemctl restart") {
+		t.Errorf("Expected RestoreBackup to start the service instead of a restart, got %q", client.commands)
+	}
+	if last := client.commands[len(client.commands)-2]; last != "sudo systemctl start 'app'" {
+		t.Errorf("Expected the service started after the restore, got %q", last)
+	}
+}
+
+func TestRollbackReleaseKeepsDataBeforeStart(t *testing.T) {
+	client := &scriptedClient{}
+	deployer := NewDeploymentManager(NewManager(client), nil)
+
+	if err := deployer.rollbackRelease(rollbackContext(), false); err != nil {
+		t.Fatalf("rollbackRelease() error = %v", err)
+	}
+
+	want := []string{
+		`sudo bash -c 'ln -sfn '\''/opt/pocketbase/apps/app/releases/100'\'' '\''/opt/pocketbase/apps/app/current.tmp'\'' && mv -Tf '\''/opt/pocketbase/apps/app/current.tmp'\'' '\''/opt/pocketbase/apps/app/current'\'''`,
+		`sudo systemctl restart 'app'`,
+	}
+	if strings.Join(client.commands, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected commands:\n got %q\nwant %q", client.commands, want)
+	}
+}
+
+func TestRollbackReleaseWithoutPreviousRelease(t *testing.T) {
+	client := &scriptedClient{}
+	deployer := NewDeploymentManager(NewManager(client), nil)
+
+	deployCtx := rollbackContext()
+	deployCtx.PreviousRelease = ""
+	err := deployer.rollbackRelease(deployCtx, true)
+	if err == nil || !strings.Contains(err.Error(), deployCtx.DataBackupPath) {
+		t.Errorf("Expected an error naming the kept snapshot, got %v", err)
+	}
+	if len(client.commands) != 1 || client.commands[0] != "sudo systemctl stop 'app'" {
+		t.Errorf("Expected only the service to be stopped, got %q", client.commands)
+	}
+}
+
+func TestReleasesToPrune(t *testing.T) {
+	names := []string{"600", "500", "400", "300", "200", "100"}
+
+	tests := []struct {
+		name      string
+		keep      int
+		protected []string
+		want      []string
+	}{
+		{"keeps newest", 3, nil, []string{"300", "200", "100"}},
+		{"nothing beyond keep", 6, nil, nil},
+		{"keeps current and previous", 1, []string{"600", "200"}, []string{"500", "400", "300", "100"}},
+		{"protected outside keep", 3, []string{"600", "100"}, []string{"300", "200"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := releasesToPrune(names, tt.keep, tt.protected...)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("releasesToPrune(keep=%d, protected=%q) = %q, want %q", tt.keep, tt.protected, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReleasesToPruneSkipsUnsafeNames(t *testing.T) {
+	got := releasesToPrune([]string{"300", "", ".", "..", "a/b", "100"}, 1)
+	if want := []string{"100"}; !slices.Equal(got, want) {
+		t.Errorf("releasesToPrune() = %q, want %q", got, want)
+	}
+}
+
+func TestPruneReleasesCommand(t *testing.T) {
+	client := &scriptedClient{results: []*Result{{Stdout: "400\n300\n200\n100\n"}}}
+	deployer := NewDeploymentManager(NewManager(client), nil)
+
+	deployer.pruneReleases(&DeploymentContext{
+		Request:         &DeploymentRequest{KeepReleases: 1},
+		WorkingDir:      "/opt/pocketbase/apps/my app",
+		ReleasePath:     "/opt/pocketbase/apps/my app/releases/400",
+		PreviousRelease: "/opt/pocketbase/apps/my app/releases/300",
+	})
+
+	want := []string{
+		`sudo ls -1t '/opt/pocketbase/apps/my app/releases'`,
+		`sudo rm -rf '/opt/pocketbase/apps/my app/releases/200' '/opt/pocketbase/apps/my app/releases/100'`,
+	}
+	if !slices.Equal(client.commands, want) {
+		t.Errorf("Unexpected commands:\n got %q\nwant %q", client.commands, want)
+	}
+}
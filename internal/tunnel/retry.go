@@ -0,0 +1,119 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RetryPolicy controls how RunCommandWithRetry retries a failed command
+type RetryPolicy struct {
+	// Attempts is the total number of runs, including the first (default 3)
+	Attempts int
+	// Backoff is the delay before the first retry, doubled after each one
+	// up to MaxBackoff (defaults 2s and 30s)
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Retryable reports why a result is worth retrying, or "" if it is not.
+	// A nil Retryable uses TransientFailure.
+	Retryable func(result *Result, err error) string
+}
+
+// transientMarkers are output fragments of failures that usually clear up on
+// their own: package manager locks held by unattended upgrades, flaky mirrors
+// and DNS
+var transientMarkers = []string{
+	"Could not get lock",
+	"Unable to acquire the dpkg frontend lock",
+	"dpkg was interrupted",
+	"is another process using it",
+	"Temporary failure resolving",
+	"Temporary failure in name resolution",
+	"Failed to fetch",
+	"Connection timed out",
+	"another app is currently holding the yum lock",
+	"Waiting for process with pid",
+	"Transaction in progress",
+	"Resource temporarily unavailable",
+}
+
+// TransientFailure treats timeouts, dropped sessions and failures whose output
+// matches a known transient condition as retryable
+func TransientFailure(result *Result, err error) string {
+	if err != nil {
+		var tunnelErr *Error
+		switch {
+		case errors.Is(err, ErrTimeout):
+			return "timed out"
+		case errors.As(err, &tunnelErr) && tunnelErr.Type == ErrorExecution:
+			return "session failed: " + err.Error()
+		}
+		return ""
+	}
+
+	if result == nil || result.ExitCode == 0 {
+		return ""
+	}
+	output := result.Stderr + "\n" + result.Stdout
+	for _, marker := range transientMarkers {
+		if strings.Contains(output, marker) {
+			return fmt.Sprintf("exit code %d: %s", result.ExitCode, marker)
+		}
+	}
+	return ""
+}
+
+// RunCommandWithRetry runs cmd and retries it according to policy while the
+// failure is retryable. Pass WithSudo to run it through ExecuteSudo. It
+// returns the last result; a non-zero exit code is not an error, as with
+// Execute. Each retry is logged with its reason.
+func (m *Manager) RunCommandWithRetry(ctx context.Context, cmd string, policy RetryPolicy, opts ...ExecOption) (*Result, error) {
+	cfg := &execConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	run := m.client.Execute
+	if cfg.sudo {
+		run = m.client.ExecuteSudo
+	}
+
+	attempts := policy.Attempts
+	if attempts <= 0 {
+		attempts = 3
+	}
+	backoff := policy.Backoff
+	if backoff <= 0 {
+		backoff = 2 * time.Second
+	}
+	maxBackoff := policy.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 30 * time.Second
+	}
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = TransientFailure
+	}
+
+	for attempt := 1; ; attempt++ {
+		result, err := run(cmd, opts...)
+
+		reason := retryable(result, err)
+		if reason == "" || attempt == attempts {
+			return result, err
+		}
+
+		m.logger.Warning("Attempt %d/%d of %q failed (%s), retrying in %s", attempt, attempts, cmd, reason, backoff)
+		select {
+		case <-ctx.Done():
+			return result, &Error{
+				Type:    ErrorTimeout,
+				Message: fmt.Sprintf("retry of %q cancelled", cmd),
+				Cause:   ctx.Err(),
+			}
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
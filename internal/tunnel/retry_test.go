@@ -0,0 +1,136 @@
+package tunnel
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scriptedClient is an SSHClient that replays canned results and records
+// the commands it was asked to run
+type scriptedClient struct {
+	results  []*Result
+	errs     []error
+	commands []string
+}
+
+func (s *scriptedClient) Connect() error            { return nil }
+func (s *scriptedClient) Close() error              { return nil }
+func (s *scriptedClient) IsConnected() bool         { return true }
+func (s *scriptedClient) Ping() error               { return nil }
+func (s *scriptedClient) SetTracer(Tracer)          {}
+func (s *scriptedClient) HostInfo() (string, error) { return "test", nil }
+
+func (s *scriptedClient) Upload(localPath, remotePath string, opts ...FileOption) error {
+	return nil
+}
+
+func (s *scriptedClient) Download(remotePath, localPath string, opts ...FileOption) error {
+	return nil
+}
+
+func (s *scriptedClient) Execute(cmd string, opts ...ExecOption) (*Result, error) {
+	i := len(s.commands)
+	s.commands = append(s.commands, cmd)
+
+	var result *Result
+	var err error
+	if i < len(s.results) {
+		result = s.results[i]
+	}
+	if i < len(s.errs) {
+		err = s.errs[i]
+	}
+	if result == nil && err == nil {
+		result = &Result{}
+	}
+	return result, err
+}
+
+func (s *scriptedClient) ExecuteSudo(cmd string, opts ...ExecOption) (*Result, error) {
+	return s.Execute("sudo "+cmd, opts...)
+}
+
+var fastRetry = RetryPolicy{Backoff: time.Millisecond}
+
+func TestRunCommandWithRetryRecoversFromLock(t *testing.T) {
+	client := &scriptedClient{results: []*Result{
+		{ExitCode: 100, Stderr: "E: Could not get lock /var/lib/dpkg/lock-frontend"},
+		{ExitCode: 0},
+	}}
+	manager := NewManager(client)
+
+	result, err := manager.RunCommandWithRetry(context.Background(), "apt-get install -y ufw", fastRetry, WithSudo())
+	if err != nil || result.ExitCode != 0 {
+		t.Fatalf("Expected retry to succeed, got %v, %+v", err, result)
+	}
+	if len(client.commands) != 2 || !strings.HasPrefix(client.commands[0], "sudo ") {
+		t.Errorf("Expected two sudo runs, got %q", client.commands)
+	}
+}
+
+func TestRunCommandWithRetryStopsOnPermanentFailure(t *testing.T) {
+	client := &scriptedClient{results: []*Result{
+		{ExitCode: 100, Stderr: "E: Unable to locate package nosuchpackage"},
+	}}
+	manager := NewManager(client)
+
+	result, err := manager.RunCommandWithRetry(context.Background(), "apt-get install -y nosuchpackage", fastRetry)
+	if err != nil || result.ExitCode != 100 {
+		t.Fatalf("Expected the failed result to be returned, got %v, %+v", err, result)
+	}
+	if len(client.commands) != 1 {
+		t.Errorf("Expected no retry, got %d runs", len(client.commands))
+	}
+}
+
+func TestRunCommandWithRetryGivesUpAfterAttempts(t *testing.T) {
+	client := &scriptedClient{errs: []error{
+		&Error{Type: ErrorTimeout, Message: "command timed out"},
+		&Error{Type: ErrorTimeout, Message: "command timed out"},
+		&Error{Type: ErrorTimeout, Message: "command timed out"},
+	}}
+	manager := NewManager(client)
+
+	policy := fastRetry
+	policy.Attempts = 2
+	if _, err := manager.RunCommandWithRetry(context.Background(), "systemctl start fail2ban", policy); err == nil {
+		t.Fatal("Expected the last error to be returned")
+	}
+	if len(client.commands) != 2 {
+		t.Errorf("Expected 2 attempts, got %d", len(client.commands))
+	}
+}
+
+func TestRunCommandWithRetryCustomPredicate(t *testing.T) {
+	client := &scriptedClient{results: []*Result{{ExitCode: 3}, {ExitCode: 0}}}
+	manager := NewManager(client)
+
+	policy := fastRetry
+	policy.Retryable = func(result *Result, err error) string {
+		if result != nil && result.ExitCode == 3 {
+			return "unit not active yet"
+		}
+		return ""
+	}
+	result, _ := manager.RunCommandWithRetry(context.Background(), "systemctl is-active app", policy)
+	if result.ExitCode != 0 || len(client.commands) != 2 {
+		t.Errorf("Expected retry on exit code 3, got %+v after %d runs", result, len(client.commands))
+	}
+}
+
+func TestRunCommandWithRetryCancelled(t *testing.T) {
+	client := &scriptedClient{results: []*Result{{ExitCode: 1, Stderr: "Temporary failure resolving 'deb.debian.org'"}}}
+	manager := NewManager(client)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := manager.RunCommandWithRetry(ctx, "apt-get update", RetryPolicy{Backoff: time.Hour})
+	if err == nil {
+		t.Fatal("Expected cancellation error")
+	}
+	if len(client.commands) != 1 {
+		t.Errorf("Expected no retry after cancellation, got %d runs", len(client.commands))
+	}
+}
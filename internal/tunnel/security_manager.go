@@ -1,7 +1,14 @@
 package tunnel
 
 import (
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -10,65 +17,220 @@ import (
 )
 
 type SecurityManager struct {
-	manager *Manager
-	logger  *logger.Logger
+	manager  *Manager
+	logger   *logger.Logger
+	progress *progressRelay
+	dryRun   *dryRunClient
+	// sshPort is the port new logins use after HardenSSH moved sshd
+	sshPort int
 	cleanup []func()
 	mu      sync.Mutex
 	closed  bool
 }
 
-func NewSecurityManager(manager *Manager) *SecurityManager {
-	return &SecurityManager{
+func NewSecurityManager(manager *Manager, opts ...SecurityOption) *SecurityManager {
+	s := &SecurityManager{
 		manager: manager,
-		logger:  logger.GetTunnelLogger(),
+		logger:  manager.logger,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// reportProgress sends an update to the progress callback, if any
+func (s *SecurityManager) reportProgress(step, status, message string, percent int) {
+	if s.progress == nil {
+		return
+	}
+	if !s.progress.send(ProgressUpdate{Step: step, Status: status, Message: message, Percent: percent}) {
+		s.logger.Debug("Progress update dropped: %s %s", step, status)
 	}
 }
 
+// failProgress reports err as the failure of step and returns it
+func (s *SecurityManager) failProgress(step string, percent int, err error) error {
+	s.reportProgress(step, ProgressFailed, err.Error(), percent)
+	return err
+}
+
 func (s *SecurityManager) SecureServer(config SecurityConfig) error {
 	s.logger.SystemOperation("Starting server security hardening")
+	s.reportProgress("validate", ProgressRunning, "Validating security configuration", 0)
 
+	from, to := s.plannedSSHPortMove(config)
+	if to != 0 {
+		s.logger.Info("Moving SSH from port %d to %d", from, to)
+		config = withSSHPortMove(config, from, to)
+	}
 	if len(config.FirewallRules) > 0 {
-		err := s.SetupFirewall(config.FirewallRules)
-		if err != nil {
-			return fmt.Errorf("failed to setup firewall: %w", err)
+		config.FirewallRules = s.ensureSSHAllowed(config.FirewallRules, config.SSHPort)
+	}
+	if err := ValidateSecurityConfig(config); err != nil {
+		return s.failProgress("validate", 0, err)
+	}
+	if (!config.SkipVerify || to != 0) && !s.IsDryRun() {
+		if _, err := s.verifyLoginUser(config); err != nil {
+			return s.failProgress("validate", 0, err)
+		}
+	}
+
+	if len(config.FirewallRules) > 0 {
+		s.reportProgress("firewall", ProgressRunning, fmt.Sprintf("Applying %d firewall rules", len(config.FirewallRules)), 10)
+		if config.AutoInstallFirewall {
+			if _, err := s.InstallFirewall(config.PreferredFirewall); err != nil {
+				return s.failProgress("firewall", 10, fmt.Errorf("failed to install firewall: %w", err))
+			}
 		}
+
+		if config.Idempotent {
+			if _, err := s.SyncFirewall(config.FirewallRules); err != nil {
+				return s.failProgress("firewall", 10, fmt.Errorf("failed to synchronize firewall: %w", err))
+			}
+		} else if err := s.SetupFirewall(config.FirewallRules); err != nil {
+			return s.failProgress("firewall", 10, fmt.Errorf("failed to setup firewall: %w", err))
+		}
+		s.reportProgress("firewall", ProgressSuccess, "Firewall configured", 35)
 	}
 
 	if config.HardenSSH {
+		s.reportProgress("ssh", ProgressRunning, "Hardening SSH configuration", 35)
 		err := s.HardenSSH(config.SSHConfig)
 		if err != nil {
-			return fmt.Errorf("failed to harden SSH: %w", err)
+			return s.failProgress("ssh", 35, fmt.Errorf("failed to harden SSH: %w", err))
 		}
+		s.reportProgress("ssh", ProgressSuccess, "SSH hardened", 60)
 	}
 
 	if config.EnableFail2ban {
-		err := s.SetupFail2ban()
+		s.reportProgress("fail2ban", ProgressRunning, "Setting up fail2ban", 60)
+		err := s.SetupFail2ban(config.Fail2banConfig)
 		if err != nil {
-			return fmt.Errorf("failed to setup fail2ban: %w", err)
+			return s.failProgress("fail2ban", 60, fmt.Errorf("failed to setup fail2ban: %w", err))
 		}
+		s.reportProgress("fail2ban", ProgressSuccess, "fail2ban running", 75)
 	}
 
+	if config.AutomaticUpdates {
+		s.reportProgress("updates", ProgressRunning, "Enabling automatic security updates", 75)
+		err := s.SetupAutomaticUpdates(config.AutomaticUpdatesEmail)
+		switch {
+		case errors.Is(err, ErrUnsupported):
+			s.logger.Warning("Skipping automatic security updates: %v", err)
+			s.reportProgress("updates", ProgressSkipped, err.Error(), 85)
+		case err != nil:
+			return s.failProgress("updates", 75, fmt.Errorf("failed to enable automatic updates: %w", err))
+		default:
+			s.reportProgress("updates", ProgressSuccess, "Automatic security updates enabled", 85)
+		}
+	}
+
+	s.reportProgress("verify", ProgressRunning, "Verifying SSH access", 85)
+	if err := s.verifyLockdown(config); err != nil {
+		return s.failProgress("verify", 85, err)
+	}
+
+	if to != 0 && len(config.FirewallRules) > 0 {
+		s.reportProgress("ssh-port", ProgressRunning, fmt.Sprintf("Closing previous SSH port %d", from), 95)
+		if err := s.closeOldSSHPort(config, from); err != nil {
+			return s.failProgress("ssh-port", 95, err)
+		}
+	}
+
+	s.reportProgress("complete", ProgressSuccess, "Server security hardening completed", 100)
 	s.logger.Success("Server security hardening completed")
 	return nil
 }
 
+// verifyLockdown is the final self-test of SecureServer: a brand-new SSH
+// login as VerifyUser must still work once firewall, sshd and fail2ban
+// changes are all in place. If it does not, the SSH configuration is rolled
+// back.
+func (s *SecurityManager) verifyLockdown(config SecurityConfig) error {
+	if config.SkipVerify {
+		return nil
+	}
+	if s.IsDryRun() {
+		s.logger.Info("[dry-run] Skipping SSH login self-test")
+		return nil
+	}
+
+	user, err := s.verifyLoginUser(config)
+	if err != nil {
+		return err
+	}
+
+	timeout := config.SSHConfig.VerifyTimeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	s.logger.SystemOperation(fmt.Sprintf("Verifying a new SSH login as %s", user))
+	err = s.verifySSHAccessAs(ctx, user)
+	if err == nil {
+		s.logger.Success("SSH login as %s verified after hardening", user)
+		return nil
+	}
+
+	if !config.HardenSSH {
+		return &Error{
+			Type:    ErrorVerification,
+			Message: fmt.Sprintf("SSH login as %s failed after hardening", user),
+			Cause:   err,
+		}
+	}
+
+	s.logger.Warning("SSH login as %s failed after hardening, rolling back SSH configuration: %v", user, err)
+	if rollbackErr := s.RollbackSSH(context.Background()); rollbackErr != nil {
+		return &Error{
+			Type:    ErrorExecution,
+			Message: fmt.Sprintf("SSH login as %s failed and rollback failed", user),
+			Cause:   errors.Join(err, rollbackErr),
+		}
+	}
+	return &Error{
+		Type:    ErrorVerification,
+		Message: fmt.Sprintf("SSH login as %s failed after hardening, SSH configuration rolled back", user),
+		Cause:   err,
+	}
+}
+
+// verifyLoginUser returns the user SSH self-tests log in as: VerifyUser, or
+// the connected user. Root cannot be tested once hardening disables root
+// login, which is an error rather than a skipped test.
+func (s *SecurityManager) verifyLoginUser(config SecurityConfig) (string, error) {
+	user := config.VerifyUser
+	if user == "" {
+		if current, ok := s.manager.client.(*Client); ok {
+			user = current.config.User
+		}
+	}
+	if user == "root" && config.HardenSSH && !config.SSHConfig.RootLogin {
+		return "", &Error{
+			Type:    ErrorVerification,
+			Message: "cannot verify SSH access as root once root login is disabled: set VerifyUser to the app user",
+		}
+	}
+	return user, nil
+}
+
 func (s *SecurityManager) SetupFirewall(rules []FirewallRule) error {
 	s.logger.SystemOperation(fmt.Sprintf("Setting up firewall with %d rules", len(rules)))
-	var firewallCmd string
 
-	result, err := s.manager.client.Execute("which ufw", WithTimeout(5*time.Second))
-	if err == nil && result.ExitCode == 0 {
-		firewallCmd = "ufw"
-	} else {
-		result, err = s.manager.client.Execute("which firewall-cmd", WithTimeout(5*time.Second))
-		if err == nil && result.ExitCode == 0 {
-			firewallCmd = "firewalld"
-		} else {
-			firewallCmd = "iptables"
-		}
+	if err := validateFirewallRules(rules); err != nil {
+		return err
+	}
+
+	firewall, err := s.requireFirewall()
+	if err != nil {
+		return err
 	}
+	rules = s.ensureSSHAllowed(rules, 0)
 
-	switch firewallCmd {
+	switch firewall {
 	case "ufw":
 		return s.setupUFW(rules)
 	case "firewalld":
@@ -101,14 +263,14 @@ func (s *SecurityManager) setupUFW(rules []FirewallRule) error {
 		}
 	}
 
-	for _, rule := range rules {
-		var cmd string
-		if rule.Source != "" {
-			cmd = fmt.Sprintf("ufw %s from %s to any port %d proto %s",
-				rule.Action, rule.Source, rule.Port, rule.Protocol)
-		} else {
-			cmd = fmt.Sprintf("ufw %s %d/%s", rule.Action, rule.Port, rule.Protocol)
+	if hasIPv6Rules(rules) {
+		if err := s.enableUFWIPv6(); err != nil {
+			return err
 		}
+	}
+
+	for _, rule := range rules {
+		cmd := "ufw " + ufwRuleArgs(rule)
 
 		result, err := s.manager.client.ExecuteSudo(cmd)
 		if err != nil {
@@ -144,10 +306,9 @@ func (s *SecurityManager) setupFirewalld(rules []FirewallRule) error {
 		var cmd string
 		if rule.Action == "allow" {
 			if rule.Source != "" {
-				cmd = fmt.Sprintf("firewall-cmd --permanent --add-rich-rule='rule family=\"ipv4\" source address=\"%s\" port protocol=\"%s\" port=\"%d\" accept'",
-					rule.Source, rule.Protocol, rule.Port)
+				cmd = fmt.Sprintf("firewall-cmd --permanent --add-rich-rule='%s'", firewalldRichRule(rule))
 			} else {
-				cmd = fmt.Sprintf("firewall-cmd --permanent --add-port=%d/%s", rule.Port, rule.Protocol)
+				cmd = fmt.Sprintf("firewall-cmd --permanent --add-port=%s/%s", portSpec(rule, "-"), rule.Protocol)
 			}
 
 			result, err := s.manager.client.ExecuteSudo(cmd)
@@ -181,65 +342,69 @@ func (s *SecurityManager) setupIPTables(rules []FirewallRule) error {
 	s.logger.SystemOperation("Configuring iptables")
 	s.manager.InstallPackages("iptables-persistent")
 
-	cmds := []string{
-		"iptables -F",
-		"iptables -P INPUT DROP",
-		"iptables -P FORWARD DROP",
-		"iptables -P OUTPUT ACCEPT",
-		"iptables -A INPUT -i lo -j ACCEPT",
-		"iptables -A INPUT -m state --state ESTABLISHED,RELATED -j ACCEPT",
-	}
-
-	for _, cmd := range cmds {
-		s.manager.client.ExecuteSudo(cmd)
-	}
+	for _, binary := range iptablesBinaries(rules) {
+		cmds := []string{
+			binary + " -F",
+			binary + " -P INPUT DROP",
+			binary + " -P FORWARD DROP",
+			binary + " -P OUTPUT ACCEPT",
+			binary + " -A INPUT -i lo -j ACCEPT",
+			binary + " -A INPUT -m state --state ESTABLISHED,RELATED -j ACCEPT",
+		}
 
-	for _, rule := range rules {
-		action := "ACCEPT"
-		if rule.Action == "deny" {
-			action = "DROP"
+		for _, cmd := range cmds {
+			s.manager.client.ExecuteSudo(cmd)
 		}
 
-		var cmd string
-		if rule.Source != "" {
-			cmd = fmt.Sprintf("iptables -A INPUT -p %s --dport %d -s %s -j %s",
-				rule.Protocol, rule.Port, rule.Source, action)
-		} else {
-			cmd = fmt.Sprintf("iptables -A INPUT -p %s --dport %d -j %s",
-				rule.Protocol, rule.Port, action)
+		for _, rule := range iptablesRulesFor(binary, rules) {
+			s.manager.client.ExecuteSudo(binary + " -A INPUT " + iptablesRuleSpec(rule))
 		}
 
-		s.manager.client.ExecuteSudo(cmd)
+		s.manager.client.ExecuteSudo(iptablesSaveCommand(binary))
 	}
 
-	s.manager.client.ExecuteSudo("iptables-save > /etc/iptables/rules.v4")
-
 	return nil
 }
 
+// SSH configuration paths managed by HardenSSH
+const (
+	SSHDConfigPath       = "/etc/ssh/sshd_config"
+	SSHDConfigBackupPath = "/etc/ssh/sshd_config.bak"
+	// SSHDConfigDiffPath holds the changes between the backup and the
+	// hardened file, written by DiffSSHConfig
+	SSHDConfigDiffPath = "/etc/ssh/sshd_config.bak.diff"
+	// SSHDHardeningConfigPath is the drop-in written by earlier versions
+	SSHDHardeningConfigPath = "/etc/ssh/sshd_config.d/99-hardening.conf"
+)
+
 func (s *SecurityManager) HardenSSH(config SSHConfig) error {
 	s.logger.SystemOperation("Hardening SSH configuration")
-	s.manager.client.ExecuteSudo("cp /etc/ssh/sshd_config /etc/ssh/sshd_config.bak")
 
-	var configLines []string
-	configLines = append(configLines, "# SSH Hardening Configuration")
-	configLines = append(configLines, fmt.Sprintf("PasswordAuthentication %s", boolToYesNo(config.PasswordAuth)))
-	configLines = append(configLines, fmt.Sprintf("PermitRootLogin %s", boolToYesNo(config.RootLogin)))
-	configLines = append(configLines, fmt.Sprintf("PubkeyAuthentication %s", boolToYesNo(config.PubkeyAuth)))
-	configLines = append(configLines, fmt.Sprintf("MaxAuthTries %d", config.MaxAuthTries))
-	configLines = append(configLines, fmt.Sprintf("ClientAliveInterval %d", config.ClientAliveInterval))
-	configLines = append(configLines, fmt.Sprintf("ClientAliveCountMax %d", config.ClientAliveCountMax))
+	if err := validateSSHAccessLists(config); err != nil {
+		return err
+	}
+	if err := validateSSHCrypto(config.SSHCryptoConfig); err != nil {
+		return err
+	}
+	s.warnIfCurrentUserDenied(config)
+
+	if err := s.backupSSHConfig(); err != nil {
+		return err
+	}
 
-	if len(config.AllowUsers) > 0 {
-		configLines = append(configLines, fmt.Sprintf("AllowUsers %s", strings.Join(config.AllowUsers, " ")))
+	result, err := s.manager.client.ExecuteSudo("cat " + SSHDConfigPath)
+	if err != nil {
+		return err
 	}
-	if len(config.AllowGroups) > 0 {
-		configLines = append(configLines, fmt.Sprintf("AllowGroups %s", strings.Join(config.AllowGroups, " ")))
+	if result.ExitCode != 0 {
+		return &Error{
+			Type:    ErrorExecution,
+			Message: fmt.Sprintf("failed to read SSH config: %s", result.Stderr),
+		}
 	}
 
-	configContent := strings.Join(configLines, "\n")
-	cmd := fmt.Sprintf("echo '%s' > /etc/ssh/sshd_config.d/99-hardening.conf", configContent)
-	result, err := s.manager.client.ExecuteSudo(cmd)
+	merged := mergeSSHDConfig(result.Stdout, sshdDirectives(config))
+	result, err = s.manager.client.ExecuteSudo(writeFileCommand(SSHDConfigPath, merged))
 	if err != nil {
 		return err
 	}
@@ -250,37 +415,388 @@ func (s *SecurityManager) HardenSSH(config SSHConfig) error {
 		}
 	}
 
+	// Drop-ins are read before the main file and would override the merge
+	s.manager.client.ExecuteSudo("rm -f " + SSHDHardeningConfigPath)
+
 	result, err = s.manager.client.ExecuteSudo("sshd -t")
 	if err != nil || result.ExitCode != 0 {
-		s.manager.client.ExecuteSudo("rm /etc/ssh/sshd_config.d/99-hardening.conf")
+		s.manager.client.ExecuteSudo(fmt.Sprintf("cp %s %s", SSHDConfigBackupPath, SSHDConfigPath))
 		return &Error{
 			Type:    ErrorExecution,
 			Message: "SSH configuration test failed",
 		}
 	}
 
+	s.recordSSHConfigDiff()
+
+	if config.Port != 0 {
+		s.reloadSSHSocket()
+	}
 	s.manager.ServiceRestart("sshd")
+	if config.Port != 0 {
+		s.sshPort = config.Port
+	}
+
+	if config.AutoRollback && !s.IsDryRun() {
+		timeout := config.VerifyTimeout
+		if timeout == 0 {
+			timeout = 30 * time.Second
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		if err := s.verifySSHAccess(ctx); err != nil {
+			s.logger.Warning("SSH verification failed after hardening, rolling back: %v", err)
+			if rollbackErr := s.RollbackSSH(context.Background()); rollbackErr != nil {
+				return &Error{
+					Type:    ErrorExecution,
+					Message: "SSH verification failed and rollback failed",
+					Cause:   rollbackErr,
+				}
+			}
+			return &Error{
+				Type:    ErrorVerification,
+				Message: "SSH verification failed after hardening, configuration rolled back",
+				Cause:   err,
+			}
+		}
+		s.logger.Success("SSH access verified after hardening")
+	}
 
 	return nil
 }
 
-func (s *SecurityManager) SetupFail2ban() error {
+// defaultSSHPort is the port sshd listens on
+const defaultSSHPort = 22
+
+// ValidateSecurityConfig rejects configurations that would lock the deployer
+// out of the server, before SecureServer changes anything. All problems are
+// reported together.
+func ValidateSecurityConfig(config SecurityConfig) error {
+	var errs []error
+	problem := func(format string, args ...any) {
+		errs = append(errs, &Error{Type: ErrorVerification, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(config.FirewallRules) > 0 {
+		if err := validateFirewallRules(config.FirewallRules); err != nil {
+			errs = append(errs, err)
+		}
+		port := cmp.Or(config.SSHPort, defaultSSHPort)
+		if !allowsPort(config.FirewallRules, port) {
+			problem("firewall rules do not allow SSH: add an allow rule for port %d/tcp", port)
+		}
+	}
+
+	if config.AutomaticUpdates {
+		if err := validateUpdateEmail(config.AutomaticUpdatesEmail); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if config.HardenSSH {
+		ssh := config.SSHConfig
+		if ssh.Port < 0 || ssh.Port > 65535 {
+			problem("SSH port %d is out of range", ssh.Port)
+		}
+		if !ssh.PasswordAuth && !ssh.PubkeyAuth {
+			problem("SSH config disables both password and public key authentication: enable PubkeyAuth")
+		}
+		if err := validateSSHAccessLists(ssh); err != nil {
+			errs = append(errs, err)
+		}
+		if err := validateSSHCrypto(ssh.SSHCryptoConfig); err != nil {
+			errs = append(errs, err)
+		}
+		if len(ssh.AllowUsers) > 0 {
+			allowed := slices.DeleteFunc(slices.Clone(ssh.AllowUsers), func(entry string) bool {
+				user, _, _ := strings.Cut(entry, "@")
+				return slices.Contains(ssh.DenyUsers, user) || (user == "root" && !ssh.RootLogin)
+			})
+			if len(allowed) == 0 {
+				problem("every AllowUsers entry is denied by DenyUsers or disabled root login: allow at least one other user")
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ensureSSHAllowed adds an allow rule for the SSH port when rules have none,
+// so enabling the firewall cannot cut off the current session. A zero port
+// is detected from the connection.
+func (s *SecurityManager) ensureSSHAllowed(rules []FirewallRule, port int) []FirewallRule {
+	if port == 0 {
+		detected, err := s.activeSSHPort()
+		if err != nil {
+			s.logger.Warning("Could not detect SSH port, assuming %d: %v", defaultSSHPort, err)
+			detected = defaultSSHPort
+		}
+		port = detected
+	}
+
+	if allowsPort(rules, port) {
+		return rules
+	}
+
+	s.logger.Warning("Firewall rules do not allow SSH on port %d, adding an allow rule to avoid a lockout", port)
+	return append(slices.Clone(rules), FirewallRule{
+		Port:        port,
+		Protocol:    "tcp",
+		Action:      "allow",
+		Description: "SSH (added automatically)",
+	})
+}
+
+// activeSSHPort returns the server port of the current SSH session
+func (s *SecurityManager) activeSSHPort() (int, error) {
+	result, err := s.manager.client.Execute("echo $SSH_CLIENT", WithTimeout(5*time.Second))
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.Fields(result.Stdout)
+	if len(fields) < 3 {
+		return 0, &Error{
+			Type:    ErrorNotFound,
+			Message: "SSH_CLIENT is not set on the server",
+		}
+	}
+	return strconv.Atoi(fields[2])
+}
+
+// allowsPort reports whether an allow rule covers port/tcp
+func allowsPort(rules []FirewallRule, port int) bool {
+	for _, rule := range rules {
+		if rule.Action != "allow" || rule.Protocol != "tcp" {
+			continue
+		}
+		end := max(rule.PortEnd, rule.Port)
+		if port >= rule.Port && port <= end {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSSHAccessLists rejects AllowUsers/AllowGroups entries sshd would
+// misparse, and an AllowUsers list that would only admit root while root
+// login is disabled, which locks everyone out
+func validateSSHAccessLists(config SSHConfig) error {
+	for _, entry := range slices.Concat(config.AllowUsers, config.AllowGroups) {
+		if entry == "" || strings.ContainsAny(entry, " \t'\"") {
+			return &Error{
+				Type:    ErrorVerification,
+				Message: fmt.Sprintf("invalid SSH AllowUsers/AllowGroups entry %q", entry),
+			}
+		}
+	}
+
+	if config.RootLogin || len(config.AllowUsers) == 0 || len(config.AllowGroups) > 0 {
+		return nil
+	}
+
+	for _, entry := range config.AllowUsers {
+		user, _, _ := strings.Cut(entry, "@")
+		if user != "root" {
+			return nil
+		}
+	}
+
+	return &Error{
+		Type:    ErrorVerification,
+		Message: "AllowUsers must include a non-root user when root login is disabled",
+	}
+}
+
+// warnIfCurrentUserDenied warns when the user this client is connected as
+// would not be admitted by the configured AllowUsers/AllowGroups
+func (s *SecurityManager) warnIfCurrentUserDenied(config SSHConfig) {
+	if len(config.AllowUsers) == 0 && len(config.AllowGroups) == 0 {
+		return
+	}
+
+	result, err := s.manager.client.Execute("id -un && id -Gn", WithTimeout(5*time.Second))
+	if err != nil || result.ExitCode != 0 {
+		return
+	}
+	lines := strings.Split(strings.TrimSpace(result.Stdout), "\n")
+	if len(lines) == 0 {
+		return
+	}
+	user := strings.TrimSpace(lines[0])
+	var groups []string
+	if len(lines) > 1 {
+		groups = strings.Fields(lines[1])
+	}
+
+	allowed := len(config.AllowUsers) == 0
+	for _, entry := range config.AllowUsers {
+		pattern, _, _ := strings.Cut(entry, "@")
+		if ok, _ := path.Match(pattern, user); ok {
+			allowed = true
+			break
+		}
+	}
+	if allowed && len(config.AllowGroups) > 0 {
+		allowed = slices.ContainsFunc(groups, func(group string) bool {
+			return slices.ContainsFunc(config.AllowGroups, func(pattern string) bool {
+				ok, _ := path.Match(pattern, group)
+				return ok
+			})
+		})
+	}
+
+	if !allowed {
+		s.logger.Warning("Current SSH user %s is not permitted by AllowUsers/AllowGroups and will lose SSH access", user)
+	}
+}
+
+// RollbackSSH restores the sshd_config backup created by HardenSSH, removes
+// the hardening drop-in and restarts sshd. It runs over the existing
+// connection, which survives the sshd restart.
+func (s *SecurityManager) RollbackSSH(ctx context.Context) error {
+	s.logger.SystemOperation("Rolling back SSH configuration")
+
+	result, err := s.manager.client.ExecuteSudo(fmt.Sprintf("test -f %s", SSHDConfigBackupPath))
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return &Error{
+			Type:    ErrorNotFound,
+			Message: fmt.Sprintf("SSH config backup not found: %s", SSHDConfigBackupPath),
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	cmds := []string{
+		fmt.Sprintf("cp %s %s", SSHDConfigBackupPath, SSHDConfigPath),
+		fmt.Sprintf("rm -f %s", SSHDHardeningConfigPath),
+		"sshd -t",
+	}
+	for _, cmd := range cmds {
+		result, err := s.manager.client.ExecuteSudo(cmd)
+		if err != nil {
+			return err
+		}
+		if result.ExitCode != 0 {
+			return &Error{
+				Type:    ErrorExecution,
+				Message: fmt.Sprintf("SSH rollback failed: %s", result.Stderr),
+			}
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if s.sshPort != 0 {
+		s.reloadSSHSocket()
+	}
+	if err := s.manager.ServiceRestart("sshd"); err != nil {
+		return err
+	}
+	s.sshPort = 0
+
+	s.logger.Success("SSH configuration rolled back")
+	return nil
+}
+
+// verifySSHAccess opens a fresh connection with the current client settings
+// to confirm new logins still work after an sshd restart
+func (s *SecurityManager) verifySSHAccess(ctx context.Context) error {
+	return s.verifySSHAccessAs(ctx, "")
+}
+
+// verifySSHAccessAs opens a fresh connection as user (the current user if
+// empty) and runs a command on it
+func (s *SecurityManager) verifySSHAccessAs(ctx context.Context, user string) error {
+	current, ok := s.manager.client.(*Client)
+	if !ok {
+		return &Error{
+			Type:    ErrorVerification,
+			Message: "SSH access verification requires a *Client connection",
+		}
+	}
+
+	config := current.config
+	if user != "" {
+		config.User = user
+	}
+	if s.sshPort != 0 {
+		config.Port = s.sshPort
+	}
+	config.RetryCount = 1
+	if deadline, ok := ctx.Deadline(); ok {
+		config.Timeout = time.Until(deadline)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		client, err := NewClient(config)
+		if err != nil {
+			done <- err
+			return
+		}
+		defer client.Close()
+
+		if err := client.Connect(); err != nil {
+			done <- err
+			return
+		}
+		result, err := client.Execute("id -un", WithTimeout(10*time.Second))
+		if err == nil && strings.TrimSpace(result.Stdout) != config.User {
+			err = &Error{
+				Type:    ErrorVerification,
+				Message: fmt.Sprintf("logged in as %q, expected %q", strings.TrimSpace(result.Stdout), config.User),
+			}
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return &Error{
+			Type:    ErrorTimeout,
+			Message: "timed out verifying SSH access",
+			Cause:   ctx.Err(),
+		}
+	}
+}
+
+func (s *SecurityManager) SetupFail2ban(config Fail2banConfig) error {
 	s.logger.SystemOperation("Setting up fail2ban intrusion detection")
+
+	ignoreIPs := append([]string{}, config.IgnoreIPs...)
+	if config.IgnoreDeployerIP {
+		ip, err := s.detectDeployerIP()
+		if err != nil {
+			s.logger.Warning("Could not detect deployer IP for fail2ban ignoreip: %v", err)
+		} else if !slices.Contains(ignoreIPs, ip) {
+			s.logger.Info("Excluding deployer IP %s from fail2ban bans", ip)
+			ignoreIPs = append(ignoreIPs, ip)
+		}
+	}
+	for _, ip := range ignoreIPs {
+		if _, err := parseRuleSource(ip); err != nil {
+			return err
+		}
+	}
+
 	err := s.manager.InstallPackages("fail2ban")
 	if err != nil {
 		return err
 	}
 
-	jailConfig := `[DEFAULT]
-bantime = 3600
-findtime = 600
-maxretry = 5
-
-[sshd]
-enabled = true
-port = ssh
-logpath = /var/log/auth.log
-backend = systemd`
+	jailConfig := s.buildFail2banJailConfig(config, ignoreIPs)
 
 	cmd := fmt.Sprintf("echo '%s' > /etc/fail2ban/jail.local", jailConfig)
 	result, err := s.manager.client.ExecuteSudo(cmd)
@@ -297,9 +813,129 @@ backend = systemd`
 	s.manager.ServiceEnable("fail2ban")
 	s.manager.ServiceRestart("fail2ban")
 
+	if s.IsDryRun() {
+		return nil
+	}
+
+	jails, err := s.verifyFail2banJail("sshd", 5)
+	if err != nil {
+		return err
+	}
+	s.logger.Success("fail2ban running with jails: %s", strings.Join(jails, ", "))
+
 	return nil
 }
 
+// buildFail2banJailConfig renders jail.local, filling unset timings with defaults
+func (s *SecurityManager) buildFail2banJailConfig(config Fail2banConfig, ignoreIPs []string) string {
+	defaults := s.GetDefaultFail2banConfig()
+	if config.BanTime == 0 {
+		config.BanTime = defaults.BanTime
+	}
+	if config.FindTime == 0 {
+		config.FindTime = defaults.FindTime
+	}
+	if config.MaxRetry == 0 {
+		config.MaxRetry = defaults.MaxRetry
+	}
+
+	ignore := append([]string{"127.0.0.1/8", "::1"}, ignoreIPs...)
+	port := "ssh"
+	if config.Port != 0 {
+		port = strconv.Itoa(config.Port)
+	}
+
+	return fmt.Sprintf(`[DEFAULT]
+bantime = %d
+findtime = %d
+maxretry = %d
+ignoreip = %s
+
+[sshd]
+enabled = true
+port = %s
+logpath = /var/log/auth.log
+backend = systemd`, config.BanTime, config.FindTime, config.MaxRetry, strings.Join(ignore, " "), port)
+}
+
+// detectDeployerIP returns the address this client connects from, as seen by
+// the server, which is the address fail2ban would ban
+func (s *SecurityManager) detectDeployerIP() (string, error) {
+	result, err := s.manager.client.Execute("echo $SSH_CLIENT", WithTimeout(5*time.Second))
+	if err != nil {
+		return "", err
+	}
+
+	fields := strings.Fields(result.Stdout)
+	if len(fields) == 0 {
+		return "", &Error{
+			Type:    ErrorNotFound,
+			Message: "SSH_CLIENT is not set on the server",
+		}
+	}
+	return fields[0], nil
+}
+
+var fail2banJailListRegex = regexp.MustCompile(`Jail list:\s*(.*)`)
+
+// verifyFail2banJail confirms fail2ban is running and the given jail loaded.
+// fail2ban takes a moment to open its socket after a restart, so the status
+// check is tried up to attempts times before giving up.
+func (s *SecurityManager) verifyFail2banJail(jail string, attempts int) ([]string, error) {
+	var jails []string
+	var lastErr string
+
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(2 * time.Second)
+		}
+
+		result, err := s.manager.client.ExecuteSudo("fail2ban-client status")
+		if err != nil {
+			return nil, err
+		}
+		if result.ExitCode != 0 {
+			lastErr = strings.TrimSpace(result.Stderr)
+			continue
+		}
+
+		jails = nil
+		if match := fail2banJailListRegex.FindStringSubmatch(result.Stdout); match != nil {
+			for _, name := range strings.Split(match[1], ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					jails = append(jails, name)
+				}
+			}
+		}
+
+		if !slices.Contains(jails, jail) {
+			lastErr = fmt.Sprintf("jail %s not in jail list", jail)
+			continue
+		}
+
+		result, err = s.manager.client.ExecuteSudo(fmt.Sprintf("fail2ban-client status %s", jail))
+		if err != nil {
+			return nil, err
+		}
+		if result.ExitCode == 0 {
+			return jails, nil
+		}
+		lastErr = strings.TrimSpace(result.Stderr)
+	}
+
+	logTail, _ := s.manager.client.ExecuteSudo(
+		"tail -n 20 /var/log/fail2ban.log 2>/dev/null || journalctl -u fail2ban -n 20 --no-pager")
+	message := fmt.Sprintf("fail2ban %s jail is not active: %s", jail, lastErr)
+	if logTail != nil && strings.TrimSpace(logTail.Stdout) != "" {
+		message += "\n" + strings.TrimSpace(logTail.Stdout)
+	}
+
+	return nil, &Error{
+		Type:    ErrorVerification,
+		Message: message,
+	}
+}
+
 func (s *SecurityManager) GetDefaultPocketBaseRules() []FirewallRule {
 	return []FirewallRule{
 		{Port: 22, Protocol: "tcp", Action: "allow", Description: "SSH"},
@@ -319,11 +955,39 @@ func (s *SecurityManager) GetDefaultSSHConfig() SSHConfig {
 	}
 }
 
+func (s *SecurityManager) GetDefaultFail2banConfig() Fail2banConfig {
+	return Fail2banConfig{
+		BanTime:          3600,
+		FindTime:         600,
+		MaxRetry:         5,
+		IgnoreDeployerIP: true,
+	}
+}
+
 type SecurityConfig struct {
 	FirewallRules  []FirewallRule
 	HardenSSH      bool
 	SSHConfig      SSHConfig
 	EnableFail2ban bool
+	Fail2banConfig Fail2banConfig
+	// Idempotent applies only the firewall rules that differ from the current
+	// state instead of resetting the firewall
+	Idempotent bool
+	// AutoInstallFirewall installs PreferredFirewall (default ufw) when the
+	// server has no supported firewall, instead of failing
+	AutoInstallFirewall bool
+	PreferredFirewall   string
+	// VerifyUser is the user the final self-test logs in as, normally the
+	// app user; empty uses the connected user. SkipVerify disables the test.
+	VerifyUser string
+	SkipVerify bool
+	// SSHPort is the port sshd listens on. Firewall rules get an allow rule
+	// for it if they lack one; 0 uses the port of the current connection.
+	SSHPort int
+	// AutomaticUpdates enables unattended security updates, mailing results
+	// to AutomaticUpdatesEmail if set. Unsupported distributions are skipped.
+	AutomaticUpdates      bool
+	AutomaticUpdatesEmail string
 }
 
 func boolToYesNo(b bool) string {
@@ -333,6 +997,10 @@ func boolToYesNo(b bool) string {
 	return "no"
 }
 
+func yesNoToBool(s string) bool {
+	return strings.EqualFold(strings.TrimSpace(s), "yes")
+}
+
 // Close performs cleanup and closes the security manager
 func (s *SecurityManager) Close() error {
 	s.mu.Lock()
@@ -345,6 +1013,10 @@ func (s *SecurityManager) Close() error {
 
 	s.logger.SystemOperation("Shutting down security manager")
 
+	if s.progress != nil {
+		s.progress.close()
+	}
+
 	// Run all cleanup functions in reverse order
 	for i := len(s.cleanup) - 1; i >= 0; i-- {
 		if s.cleanup[i] != nil {
@@ -0,0 +1,189 @@
+package tunnel
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateSecurityConfigDefaults(t *testing.T) {
+	s := &SecurityManager{}
+	config := SecurityConfig{
+		FirewallRules:  s.GetDefaultPocketBaseRules(),
+		HardenSSH:      true,
+		SSHConfig:      s.GetDefaultSSHConfig(),
+		EnableFail2ban: true,
+		Fail2banConfig: s.GetDefaultFail2banConfig(),
+	}
+	if err := ValidateSecurityConfig(config); err != nil {
+		t.Errorf("Expected default configuration to be valid, got %v", err)
+	}
+}
+
+func TestValidateSecurityConfigLockoutRisks(t *testing.T) {
+	tests := []struct {
+		name   string
+		config SecurityConfig
+		want   string
+	}{
+		{
+			name: "no SSH firewall rule",
+			config: SecurityConfig{
+				FirewallRules: []FirewallRule{{Port: 80, Protocol: "tcp", Action: "allow"}},
+			},
+			want: "do not allow SSH",
+		},
+		{
+			name: "all auth methods disabled",
+			config: SecurityConfig{
+				HardenSSH: true,
+				SSHConfig: SSHConfig{PasswordAuth: false, PubkeyAuth: false},
+			},
+			want: "disables both password and public key",
+		},
+		{
+			name: "only root allowed with root login disabled",
+			config: SecurityConfig{
+				HardenSSH: true,
+				SSHConfig: SSHConfig{PubkeyAuth: true, AllowUsers: []string{"root"}},
+			},
+			want: "must include a non-root user",
+		},
+		{
+			name: "allowed user also denied",
+			config: SecurityConfig{
+				HardenSSH: true,
+				SSHConfig: SSHConfig{PubkeyAuth: true, AllowUsers: []string{"deploy"}, DenyUsers: []string{"deploy"}},
+			},
+			want: "every AllowUsers entry is denied",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSecurityConfig(tt.config)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestValidateSecurityConfigReportsAllProblems(t *testing.T) {
+	err := ValidateSecurityConfig(SecurityConfig{
+		FirewallRules: []FirewallRule{{Port: 443, Protocol: "tcp", Action: "allow"}},
+		HardenSSH:     true,
+	})
+	if err == nil || strings.Count(err.Error(), "\n") != 1 {
+		t.Errorf("Expected two problems, got %v", err)
+	}
+}
+
+func TestAllowsPortRange(t *testing.T) {
+	rules := []FirewallRule{{Port: 20, PortEnd: 25, Protocol: "tcp", Action: "allow"}}
+	if !allowsPort(rules, 22) {
+		t.Error("Expected port range to cover 22")
+	}
+	if allowsPort([]FirewallRule{{Port: 22, Protocol: "udp", Action: "allow"}}, 22) {
+		t.Error("Expected udp rule not to allow SSH")
+	}
+}
+
+func TestEnsureSSHAllowedAddsDetectedPort(t *testing.T) {
+	client := &scriptedClient{results: []*Result{{Stdout: "203.0.113.7 51234 2222\n"}}}
+	security := NewSecurityManager(NewManager(client))
+
+	rules := security.ensureSSHAllowed([]FirewallRule{{Port: 22, Protocol: "tcp", Action: "allow"}}, 0)
+	if len(rules) != 2 || rules[1].Port != 2222 || rules[1].Protocol != "tcp" || rules[1].Action != "allow" {
+		t.Errorf("Expected an allow rule for 2222/tcp to be added, got %+v", rules)
+	}
+}
+
+func TestEnsureSSHAllowedKeepsExistingRule(t *testing.T) {
+	client := &scriptedClient{}
+	security := NewSecurityManager(NewManager(client))
+
+	rules := []FirewallRule{{Port: 2222, Protocol: "tcp", Action: "allow"}}
+	if got := security.ensureSSHAllowed(rules, 2222); len(got) != 1 {
+		t.Errorf("Expected rules unchanged, got %+v", got)
+	}
+	if len(client.commands) != 0 {
+		t.Errorf("Expected no port detection when the port is given, got %q", client.commands)
+	}
+}
+
+func TestVerifyLockdownFailsForRootWhenRootLoginDisabled(t *testing.T) {
+	client := &scriptedClient{}
+	security := NewSecurityManager(NewManager(client))
+
+	err := security.verifyLockdown(SecurityConfig{HardenSSH: true, VerifyUser: "root"})
+	if err == nil || !strings.Contains(err.Error(), "VerifyUser") {
+		t.Errorf("Expected an unverifiable root login to fail, got %v", err)
+	}
+	if len(client.commands) != 0 {
+		t.Errorf("Expected no commands, got %q", client.commands)
+	}
+}
+
+func TestSecureServerRejectsUnverifiableRootBeforeChanges(t *testing.T) {
+	client := &scriptedClient{}
+	security := NewSecurityManager(NewManager(client))
+
+	err := security.SecureServer(SecurityConfig{
+		HardenSSH:  true,
+		SSHConfig:  SSHConfig{PubkeyAuth: true},
+		VerifyUser: "root",
+	})
+	if err == nil || !strings.Contains(err.Error(), "root login is disabled") {
+		t.Fatalf("Expected SecureServer to refuse, got %v", err)
+	}
+	if len(client.commands) != 0 {
+		t.Errorf("Expected no changes to the server, got %q", client.commands)
+	}
+}
+
+func TestVerifyLockdownRollsBackOnFailure(t *testing.T) {
+	client := &scriptedClient{}
+	security := NewSecurityManager(NewManager(client))
+
+	// A scripted client cannot open a second connection, so the login fails
+	err := security.verifyLockdown(SecurityConfig{HardenSSH: true, VerifyUser: "pocketbase"})
+	if err == nil || !strings.Contains(err.Error(), "rolled back") {
+		t.Fatalf("Expected rollback error, got %v", err)
+	}
+	if !strings.Contains(strings.Join(client.commands, "\n"), "cp "+SSHDConfigBackupPath+" "+SSHDConfigPath) {
+		t.Errorf("Expected sshd_config to be restored, got %q", client.commands)
+	}
+}
+
+func TestVerifyLockdownWithoutSSHHardening(t *testing.T) {
+	client := &scriptedClient{}
+	security := NewSecurityManager(NewManager(client))
+
+	err := security.verifyLockdown(SecurityConfig{VerifyUser: "pocketbase"})
+	if err == nil || strings.Contains(err.Error(), "rolled back") {
+		t.Errorf("Expected failure without rollback, got %v", err)
+	}
+	if len(client.commands) != 0 {
+		t.Errorf("Expected no rollback commands, got %q", client.commands)
+	}
+
+	if err := security.verifyLockdown(SecurityConfig{SkipVerify: true}); err != nil {
+		t.Errorf("Expected SkipVerify to skip the self-test, got %v", err)
+	}
+}
+
+func TestHardenSSHWritesConfigUnderSudo(t *testing.T) {
+	client := &scriptedClient{}
+	security := NewSecurityManager(NewManager(client))
+
+	config := SSHConfig{PubkeyAuth: true}
+	if err := security.HardenSSH(config); err != nil {
+		t.Fatalf("HardenSSH failed: %v", err)
+	}
+
+	want := "sudo " + writeFileCommand(SSHDConfigPath, mergeSSHDConfig("", sshdDirectives(config)))
+	if !slices.Contains(client.commands, want) {
+		t.Errorf("Expected sshd_config written with %q, got %q", want, client.commands)
+	}
+}
@@ -20,7 +20,7 @@ type SetupManager struct {
 func NewSetupManager(manager *Manager) *SetupManager {
 	return &SetupManager{
 		manager: manager,
-		logger:  logger.GetTunnelLogger(),
+		logger:  manager.logger,
 	}
 }
 
@@ -97,32 +97,25 @@ func (s *SetupManager) CreatePocketBaseDirectories(username string) error {
 func (s *SetupManager) UpdateSystem() error {
 	s.logger.SystemOperation("Updating system packages")
 
-	result, err := s.manager.client.Execute("which apt", WithTimeout(5*time.Second))
-	if err == nil && result.ExitCode == 0 {
+	var cmd string
+	switch {
+	case s.manager.HasCommand("apt"):
 		// Debian/Ubuntu
-		cmd := "apt update && apt upgrade -y && apt autoremove -y"
-		result, err = s.manager.client.ExecuteSudo(cmd, WithTimeout(15*time.Minute))
-	} else {
-		result, err = s.manager.client.Execute("which yum", WithTimeout(5*time.Second))
-		if err == nil && result.ExitCode == 0 {
-			// RHEL/CentOS
-			cmd := "yum update -y"
-			result, err = s.manager.client.ExecuteSudo(cmd, WithTimeout(15*time.Minute))
-		} else {
-			result, err = s.manager.client.Execute("which dnf", WithTimeout(5*time.Second))
-			if err == nil && result.ExitCode == 0 {
-				// Fedora
-				cmd := "dnf update -y"
-				result, err = s.manager.client.ExecuteSudo(cmd, WithTimeout(15*time.Minute))
-			} else {
-				return &Error{
-					Type:    ErrorNotFound,
-					Message: "no supported package manager found",
-				}
-			}
+		cmd = "apt update && apt upgrade -y && apt autoremove -y"
+	case s.manager.HasCommand("yum"):
+		// RHEL/CentOS
+		cmd = "yum update -y"
+	case s.manager.HasCommand("dnf"):
+		// Fedora
+		cmd = "dnf update -y"
+	default:
+		return &Error{
+			Type:    ErrorNotFound,
+			Message: "no supported package manager found",
 		}
 	}
 
+	result, err := s.manager.client.ExecuteSudo(cmd, WithTimeout(15*time.Minute))
 	if err != nil {
 		return err
 	}
@@ -189,7 +182,7 @@ func (s *SetupManager) VerifySetup(username string) error {
 
 	essentials := []string{"curl", "wget", "unzip", "setcap"}
 	for _, pkg := range essentials {
-		if result, err := s.manager.client.Execute(fmt.Sprintf("which %s", pkg)); err != nil || result.ExitCode != 0 {
+		if !s.manager.HasCommand(pkg) {
 			return &Error{
 				Type:    ErrorVerification,
 				Message: fmt.Sprintf("package %s is not installed", pkg),
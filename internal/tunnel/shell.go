@@ -0,0 +1,26 @@
+package tunnel
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+// shellQuote returns s as a single POSIX shell word. Everything inside single
+// quotes is literal, so only embedded single quotes need escaping.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// bashScript wraps a compound command so that all of it runs under a single
+// ExecuteSudo. Values inside script must already be quoted with shellQuote.
+func bashScript(script string) string {
+	return "bash -c " + shellQuote(script)
+}
+
+// writeFileCommand returns a command that replaces path with content when run
+// with ExecuteSudo. Base64 keeps quotes and special characters in content
+// intact, and bashScript keeps the redirect under sudo.
+func writeFileCommand(path, content string) string {
+	encoded := base64.StdEncoding.EncodeToString([]byte(content))
+	return bashScript("echo " + shellQuote(encoded) + " | base64 -d > " + shellQuote(path))
+}
@@ -0,0 +1,77 @@
+package tunnel
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	tests := []string{
+		"",
+		"/opt/pocketbase/apps/my app",
+		"it's",
+		`say "hi"`,
+		"$(touch /tmp/pwned)",
+		"`id`",
+		"a; rm -rf /",
+		"$HOME",
+		"line\nbreak",
+		"'",
+		`\'`,
+	}
+
+	for _, input := range tests {
+		out, err := exec.Command("sh", "-c", "printf %s "+shellQuote(input)).Output()
+		if err != nil {
+			t.Errorf("shellQuote(%q) produced an invalid command: %v", input, err)
+			continue
+		}
+		if string(out) != input {
+			t.Errorf("shellQuote(%q) expanded to %q", input, out)
+		}
+	}
+}
+
+func TestBashScriptPassesQuotedValuesThrough(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+
+	for _, input := range []string{"/opt/pocketbase/apps/my app", "it's", "$(touch /tmp/pwned)", "a; rm -rf /"} {
+		script := bashScript("printf %s " + shellQuote(input) + " && printf %s " + shellQuote(input))
+		out, err := exec.Command("sh", "-c", script).Output()
+		if err != nil {
+			t.Errorf("bashScript for %q produced an invalid command: %v", input, err)
+			continue
+		}
+		if string(out) != input+input {
+			t.Errorf("bashScript for %q expanded to %q", input, out)
+		}
+	}
+}
+
+func TestWriteFileCommand(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+
+	path := filepath.Join(t.TempDir(), "sshd config")
+	content := "Banner 'it''s'\nMatch User \"$(id)\"\n"
+	if out, err := exec.Command("sh", "-c", writeFileCommand(path, content)).CombinedOutput(); err != nil {
+		t.Fatalf("writeFileCommand produced an invalid command: %v: %s", err, out)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read written file: %v", err)
+	}
+	if string(got) != content {
+		t.Errorf("Expected %q written, got %q", content, got)
+	}
+}
@@ -0,0 +1,169 @@
+package tunnel
+
+import (
+	"strings"
+	"testing"
+)
+
+const testSSHDConfig = `Include /etc/ssh/sshd_config.d/*.conf
+
+Port 2222
+PermitRootLogin yes
+#PasswordAuthentication yes
+PasswordAuthentication yes
+PasswordAuthentication no
+Subsystem sftp internal-sftp
+
+Match Group sftponly
+    ChrootDirectory /srv/sftp/%u
+    ForceCommand internal-sftp
+    PasswordAuthentication yes
+    AllowTcpForwarding no
+`
+
+func TestMergeSSHDConfig_PreservesMatchBlock(t *testing.T) {
+	config := SSHConfig{
+		PasswordAuth:        false,
+		RootLogin:           false,
+		PubkeyAuth:          true,
+		MaxAuthTries:        3,
+		ClientAliveInterval: 300,
+		ClientAliveCountMax: 2,
+		AllowUsers:          []string{"pocketbase", "deploy"},
+	}
+
+	merged := mergeSSHDConfig(testSSHDConfig, sshdDirectives(config))
+
+	matchBlock := testSSHDConfig[strings.Index(testSSHDConfig, "Match Group sftponly"):]
+	if !strings.HasSuffix(merged, matchBlock) {
+		t.Errorf("Match block was not preserved at the end of the config:\n%s", merged)
+	}
+
+	for _, line := range []string{
+		"Include /etc/ssh/sshd_config.d/*.conf",
+		"Port 2222",
+		"Subsystem sftp internal-sftp",
+		"#PasswordAuthentication yes",
+		"PermitRootLogin no",
+		"PasswordAuthentication no",
+	} {
+		if !strings.Contains(merged, line+"\n") {
+			t.Errorf("expected line %q in merged config:\n%s", line, merged)
+		}
+	}
+
+	global := merged[:strings.Index(merged, "Match Group sftponly")]
+
+	if strings.Contains(global, "PermitRootLogin yes") {
+		t.Error("PermitRootLogin was not updated in place")
+	}
+	if n := strings.Count(global, "\nPasswordAuthentication "); n != 1 {
+		t.Errorf("expected a single global PasswordAuthentication directive, got %d", n)
+	}
+
+	// New directives must be global, so they go before the Match block
+	for _, line := range []string{
+		sshdManagedBegin,
+		"PubkeyAuthentication yes",
+		"MaxAuthTries 3",
+		"AllowUsers pocketbase deploy",
+		sshdManagedEnd,
+	} {
+		if !strings.Contains(global, line+"\n") {
+			t.Errorf("expected line %q before the Match block:\n%s", line, merged)
+		}
+	}
+}
+
+func TestMergeSSHDConfig_Idempotent(t *testing.T) {
+	config := SSHConfig{
+		PubkeyAuth:   true,
+		MaxAuthTries: 3,
+		AllowUsers:   []string{"pocketbase"},
+	}
+
+	once := mergeSSHDConfig(testSSHDConfig, sshdDirectives(config))
+	twice := mergeSSHDConfig(once, sshdDirectives(config))
+	if once != twice {
+		t.Errorf("merging twice changed the config:\n--- once ---\n%s\n--- twice ---\n%s", once, twice)
+	}
+
+	config.AllowUsers = []string{"deploy"}
+	updated := mergeSSHDConfig(once, sshdDirectives(config))
+	if strings.Contains(updated, "AllowUsers pocketbase") || !strings.Contains(updated, "AllowUsers deploy\n") {
+		t.Errorf("managed block was not replaced:\n%s", updated)
+	}
+	if strings.Count(updated, sshdManagedBegin) != 1 {
+		t.Errorf("expected a single managed block:\n%s", updated)
+	}
+}
+
+func TestSSHDKeyword(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{"", ""},
+		{"# PermitRootLogin no", ""},
+		{"PermitRootLogin no", "PermitRootLogin"},
+		{"MaxAuthTries\t3", "MaxAuthTries"},
+		{"MaxAuthTries=3", "MaxAuthTries"},
+		{"Match User deploy", "Match"},
+	}
+
+	for _, tt := range tests {
+		if got := sshdKeyword(tt.line); got != tt.expected {
+			t.Errorf("sshdKeyword(%q) = %q, want %q", tt.line, got, tt.expected)
+		}
+	}
+}
+
+func TestSSHDDirectives_Crypto(t *testing.T) {
+	config := SSHConfig{SSHCryptoConfig: StrongCryptoDefaults()}
+	config.MACs = nil
+
+	values := make(map[string]string)
+	for _, d := range sshdDirectives(config) {
+		values[d.Key] = d.Value
+	}
+
+	if got := values["KexAlgorithms"]; got != strings.Join(config.KexAlgorithms, ",") {
+		t.Errorf("KexAlgorithms = %q", got)
+	}
+	if got := values["Ciphers"]; !strings.HasPrefix(got, "chacha20-poly1305@openssh.com,") {
+		t.Errorf("Ciphers = %q", got)
+	}
+	if _, ok := values["MACs"]; ok {
+		t.Error("expected no MACs directive for an empty list")
+	}
+}
+
+func TestValidateSSHCrypto(t *testing.T) {
+	if err := validateSSHCrypto(StrongCryptoDefaults()); err != nil {
+		t.Fatalf("strong defaults rejected: %v", err)
+	}
+
+	bad := []SSHCryptoConfig{
+		{KexAlgorithms: []string{""}},
+		{Ciphers: []string{"aes256-ctr,aes128-ctr"}},
+		{MACs: []string{"hmac-sha2-256 "}},
+	}
+	for _, config := range bad {
+		if err := validateSSHCrypto(config); err == nil {
+			t.Errorf("expected %+v to be rejected", config)
+		}
+	}
+}
+
+func TestSSHDDirectives_Port(t *testing.T) {
+	merged := mergeSSHDConfig(testSSHDConfig, sshdDirectives(SSHConfig{Port: 2200}))
+
+	if strings.Contains(merged, "Port 2222") || strings.Count(merged, "Port 2200") != 1 {
+		t.Errorf("Expected the existing Port to be replaced:\n%s", merged)
+	}
+	for _, d := range sshdDirectives(SSHConfig{}) {
+		if d.Key == "Port" {
+			t.Error("expected no Port directive when Port is unset")
+		}
+	}
+}
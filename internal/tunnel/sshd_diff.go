@@ -0,0 +1,204 @@
+package tunnel
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 3
+
+// backupSSHConfig copies the live sshd_config to SSHDConfigBackupPath. The
+// copy is both the rollback target and the "before" side of DiffSSHConfig.
+func (s *SecurityManager) backupSSHConfig() error {
+	result, err := s.manager.client.ExecuteSudo(fmt.Sprintf("cp %s %s", SSHDConfigPath, SSHDConfigBackupPath))
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return &Error{
+			Type:    ErrorExecution,
+			Message: fmt.Sprintf("failed to back up SSH config: %s", result.Stderr),
+		}
+	}
+	return nil
+}
+
+// DiffSSHConfig compares the sshd_config backup taken by HardenSSH with the
+// live file, writes the unified diff to SSHDConfigDiffPath next to the
+// backup and returns it. The diff is empty when nothing changed.
+func (s *SecurityManager) DiffSSHConfig() (string, error) {
+	before, err := s.readRemoteFile(SSHDConfigBackupPath)
+	if err != nil {
+		return "", err
+	}
+	after, err := s.readRemoteFile(SSHDConfigPath)
+	if err != nil {
+		return "", err
+	}
+
+	diff := unifiedDiff(before, after, SSHDConfigBackupPath, SSHDConfigPath)
+
+	result, err := s.manager.client.ExecuteSudo(writeFileCommand(SSHDConfigDiffPath, diff))
+	if err != nil {
+		return "", err
+	}
+	if result.ExitCode != 0 {
+		return "", &Error{
+			Type:    ErrorExecution,
+			Message: fmt.Sprintf("failed to write SSH config diff: %s", result.Stderr),
+		}
+	}
+
+	return diff, nil
+}
+
+// recordSSHConfigDiff stores the diff of a hardening run. Failing to record
+// it does not fail the hardening.
+func (s *SecurityManager) recordSSHConfigDiff() {
+	diff, err := s.DiffSSHConfig()
+	if err != nil {
+		s.logger.Warning("Could not record sshd_config diff: %v", err)
+		return
+	}
+	if diff == "" {
+		s.logger.Info("sshd_config unchanged by hardening")
+		return
+	}
+	s.logger.Info("sshd_config changes saved to %s", SSHDConfigDiffPath)
+}
+
+func (s *SecurityManager) readRemoteFile(path string) (string, error) {
+	result, err := s.manager.client.ExecuteSudo("cat " + shellQuote(path))
+	if err != nil {
+		return "", err
+	}
+	if result.ExitCode != 0 {
+		return "", &Error{
+			Type:    ErrorExecution,
+			Message: fmt.Sprintf("failed to read %s: %s", path, result.Stderr),
+		}
+	}
+	return result.Stdout, nil
+}
+
+// diffLine is one line of a line diff: ' ' unchanged, '-' removed, '+' added
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// unifiedDiff returns the differences between two texts in unified diff
+// format, or "" if they are equal
+func unifiedDiff(a, b, fromName, toName string) string {
+	lines := diffLines(splitLines(a), splitLines(b))
+
+	var changes []int
+	for i, line := range lines {
+		if line.op != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	// aPos[i] and bPos[i] count the lines of each side before lines[i]
+	aPos := make([]int, len(lines)+1)
+	bPos := make([]int, len(lines)+1)
+	for i, line := range lines {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if line.op != '+' {
+			aPos[i+1]++
+		}
+		if line.op != '-' {
+			bPos[i+1]++
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+
+	for i := 0; i < len(changes); {
+		start := max(changes[i]-diffContext, 0)
+		end := min(changes[i]+diffContext+1, len(lines))
+		i++
+		for i < len(changes) && changes[i]-diffContext <= end {
+			end = min(changes[i]+diffContext+1, len(lines))
+			i++
+		}
+
+		aLen, bLen := aPos[end]-aPos[start], bPos[end]-bPos[start]
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aPos[start], aLen), hunkRange(bPos[start], bLen))
+		for _, line := range lines[start:end] {
+			out.WriteByte(line.op)
+			out.WriteString(line.text)
+			out.WriteByte('\n')
+		}
+	}
+
+	return out.String()
+}
+
+// hunkRange formats a hunk's line range. An empty range names the line
+// before it, as diff -u does.
+func hunkRange(before, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", before+1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, length)
+}
+
+// diffLines returns a shortest edit script between a and b from their
+// longest common subsequence. sshd_config is small enough for the
+// quadratic table.
+func diffLines(a, b []string) []diffLine {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, diffLine{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, diffLine{'+', b[j]})
+	}
+	return lines
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
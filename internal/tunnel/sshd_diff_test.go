@@ -0,0 +1,88 @@
+package tunnel
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	before := "Include /etc/ssh/sshd_config.d/*.conf\n" +
+		"Port 22\n" +
+		"#PermitRootLogin prohibit-password\n" +
+		"PasswordAuthentication yes\n" +
+		"UsePAM yes\n" +
+		"X11Forwarding yes\n" +
+		"PrintMotd no\n" +
+		"AcceptEnv LANG LC_*\n" +
+		"Subsystem sftp /usr/lib/openssh/sftp-server\n"
+	after := strings.Replace(before, "PasswordAuthentication yes", "PasswordAuthentication no", 1) +
+		"MaxAuthTries 3\n"
+
+	want := "--- /etc/ssh/sshd_config.bak\n" +
+		"+++ /etc/ssh/sshd_config\n" +
+		"@@ -1,9 +1,10 @@\n" +
+		" Include /etc/ssh/sshd_config.d/*.conf\n" +
+		" Port 22\n" +
+		" #PermitRootLogin prohibit-password\n" +
+		"-PasswordAuthentication yes\n" +
+		"+PasswordAuthentication no\n" +
+		" UsePAM yes\n" +
+		" X11Forwarding yes\n" +
+		" PrintMotd no\n" +
+		" AcceptEnv LANG LC_*\n" +
+		" Subsystem sftp /usr/lib/openssh/sftp-server\n" +
+		"+MaxAuthTries 3\n"
+
+	if got := unifiedDiff(before, after, SSHDConfigBackupPath, SSHDConfigPath); got != want {
+		t.Errorf("unifiedDiff() =\n%s\nwant\n%s", got, want)
+	}
+
+	if got := unifiedDiff(before, before, "a", "b"); got != "" {
+		t.Errorf("Expected no diff for equal files, got %q", got)
+	}
+}
+
+func TestUnifiedDiffSeparateHunks(t *testing.T) {
+	var lines []string
+	for i := range 20 {
+		lines = append(lines, strings.Repeat("x", i+1))
+	}
+	before := strings.Join(lines, "\n") + "\n"
+	lines[1] = "changed"
+	lines[18] = "changed"
+	after := strings.Join(lines, "\n") + "\n"
+
+	diff := unifiedDiff(before, after, "a", "b")
+	if !strings.Contains(diff, "@@ -1,5 +1,5 @@\n") || !strings.Contains(diff, "@@ -16,5 +16,5 @@\n") {
+		t.Errorf("Expected two hunks, got\n%s", diff)
+	}
+}
+
+func TestDiffSSHConfigWritesDiffNextToBackup(t *testing.T) {
+	client := &scriptedClient{results: []*Result{
+		{Stdout: "PasswordAuthentication yes\n"},
+		{Stdout: "PasswordAuthentication no\n"},
+	}}
+	security := NewSecurityManager(NewManager(client))
+
+	diff, err := security.DiffSSHConfig()
+	if err != nil {
+		t.Fatalf("DiffSSHConfig failed: %v", err)
+	}
+	if !strings.Contains(diff, "-PasswordAuthentication yes\n+PasswordAuthentication no\n") {
+		t.Errorf("Unexpected diff:\n%s", diff)
+	}
+
+	if len(client.commands) != 3 {
+		t.Fatalf("Expected read, read, write; got %q", client.commands)
+	}
+	if client.commands[0] != "sudo cat '"+SSHDConfigBackupPath+"'" || client.commands[1] != "sudo cat '"+SSHDConfigPath+"'" {
+		t.Errorf("Expected the backup and the live file to be read, got %q", client.commands[:2])
+	}
+	encoded := base64.StdEncoding.EncodeToString([]byte(diff))
+	want := `sudo bash -c 'echo '\''` + encoded + `'\'' | base64 -d > '\''` + SSHDConfigDiffPath + `'\'''`
+	if client.commands[2] != want {
+		t.Errorf("Expected diff written to %s, got %q", SSHDConfigDiffPath, client.commands[2])
+	}
+}
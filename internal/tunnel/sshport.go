@@ -0,0 +1,143 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// plannedSSHPortMove returns the port sshd listens on now and the port
+// SSHConfig.Port moves it to. to is 0 when the port does not change.
+func (s *SecurityManager) plannedSSHPortMove(config SecurityConfig) (from, to int) {
+	if !config.HardenSSH || config.SSHConfig.Port == 0 {
+		return config.SSHPort, 0
+	}
+
+	from = config.SSHPort
+	if from == 0 {
+		detected, err := s.activeSSHPort()
+		if err != nil {
+			s.logger.Warning("Could not detect SSH port, assuming %d: %v", defaultSSHPort, err)
+			detected = defaultSSHPort
+		}
+		from = detected
+	}
+	if from == config.SSHConfig.Port {
+		return from, 0
+	}
+	return from, config.SSHConfig.Port
+}
+
+// withSSHPortMove prepares a SecurityConfig for moving sshd from one port to
+// another: the firewall opens both ports until the new one is verified, and
+// the fail2ban sshd jail watches the new port.
+func withSSHPortMove(config SecurityConfig, from, to int) SecurityConfig {
+	config.SSHPort = from
+	if len(config.FirewallRules) > 0 && !allowsPort(config.FirewallRules, to) {
+		config.FirewallRules = append(slices.Clone(config.FirewallRules), FirewallRule{
+			Port:        to,
+			Protocol:    "tcp",
+			Action:      "allow",
+			Description: "SSH",
+		})
+	}
+	if config.Fail2banConfig.Port == 0 {
+		config.Fail2banConfig.Port = to
+	}
+	return config
+}
+
+// closeOldSSHPort removes the allow rules for the port sshd moved away from.
+// A fresh login over the new port must succeed first; when it fails or
+// cannot be attempted the old port is left open and an error returned.
+func (s *SecurityManager) closeOldSSHPort(config SecurityConfig, from int) error {
+	if !s.IsDryRun() {
+		user, err := s.verifyLoginUser(config)
+		if err != nil {
+			return &Error{
+				Type:    ErrorVerification,
+				Message: fmt.Sprintf("cannot confirm SSH port %d, leaving port %d open", config.SSHConfig.Port, from),
+				Cause:   err,
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := s.verifySSHAccessAs(ctx, user); err != nil {
+			return &Error{
+				Type:    ErrorVerification,
+				Message: fmt.Sprintf("SSH port %d is not reachable, leaving port %d open", config.SSHConfig.Port, from),
+				Cause:   err,
+			}
+		}
+	}
+
+	var rules []FirewallRule
+	for _, rule := range config.FirewallRules {
+		if rule.Action == "allow" && rule.Protocol == "tcp" && rule.Port == from && max(rule.PortEnd, rule.Port) == from {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	s.logger.SystemOperation(fmt.Sprintf("Closing previous SSH port %d", from))
+	firewall, err := s.requireFirewall()
+	if err != nil {
+		return err
+	}
+
+	var cmds []string
+	switch firewall {
+	case "ufw":
+		for _, rule := range rules {
+			cmds = append(cmds, "ufw delete "+ufwRuleArgs(rule))
+		}
+	case "firewalld":
+		for _, rule := range rules {
+			if rule.Source != "" {
+				cmds = append(cmds, fmt.Sprintf("firewall-cmd --permanent --remove-rich-rule='%s'", firewalldRichRule(rule)))
+			} else {
+				cmds = append(cmds, fmt.Sprintf("firewall-cmd --permanent --remove-port=%d/tcp", from))
+			}
+		}
+		// The default zone opens 22 through the ssh service rather than a port
+		if from == defaultSSHPort {
+			cmds = append(cmds, "firewall-cmd --permanent --remove-service=ssh")
+		}
+		cmds = append(cmds, "firewall-cmd --reload")
+	default:
+		for _, binary := range iptablesBinaries(rules) {
+			for _, rule := range iptablesRulesFor(binary, rules) {
+				cmds = append(cmds, binary+" -D INPUT "+iptablesRuleSpec(rule))
+			}
+			cmds = append(cmds, iptablesSaveCommand(binary))
+		}
+	}
+
+	for _, cmd := range cmds {
+		result, err := s.manager.client.ExecuteSudo(cmd)
+		if err != nil {
+			return err
+		}
+		// Removing a rule that is already gone is not a failure
+		if result.ExitCode != 0 {
+			s.logger.Warning("Firewall command %q failed: %s", cmd, result.Stderr)
+		}
+	}
+
+	s.logger.Success("SSH port %d closed, sshd now listens on %d", from, config.SSHConfig.Port)
+	return nil
+}
+
+// reloadSSHSocket regenerates the listening socket where sshd is socket
+// activated (Ubuntu 22.10 and later), which otherwise ignores Port
+func (s *SecurityManager) reloadSSHSocket() {
+	if !s.manager.ServiceActive("ssh.socket") {
+		return
+	}
+	s.manager.client.ExecuteSudo("systemctl daemon-reload")
+	s.manager.client.ExecuteSudo("systemctl restart ssh.socket")
+}
@@ -0,0 +1,103 @@
+package tunnel
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPlannedSSHPortMove(t *testing.T) {
+	security := NewSecurityManager(NewManager(&scriptedClient{}))
+
+	tests := []struct {
+		name     string
+		config   SecurityConfig
+		from, to int
+	}{
+		{"no port set", SecurityConfig{HardenSSH: true, SSHPort: 22}, 22, 0},
+		{"same port", SecurityConfig{HardenSSH: true, SSHPort: 2222, SSHConfig: SSHConfig{Port: 2222}}, 2222, 0},
+		{"not hardening", SecurityConfig{SSHPort: 22, SSHConfig: SSHConfig{Port: 2222}}, 22, 0},
+		{"move", SecurityConfig{HardenSSH: true, SSHPort: 22, SSHConfig: SSHConfig{Port: 2222}}, 22, 2222},
+	}
+
+	for _, tt := range tests {
+		from, to := security.plannedSSHPortMove(tt.config)
+		if from != tt.from || to != tt.to {
+			t.Errorf("%s: got %d -> %d, want %d -> %d", tt.name, from, to, tt.from, tt.to)
+		}
+	}
+}
+
+func TestWithSSHPortMoveOpensBothPorts(t *testing.T) {
+	config := withSSHPortMove(SecurityConfig{
+		FirewallRules: []FirewallRule{{Port: 22, Protocol: "tcp", Action: "allow"}},
+		SSHConfig:     SSHConfig{Port: 2222},
+	}, 22, 2222)
+
+	if !allowsPort(config.FirewallRules, 22) || !allowsPort(config.FirewallRules, 2222) {
+		t.Errorf("Expected both SSH ports to be allowed, got %+v", config.FirewallRules)
+	}
+	if config.Fail2banConfig.Port != 2222 {
+		t.Errorf("Expected the sshd jail to watch port 2222, got %d", config.Fail2banConfig.Port)
+	}
+	if config.SSHPort != 22 {
+		t.Errorf("Expected SSHPort to stay on the current port, got %d", config.SSHPort)
+	}
+}
+
+func TestCloseOldSSHPortRemovesOnlyOldRule(t *testing.T) {
+	client := &scriptedClient{results: []*Result{
+		{ExitCode: 0}, // which ufw
+	}}
+	security := NewSecurityManager(NewManager(client), WithDryRun())
+
+	config := SecurityConfig{
+		FirewallRules: []FirewallRule{
+			{Port: 22, Protocol: "tcp", Action: "allow"},
+			{Port: 80, Protocol: "tcp", Action: "allow"},
+			{Port: 2222, Protocol: "tcp", Action: "allow"},
+		},
+		SSHConfig: SSHConfig{Port: 2222},
+	}
+	if err := security.closeOldSSHPort(config, 22); err != nil {
+		t.Fatalf("closeOldSSHPort failed: %v", err)
+	}
+
+	want := []string{"sudo ufw delete allow 22/tcp"}
+	if got := security.DryRunCommands(); !slices.Equal(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestCloseOldSSHPortFailsWhenRootCannotVerify(t *testing.T) {
+	client := &scriptedClient{}
+	security := NewSecurityManager(NewManager(client))
+
+	config := SecurityConfig{
+		FirewallRules: []FirewallRule{
+			{Port: 22, Protocol: "tcp", Action: "allow"},
+			{Port: 2222, Protocol: "tcp", Action: "allow"},
+		},
+		HardenSSH:  true,
+		SSHConfig:  SSHConfig{Port: 2222},
+		VerifyUser: "root",
+	}
+	err := security.closeOldSSHPort(config, 22)
+	if err == nil || !strings.Contains(err.Error(), "leaving port 22 open") {
+		t.Fatalf("Expected the old port to be kept with an error, got %v", err)
+	}
+	if len(client.commands) != 0 {
+		t.Errorf("Expected no firewall changes, got %q", client.commands)
+	}
+}
+
+func TestFail2banJailWatchesSSHPort(t *testing.T) {
+	security := NewSecurityManager(NewManager(&scriptedClient{}))
+
+	if jail := security.buildFail2banJailConfig(Fail2banConfig{}, nil); !strings.Contains(jail, "port = ssh\n") {
+		t.Errorf("Expected the default ssh port, got:\n%s", jail)
+	}
+	if jail := security.buildFail2banJailConfig(Fail2banConfig{Port: 2222}, nil); !strings.Contains(jail, "port = 2222\n") {
+		t.Errorf("Expected port 2222, got:\n%s", jail)
+	}
+}
@@ -0,0 +1,125 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// tailBuffer is how many lines may wait for a slow reader before the remote
+// output is left unread
+const tailBuffer = 64
+
+// TailRemoteFile streams the last lines of a remote file, and with follow
+// every line appended afterwards, until ctx is cancelled. The channel is
+// closed when the remote tail exits or ctx is done.
+//
+// The command runs on a pseudo-terminal so closing the session hangs it up
+// even on servers that ignore SSH signal requests; a "tail -F" left behind
+// would otherwise run until it next fails to write.
+func (c *Client) TailRemoteFile(ctx context.Context, path string, lines int, follow bool) (<-chan string, error) {
+	if c.conn == nil {
+		return nil, &Error{
+			Type:    ErrorConnection,
+			Message: "not connected",
+		}
+	}
+	if lines <= 0 {
+		lines = 10
+	}
+
+	cmd := fmt.Sprintf("tail -n %d", lines)
+	if follow {
+		cmd += " -F"
+	}
+	cmd += " " + shellQuote(path)
+
+	c.tracer.OnExecute(cmd)
+	c.logger.SSHCommand(cmd)
+
+	session, err := c.conn.NewSession()
+	if err != nil {
+		c.tracer.OnError("create_session", err)
+		return nil, &Error{
+			Type:    ErrorExecution,
+			Message: "failed to create session",
+			Cause:   err,
+		}
+	}
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          0,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	if err := session.RequestPty("dumb", 40, 500, modes); err != nil {
+		session.Close()
+		return nil, &Error{
+			Type:    ErrorExecution,
+			Message: "failed to request pseudo-terminal",
+			Cause:   err,
+		}
+	}
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, &Error{
+			Type:    ErrorExecution,
+			Message: "failed to create stdout pipe",
+			Cause:   err,
+		}
+	}
+
+	if err := session.Start(cmd); err != nil {
+		session.Close()
+		c.tracer.OnError("start_command", err)
+		return nil, &Error{
+			Type:    ErrorExecution,
+			Message: "failed to start command",
+			Cause:   err,
+		}
+	}
+
+	out := make(chan string, tailBuffer)
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.Signal(ssh.SIGTERM)
+		case <-done:
+		}
+		session.Close()
+	}()
+
+	go func() {
+		defer close(out)
+		defer close(done)
+
+		scanLines(ctx, stdout, out)
+		if err := session.Wait(); err != nil && ctx.Err() == nil {
+			c.logger.Debug("Tail of %s ended: %v", path, err)
+		}
+	}()
+
+	return out, nil
+}
+
+// scanLines sends each line of r to out until r ends or ctx is done. The
+// carriage returns a pseudo-terminal adds are removed.
+func scanLines(ctx context.Context, r io.Reader, out chan<- string) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		select {
+		case out <- strings.TrimRight(scanner.Text(), "\r"):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package tunnel
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScanLinesStripsCarriageReturns(t *testing.T) {
+	out := make(chan string, 4)
+	scanLines(context.Background(), strings.NewReader("first\r\nsecond\r\n"), out)
+	close(out)
+
+	var got []string
+	for line := range out {
+		got = append(got, line)
+	}
+	if len(got) != 2 || got[0] != "first" || got[1] != "second" {
+		t.Errorf("Unexpected lines %q", got)
+	}
+}
+
+func TestScanLinesStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	out := make(chan string)
+	done := make(chan struct{})
+	go func() {
+		scanLines(ctx, strings.NewReader("blocked\n"), out)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected scanLines to return when nobody reads after cancel")
+	}
+}
@@ -1,6 +1,7 @@
 package tunnel
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -27,6 +28,9 @@ type Config struct {
 	Timeout        time.Duration
 	RetryCount     int
 	RetryDelay     time.Duration
+	// LogFields are attached to every log line of the client and of the
+	// managers built on it, e.g. a request_id correlating one API call
+	LogFields map[string]any
 }
 
 type Result struct {
@@ -47,13 +51,27 @@ type ServiceStatus struct {
 }
 
 type FirewallRule struct {
-	Port        int
+	Port int
+	// PortEnd, when set, opens the inclusive range Port-PortEnd
+	PortEnd     int
 	Protocol    string
 	Source      string
 	Action      string
 	Description string
 }
 
+type Fail2banConfig struct {
+	BanTime  int
+	FindTime int
+	MaxRetry int
+	// IgnoreIPs are never banned, in addition to localhost
+	IgnoreIPs []string
+	// IgnoreDeployerIP adds the address this client connects from to IgnoreIPs
+	IgnoreDeployerIP bool
+	// Port is the sshd port watched by the sshd jail; 0 uses the ssh service port
+	Port int
+}
+
 type SSHConfig struct {
 	PasswordAuth        bool
 	RootLogin           bool
@@ -65,6 +83,22 @@ type SSHConfig struct {
 	AllowGroups         []string
 	DenyUsers           []string
 	DenyGroups          []string
+	// Port moves sshd to a new port when non-zero. SecureServer opens it in
+	// the firewall first and closes the old port once a login over it works.
+	Port int
+	// AutoRollback verifies a fresh login after restarting sshd and restores
+	// the previous configuration if it fails within VerifyTimeout
+	AutoRollback  bool
+	VerifyTimeout time.Duration
+	// Algorithm lists left empty keep the sshd defaults
+	SSHCryptoConfig
+}
+
+// SSHCryptoConfig pins the algorithms sshd offers
+type SSHCryptoConfig struct {
+	KexAlgorithms []string
+	Ciphers       []string
+	MACs          []string
 }
 
 type AppConfig struct {
@@ -110,6 +144,23 @@ func (e *Error) Unwrap() error {
 	return e.Cause
 }
 
+// Is makes every ErrorTimeout match ErrTimeout, including command and
+// transfer timeouts that have no underlying network error
+func (e *Error) Is(target error) bool {
+	return target == ErrTimeout && e.Type == ErrorTimeout
+}
+
+// Connection failures are classified into these errors at the SSH boundary,
+// so callers can use errors.Is instead of matching error text
+var (
+	ErrConnectionRefused = errors.New("connection refused")
+	ErrAuthFailed        = errors.New("authentication failed")
+	ErrHostKeyUnknown    = errors.New("host key unknown")
+	ErrHostKeyMismatch   = errors.New("host key mismatch")
+	ErrTimeout           = errors.New("timed out")
+	ErrUnsupported       = errors.New("not supported on this server")
+)
+
 type Command struct {
 	Cmd  string
 	Opts []ExecOption
@@ -210,9 +261,11 @@ func WithSystemUser() UserOption {
 }
 
 type fileTransferConfig struct {
-	progress func(int)
-	mode     uint32
-	preserve bool
+	progress       func(int)
+	mode           uint32
+	preserve       bool
+	bytesPerSecond int64
+	checkDiskSpace bool
 }
 
 type FileOption func(*fileTransferConfig)
@@ -235,6 +288,28 @@ func WithPreserve() FileOption {
 	}
 }
 
+// WithBandwidthLimit caps the transfer rate in bytes per second (0 = unlimited)
+func WithBandwidthLimit(bytesPerSecond int64) FileOption {
+	return func(c *fileTransferConfig) {
+		c.bytesPerSecond = bytesPerSecond
+	}
+}
+
+// DirectoryTransferResult summarizes a recursive directory transfer
+type DirectoryTransferResult struct {
+	Files  int
+	Bytes  int64
+	Errors []error
+}
+
+// WithDiskSpaceCheck verifies the remote filesystem has room for the file
+// before an upload starts
+func WithDiskSpaceCheck() FileOption {
+	return func(c *fileTransferConfig) {
+		c.checkDiskSpace = true
+	}
+}
+
 type SystemInfo struct {
 	OS           string
 	Architecture string
@@ -0,0 +1,167 @@
+package tunnel
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// calculateLocalChecksum returns the hex SHA256 digest of a local file
+func calculateLocalChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// VerifyChecksum checks that the SHA256 of the file at path matches the
+// expected hex digest
+func VerifyChecksum(path, expected string) error {
+	actual, err := calculateLocalChecksum(path)
+	if err != nil {
+		return &Error{
+			Type:    ErrorVerification,
+			Message: "failed to calculate checksum",
+			Cause:   err,
+		}
+	}
+
+	if !strings.EqualFold(actual, strings.TrimSpace(expected)) {
+		return &Error{
+			Type:    ErrorVerification,
+			Message: fmt.Sprintf("checksum mismatch: expected %s, got %s", expected, actual),
+		}
+	}
+	return nil
+}
+
+// VerifyMinisignSignature checks a minisign signature of the file at path.
+// signature is the content of the .minisig file and publicKey either the
+// content of a minisign public key file or its base64 key line.
+func VerifyMinisignSignature(path, signature, publicKey string) error {
+	keyID, key, err := parseMinisignPublicKey(publicKey)
+	if err != nil {
+		return &Error{Type: ErrorVerification, Message: "invalid minisign public key", Cause: err}
+	}
+
+	sig, err := parseMinisignSignature(signature)
+	if err != nil {
+		return &Error{Type: ErrorVerification, Message: "invalid minisign signature", Cause: err}
+	}
+
+	if !bytes.Equal(sig.keyID, keyID) {
+		return &Error{
+			Type:    ErrorVerification,
+			Message: fmt.Sprintf("signature key ID %X does not match public key %X", sig.keyID, keyID),
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return &Error{Type: ErrorVerification, Message: "failed to read signed file", Cause: err}
+	}
+
+	// "ED" signatures sign the BLAKE2b-512 digest of the file
+	message := data
+	if sig.algorithm == "ED" {
+		digest := blake2b.Sum512(data)
+		message = digest[:]
+	}
+
+	if !ed25519.Verify(key, message, sig.signature) {
+		return &Error{Type: ErrorVerification, Message: "signature verification failed"}
+	}
+
+	global := append(append([]byte{}, sig.signature...), []byte(sig.trustedComment)...)
+	if !ed25519.Verify(key, global, sig.globalSignature) {
+		return &Error{Type: ErrorVerification, Message: "trusted comment signature verification failed"}
+	}
+
+	return nil
+}
+
+type minisignSignature struct {
+	algorithm       string
+	keyID           []byte
+	signature       []byte
+	trustedComment  string
+	globalSignature []byte
+}
+
+func parseMinisignPublicKey(publicKey string) ([]byte, ed25519.PublicKey, error) {
+	var line string
+	for _, l := range strings.Split(publicKey, "\n") {
+		l = strings.TrimSpace(l)
+		if l != "" && !strings.HasPrefix(l, "untrusted comment:") {
+			line = l
+		}
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(line)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(raw) != 2+8+ed25519.PublicKeySize || string(raw[:2]) != "Ed" {
+		return nil, nil, fmt.Errorf("unsupported key format")
+	}
+
+	return raw[2:10], ed25519.PublicKey(raw[10:]), nil
+}
+
+func parseMinisignSignature(signature string) (*minisignSignature, error) {
+	var lines []string
+	for _, l := range strings.Split(strings.TrimSpace(signature), "\n") {
+		lines = append(lines, strings.TrimRight(l, "\r"))
+	}
+	if len(lines) != 4 {
+		return nil, fmt.Errorf("expected 4 lines, got %d", len(lines))
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != 2+8+ed25519.SignatureSize {
+		return nil, fmt.Errorf("unexpected signature length %d", len(raw))
+	}
+	algorithm := string(raw[:2])
+	if algorithm != "Ed" && algorithm != "ED" {
+		return nil, fmt.Errorf("unsupported signature algorithm %q", algorithm)
+	}
+
+	trustedComment, ok := strings.CutPrefix(lines[2], "trusted comment: ")
+	if !ok {
+		return nil, fmt.Errorf("missing trusted comment")
+	}
+
+	global, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil {
+		return nil, err
+	}
+	if len(global) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("unexpected global signature length %d", len(global))
+	}
+
+	return &minisignSignature{
+		algorithm:       algorithm,
+		keyID:           raw[2:10],
+		signature:       raw[10:],
+		trustedComment:  trustedComment,
+		globalSignature: global,
+	}, nil
+}
@@ -0,0 +1,146 @@
+package tunnel
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+func writeTestFile(t testing.TB, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pocketbase.zip")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	return path
+}
+
+// minisignFixture signs data the way minisign does and returns the
+// signature file and public key line
+func minisignFixture(t *testing.T, data []byte, algorithm string) (string, string) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	keyID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+	message := data
+	if algorithm == "ED" {
+		digest := blake2b.Sum512(data)
+		message = digest[:]
+	}
+	sig := ed25519.Sign(priv, message)
+	trusted := "timestamp:1700000000\tfile:pocketbase.zip"
+	global := ed25519.Sign(priv, append(append([]byte{}, sig...), []byte(trusted)...))
+
+	sigLine := append(append([]byte(algorithm), keyID...), sig...)
+	keyLine := append(append([]byte("Ed"), keyID...), pub...)
+
+	signature := "untrusted comment: signature from minisign secret key\n" +
+		base64.StdEncoding.EncodeToString(sigLine) + "\n" +
+		"trusted comment: " + trusted + "\n" +
+		base64.StdEncoding.EncodeToString(global) + "\n"
+	publicKey := "untrusted comment: minisign public key 0807060504030201\n" +
+		base64.StdEncoding.EncodeToString(keyLine) + "\n"
+	return signature, publicKey
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	path := writeTestFile(t, "release contents")
+	sum := sha256.Sum256([]byte("release contents"))
+	digest := hex.EncodeToString(sum[:])
+
+	if err := VerifyChecksum(path, digest); err != nil {
+		t.Errorf("Expected checksum to match, got: %v", err)
+	}
+
+	err := VerifyChecksum(path, hex.EncodeToString(make([]byte, sha256.Size)))
+	var tunnelErr *Error
+	if !errors.As(err, &tunnelErr) || tunnelErr.Type != ErrorVerification {
+		t.Errorf("Expected verification error for mismatched checksum, got: %v", err)
+	}
+}
+
+func TestVerifyMinisignSignature(t *testing.T) {
+	data := []byte("release contents")
+
+	for _, algorithm := range []string{"Ed", "ED"} {
+		t.Run(algorithm, func(t *testing.T) {
+			path := writeTestFile(t, string(data))
+			signature, publicKey := minisignFixture(t, data, algorithm)
+
+			if err := VerifyMinisignSignature(path, signature, publicKey); err != nil {
+				t.Errorf("Expected valid signature, got: %v", err)
+			}
+
+			tampered := writeTestFile(t, "tampered contents")
+			if err := VerifyMinisignSignature(tampered, signature, publicKey); err == nil {
+				t.Error("Expected tampered file to fail verification")
+			}
+		})
+	}
+}
+
+func TestVerifyMinisignSignatureWrongKey(t *testing.T) {
+	data := []byte("release contents")
+	path := writeTestFile(t, string(data))
+	signature, _ := minisignFixture(t, data, "Ed")
+	_, otherKey := minisignFixture(t, data, "Ed")
+
+	if err := VerifyMinisignSignature(path, signature, otherKey); err == nil {
+		t.Error("Expected signature from another key to fail verification")
+	}
+}
+
+func TestVerifyMinisignSignatureMalformed(t *testing.T) {
+	path := writeTestFile(t, "release contents")
+	_, publicKey := minisignFixture(t, []byte("release contents"), "Ed")
+
+	if err := VerifyMinisignSignature(path, "not a signature", publicKey); err == nil {
+		t.Error("Expected malformed signature to be rejected")
+	}
+	if err := VerifyMinisignSignature(path, "", "not-base64!"); err == nil {
+		t.Error("Expected malformed public key to be rejected")
+	}
+}
+
+func BenchmarkCalculateLocalChecksum(b *testing.B) {
+	path := writeTestFile(b, strings.Repeat("x", 8<<20))
+	b.SetBytes(8 << 20)
+
+	for b.Loop() {
+		if _, err := calculateLocalChecksum(path); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestVerifyRemoteChecksumQuotesPath(t *testing.T) {
+	sum := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	client := &scriptedClient{results: []*Result{{Stdout: sum + "  /opt/pocketbase/staging/my app;id/deployment.zip\n"}}}
+	deployer := NewDeploymentManager(NewManager(client), nil)
+
+	if err := deployer.verifyRemoteChecksum("/opt/pocketbase/staging/my app;id/deployment.zip", strings.ToUpper(sum)); err != nil {
+		t.Fatalf("verifyRemoteChecksum() error = %v", err)
+	}
+	want := []string{`sha256sum '/opt/pocketbase/staging/my app;id/deployment.zip'`}
+	if !slices.Equal(client.commands, want) {
+		t.Errorf("Expected %q, got %q", want, client.commands)
+	}
+
+	client.results = append(client.results, &Result{Stdout: strings.Repeat("0", 64) + "  deployment.zip\n"})
+	err := deployer.verifyRemoteChecksum("deployment.zip", sum)
+	if err == nil || !strings.Contains(err.Error(), "mismatch") {
+		t.Errorf("Expected a checksum mismatch, got %v", err)
+	}
+}